@@ -5,39 +5,43 @@ import (
 	"testing"
 )
 
-func TestGenerateRandomRarity(t *testing.T) {
-	// Тестируем генерацию редкостей
-	commonCount := 0
-	rareCount := 0
-	legendaryCount := 0
-
-	// Генерируем 1000 значений для тестирования вероятностей
-	for i := 0; i < 1000; i++ {
-		rarity := GenerateRandomRarity()
-		switch rarity {
-		case Common:
-			commonCount++
-		case Rare:
-			rareCount++
-		case Legendary:
-			legendaryCount++
+func TestRollPercent(t *testing.T) {
+	seen := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		roll := RollPercent()
+		if roll < 0 || roll > 99 {
+			t.Fatalf("RollPercent вернул %d вне диапазона 0-99", roll)
 		}
+		seen[roll] = true
+	}
+	if len(seen) < 90 {
+		t.Errorf("За 5000 бросков выпало только %d разных значений", len(seen))
 	}
+}
 
-	fmt.Printf("Результаты тестирования (1000 генераций):\n")
-	fmt.Printf("Common: %d (~80%%)\n", commonCount)
-	fmt.Printf("Rare: %d (~15%%)\n", rareCount)
-	fmt.Printf("Legendary: %d (~6%%)\n", legendaryCount)
+func TestWeightedIndex(t *testing.T) {
+	if idx := WeightedIndex(nil); idx != -1 {
+		t.Errorf("WeightedIndex(nil) = %d, ожидалось -1", idx)
+	}
 
-	// Проверяем что все значения сгенерированы
-	if commonCount == 0 || rareCount == 0 || legendaryCount == 0 {
-		t.Error("Не все редкости были сгенерированы")
+	// Нулевой и отрицательный веса никогда не выпадают
+	counts := make([]int, 4)
+	for i := 0; i < 1000; i++ {
+		counts[WeightedIndex([]int{0, 3, -5, 1})]++
+	}
+	if counts[0] != 0 || counts[2] != 0 {
+		t.Errorf("Выпали элементы с нулевым весом: %v", counts)
+	}
+	if counts[1] <= counts[3] {
+		t.Errorf("Элемент с весом 3 выпал не чаще элемента с весом 1: %v", counts)
 	}
-}
 
-func ExampleGenerateRandomRarity() {
-	rarity := GenerateRandomRarity()
-	fmt.Printf("Выпала редкость: %s\n", rarity)
+	// Если все веса нулевые, выбираем равномерно
+	for i := 0; i < 100; i++ {
+		if idx := WeightedIndex([]int{0, 0}); idx < 0 || idx > 1 {
+			t.Fatalf("WeightedIndex вернул индекс %d вне диапазона", idx)
+		}
+	}
 }
 
 func ExampleGenerateRandomNumber() {
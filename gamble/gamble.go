@@ -6,49 +6,66 @@ import (
 	"math/big"
 )
 
-// Rarity представляет редкость предмета
-type Rarity string
-
-const (
-	Common    Rarity = "common"
-	Rare      Rarity = "rare"
-	Legendary Rarity = "legendary"
-)
-
-// GenerateRandomRarity генерирует случайную редкость на основе вероятностей:
-// - Common: 0-79 (80% шанс)
-// - Rare: 80-94 (15% шанс)
-// - Legendary: 95-100 (6% шанс)
-func GenerateRandomRarity() Rarity {
-	// Генерируем криптографически безопасное случайное число от 0 до 100
-	max := big.NewInt(101) // 0-100 включительно
+// GenerateRandomNumber генерирует случайное число от 0 до 100
+func GenerateRandomNumber() int {
+	max := big.NewInt(101)
 	randomBig, err := rand.Int(rand.Reader, max)
 	if err != nil {
-		// В случае ошибки возвращаем common как fallback
-		return Common
+		return 0 // fallback
 	}
+	return int(randomBig.Int64())
+}
 
-	randomNum := int(randomBig.Int64())
-
-	// Определяем редкость по диапазонам
-	switch {
-	case randomNum <= 59:
-		return Common
-	case randomNum <= 84:
-		return Rare
-	default:
-		return Legendary
+// RollPercent генерирует случайное число от 0 до 99 для проверки шанса в процентах:
+// условие RollPercent() < chance выполняется ровно в chance случаях из 100
+func RollPercent() int {
+	randomBig, err := rand.Int(rand.Reader, big.NewInt(100))
+	if err != nil {
+		return 99 // fallback: шанс не срабатывает
 	}
+	return int(randomBig.Int64())
 }
 
-// GenerateRandomNumber генерирует случайное число от 0 до 100
-func GenerateRandomNumber() int {
-	max := big.NewInt(101)
-	randomBig, err := rand.Int(rand.Reader, max)
+// WeightedIndex выбирает индекс с вероятностью, пропорциональной весу.
+// Неположительные веса не выпадают; если все веса нулевые, выбор равномерный.
+// Для пустого списка возвращает -1.
+func WeightedIndex(weights []int) int {
+	if len(weights) == 0 {
+		return -1
+	}
+
+	total := 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+
+	if total == 0 {
+		randomBig, err := rand.Int(rand.Reader, big.NewInt(int64(len(weights))))
+		if err != nil {
+			return 0 // fallback
+		}
+		return int(randomBig.Int64())
+	}
+
+	randomBig, err := rand.Int(rand.Reader, big.NewInt(int64(total)))
 	if err != nil {
 		return 0 // fallback
 	}
-	return int(randomBig.Int64())
+
+	randomNum := int(randomBig.Int64())
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if randomNum < w {
+			return i
+		}
+		randomNum -= w
+	}
+
+	return len(weights) - 1
 }
 
 // CoinResult представляет результат броска монеты
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -10,11 +11,14 @@ import (
 	"math/big"
 	crand "math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"tg-random-bot/gamble"
+	"tg-random-bot/render"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/redis/go-redis/v9"
@@ -26,6 +30,7 @@ var participants []string
 // Глобальные переменные для плашек
 var prizes []Prize
 var currentPrize Prize
+var currentPrizeSerial int // Номер экземпляра, зарезервированный за лимитированной плашкой текущей игры (0 - не зарезервирован)
 
 // Структура для хранения ставки
 type Bet struct {
@@ -43,1760 +48,6870 @@ type Prize struct {
 	Emoji       string `json:"emoji,omitempty"`
 	Rarity      string `json:"rarity"`
 	Cost        int    `json:"cost,omitempty"`
+	MaxSupply   int    `json:"maxSupply,omitempty"` // Тираж лимитированной плашки (0 - без ограничений)
+	Weight      int    `json:"weight,omitempty"`    // Вес выпадения внутри редкости (0 - по умолчанию 1)
+	Disabled    bool   `json:"disabled,omitempty"`  // Выключенный приз больше не выпадает, но остается в инвентарях
+}
+
+// Структура для настроек гаранта легендарки: после Threshold игр без легендарной плашки
+// шанс легендарки растет на Step процентов за каждую следующую игру
+type PityConfig struct {
+	Threshold int `json:"threshold"`
+	Step      int `json:"step"`
+}
+
+// Структура для уровня редкости (задается в prizes.json, без правок кода)
+type RarityTier struct {
+	Name           string `json:"name"`            // Идентификатор редкости в призах (common, rare, ...)
+	Label          string `json:"label"`           // Подпись в сообщениях ("ЛЕГЕНДАРНАЯ")
+	GroupLabel     string `json:"groupLabel"`      // Заголовок группы в /inv ("ЛЕГЕНДАРНЫЕ")
+	Emoji          string `json:"emoji"`           // Эмодзи группы в /inv
+	Weight         int    `json:"weight"`          // Вес выпадения редкости в игре
+	PlaterobChance int    `json:"platerobChance"`  // Шанс успешной кражи плашки через /platerob (%)
+	Order          int    `json:"order"`           // Порядок сортировки (больше - ценнее)
+	Color          string `json:"color,omitempty"` // Цвет карточки плашки (#RRGGBB)
 }
 
 // Структура для конфига призов
 type PrizeConfig struct {
-	Prizes []Prize `json:"prizes"`
+	Version  int64        `json:"version,omitempty"`
+	Prizes   []Prize      `json:"prizes"`
+	Pity     *PityConfig  `json:"pity,omitempty"`
+	Rarities []RarityTier `json:"rarities,omitempty"`
 }
 
-// Структура для элемента инвентаря
-type InventoryItem struct {
-	PrizeName string `json:"prizeName"`
-	Rarity    string `json:"rarity"`
-	Cost      int    `json:"cost"`
-	Count     int    `json:"count"`
-	Hash      string `json:"hash"` // Уникальный хэш предмета для продажи
+// Уровни редкости по умолчанию (если в prizes.json нет секции rarities)
+var defaultRarityTiers = []RarityTier{
+	{Name: "common", Label: "ОБЫЧНАЯ", GroupLabel: "ОБЫЧНЫЕ", Emoji: "⚪", Weight: 80, PlaterobChance: 50, Order: 1, Color: "#9E9E9E"},
+	{Name: "rare", Label: "РЕДКАЯ", GroupLabel: "РЕДКИЕ", Emoji: "💎", Weight: 15, PlaterobChance: 25, Order: 2, Color: "#2196F3"},
+	{Name: "legendary", Label: "ЛЕГЕНДАРНАЯ", GroupLabel: "ЛЕГЕНДАРНЫЕ", Emoji: "🔥", Weight: 6, PlaterobChance: 10, Order: 3, Color: "#FF9800"},
 }
 
-// Rarity представляет редкость предмета
-type Rarity string
-
-const (
-	CommonRarity    Rarity = "common"
-	RareRarity      Rarity = "rare"
-	LegendaryRarity Rarity = "legendary"
-)
+// Текущие уровни редкости
+var rarityTiers = defaultRarityTiers
 
-// GenerateRandomRarity генерирует случайную редкость на основе вероятностей:
-// - Common: 0-79 (80% шанс)
-// - Rare: 80-94 (15% шанс)
-// - Legendary: 95-100 (6% шанс)
-func GenerateRandomRarity() Rarity {
-	// Генерируем криптографически безопасное случайное число от 0 до 100
-	max := big.NewInt(101) // 0-100 включительно
-	randomBig, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		// В случае ошибки возвращаем common как fallback
-		return CommonRarity
+// Функция для получения уровня редкости по названию
+func getRarityTier(name string) (RarityTier, bool) {
+	for _, tier := range rarityTiers {
+		if tier.Name == name {
+			return tier, true
+		}
 	}
+	return RarityTier{}, false
+}
 
-	randomNum := int(randomBig.Int64())
+// Функция для получения подписи редкости ("ЛЕГЕНДАРНАЯ")
+func rarityLabel(name string) string {
+	if tier, ok := getRarityTier(name); ok {
+		return tier.Label
+	}
+	return "НЕИЗВЕСТНАЯ"
+}
 
-	// Определяем редкость по диапазонам
-	switch {
-	case randomNum <= 79:
-		return CommonRarity
-	case randomNum <= 94:
-		return RareRarity
-	default:
-		return LegendaryRarity
+// Функция для получения цвета карточки редкости (серый по умолчанию)
+func rarityColor(name string) string {
+	if tier, ok := getRarityTier(name); ok && tier.Color != "" {
+		return tier.Color
 	}
+	return "#9E9E9E"
 }
 
-// Переменные для управления игрой
-var gameMessageID int
-var gameChatID int64
-var isGameActive bool
-var gameInProgress bool  // Флаг, что идет процесс игры (чтобы предотвратить запуск нескольких игр)
-var gameCancel chan bool // Канал для отмены активной игры
-var totalRounds int
-var currentRound int
-var bettingPhase string
+// Функция для получения следующего по ценности уровня редкости (в него крафтятся плашки)
+func nextRarityTier(name string) (RarityTier, bool) {
+	current, ok := getRarityTier(name)
+	if !ok {
+		return RarityTier{}, false
+	}
 
-// Переменные для управления ставками
-var initialBets = make(map[string]Bet)  // Ставки на начальном этапе (ключ: username игрока)
-var finalBets = make(map[string]Bet)    // Ставки на финальном этапе (ключ: username игрока)
-var bettingParticipants []string        // Участники для ставок (сортированные алфавитно)
-var initialBettingParticipants []string // Сохраняем первоначальный список для ставок
-var finalBettingNumbers []int           // Номера для финальных ставок
+	var next RarityTier
+	found := false
+	for _, tier := range rarityTiers {
+		if tier.Order > current.Order && (!found || tier.Order < next.Order) {
+			next = tier
+			found = true
+		}
+	}
+	return next, found
+}
 
-// Map для хранения username/ID участников (ключ: имя, значение: user ID)
-// ТЕСТОВЫЙ СПИСОК ИЗ 5 УЧАСТНИКОВ
-var participantIDs = map[string]string{
-	"Арсений Квятковский": "Arsenkwait",
-	"Василий Гончаров":    "BroisHelmut",
-	"Виктория Григорьева": "sweerty_yv",
-	"Владислав Рыбаков":   "mbr3unk",
-	"Глеб Сушкевич":       "glbmsk",
-	"Дарья Шилина":        "quasarqs0",
-	"Екатерина Гнедова":   "Katharina_gn",
-	"Игнат Пикта":         "LilakGnatius",
-	"Максим Хваль":        "Whereisthesenses",
-	"Мария Князькова":     "tomazzeto",
-	"Назар Закревский":    "Zakrevski_05",
-	"Настя Павлюченко":    "kuvillin",
-	"Никита Янович":       "nktstrltz",
-	"Ольга Легостаева":    "legostaevaa",
-	"Ольга Васильева":     "olgavas8",
-	"Рома Болдырев":       "woistmeinemutter",
-	"Софья Цыбукова":      "Stelul003",
-	"Вероника Войтех":     "veronikavoiteh",
-	"Юля Луцевич":         "iuliia_lutsevich",
-	"Глеб Гусев":          "hunnidstooblue",
-	"Никита Шакалов":      "iamnothiding",
-	"Алексей Баранов":     "barrrraaa",
+// Функция для получения порядка редкости (неизвестные редкости - в конце)
+func rarityOrder(name string) int {
+	if tier, ok := getRarityTier(name); ok {
+		return tier.Order
+	}
+	return 0
 }
 
-// Map для хранения хэшей участников (ключ: имя участника, значение: SHA-256 хэш)
-var participantHashes = make(map[string]string)
-var eliminatedParticipants []string // Выбывшие участники
+// Функция для получения уровней редкости от самых ценных к обычным
+func sortedRarityTiers() []RarityTier {
+	tiers := make([]RarityTier, len(rarityTiers))
+	copy(tiers, rarityTiers)
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Order > tiers[j].Order
+	})
+	return tiers
+}
 
-// Map для хранения балансов игроков (ключ: username, значение: баланс)
-var playerBalances = make(map[string]int)
-var playerBanks = make(map[string]int)
-var playerFines = make(map[string]int)           // Штрафы за ограбления (ключ: username, значение: сумма штрафа)
-var playerFineDates = make(map[string]time.Time) // Дата последнего обновления штрафа
+// Функция для получения самой ценной редкости (на нее действует гарант)
+func topRarity() Rarity {
+	tiers := sortedRarityTiers()
+	if len(tiers) == 0 {
+		return Rarity(defaultRarityTiers[len(defaultRarityTiers)-1].Name)
+	}
+	return Rarity(tiers[0].Name)
+}
 
-// Redis клиент для персистентного хранения балансов
-var redisClient *redis.Client
+// Функция для проверки и установки уровней редкости из конфига
+func applyRarityTiers(tiers []RarityTier) error {
+	if err := validateRarityTiers(tiers); err != nil {
+		return err
+	}
 
-// Цитаты для команды /giveplate
-var giveplateQuotes = []string{
-	"💝 Щедрость - это добродетель!",
-	"🎁 Дарение - это искусство делиться радостью!",
-	"❤️ Лучше отдать, чем держать при себе!",
-	"🤝 Настоящая дружба - это когда делишься самым ценным!",
-	"✨ Щедрость возвращается сторицей!",
-	"🌟 Поделись счастьем с друзьями!",
-	"💎 Драгоценности ценнее, когда ими делятся!",
-	"🎉 Пусть каждый подарок принесет улыбку!",
-	"🌈 Щедрость окрашивает мир в яркие цвета!",
-	"💫 Дарить - значит любить!",
-	"🎊 Пусть этот подарок станет началом чего-то прекрасного!",
-	"🌸 Щедрость - цветок, который никогда не вянет!",
-	"🎨 Твори добро - делись красотой!",
-	"🌟 Звезды светят ярче, когда ими делятся!",
-	"💫 Волшебство начинается с щедрости!",
-	"🎭 Жизнь - это театр, а щедрость - лучший спектакль!",
-	"🌺 Пусть этот дар расцветет в сердце друга!",
-	"🎪 Цирк жизни: щедрость - главный артист!",
-	"🌙 Под луной щедрости все желания сбываются!",
-	"🎨 Палитра жизни ярче от щедрых мазков!",
-	"🌟 Звездопад щедрости освещает путь к счастью!",
-	"💫 Магия дарения: один подарок - тысяча улыбок!",
-	"🎭 Театр жизни: щедрость - лучший режиссер!",
-	"🌺 Сад души расцветает от семян щедрости!",
-	"🎪 Шапито чудес: щедрость - главный фокусник!",
+	if len(tiers) == 0 {
+		rarityTiers = defaultRarityTiers
+	} else {
+		rarityTiers = tiers
+	}
+	return nil
 }
 
-// Функция для выбора случайной цитаты для /giveplate
-func getRandomGiveplateQuote() string {
-	if len(giveplateQuotes) == 0 {
-		return "💝 Щедрость - это добродетель!"
+// Функция для проверки уровней редкости из конфига
+func validateRarityTiers(tiers []RarityTier) error {
+	seen := make(map[string]bool)
+	for _, tier := range tiers {
+		if tier.Name == "" || tier.Name == "shop" {
+			return fmt.Errorf("некорректное название редкости %q", tier.Name)
+		}
+		if seen[tier.Name] {
+			return fmt.Errorf("редкость %s указана дважды", tier.Name)
+		}
+		if tier.Weight < 0 || tier.PlaterobChance < 0 || tier.PlaterobChance > 100 {
+			return fmt.Errorf("некорректные вес или шанс кражи у редкости %s", tier.Name)
+		}
+		if tier.Color != "" {
+			if _, err := strconv.ParseUint(strings.TrimPrefix(tier.Color, "#"), 16, 32); err != nil || len(tier.Color) != 7 || tier.Color[0] != '#' {
+				return fmt.Errorf("некорректный цвет %q у редкости %s (нужен формат #RRGGBB)", tier.Color, tier.Name)
+			}
+		}
+		seen[tier.Name] = true
 	}
-	randomIndex := crand.Intn(len(giveplateQuotes))
-	return giveplateQuotes[randomIndex]
+
+	return nil
 }
 
-// Цитаты для доски позора должников
-var shameBoardQuotes = []string{
-	"🚨 ПОЗОР! Должник номер один в списке неплательщиков!",
-	"⚡ КАКОЙ СТЫД! Общественный враг номер один!",
-	"🏛️ БЕЗСОВЕСТНЫЙ! Позорит всю страну своими долгами!",
-	"🚔 КРИМИНАЛ! Худший должник в истории!",
-	"⚖️ СТЫД И ПОЗОР! Предатель коллектива и государства!",
-	"🏛️ ОБЩЕСТВО В ШОКЕ! Такого должника еще не было!",
-	"🚨 БЕЗДУШНЫЙ! Все платят, а этот - чемпион по долгам!",
-	"⚖️ КАКОЕ БЕЗОБРАЗИЕ! Рекордсмен по безответственности!",
-	"🏛️ ПОЗОР ДЛЯ СЕМЬИ! Дети такого должника страдают!",
-	"🚔 КРИМИНАЛЬНЫЙ ЭЛЕМЕНТ! Угроза экономической безопасности!",
-	"⚡ НРАВСТВЕННЫЙ УРОД! Долги - это его хобби!",
-	"⚖️ ОБЩЕСТВЕННЫЙ ВРАГ! Номера один в списке позора!",
-	"🏛️ ТЫ СЛИШКОМ НИЗКО ПАЛ! Дно должников!",
-	"🚨 СТЫДНО ДО СЛЁЗ! Чемпион среди неплательщиков!",
-	"⚡ ПОЛНОЕ РАЗОЧАРОВАНИЕ! Образец для антигероев!",
-	"🏛️ ПОЗОР ДЛЯ КОЛЛЕКТИВА! Все краснеют за такого!",
-	"🚔 КРИМИНАЛ И ДОЛГИ! Двойная угроза обществу!",
-	"⚖️ НИКАКОЙ СОВЕСТИ! Долги превышают все нормы!",
-	"🏛️ ОБЩЕСТВО ОСЖДАЕТ! Исправься, позор коллектива!",
-	"🚨 КАКОЙ КОНФУЗ! Рекордсмен по аморальности!",
-	"⚡ ПОТЕРЯЛ СОВЕСТЬ! Долги - его главное достижение!",
-	"⚖️ СТЫДНЫЙ РЕКОРД! Никто не должен повторять!",
-	"🏛️ БЕЗ ЧЕСТИ И СОВЕСТИ! Абсолютный чемпион по долгам!",
-	"🚔 КРИМИНАЛЬНАЯ НАТУРА! Долги - его вторая натура!",
-	"⚡ БЕЗ ПРИНЦИПОВ! Долги - это его философия!",
+// Настройки гаранта легендарки (nil - механизм выключен)
+var pityConfig *PityConfig
+
+// Файл настроек экономики
+const economyFile = "economy.json"
+
+// Настройки крафта плашек
+type CraftConfig struct {
+	Inputs     int `json:"inputs"`     // Сколько плашек одной редкости переплавляется в одну
+	Fee        int `json:"fee"`        // Плата за крафт в фишках
+	FailChance int `json:"failChance"` // Шанс неудачи (%): плашки и плата сгорают
 }
 
-// Агрессивные цитаты для должников при грабеже
-var debtRobQuotes = []string{
-	"🚨 ПОЗОР! Должник взялся за грабёж вместо оплаты долгов!",
-	"⚡ КАКОЙ СТЫД! Ты должен государству, а грабишь честных людей!",
-	"🏛️ БЕЗСОВЕСТНЫЙ! Оплати штрафы, прежде чем позорить общество!",
-	"🚔 КРИМИНАЛ! Долги не платит, зато грабит - это же аморально!",
-	"⚖️ СТЫД И ПОЗОР! Ты предатель коллектива, должник-грабитель!",
-	"⚡ НИЧЕГО СВЯТОГО! Даже долг не остановил тебя от преступления!",
-	"🏛️ ОБЩЕСТВО В ШОКЕ! Должник вместо исправления - грабит!",
-	"🚨 БЕЗДУШНЫЙ! Другие платят штрафы, а ты грабишь их!",
-	"⚖️ КАКОЕ БЕЗОБРАЗИЕ! Должник позорит честь гражданина!",
-	"🏛️ ПОТЕРЯЛ СОВЕСТЬ! Оплати долги, потом грабь если хочешь!",
-	"🚔 КРИМИНАЛЬНЫЙ ЭЛЕМЕНТ! Долги не пугают, зато грабёж - да!",
-	"⚡ НРАВСТВЕННЫЙ УРОД! Должник - и грабитель одновременно!",
-	"⚖️ ОБЩЕСТВЕННЫЙ ВРАГ! Не платишь штрафы, зато обворовываешь!",
-	"🏛️ ТЫ СЛИШКОМ НИЗКО ПАЛ! Должник взялся за уголовщину!",
-	"🚨 СТЫДНО ДО СЛЁЗ! Грабить, имея долги перед государством!",
-	"⚡ БЕЗ ПРИНЦИПОВ! Долги - фигня, главное - награбить!",
-	"🏛️ ПОЗОР ДЛЯ СЕМЬИ! Должник позорит всех родственников!",
-	"🚔 КРИМИНАЛ И ДОЛГИ! Ты - угроза обществу!",
-	"⚖️ НИКАКОЙ СОВЕСТИ! Грабит тех, кто честно работает!",
-	"🏛️ ОБЩЕСТВО ОСЖДАЕТ! Исправься, должник-грабитель!",
-	"🚨 КАКОЙ КОНФУЗ! Должник вместо оплаты - ворует!",
-	"⚡ ПОЛНОЕ РАЗОЧАРОВАНИЕ! Ты подвёл весь коллектив!",
-	"⚖️ СТЫДНЫЙ ПОСТУПОК! Долги не мешают тебе грабить!",
-	"🏛️ БЕЗ ЧЕСТИ И СОВЕСТИ! Должник - уголовник!",
-	"🚔 КРИМИНАЛЬНАЯ НАТУРА! Даже штрафы не останавливают!",
+// Структура для таблицы шансов ящика (сам ящик продается через каталог магазина)
+type CrateConfig struct {
+	ID          string         `json:"id"`          // Идентификатор, на который ссылается предмет магазина
+	Weights     map[string]int `json:"weights"`     // Веса выпадения редкостей (по названию редкости)
+	SellPercent int            `json:"sellPercent"` // Какой процент стоимости плашки из ящика платит /sell
 }
 
-// Цитаты про долг/закон в духе СССР
-var debtQuotes = []string{
-	"⚖️ Долг перед законом - святое дело! Выполняй свой гражданский долг!",
-	"🚔 Законопослушный гражданин не имеет долгов перед государством!",
-	"⚡ В нашем обществе долги - это позор! Расплатись и живи с чистой совестью!",
-	"🏛️ Государство в тебя верит! Оплати штрафы и будь примером для других!",
-	"⚖️ Закон - это основа нашего общества! Не позорь свою страну долгами!",
-	"🚨 Долги - это цепи, которые сковывают свободного человека!",
-	"⚡ Выполняй свои обязательства перед обществом! Оплати штрафы!",
-	"🏛️ Чистота перед законом - залог счастливой жизни!",
-	"⚖️ В нашем государстве долги - это преступление против общества!",
-	"🚔 Закон суров, но справедлив! Расплатись с долгами!",
-	"⚖️ Долги - это яд для души! Очистись от них законом!",
-	"🏛️ В социалистическом обществе долг - это предательство идеалов!",
-	"⚡ Государство не прощает должников! Исправься немедленно!",
-	"🚨 Долги калечат человека! Будь достойным гражданином!",
-	"⚖️ Закон - твой друг! Он поможет избавиться от долгов!",
-	"🏛️ Общество осуждает должников! Встань на путь исправления!",
-	"🚔 Долги - это кандалы на ногах прогресса!",
-	"⚡ Каждый рубль долга - это удар по твоей чести!",
-	"⚖️ Справедливость требует оплаты долгов! Не медли!",
-	"🏛️ Государство протягивает руку помощи, но требует дисциплины!",
-	"🚨 Должник - это позор для коллектива! Исправься!",
-	"⚖️ Закон карает, но и милует! Оплати долги и живи свободно!",
-	"🏛️ В нашем обществе долг - это не норма, а исключение!",
-	"⚡ Долги мешают строить коммунизм! Расплатись!",
-	"🚔 Закон - это справедливость! Он защитит тебя от долгов!",
-	"⚖️ Долги - это бремя для общества! Сними его с плеч народа!",
-	"🏛️ Государство верит в твоё исправление! Оплати штрафы!",
-	"🚨 Должник теряет доверие коллектива! Восстанови его!",
-	"⚡ Закон требует справедливости! Оплати свои долги!",
-	"⚖️ В социалистическом праве долг - это несчастье, которое можно исправить!",
-	"🏛️ Общество ждёт твоего возвращения к честной жизни!",
-	"🚔 Долги - это тень на твоей репутации! Рассеи её!",
-	"⚡ Государство поможет тебе, но ты должен помочь себе!",
-	"⚖️ Закон - это свет справедливости! Следуй за ним!",
-	"🏛️ Долги - это преграда на пути к счастью!",
-	"🚨 Исправься перед законом и обществом!",
-	"⚡ Должник - это человек, который сам себя наказывает!",
-	"⚖️ Справедливость восторжествует! Оплати долги!",
-	"🏛️ Государство даёт второй шанс! Не упусти его!",
-	"🚔 Закон суров к должникам, но справедлив к исправляющимся!",
-	"⚡ Долги - это болезнь души! Вылечи её законом!",
-	"⚖️ В нашем обществе долг - это вызов системе!",
-	"🏛️ Общество простит, но требует исправления!",
-	"🚨 Должник - это слабое звено! Стань сильнее!",
-	"⚡ Закон - это справедливый судья! Он ждёт твоего раскаяния!",
-	"⚖️ Долги мешают мирному труду! Освободись от них!",
-	"🏛️ Государство заботится о каждом гражданине! Заботься о долгах!",
-	"🚔 Законопослушание - основа счастья! Начни с оплаты штрафов!",
-	"⚡ Долги - это цепи капитализма! Сбрось их!",
-	"⚖️ Справедливость требует дисциплины! Будь дисциплинирован!",
-	"🏛️ В социализме долг - это ошибка, которую можно исправить!",
-	"🚨 Государство поможет тебе встать на путь истинный!",
-	"⚡ Закон - это твоя защита от долгов и бед!",
-	"⚖️ Долги - это бремя прошлого! Создай светлое будущее!",
-	"🏛️ Общество ждёт твоего вклада! Оплати долги и внеси его!",
+// Настройки защитных предметов от /rob и /platerob
+type DefenseConfig struct {
+	AlarmSuccessPenalty int `json:"alarmSuccessPenalty"` // На сколько процентов сигнализация снижает шанс успеха /rob
+	AlarmFineMultiplier int `json:"alarmFineMultiplier"` // Во сколько раз сигнализация увеличивает штраф грабителя
+	SafeDays            int `json:"safeDays"`            // Сколько дней сейф защищает надетую плашку от /platerob
+	BodyguardChance     int `json:"bodyguardChance"`     // Шанс, что охранник отобьет нападение (%)
+	BodyguardFine       int `json:"bodyguardFine"`       // Штраф грабителю от охранника (достается жертве)
 }
 
-// Функция для выбора случайной цитаты про долг
-func getRandomDebtQuote() string {
-	if len(debtQuotes) == 0 {
-		return "⚖️ Оплати свои долги перед законом!"
-	}
-	randomIndex := crand.Intn(len(debtQuotes))
-	return debtQuotes[randomIndex]
+// Правила ограблений (/rob и /platerob) против гриферства
+type RobRulesConfig struct {
+	CooldownMinutes int `json:"cooldownMinutes"` // Пауза между попытками одного грабителя
+	ShieldMinutes   int `json:"shieldMinutes"`   // Сколько жертву нельзя грабить после успешного ограбления
+	DailyAttempts   int `json:"dailyAttempts"`   // Максимум попыток в день на грабителя (0 - без ограничения)
+	ForbiddenRatio  int `json:"forbiddenRatio"`  // /rob запрещен, если баланс жертвы меньше этого % от баланса грабителя
+	WeakerRatio     int `json:"weakerRatio"`     // Если баланс жертвы меньше этого % - шанс /rob снижается
+	WeakerPenalty   int `json:"weakerPenalty"`   // На сколько процентов снижается шанс /rob против более бедной жертвы
 }
 
-// Функция для выбора случайной агрессивной цитаты для должника при грабеже
-func getRandomDebtRobQuote() string {
-	if len(debtRobQuotes) == 0 {
-		return "🚨 ПОЗОР! Должник взялся за грабёж вместо оплаты долгов!"
-	}
-	randomIndex := crand.Intn(len(debtRobQuotes))
-	return debtRobQuotes[randomIndex]
+// Настройки тюрьмы для пойманных грабителей
+type JailConfig struct {
+	Chance        int `json:"chance"`        // Шанс попасть в тюрьму, если грабителя поймали (в процентах)
+	Minutes       int `json:"minutes"`       // Срок заключения
+	BailPerMinute int `json:"bailPerMinute"` // Залог за каждую оставшуюся минуту срока
 }
 
-// Функция для выбора случайной цитаты позора для доски позора
-func getRandomShameQuote() string {
-	if len(shameBoardQuotes) == 0 {
-		return "🚨 ПОЗОР! Должник в списке неплательщиков!"
-	}
+// Настройки совместных ограблений (/heist)
+type HeistConfig struct {
+	LobbyMinutes    int `json:"lobbyMinutes"`    // Сколько минут набирается банда
+	MinCrew         int `json:"minCrew"`         // Минимальный размер банды (иначе ограбление срывается)
+	MaxCrew         int `json:"maxCrew"`         // Максимальный размер банды
+	BaseChance      int `json:"baseChance"`      // Шанс успеха для одного грабителя
+	ChancePerMember int `json:"chancePerMember"` // Прибавка к шансу за каждого участника сверх первого
+	MaxChance       int `json:"maxChance"`       // Потолок шанса успеха
+	BalancePercent  int `json:"balancePercent"`  // Какой процент баланса жертвы забирает банда
+	BankPercent     int `json:"bankPercent"`     // Какой процент банковского счета жертвы забирает банда
+	Fine            int `json:"fine"`            // Штраф каждому участнику при провале
+}
+
+// Настройки наград за голову (/bounty)
+type BountyConfig struct {
+	MinAmount int `json:"minAmount"` // Минимальная награда
+	Days      int `json:"days"`      // Через сколько дней невостребованная награда возвращается
+}
+
+// Настройки автоматического взыскания долга по штрафам
+type GarnishConfig struct {
+	Percent int `json:"percent"` // Какой процент каждого поступления уходит в погашение штрафа
+}
+
+// Периодическое объявление в чате
+type AnnouncementConfig struct {
+	ID         string `json:"id"`
+	Text       string `json:"text"`
+	EveryHours int    `json:"everyHours"`
+}
+
+// Настройки фоновых задач планировщика
+type JobsConfig struct {
+	SeasonDays         int                  `json:"seasonDays"`         // Длина сезона в днях
+	AnnouncementChatID int64                `json:"announcementChatId"` // Чат для объявлений и итогов сезона (0 - объявления выключены)
+	Announcements      []AnnouncementConfig `json:"announcements"`
+}
+
+// Ступень ставки по банковскому счету
+type InterestTier struct {
+	MinBalance int     `json:"minBalance"` // С какой суммы на счету действует ставка
+	Rate       float64 `json:"rate"`       // Процент в день
+}
+
+// Срок вклада и его ставка
+type DepositTerm struct {
+	Days int     `json:"days"`
+	Rate float64 `json:"rate"` // Процент в день, выплачивается в конце срока
+}
+
+// Максимальная ставка банка в процентах в день: выше нее проценты разгоняют экономику
+const maxBankRate = 0.5
+
+// Настройки банка
+type BankConfig struct {
+	Tiers               []InterestTier `json:"tiers"`
+	Deposits            []DepositTerm  `json:"deposits"`
+	MinDeposit          int            `json:"minDeposit"`
+	EarlyPenaltyPercent int            `json:"earlyPenaltyPercent"` // Штраф с суммы вклада при досрочном закрытии
+}
+
+// Настройки кредитов (/loan)
+type LoanConfig struct {
+	MinScore        int `json:"minScore"`        // Минимальный кредитный рейтинг для кредита
+	LimitPerPoint   int `json:"limitPerPoint"`   // Лимит кредита за каждый пункт рейтинга
+	InterestPercent int `json:"interestPercent"` // Процент сверху от суммы кредита
+	Installments    int `json:"installments"`    // Количество платежей
+	InstallmentDays int `json:"installmentDays"` // Дней между платежами
+	MaxMissed       int `json:"maxMissed"`       // Сколько платежей подряд можно пропустить до перевода долга в штраф
+}
+
+// Настройки банкротства (/bankrupt)
+type BankruptcyConfig struct {
+	Days     int `json:"days"`     // Сколько дней действует статус банкрота
+	MaxStake int `json:"maxStake"` // Максимальная ставка в /bet и /coin для банкрота
+}
+
+// Настройки переводов (/pay, /give, /giveplate)
+type TransferConfig struct {
+	TaxPercent        int `json:"taxPercent"`        // Налог с перевода, платит отправитель
+	BaseDailyLimit    int `json:"baseDailyLimit"`    // Суточный лимит переводов для нового аккаунта
+	LimitPerDay       int `json:"limitPerDay"`       // Прибавка к лимиту за каждый день возраста аккаунта
+	MaxDailyLimit     int `json:"maxDailyLimit"`     // Максимальный суточный лимит
+	CircularThreshold int `json:"circularThreshold"` // Сколько переводов в каждую сторону между парой считается подозрительным
+	CircularHours     int `json:"circularHours"`     // Окно учета встречных переводов в часах
+}
+
+// Структура для настроек экономики
+type EconomyConfig struct {
+	Craft      CraftConfig      `json:"craft"`
+	Crates     []CrateConfig    `json:"crates"`
+	Defense    DefenseConfig    `json:"defense"`
+	RobRules   RobRulesConfig   `json:"robRules"`
+	Jail       JailConfig       `json:"jail"`
+	Heist      HeistConfig      `json:"heist"`
+	Bounty     BountyConfig     `json:"bounty"`
+	Garnish    GarnishConfig    `json:"garnish"`
+	Jobs       JobsConfig       `json:"jobs"`
+	Bank       BankConfig       `json:"bank"`
+	Loan       LoanConfig       `json:"loan"`
+	Bankruptcy BankruptcyConfig `json:"bankruptcy"`
+	Transfer   TransferConfig   `json:"transfer"`
+}
+
+// Настройки экономики по умолчанию (если economy.json нет или в нем не хватает полей)
+var defaultEconomyConfig = EconomyConfig{
+	Craft: CraftConfig{Inputs: 3, Fee: 500, FailChance: 10},
+	Crates: []CrateConfig{
+		{ID: "crate_wood", Weights: map[string]int{"common": 85, "rare": 13, "legendary": 2}, SellPercent: 10},
+		{ID: "crate_silver", Weights: map[string]int{"common": 55, "rare": 38, "legendary": 7}, SellPercent: 20},
+		{ID: "crate_gold", Weights: map[string]int{"common": 20, "rare": 55, "legendary": 25}, SellPercent: 30},
+	},
+	Defense:  DefenseConfig{AlarmSuccessPenalty: 15, AlarmFineMultiplier: 2, SafeDays: 3, BodyguardChance: 60, BodyguardFine: 1500},
+	RobRules: RobRulesConfig{CooldownMinutes: 30, ShieldMinutes: 120, DailyAttempts: 5, ForbiddenRatio: 10, WeakerRatio: 50, WeakerPenalty: 10},
+	Jail:     JailConfig{Chance: 50, Minutes: 60, BailPerMinute: 50},
+	Heist: HeistConfig{LobbyMinutes: 5, MinCrew: 2, MaxCrew: 5, BaseChance: 15, ChancePerMember: 10, MaxChance: 60,
+		BalancePercent: 30, BankPercent: 10, Fine: 1000},
+	Bounty:  BountyConfig{MinAmount: 100, Days: 3},
+	Garnish: GarnishConfig{Percent: 50},
+	Jobs: JobsConfig{SeasonDays: 30, Announcements: []AnnouncementConfig{
+		{ID: "fines", Text: "🏛️ Напоминание: штрафы растут на 10% каждый день! Выплатить: /payfine", EveryHours: 24},
+	}},
+	Bank: BankConfig{
+		Tiers:               []InterestTier{{MinBalance: 0, Rate: 0.05}, {MinBalance: 10000, Rate: 0.08}, {MinBalance: 100000, Rate: 0.1}},
+		Deposits:            []DepositTerm{{Days: 3, Rate: 0.12}, {Days: 7, Rate: 0.15}, {Days: 30, Rate: 0.2}},
+		MinDeposit:          1000,
+		EarlyPenaltyPercent: 10,
+	},
+	Loan:       LoanConfig{MinScore: 300, LimitPerPoint: 10, InterestPercent: 15, Installments: 5, InstallmentDays: 1, MaxMissed: 2},
+	Bankruptcy: BankruptcyConfig{Days: 14, MaxStake: 500},
+	Transfer: TransferConfig{TaxPercent: 5, BaseDailyLimit: 5000, LimitPerDay: 500, MaxDailyLimit: 50000,
+		CircularThreshold: 3, CircularHours: 24},
+}
+
+// Текущие настройки экономики
+var economyConfig = defaultEconomyConfig
+
+// Функция для загрузки настроек экономики из economy.json
+func loadEconomyConfig() error {
+	data, err := os.ReadFile(economyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", economyFile, err)
+	}
+
+	// Списки не смешиваем со значениями по умолчанию: они берутся по умолчанию, только если их нет в файле
+	config := defaultEconomyConfig
+	config.Crates = nil
+	config.Jobs.Announcements = nil
+	config.Bank.Tiers = nil
+	config.Bank.Deposits = nil
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", economyFile, err)
+	}
+	if config.Crates == nil {
+		config.Crates = defaultEconomyConfig.Crates
+	}
+	if config.Jobs.Announcements == nil {
+		config.Jobs.Announcements = defaultEconomyConfig.Jobs.Announcements
+	}
+	if config.Bank.Tiers == nil {
+		config.Bank.Tiers = defaultEconomyConfig.Bank.Tiers
+	}
+	if config.Bank.Deposits == nil {
+		config.Bank.Deposits = defaultEconomyConfig.Bank.Deposits
+	}
+
+	if config.Craft.Inputs < 2 || config.Craft.Fee < 0 || config.Craft.FailChance < 0 || config.Craft.FailChance > 100 {
+		return fmt.Errorf("некорректные настройки крафта в %s", economyFile)
+	}
+
+	defense := config.Defense
+	if defense.AlarmSuccessPenalty < 0 || defense.AlarmFineMultiplier < 1 || defense.SafeDays < 1 ||
+		defense.BodyguardChance < 0 || defense.BodyguardChance > 100 || defense.BodyguardFine < 0 {
+		return fmt.Errorf("некорректные настройки защитных предметов в %s", economyFile)
+	}
+
+	rules := config.RobRules
+	if rules.CooldownMinutes < 0 || rules.ShieldMinutes < 0 || rules.DailyAttempts < 0 || rules.ForbiddenRatio < 0 ||
+		rules.WeakerRatio < rules.ForbiddenRatio || rules.WeakerPenalty < 0 || rules.WeakerPenalty > 100 {
+		return fmt.Errorf("некорректные правила ограблений в %s", economyFile)
+	}
+	if config.Jail.Chance < 0 || config.Jail.Chance > 100 || config.Jail.Minutes < 0 || config.Jail.BailPerMinute < 0 {
+		return fmt.Errorf("некорректные настройки тюрьмы в %s", economyFile)
+	}
+	heist := config.Heist
+	if heist.LobbyMinutes <= 0 || heist.MinCrew < 1 || heist.MaxCrew < heist.MinCrew || heist.BaseChance < 0 ||
+		heist.ChancePerMember < 0 || heist.MaxChance > 100 || heist.BalancePercent < 0 || heist.BalancePercent > 100 ||
+		heist.BankPercent < 0 || heist.BankPercent > 100 || heist.Fine < 0 {
+		return fmt.Errorf("некорректные настройки ограблений банды в %s", economyFile)
+	}
+	if config.Bounty.MinAmount < 1 || config.Bounty.Days < 1 {
+		return fmt.Errorf("некорректные настройки наград в %s", economyFile)
+	}
+	if config.Garnish.Percent < 0 || config.Garnish.Percent > 100 {
+		return fmt.Errorf("некорректный процент взыскания долга в %s", economyFile)
+	}
+	if config.Jobs.SeasonDays < 1 {
+		return fmt.Errorf("некорректные настройки фоновых задач в %s", economyFile)
+	}
+	announcements := make(map[string]bool)
+	for _, announcement := range config.Jobs.Announcements {
+		if announcement.ID == "" || announcements[announcement.ID] || announcement.Text == "" || announcement.EveryHours < 1 {
+			return fmt.Errorf("некорректное объявление %q в %s", announcement.ID, economyFile)
+		}
+		announcements[announcement.ID] = true
+	}
+
+	bank := config.Bank
+	if bank.MinDeposit < 1 || bank.EarlyPenaltyPercent < 0 || bank.EarlyPenaltyPercent > 100 {
+		return fmt.Errorf("некорректные настройки банка в %s", economyFile)
+	}
+	for i, tier := range bank.Tiers {
+		if tier.Rate < 0 || tier.Rate > maxBankRate || (i > 0 && tier.MinBalance <= bank.Tiers[i-1].MinBalance) {
+			return fmt.Errorf("ступени ставок банка в %s должны идти по возрастанию суммы, ставка - не выше %.1f%% в день", economyFile, maxBankRate)
+		}
+	}
+	terms := make(map[int]bool)
+	for _, term := range bank.Deposits {
+		if term.Days < 1 || term.Rate < 0 || term.Rate > maxBankRate || terms[term.Days] {
+			return fmt.Errorf("некорректный срок вклада %d дн. в %s (ставка - не выше %.1f%% в день)", term.Days, economyFile, maxBankRate)
+		}
+		terms[term.Days] = true
+	}
+
+	loan := config.Loan
+	if loan.MinScore < 0 || loan.LimitPerPoint < 0 || loan.InterestPercent < 0 || loan.Installments < 1 ||
+		loan.InstallmentDays < 1 || loan.MaxMissed < 1 {
+		return fmt.Errorf("некорректные настройки кредитов в %s", economyFile)
+	}
+	if config.Bankruptcy.Days < 1 || config.Bankruptcy.MaxStake < 0 {
+		return fmt.Errorf("некорректные настройки банкротства в %s", economyFile)
+	}
+	transfer := config.Transfer
+	if transfer.TaxPercent < 0 || transfer.TaxPercent > 100 || transfer.BaseDailyLimit < 0 || transfer.LimitPerDay < 0 ||
+		transfer.MaxDailyLimit < transfer.BaseDailyLimit || transfer.CircularThreshold < 1 || transfer.CircularHours < 1 {
+		return fmt.Errorf("некорректные настройки переводов в %s", economyFile)
+	}
+
+	seen := make(map[string]bool)
+	for _, crate := range config.Crates {
+		if crate.ID == "" || seen[crate.ID] || crate.SellPercent < 0 || crate.SellPercent > 100 {
+			return fmt.Errorf("некорректный ящик %q в %s", crate.ID, economyFile)
+		}
+		total := 0
+		for _, weight := range crate.Weights {
+			if weight < 0 {
+				return fmt.Errorf("отрицательный вес в ящике %s", crate.ID)
+			}
+			total += weight
+		}
+		if total == 0 {
+			return fmt.Errorf("у ящика %s не заданы веса редкостей", crate.ID)
+		}
+		seen[crate.ID] = true
+	}
+
+	economyConfig = config
+	return nil
+}
+
+// Функция для поиска таблицы шансов ящика по идентификатору
+func findCrate(id string) (CrateConfig, bool) {
+	for _, crate := range economyConfig.Crates {
+		if crate.ID == id {
+			return crate, true
+		}
+	}
+	return CrateConfig{}, false
+}
+
+// Функция для получения процента выкупа плашки из ящика (ящик убран из настроек - самый низкий из оставшихся)
+func crateSellPercent(id string) int {
+	if crate, ok := findCrate(id); ok {
+		return crate.SellPercent
+	}
+	lowest := 0
+	for i, crate := range economyConfig.Crates {
+		if i == 0 || crate.SellPercent < lowest {
+			lowest = crate.SellPercent
+		}
+	}
+	return lowest
+}
+
+// Функция для форматирования шансов ящика по редкостям ("⚪ ОБЫЧНАЯ 85%, ...")
+func formatCrateOdds(crate CrateConfig) string {
+	total := 0
+	for _, tier := range rarityTiers {
+		total += crate.Weights[tier.Name]
+	}
+	if total == 0 {
+		return "нет доступных редкостей"
+	}
+
+	var odds []string
+	for _, tier := range sortedRarityTiers() {
+		weight := crate.Weights[tier.Name]
+		if weight == 0 {
+			continue
+		}
+		tenths := weight * 1000 / total
+		percent := fmt.Sprintf("%d%%", tenths/10)
+		if tenths%10 != 0 {
+			percent = fmt.Sprintf("%d.%d%%", tenths/10, tenths%10)
+		}
+		odds = append(odds, fmt.Sprintf("%s %s %s", tier.Emoji, tier.Label, percent))
+	}
+	return strings.Join(odds, ", ")
+}
+
+// Функция для выбора редкости по таблице весов ящика
+func rollCrateRarity(crate CrateConfig) (Rarity, error) {
+	weights := make([]int, len(rarityTiers))
+	total := 0
+	for i, tier := range rarityTiers {
+		weights[i] = crate.Weights[tier.Name]
+		total += weights[i]
+	}
+	if total == 0 {
+		return "", fmt.Errorf("у ящика %s нет весов для текущих редкостей", crate.ID)
+	}
+	return Rarity(rarityTiers[gamble.WeightedIndex(weights)].Name), nil
+}
+
+// Файл каталога магазина
+const shopFile = "shop.json"
+
+// Ключ Redis-хэша с остатками товаров (поле: ID товара)
+const shopStockKey = "shop:stock"
+
+// Эффекты магазинных предметов (по ним команды ищут нужный предмет в инвентаре)
+const (
+	shopEffectRob       = "rob"       // Оборудование для /rob и /platerob
+	shopEffectScout     = "scout"     // Оборудование для /scout
+	shopEffectCrate     = "crate"     // Ящик с плашкой для /open
+	shopEffectAlarm     = "alarm"     // Сигнализация: снижает шанс /rob против владельца
+	shopEffectSafe      = "safe"      // Сейф: включается через /use и защищает надетую плашку
+	shopEffectBodyguard = "bodyguard" // Охранник: может отбить /rob и /platerob
+)
+
+// Структура для товара в магазине
+type ShopItem struct {
+	ID             string `json:"id"`              // Идентификатор для /shop buy
+	Number         int    `json:"number"`          // Номер в меню /shop
+	Name           string `json:"name"`            // Название предмета в инвентаре
+	Emoji          string `json:"emoji"`           // Эмодзи в меню и сообщении о покупке
+	Description    string `json:"description"`     // Описание в меню (строки через \n)
+	Price          int    `json:"price"`           // Цена покупки
+	SellPrice      int    `json:"sellPrice"`       // Цена выкупа через /sell (и оценка в /inv)
+	MaxPerPurchase int    `json:"maxPerPurchase"`  // Максимум за одну покупку (0 - без ограничения)
+	Stock          int    `json:"stock"`           // Запас товара (0 - без ограничения)
+	Effect         string `json:"effect"`          // Что делает предмет: rob, scout, crate, alarm, safe, bodyguard
+	Crate          string `json:"crate,omitempty"` // Таблица шансов из economy.json (для effect=crate)
+}
+
+// Структура для каталога магазина
+type ShopCatalog struct {
+	Items []ShopItem `json:"items"`
+}
+
+// Каталог по умолчанию (если shop.json нет)
+var defaultShopItems = []ShopItem{
+	{ID: "robbery_gear", Number: 1, Name: "Оборудование для грабежа", Emoji: "🔫", Price: 1000, SellPrice: 500, MaxPerPurchase: 10, Effect: shopEffectRob,
+		Description: "Специальное оборудование для проведения грабежей\n📦 Хранится в инвентаре\n🎯 Шанс успеха: 30% (украсть до 50% баланса)\n💸 Штраф: 30% (потерять 10% баланса)\n🏃‍♂️ Бегство: 40% (ничего не происходит)"},
+	{ID: "scout_gear", Number: 2, Name: "Оборудование для разведки", Emoji: "🕵️", Price: 100, SellPrice: 50, MaxPerPurchase: 10, Effect: shopEffectScout,
+		Description: "Позволяет шпионить за балансами и инвентарем других игроков\n📦 Хранится в инвентаре\n👁️ Шанс успеха: 70%"},
+	{ID: "crate_wood", Number: 3, Name: "Деревянный ящик", Emoji: "📦", Price: 1500, SellPrice: 750, MaxPerPurchase: 10, Effect: shopEffectCrate, Crate: "crate_wood",
+		Description: "Случайная плашка, чаще всего обычная"},
+	{ID: "crate_silver", Number: 4, Name: "Серебряный ящик", Emoji: "📦", Price: 5000, SellPrice: 2500, MaxPerPurchase: 10, Effect: shopEffectCrate, Crate: "crate_silver",
+		Description: "Случайная плашка с хорошим шансом на редкую"},
+	{ID: "crate_gold", Number: 5, Name: "Золотой ящик", Emoji: "📦", Price: 15000, SellPrice: 7500, MaxPerPurchase: 3, Stock: 100, Effect: shopEffectCrate, Crate: "crate_gold",
+		Description: "Лимитированная партия: редкие и легендарные плашки"},
+	{ID: "alarm", Number: 6, Name: "Сигнализация", Emoji: "🚨", Price: 800, SellPrice: 400, MaxPerPurchase: 5, Effect: shopEffectAlarm,
+		Description: "Срабатывает при попытке /rob против вас\n📉 Снижает шанс успеха грабителя\n💸 Увеличивает штраф грабителя\n⚠️ Расходуется при срабатывании"},
+	{ID: "safe", Number: 7, Name: "Сейф", Emoji: "🔐", Price: 3000, SellPrice: 1500, MaxPerPurchase: 5, Effect: shopEffectSafe,
+		Description: "Защищает надетую плашку от /platerob на несколько дней\n🔑 Включается командой /use (хэш)"},
+	{ID: "bodyguard", Number: 8, Name: "Охранник", Emoji: "💂", Price: 2500, SellPrice: 1250, MaxPerPurchase: 5, Effect: shopEffectBodyguard,
+		Description: "Может отбить /rob и /platerob и взыскать штраф с грабителя в вашу пользу\n⚠️ Уходит после любого нападения"},
+}
+
+// Текущий каталог магазина (отсортирован по номеру)
+var shopItems = defaultShopItems
+
+// Функция для загрузки каталога магазина из shop.json (остатки товаров хранятся в Redis)
+func loadShopCatalog() error {
+	data, err := os.ReadFile(shopFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", shopFile, err)
+	}
+
+	var catalog ShopCatalog
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&catalog); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", shopFile, err)
+	}
+
+	if err := validateShopItems(catalog.Items); err != nil {
+		return err
+	}
+
+	sort.SliceStable(catalog.Items, func(i, j int) bool {
+		return catalog.Items[i].Number < catalog.Items[j].Number
+	})
+	shopItems = catalog.Items
+
+	initShopStock()
+	return nil
+}
+
+// Функция для проверки товаров каталога
+func validateShopItems(items []ShopItem) error {
+	ids := make(map[string]bool)
+	numbers := make(map[int]bool)
+	names := make(map[string]bool)
+	for _, item := range items {
+		if item.ID == "" || item.Name == "" || item.Number <= 0 {
+			return fmt.Errorf("у товара %q не заданы ID, номер или название", item.ID)
+		}
+		if ids[item.ID] || numbers[item.Number] || names[item.Name] {
+			return fmt.Errorf("товар %s повторяет ID, номер или название другого товара", item.ID)
+		}
+		if item.Price <= 0 || item.SellPrice < 0 || item.MaxPerPurchase < 0 || item.Stock < 0 {
+			return fmt.Errorf("некорректные цена, выкуп, лимит или запас у товара %s", item.ID)
+		}
+		switch item.Effect {
+		case shopEffectRob, shopEffectScout, shopEffectAlarm, shopEffectSafe, shopEffectBodyguard:
+		case shopEffectCrate:
+			if _, ok := findCrate(item.Crate); !ok {
+				return fmt.Errorf("у ящика %s нет таблицы шансов %q в %s", item.ID, item.Crate, economyFile)
+			}
+		default:
+			return fmt.Errorf("неизвестный эффект %q у товара %s", item.Effect, item.ID)
+		}
+		ids[item.ID] = true
+		numbers[item.Number] = true
+		names[item.Name] = true
+	}
+	return nil
+}
+
+// Функция для заведения остатков лимитированных товаров (существующие остатки не трогаются)
+func initShopStock() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	for _, item := range shopItems {
+		if item.Stock > 0 {
+			if err := redisClient.HSetNX(ctx, shopStockKey, item.ID, item.Stock).Err(); err != nil {
+				log.Printf("initShopStock: Ошибка заведения остатка товара %s: %v", item.ID, err)
+			}
+		}
+	}
+}
+
+// Функция для поиска товара по номеру в меню или идентификатору
+func findShopItem(id string) (ShopItem, bool) {
+	for _, item := range shopItems {
+		if item.ID == id || strconv.Itoa(item.Number) == id {
+			return item, true
+		}
+	}
+	return ShopItem{}, false
+}
+
+// Функция для поиска товара по названию предмета в инвентаре
+func findShopItemByName(name string) (ShopItem, bool) {
+	for _, item := range shopItems {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return ShopItem{}, false
+}
+
+// Функция для получения цены выкупа магазинного предмета
+func shopSellPrice(itemName string) int {
+	if item, ok := findShopItemByName(itemName); ok {
+		return item.SellPrice
+	}
+	return 0 // Товар убран из каталога - выкупать не за что
+}
+
+// Функция для получения остатка товара (-1 - без ограничения)
+func getShopStock(item ShopItem) int {
+	if item.Stock == 0 || redisClient == nil {
+		return -1
+	}
+
+	ctx := context.Background()
+	stock, err := redisClient.HGet(ctx, shopStockKey, item.ID).Int()
+	if err != nil {
+		log.Printf("getShopStock: Ошибка чтения остатка товара %s: %v", item.ID, err)
+		return 0
+	}
+	return stock
+}
+
+// Функция для резервирования товара на складе перед покупкой
+func reserveShopStock(item ShopItem, quantity int) error {
+	if item.Stock == 0 {
+		return nil
+	}
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	left, err := redisClient.HIncrBy(ctx, shopStockKey, item.ID, int64(-quantity)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to reserve stock: %v", err)
+	}
+	if left < 0 {
+		redisClient.HIncrBy(ctx, shopStockKey, item.ID, int64(quantity))
+		return fmt.Errorf("на складе осталось только %d шт.", left+int64(quantity))
+	}
+	return nil
+}
+
+// Функция для возврата товара на склад (покупка не состоялась)
+func releaseShopStock(item ShopItem, quantity int) {
+	if item.Stock == 0 || redisClient == nil || quantity <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	if err := redisClient.HIncrBy(ctx, shopStockKey, item.ID, int64(quantity)).Err(); err != nil {
+		log.Printf("releaseShopStock: Ошибка возврата товара %s на склад: %v", item.ID, err)
+	}
+}
+
+// Функция для форматирования меню магазина
+func formatShopMenu() string {
+	text := "🛒 МАГАЗИН\n\n💰 Доступные товары:\n\n"
+	for _, item := range shopItems {
+		text += fmt.Sprintf("%d\uFE0F\u20E3 %s **%s** - %d %s\n", item.Number, item.Emoji, item.Name, item.Price, getChipsWord(item.Price))
+		for _, line := range strings.Split(item.Description, "\n") {
+			if line != "" {
+				text += "   " + line + "\n"
+			}
+		}
+		if item.Effect == shopEffectCrate {
+			crate, _ := findCrate(item.Crate)
+			text += "   📦 Открывается командой /open (хэш)\n"
+			text += fmt.Sprintf("   🎲 Шансы: %s\n", formatCrateOdds(crate))
+			text += fmt.Sprintf("   💱 Плашки из ящика выкупаются за %d%% стоимости\n", crate.SellPercent)
+		}
+		text += fmt.Sprintf("   💱 Выкуп: %d %s\n", item.SellPrice, getChipsWord(item.SellPrice))
+		if stock := getShopStock(item); stock >= 0 {
+			if stock == 0 {
+				text += "   ❌ Нет в наличии\n"
+			} else {
+				text += fmt.Sprintf("   🏷️ Осталось: %d шт.\n", stock)
+			}
+		}
+		text += "\n"
+	}
+
+	text += "💡 Для покупки используйте: /shop buy (номер или ID) [кол-во]\n\n"
+	text += "⚠️ Оборудование можно использовать только один раз!"
+	return text
+}
+
+// Функция для списка товаров в подсказке ("• 1 или robbery_gear - ...")
+func formatShopItemList() string {
+	var lines []string
+	for _, item := range shopItems {
+		lines = append(lines, fmt.Sprintf("• %d или %s - %s", item.Number, item.ID, item.Name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Функция для получения ключа сейфа игрока (значение - время окончания защиты)
+func safeKey(username string) string {
+	return fmt.Sprintf("safe:%s", username)
+}
+
+// Функция для проверки, защищена ли надетая плашка игрока сейфом
+func getSafeUntil(username string) (time.Time, bool) {
+	if redisClient == nil {
+		return time.Time{}, false
+	}
+
+	ctx := context.Background()
+	until, err := redisClient.Get(ctx, safeKey(username)).Int64()
+	if err != nil || time.Now().Unix() >= until {
+		return time.Time{}, false
+	}
+	return time.Unix(until, 0), true
+}
+
+// Функция для включения сейфа (продлевает уже действующую защиту)
+func activateSafe(username string) (time.Time, error) {
+	if redisClient == nil {
+		return time.Time{}, fmt.Errorf("Redis client not available")
+	}
+
+	start := time.Now()
+	if until, active := getSafeUntil(username); active {
+		start = until
+	}
+	until := start.AddDate(0, 0, economyConfig.Defense.SafeDays)
+
+	ctx := context.Background()
+	if err := redisClient.Set(ctx, safeKey(username), until.Unix(), time.Until(until)).Err(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to save safe: %v", err)
+	}
+	return until, nil
+}
+
+// Функция для штрафа грабителя охранником: что есть на балансе достается жертве, остальное - в долг
+func applyBodyguardFine(robber, victim string) (int, int) {
+	penalty := economyConfig.Defense.BodyguardFine
+
+	// Обновляем штрафы перед проверкой
+	updateFinesDaily()
+
+	paid := playerBalances[robber]
+	if paid > penalty {
+		paid = penalty
+	}
+	if paid > 0 {
+		changeBalance(robber, -paid)
+		creditPlayer(victim, paid)
+	}
+
+	debt := penalty - paid
+	if debt > 0 {
+		playerFines[robber] += debt
+		playerFineDates[robber] = time.Now()
+		saveFinesToRedis()
+	}
+
+	log.Printf("applyBodyguardFine: Охранник %s оштрафовал %s на %d (оплачено %d, в долг %d)", victim, robber, penalty, paid, debt)
+	return paid, debt
+}
+
+// Функция для уведомления жертвы о нападении и сработавшей защите (отдельным сообщением в чат)
+func notifyRobVictim(bot *tgbotapi.BotAPI, chatID int64, victim, text string) {
+	notice := tgbotapi.NewMessage(chatID, fmt.Sprintf("🛡️ @%s, %s", victim, text))
+	if _, err := bot.Send(notice); err != nil {
+		log.Printf("notifyRobVictim: Ошибка уведомления %s: %v", victim, err)
+	}
+}
+
+// Функция для получения ключа паузы грабителя (значение - время окончания паузы)
+func robCooldownKey(username string) string {
+	return fmt.Sprintf("rob:cooldown:%s", username)
+}
+
+// Функция для получения ключа защиты недавно ограбленной жертвы (значение - время окончания защиты)
+func robShieldKey(username string) string {
+	return fmt.Sprintf("rob:shield:%s", username)
+}
+
+// Функция для получения ключа счетчика попыток грабителя за сегодня
+func robAttemptsKey(username string) string {
+	return fmt.Sprintf("rob:attempts:%s:%s", username, time.Now().Format("2006-01-02"))
+}
+
+// Функция для чтения времени окончания из ключа (false - время прошло или ключа нет)
+func getRobUntil(key string) (time.Time, bool) {
+	if redisClient == nil {
+		return time.Time{}, false
+	}
+
+	ctx := context.Background()
+	until, err := redisClient.Get(ctx, key).Int64()
+	if err != nil || time.Now().Unix() >= until {
+		return time.Time{}, false
+	}
+	return time.Unix(until, 0), true
+}
+
+// Функция для получения количества попыток ограбления за сегодня
+func getRobAttemptsToday(username string) int {
+	if redisClient == nil {
+		return 0
+	}
+
+	ctx := context.Background()
+	attempts, err := redisClient.Get(ctx, robAttemptsKey(username)).Int()
+	if err != nil && err != redis.Nil {
+		log.Printf("getRobAttemptsToday: Ошибка чтения попыток %s: %v", username, err)
+	}
+	return attempts
+}
+
+// Функция для расчета штрафа к шансу /rob против более бедной жертвы (forbidden - грабить нельзя совсем)
+func getRobWealthPenalty(robber, victim string) (penalty int, forbidden bool) {
+	robberBalance := playerBalances[robber]
+	if robberBalance <= 0 {
+		return 0, false
+	}
+
+	ratio := playerBalances[victim] * 100 / robberBalance
+	rules := economyConfig.RobRules
+	if ratio < rules.ForbiddenRatio {
+		return 0, true
+	}
+	if ratio < rules.WeakerRatio {
+		return rules.WeakerPenalty, false
+	}
+	return 0, false
+}
+
+// Функция для централизованной проверки правил перед /rob и /platerob
+func checkRobAllowed(robber, victim string) error {
+	rules := economyConfig.RobRules
+
+	if err := checkNotJailed(robber); err != nil {
+		return err
+	}
+
+	if until, active := getRobUntil(robCooldownKey(robber)); active {
+		return fmt.Errorf("⏳ Пауза между ограблениями! Следующая попытка в %s.\n\n📋 Статус: /robstatus", until.Format("15:04"))
+	}
+
+	if rules.DailyAttempts > 0 && getRobAttemptsToday(robber) >= rules.DailyAttempts {
+		return fmt.Errorf("🚫 Лимит ограблений на сегодня исчерпан (%d/%d)!\n\n📅 Новые попытки появятся после полуночи.",
+			rules.DailyAttempts, rules.DailyAttempts)
+	}
+
+	if until, active := getRobUntil(robShieldKey(victim)); active {
+		return fmt.Errorf("🛡️ @%s недавно ограбили! Жертва под защитой до %s.\n\n📋 Статус: /robstatus @%s",
+			victim, until.Format("15:04"), victim)
+	}
+
+	return nil
+}
+
+// Функция для учета попытки ограбления (пауза грабителя и дневной счетчик)
+func recordRobAttempt(robber string) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	rules := economyConfig.RobRules
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if rules.CooldownMinutes > 0 {
+			cooldown := time.Duration(rules.CooldownMinutes) * time.Minute
+			pipe.Set(ctx, robCooldownKey(robber), time.Now().Add(cooldown).Unix(), cooldown)
+		}
+		pipe.Incr(ctx, robAttemptsKey(robber))
+		pipe.Expire(ctx, robAttemptsKey(robber), 48*time.Hour)
+		return nil
+	})
+	if err != nil {
+		log.Printf("recordRobAttempt: Ошибка учета попытки %s: %v", robber, err)
+	}
+}
+
+// Функция для включения защиты жертвы после успешного ограбления
+func shieldRobVictim(victim string) {
+	if redisClient == nil || economyConfig.RobRules.ShieldMinutes <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	shield := time.Duration(economyConfig.RobRules.ShieldMinutes) * time.Minute
+	if err := redisClient.Set(ctx, robShieldKey(victim), time.Now().Add(shield).Unix(), shield).Err(); err != nil {
+		log.Printf("shieldRobVictim: Ошибка включения защиты %s: %v", victim, err)
+	}
+}
+
+// Функция для получения ключа тюрьмы (значение - время освобождения)
+func jailKey(username string) string {
+	return fmt.Sprintf("jail:%s", username)
+}
+
+// Функция для проверки, сидит ли игрок в тюрьме
+func getJailUntil(username string) (time.Time, bool) {
+	return getRobUntil(jailKey(username))
+}
+
+// Функция для расчета залога по оставшемуся сроку
+func getBailAmount(until time.Time) int {
+	minutes := int((time.Until(until) + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes * economyConfig.Jail.BailPerMinute
+}
+
+// Функция для отправки пойманного грабителя в тюрьму (с шансом из настроек, возвращает текст для сообщения)
+func tryJailRobber(robber string) string {
+	jail := economyConfig.Jail
+	if redisClient == nil || jail.Minutes <= 0 || gamble.RollPercent() >= jail.Chance {
+		return ""
+	}
+
+	ctx := context.Background()
+	term := time.Duration(jail.Minutes) * time.Minute
+	until := time.Now().Add(term)
+	if err := redisClient.Set(ctx, jailKey(robber), until.Unix(), term).Err(); err != nil {
+		log.Printf("tryJailRobber: Ошибка заключения %s: %v", robber, err)
+		return ""
+	}
+
+	log.Printf("tryJailRobber: %s отправлен в тюрьму до %s", robber, until.Format("15:04"))
+	return fmt.Sprintf("\n\n🚓 **ВАС ПОСАДИЛИ В ТЮРЬМУ** до %s!\n"+
+		"⛓️ До освобождения нельзя /rob, /platerob, /coin и /bet\n"+
+		"💰 Залог: %d %s (/bail) или попросите друга: /bail @%s",
+		until.Format("15:04"), getBailAmount(until), getChipsWord(getBailAmount(until)), robber)
+}
+
+// Функция для проверки, что игрок не в тюрьме (для /rob, /platerob, /coin и /bet)
+func checkNotJailed(username string) error {
+	if until, jailed := getJailUntil(username); jailed {
+		bail := getBailAmount(until)
+		return fmt.Errorf("⛓️ Вы в тюрьме до %s!\n\n💰 Выйти под залог: /bail (%d %s)\n🤝 Или попросите друга: /bail @%s",
+			until.Format("15:04"), bail, getChipsWord(bail), username)
+	}
+	return nil
+}
+
+// Функция для освобождения игрока под залог (платит payer, возвращает сумму залога)
+func payBail(payer, prisoner string) (int, error) {
+	until, jailed := getJailUntil(prisoner)
+	if !jailed {
+		return 0, fmt.Errorf("@%s не в тюрьме", prisoner)
+	}
+
+	bail := getBailAmount(until)
+	if playerBalances[payer] < bail {
+		return bail, fmt.Errorf("недостаточно средств для залога")
+	}
+	if !changeBalance(payer, -bail) {
+		return bail, fmt.Errorf("не удалось списать залог")
+	}
+
+	// Освобождает только тот, кто успел удалить ключ - иначе возвращаем деньги
+	ctx := context.Background()
+	deleted, err := redisClient.Del(ctx, jailKey(prisoner)).Result()
+	if err != nil || deleted == 0 {
+		changeBalance(payer, bail)
+		if err != nil {
+			return bail, fmt.Errorf("failed to release from jail: %v", err)
+		}
+		return bail, fmt.Errorf("@%s уже на свободе", prisoner)
+	}
+
+	log.Printf("payBail: %s внес залог %d за %s", payer, bail, prisoner)
+	return bail, nil
+}
+
+// Функция для форматирования статуса ограблений игрока (/robstatus)
+func formatRobStatus(username string) string {
+	rules := economyConfig.RobRules
+	text := fmt.Sprintf("🕵️ СТАТУС ОГРАБЛЕНИЙ @%s\n\n", username)
+
+	if until, jailed := getJailUntil(username); jailed {
+		text += fmt.Sprintf("⛓️ В тюрьме до %s (залог: /bail)\n", until.Format("02.01.2006 15:04"))
+	} else if until, active := getRobUntil(robCooldownKey(username)); active {
+		text += fmt.Sprintf("⏳ Грабить: после %s\n", until.Format("02.01.2006 15:04"))
+	} else {
+		text += "🔫 Грабить: можно сейчас\n"
+	}
+	if rules.DailyAttempts > 0 {
+		text += fmt.Sprintf("📅 Попыток сегодня: %d/%d (сброс в полночь)\n", getRobAttemptsToday(username), rules.DailyAttempts)
+	}
+
+	if until, active := getRobUntil(robShieldKey(username)); active {
+		text += fmt.Sprintf("🛡️ Защита от ограблений: до %s\n", until.Format("02.01.2006 15:04"))
+	} else {
+		text += "🎯 Защиты нет: ограбить можно прямо сейчас\n"
+	}
+	if until, active := getSafeUntil(username); active {
+		text += fmt.Sprintf("🔐 Сейф: надетая плашка защищена до %s\n", until.Format("02.01.2006 15:04"))
+	}
+
+	text += fmt.Sprintf("\n📋 ПРАВИЛА:\n"+
+		"• Пауза между попытками: %d мин.\n"+
+		"• Защита после успешного ограбления: %d мин.\n"+
+		"• /rob запрещен, если у жертвы меньше %d%% вашего баланса\n"+
+		"• Шанс /rob на %d%% ниже, если у жертвы меньше %d%% вашего баланса",
+		rules.CooldownMinutes, rules.ShieldMinutes, rules.ForbiddenRatio, rules.WeakerPenalty, rules.WeakerRatio)
+
+	return text
+}
+
+const heistsActiveKey = "heists:active"
+
+// Структура для совместного ограбления (/heist)
+type Heist struct {
+	ID     string    `json:"id"`
+	ChatID int64     `json:"chatId"`
+	Leader string    `json:"leader"`
+	Target string    `json:"target"`
+	Crew   []string  `json:"crew"`
+	EndsAt time.Time `json:"endsAt"`
+}
+
+// Функция для получения ключа ограбления
+func heistKey(id string) string {
+	return fmt.Sprintf("heist:%s", id)
+}
+
+// Функция для расчета шанса успеха ограбления по размеру банды
+func heistChance(crewSize int) int {
+	config := economyConfig.Heist
+	chance := config.BaseChance + config.ChancePerMember*(crewSize-1)
+	if chance > config.MaxChance {
+		chance = config.MaxChance
+	}
+	return chance
+}
+
+// Функция для загрузки ограбления из Redis
+func getHeist(id string) (Heist, error) {
+	var heist Heist
+	if redisClient == nil {
+		return heist, fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	data, err := redisClient.Get(ctx, heistKey(id)).Bytes()
+	if err != nil {
+		return heist, err
+	}
+	err = json.Unmarshal(data, &heist)
+	return heist, err
+}
+
+// Функция для загрузки всех активных ограблений
+func getActiveHeists() []Heist {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	ids, err := redisClient.SMembers(ctx, heistsActiveKey).Result()
+	if err != nil {
+		log.Printf("getActiveHeists: Ошибка чтения активных ограблений: %v", err)
+		return nil
+	}
+
+	heists := make([]Heist, 0, len(ids))
+	for _, id := range ids {
+		heist, err := getHeist(id)
+		if err != nil {
+			log.Printf("getActiveHeists: Ограбление %s не найдено: %v", id, err)
+			continue
+		}
+		heists = append(heists, heist)
+	}
+	sort.Slice(heists, func(i, j int) bool { return heists[i].EndsAt.Before(heists[j].EndsAt) })
+	return heists
+}
+
+// Функция для проверки, что игрок не участвует в другом ограблении и не является его целью
+func checkHeistBusy(username string) error {
+	for _, heist := range getActiveHeists() {
+		if heist.Target == username {
+			return fmt.Errorf("на @%s уже готовится ограбление #%s", username, heist.ID)
+		}
+		for _, member := range heist.Crew {
+			if member == username {
+				return fmt.Errorf("@%s уже в банде ограбления #%s", username, heist.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// Функция для открытия лобби ограбления
+func startHeist(chatID int64, leader, target string) (Heist, error) {
+	if redisClient == nil {
+		return Heist{}, fmt.Errorf("Redis client not available")
+	}
+	if err := checkHeistBusy(leader); err != nil {
+		return Heist{}, err
+	}
+	if err := checkHeistBusy(target); err != nil {
+		return Heist{}, err
+	}
+
+	ctx := context.Background()
+	number, err := redisClient.Incr(ctx, "heist:counter").Result()
+	if err != nil {
+		return Heist{}, fmt.Errorf("failed to get heist number: %v", err)
+	}
+
+	heist := Heist{
+		ID:     strconv.FormatInt(number, 10),
+		ChatID: chatID,
+		Leader: leader,
+		Target: target,
+		Crew:   []string{leader},
+		EndsAt: time.Now().Add(time.Duration(economyConfig.Heist.LobbyMinutes) * time.Minute),
+	}
+	data, err := json.Marshal(heist)
+	if err != nil {
+		return Heist{}, err
+	}
+
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, heistKey(heist.ID), data, 0)
+		pipe.SAdd(ctx, heistsActiveKey, heist.ID)
+		return nil
+	})
+	if err != nil {
+		return Heist{}, fmt.Errorf("failed to save heist: %v", err)
+	}
+
+	log.Printf("startHeist: %s открыл ограбление #%s против %s", leader, heist.ID, target)
+	return heist, nil
+}
+
+// Функция для атомарного изменения состава банды (WATCH на ключ ограбления)
+func updateHeistCrew(id string, update func(heist *Heist) error) (Heist, error) {
+	var heist Heist
+	if redisClient == nil {
+		return heist, fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	key := heistKey(id)
+	err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return fmt.Errorf("ограбление #%s не найдено или уже завершено", id)
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &heist); err != nil {
+			return err
+		}
+		if err := update(&heist); err != nil {
+			return err
+		}
+
+		data, err = json.Marshal(heist)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+
+	if err == redis.TxFailedErr {
+		return heist, fmt.Errorf("состав банды изменился, попробуйте еще раз")
+	}
+	return heist, err
+}
+
+// Функция для вступления в банду ограбления
+func joinHeist(id, username string) (Heist, error) {
+	if err := checkHeistBusy(username); err != nil {
+		return Heist{}, err
+	}
+
+	return updateHeistCrew(id, func(heist *Heist) error {
+		if !time.Now().Before(heist.EndsAt) {
+			return fmt.Errorf("набор в банду ограбления #%s уже закрыт", heist.ID)
+		}
+		if len(heist.Crew) >= economyConfig.Heist.MaxCrew {
+			return fmt.Errorf("банда ограбления #%s уже набрана (%d/%d)", heist.ID, len(heist.Crew), economyConfig.Heist.MaxCrew)
+		}
+		heist.Crew = append(heist.Crew, username)
+		return nil
+	})
+}
+
+// Функция для отмены ограбления (если главарь не смог потратить оборудование)
+func cancelHeist(id string) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, heistKey(id))
+		pipe.SRem(ctx, heistsActiveKey, id)
+		return nil
+	})
+	if err != nil {
+		log.Printf("cancelHeist: Ошибка отмены ограбления #%s: %v", id, err)
+	}
+}
+
+// Функция для выхода из банды (если не удалось потратить оборудование)
+func leaveHeist(id, username string) {
+	_, err := updateHeistCrew(id, func(heist *Heist) error {
+		for i, member := range heist.Crew {
+			if member == username {
+				heist.Crew = append(heist.Crew[:i], heist.Crew[i+1:]...)
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("leaveHeist: Ошибка выхода %s из ограбления #%s: %v", username, id, err)
+	}
+}
+
+// Функция для подведения итогов ограбления: списание с жертвы, штрафы и удаление ограбления - одной транзакцией, доли банды зачисляются после нее
+func settleHeist(id string) (string, error) {
+	if redisClient == nil {
+		return "", fmt.Errorf("Redis client not available")
+	}
+
+	// Обновляем штрафы перед расчетом
+	updateFinesDaily()
+
+	ctx := context.Background()
+	key := heistKey(id)
+	config := economyConfig.Heist
+
+	var heist Heist
+	var text string
+	var success bool
+	var balances, banks, fines map[string]int // Изменения (дельты), а не итоговые значения
+	var withheld map[string]int               // Удержания из долей банды в счет штрафа
+
+	settle := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &heist); err != nil {
+			return err
+		}
+
+		balances = make(map[string]int)
+		banks = make(map[string]int)
+		fines = make(map[string]int)
+		withheld = make(map[string]int)
+		success = false
+		crew := len(heist.Crew)
+
+		if crew < config.MinCrew {
+			text = fmt.Sprintf("🚫 **ОГРАБЛЕНИЕ #%s СОРВАЛОСЬ!**\n\n"+
+				"👥 Банда не набралась: %d из %d\n"+
+				"🎯 @%s может спать спокойно, оборудование потрачено зря",
+				heist.ID, crew, config.MinCrew, heist.Target)
+		} else if chance := heistChance(crew); gamble.RollPercent() < chance {
+			success = true
+			fromBalance := playerBalances[heist.Target] * config.BalancePercent / 100
+			fromBank := playerBanks[heist.Target] * config.BankPercent / 100
+			loot := fromBalance + fromBank
+			share := loot / crew
+
+			balances[heist.Target] = -fromBalance
+			banks[heist.Target] = -fromBank
+			shares := make(map[string]int)
+			for _, member := range heist.Crew {
+				shares[member] += share
+			}
+			// Остаток от деления достается главарю
+			shares[heist.Leader] += loot - share*crew
+
+			// Удержание в счет штрафа считаем заранее, чтобы зачислить доли в той же транзакции
+			for member, amount := range shares {
+				withheld[member] = garnishAmount(member, amount)
+				balances[member] += amount - withheld[member]
+				if withheld[member] > 0 {
+					fines[member] = -withheld[member]
+				}
+			}
+
+			text = fmt.Sprintf("💰 **ОГРАБЛЕНИЕ #%s УДАЛОСЬ!**\n\n"+
+				"🎯 Цель: @%s\n"+
+				"👥 Банда: %s\n"+
+				"🎲 Шанс был: %d%%\n\n"+
+				"💵 С рук: %d %s\n"+
+				"🏦 Из банка: %d %s\n"+
+				"💰 Доля каждого: %d %s",
+				heist.ID, heist.Target, formatHeistCrew(heist), chance,
+				fromBalance, getChipsWord(fromBalance), fromBank, getChipsWord(fromBank), share, getChipsWord(share))
+		} else {
+			text = fmt.Sprintf("🚔 **ОГРАБЛЕНИЕ #%s ПРОВАЛИЛОСЬ!**\n\n"+
+				"🎯 Цель: @%s\n"+
+				"🎲 Шанс был: %d%%\n"+
+				"💸 Каждый участник оштрафован на %d %s:\n",
+				heist.ID, heist.Target, chance, config.Fine, getChipsWord(config.Fine))
+			for _, member := range heist.Crew {
+				paid := playerBalances[member]
+				if paid > config.Fine {
+					paid = config.Fine
+				}
+				balances[member] = -paid
+				debt := config.Fine - paid
+				if debt > 0 {
+					fines[member] = debt
+					text += fmt.Sprintf("• @%s: списано %d, в долг %d\n", member, paid, debt)
+				} else {
+					text += fmt.Sprintf("• @%s: списано %d\n", member, paid)
+				}
+			}
+		}
+
+		// Снятие ограбления и все изменения - одной транзакцией, суммы меняются через INCRBY
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.SRem(ctx, heistsActiveKey, heist.ID)
+			for username, delta := range balances {
+				pipe.IncrBy(ctx, fmt.Sprintf("balance:%s", username), int64(delta))
+			}
+			for username, delta := range banks {
+				pipe.IncrBy(ctx, fmt.Sprintf("bank:%s", username), int64(delta))
+			}
+			for username, delta := range fines {
+				switch {
+				case playerFines[username]+delta <= 0:
+					// Штраф погашен удержанием - удаляем его, как clearFine
+					pipe.Del(ctx, fmt.Sprintf("fine:%s", username))
+					pipe.HDel(ctx, fineDatesKey, username)
+				case delta > 0:
+					pipe.IncrBy(ctx, fmt.Sprintf("fine:%s", username), int64(delta))
+					pipe.HSet(ctx, fineDatesKey, username, time.Now().Unix())
+				default:
+					pipe.IncrBy(ctx, fmt.Sprintf("fine:%s", username), int64(delta))
+				}
+			}
+			return nil
+		})
+		return err
+	}
+
+	// Если ограбление изменилось во время расчета (например, кто-то вступил в банду), считаем заново
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = redisClient.Watch(ctx, settle, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+		log.Printf("settleHeist: Ограбление #%s изменилось во время расчета, повторяем", id)
+	}
+	if err != nil {
+		if err == redis.Nil {
+			// Ограбление уже подвел другой обработчик
+			return "", fmt.Errorf("heist %s already settled", id)
+		}
+		return "", err
+	}
+
+	// Транзакция прошла - переносим изменения в память
+	for username, delta := range balances {
+		playerBalances[username] += delta
+	}
+	for username, delta := range banks {
+		playerBanks[username] += delta
+	}
+	for username, delta := range fines {
+		playerFines[username] += delta
+		if playerFines[username] <= 0 {
+			delete(playerFines, username)
+			delete(playerFineDates, username)
+			incrCreditStat(username, "fines_cleared")
+		} else if delta > 0 {
+			playerFineDates[username] = time.Now()
+		}
+	}
+	for _, member := range heist.Crew {
+		if withheld[member] > 0 {
+			text += fmt.Sprintf("\n🏛️ У @%s в счет штрафа удержано: %d %s", member, withheld[member], getChipsWord(withheld[member]))
+			log.Printf("settleHeist: У %s удержано %d в счет штрафа", member, withheld[member])
+		}
+	}
+	if success {
+		shieldRobVictim(heist.Target)
+	}
+
+	log.Printf("settleHeist: Ограбление #%s против %s завершено (успех: %t, банда: %v)", heist.ID, heist.Target, success, heist.Crew)
+	return text, nil
+}
+
+// Функция для форматирования состава банды
+func formatHeistCrew(heist Heist) string {
+	members := make([]string, len(heist.Crew))
+	for i, member := range heist.Crew {
+		members[i] = "@" + member
+	}
+	return strings.Join(members, ", ")
+}
+
+// Функция для ожидания конца набора и подведения итогов ограбления в чате
+func scheduleHeist(bot *tgbotapi.BotAPI, heist Heist) {
+	go func() {
+		time.Sleep(time.Until(heist.EndsAt))
+
+		// Итоги подводятся в основном цикле: там же меняются балансы по командам
+		runOnMainLoop(func() {
+			text, err := settleHeist(heist.ID)
+			if err != nil {
+				log.Printf("scheduleHeist: Ограбление #%s не подведено: %v", heist.ID, err)
+				return
+			}
+
+			msg := tgbotapi.NewMessage(heist.ChatID, text)
+			if _, err := bot.Send(msg); err != nil {
+				log.Printf("scheduleHeist: Ошибка отправки итогов ограбления #%s: %v", heist.ID, err)
+			}
+		})
+	}()
+}
+
+// Функция для возобновления ограблений после перезапуска бота
+func resumeHeists(bot *tgbotapi.BotAPI) {
+	heists := getActiveHeists()
+	for _, heist := range heists {
+		scheduleHeist(bot, heist)
+	}
+	log.Printf("resumeHeists: Возобновлено %d ограблений", len(heists))
+}
+
+const bountyTargetsKey = "bounties:targets"
+
+// Структура для награды за голову игрока (/bounty)
+type Bounty struct {
+	ID        string    `json:"id"`
+	ChatID    int64     `json:"chatId"`
+	Placer    string    `json:"placer"`
+	Target    string    `json:"target"`
+	Amount    int       `json:"amount"`
+	Tax       int       `json:"tax,omitempty"` // Налог на перевод, уплаченный при назначении (не возвращается)
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Функция для получения ключа наград за голову игрока (hash: id -> JSON награды)
+func bountyKey(target string) string {
+	return fmt.Sprintf("bounty:%s", target)
+}
+
+// Функция для загрузки наград за голову игрока
+func getBounties(target string) []Bounty {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	fields, err := redisClient.HGetAll(ctx, bountyKey(target)).Result()
+	if err != nil {
+		log.Printf("getBounties: Ошибка чтения наград за %s: %v", target, err)
+		return nil
+	}
+	return parseBounties(fields)
+}
+
+// Функция для разбора наград из hash (по возрастанию срока)
+func parseBounties(fields map[string]string) []Bounty {
+	bounties := make([]Bounty, 0, len(fields))
+	for id, data := range fields {
+		var bounty Bounty
+		if err := json.Unmarshal([]byte(data), &bounty); err != nil {
+			log.Printf("parseBounties: Некорректная награда %s: %v", id, err)
+			continue
+		}
+		bounties = append(bounties, bounty)
+	}
+	sort.Slice(bounties, func(i, j int) bool { return bounties[i].ExpiresAt.Before(bounties[j].ExpiresAt) })
+	return bounties
+}
+
+// Функция для назначения награды: фишки списываются с назначившего и лежат на кону до выплаты или возврата
+func placeBounty(chatID int64, placer, target string, amount int) (Bounty, error) {
+	if redisClient == nil {
+		return Bounty{}, fmt.Errorf("Redis client not available")
+	}
+
+	// Награду может забрать кто угодно, в том числе второй аккаунт назначившего, поэтому это такой же перевод:
+	// долг его запрещает, сумма идет в суточный лимит и облагается налогом
+	if err := checkTransferAllowed(placer, amount); err != nil {
+		return Bounty{}, err
+	}
+	tax := transferTax(amount)
+	if !changeBalance(placer, -(amount + tax)) {
+		return Bounty{}, fmt.Errorf("недостаточно средств")
+	}
+
+	ctx := context.Background()
+	number, err := redisClient.Incr(ctx, "bounty:counter").Result()
+	if err != nil {
+		changeBalance(placer, amount+tax)
+		return Bounty{}, fmt.Errorf("failed to get bounty number: %v", err)
+	}
+
+	bounty := Bounty{
+		ID:        strconv.FormatInt(number, 10),
+		ChatID:    chatID,
+		Placer:    placer,
+		Target:    target,
+		Amount:    amount,
+		Tax:       tax,
+		ExpiresAt: time.Now().AddDate(0, 0, economyConfig.Bounty.Days),
+	}
+	data, err := json.Marshal(bounty)
+	if err != nil {
+		changeBalance(placer, amount+tax)
+		return Bounty{}, err
+	}
+
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, bountyKey(target), bounty.ID, data)
+		pipe.SAdd(ctx, bountyTargetsKey, target)
+		pipe.IncrBy(ctx, transferOutKey(placer), int64(amount))
+		pipe.Expire(ctx, transferOutKey(placer), 48*time.Hour)
+		return nil
+	})
+	if err != nil {
+		changeBalance(placer, amount+tax)
+		return Bounty{}, fmt.Errorf("failed to save bounty: %v", err)
+	}
+
+	appendJournal(placer, JournalEntry{Type: "transfer_out", Amount: -(amount + tax), Note: fmt.Sprintf("награда за @%s, налог %d", target, tax)})
+	log.Printf("placeBounty: %s назначил награду %d за %s (налог %d, до %s)", placer, amount, target, tax, bounty.ExpiresAt.Format("02.01.2006 15:04"))
+	return bounty, nil
+}
+
+// Функция для атомарного снятия наград с цели (WATCH на hash наград): выплата или возврат фишек
+// take решает, какие награды снять; возвращает суммы по получателям, зачисляет их вызывающий код
+func takeBounties(target string, take func(bounty Bounty) (recipient string, ok bool)) (map[string]int, []Bounty, error) {
+	ctx := context.Background()
+	key := bountyKey(target)
+
+	var payouts map[string]int
+	var taken []Bounty
+	err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		payouts = make(map[string]int)
+		taken = nil
+		bounties := parseBounties(fields)
+		for _, bounty := range bounties {
+			if recipient, ok := take(bounty); ok {
+				payouts[recipient] += bounty.Amount
+				taken = append(taken, bounty)
+			}
+		}
+		if len(taken) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, bounty := range taken {
+				pipe.HDel(ctx, key, bounty.ID)
+			}
+			if len(taken) == len(bounties) {
+				pipe.SRem(ctx, bountyTargetsKey, target)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payouts, taken, nil
+}
+
+// Функция для выплаты всех наград за голову жертвы после успешного ограбления (возвращает текст для сообщения)
+func payBounties(robber, target string) string {
+	if redisClient == nil {
+		return ""
+	}
+
+	payouts, taken, err := takeBounties(target, func(bounty Bounty) (string, bool) {
+		return robber, time.Now().Before(bounty.ExpiresAt)
+	})
+	if err != nil {
+		log.Printf("payBounties: Ошибка выплаты наград за %s: %v", target, err)
+		return ""
+	}
+	if len(taken) == 0 {
+		return ""
+	}
+
+	total := payouts[robber]
+	withheld, ok := creditPlayer(robber, total)
+	if !ok {
+		log.Printf("payBounties: Ошибка зачисления %d игроку %s за голову %s", total, robber, target)
+		return ""
+	}
+	log.Printf("payBounties: %s получил %d за голову %s (%d наград)", robber, total, target, len(taken))
+	return fmt.Sprintf("\n\n🎯 **НАГРАДА ЗА ГОЛОВУ!**\n💰 Вы получили %d %s за @%s (наград: %d)\n💵 Ваш баланс: %d %s",
+		total, getChipsWord(total), target, len(taken), playerBalances[robber], getChipsWord(playerBalances[robber])) +
+		formatWithheld(robber, withheld)
+}
+
+// Функция для возврата фишек за просроченные награды (возвращает снятые награды)
+func expireBounties() []Bounty {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	targets, err := redisClient.SMembers(ctx, bountyTargetsKey).Result()
+	if err != nil {
+		log.Printf("expireBounties: Ошибка чтения целей: %v", err)
+		return nil
+	}
+
+	var expired []Bounty
+	for _, target := range targets {
+		refunds, taken, err := takeBounties(target, func(bounty Bounty) (string, bool) {
+			return bounty.Placer, !time.Now().Before(bounty.ExpiresAt)
+		})
+		if err != nil {
+			log.Printf("expireBounties: Ошибка возврата наград за %s: %v", target, err)
+			continue
+		}
+		// Возврат своих же фишек - не доход, взыскание по штрафу не применяется
+		for username, amount := range refunds {
+			changeBalance(username, amount)
+		}
+		expired = append(expired, taken...)
+	}
+
+	if len(expired) > 0 {
+		log.Printf("expireBounties: Возвращено %d просроченных наград", len(expired))
+	}
+	return expired
+}
+
+// Функция для периодического возврата просроченных наград с уведомлением в чат (возврат выполняется в основном цикле)
+func watchBountyExpiry(bot *tgbotapi.BotAPI) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		runOnMainLoop(func() { refundExpiredBounties(bot) })
+	}
+}
+
+// Функция для возврата просроченных наград и уведомления тех, кто их назначал
+func refundExpiredBounties(bot *tgbotapi.BotAPI) {
+	for _, bounty := range expireBounties() {
+		notice := tgbotapi.NewMessage(bounty.ChatID, fmt.Sprintf("⌛ @%s, награда %d %s за голову @%s истекла - фишки возвращены.",
+			bounty.Placer, bounty.Amount, getChipsWord(bounty.Amount), bounty.Target))
+		if _, err := bot.Send(notice); err != nil {
+			log.Printf("refundExpiredBounties: Ошибка уведомления %s: %v", bounty.Placer, err)
+		}
+	}
+}
+
+// Функция для форматирования доски наград (/bounties)
+func formatBountyBoard() string {
+	if redisClient == nil {
+		return "🚫 Доска наград недоступна"
+	}
+
+	ctx := context.Background()
+	targets, err := redisClient.SMembers(ctx, bountyTargetsKey).Result()
+	if err != nil {
+		log.Printf("formatBountyBoard: Ошибка чтения целей: %v", err)
+		return "🚫 Не удалось загрузить доску наград"
+	}
+
+	type targetTotal struct {
+		target  string
+		total   int
+		count   int
+		nearest time.Time
+	}
+	var totals []targetTotal
+	for _, target := range targets {
+		entry := targetTotal{target: target}
+		for _, bounty := range getBounties(target) {
+			if !time.Now().Before(bounty.ExpiresAt) {
+				continue
+			}
+			entry.total += bounty.Amount
+			entry.count++
+			if entry.nearest.IsZero() {
+				entry.nearest = bounty.ExpiresAt
+			}
+		}
+		if entry.count > 0 {
+			totals = append(totals, entry)
+		}
+	}
+	if len(totals) == 0 {
+		return "🎯 ДОСКА НАГРАД\n\nНаград пока нет.\n\n💰 Назначить: /bounty @username сумма"
+	}
+
+	sort.Slice(totals, func(i, j int) bool { return totals[i].total > totals[j].total })
+	text := "🎯 ДОСКА НАГРАД\n"
+	for i, entry := range totals {
+		text += fmt.Sprintf("\n%d. @%s - %d %s (наград: %d, ближайшая истекает %s)",
+			i+1, entry.target, entry.total, getChipsWord(entry.total), entry.count, entry.nearest.Format("02.01 15:04"))
+	}
+	text += "\n\n🔫 Награду забирает первый, кто успешно ограбит цель через /rob или /platerob"
+	return text
+}
+
+// Структура для элемента инвентаря
+type InventoryItem struct {
+	PrizeID   string `json:"prizeId,omitempty"` // id приза в каталоге: название берется из каталога, переименование не трогает инвентари
+	PrizeName string `json:"prizeName"`
+	Rarity    string `json:"rarity"`
+	Cost      int    `json:"cost"`
+	Count     int    `json:"count"`
+	Hash      string `json:"hash"`                // Уникальный хэш предмета для продажи
+	Source    string `json:"source,omitempty"`    // Ящик, из которого получена плашка (выкупается дешевле)
+	Serial    int    `json:"serial,omitempty"`    // Номер экземпляра лимитированной плашки
+	MaxSupply int    `json:"maxSupply,omitempty"` // Тираж лимитированной плашки
+}
+
+// Функция для форматирования названия предмета с номером экземпляра ("Плашка #3/10")
+func formatItemName(item InventoryItem) string {
+	if item.Serial > 0 && item.MaxSupply > 0 {
+		return fmt.Sprintf("%s #%d/%d", item.PrizeName, item.Serial, item.MaxSupply)
+	}
+	return item.PrizeName
+}
+
+// Rarity представляет редкость предмета (название уровня из rarityTiers)
+type Rarity string
+
+// GenerateRandomRarity генерирует случайную редкость пропорционально весам уровней rarityTiers
+// (по умолчанию common 80, rare 15, legendary 6)
+func GenerateRandomRarity() Rarity {
+	if len(rarityTiers) == 0 {
+		return Rarity(defaultRarityTiers[0].Name)
+	}
+
+	// Выбираем редкость пропорционально весам уровней
+	weights := make([]int, len(rarityTiers))
+	for i, tier := range rarityTiers {
+		weights[i] = tier.Weight
+	}
+
+	return Rarity(rarityTiers[gamble.WeightedIndex(weights)].Name)
+}
+
+// Ключ Redis-хэша счетчиков игр без легендарной плашки (поле: ID чата)
+const pityKey = "pity"
+
+// Функция для выбора редкости плашки с учетом гаранта легендарки в чате
+func rollRarityForChat(chatID int64) Rarity {
+	if redisClient == nil || pityConfig == nil || pityConfig.Step <= 0 {
+		return GenerateRandomRarity()
+	}
+
+	ctx := context.Background()
+	field := strconv.FormatInt(chatID, 10)
+	gamesWithoutLegendary, err := redisClient.HGet(ctx, pityKey, field).Int()
+	if err != nil && err != redis.Nil {
+		log.Printf("rollRarityForChat: Ошибка чтения счетчика для чата %d: %v", chatID, err)
+	}
+
+	legendary := topRarity()
+	rarity := GenerateRandomRarity()
+	if rarity != legendary && gamesWithoutLegendary >= pityConfig.Threshold {
+		bonus := (gamesWithoutLegendary - pityConfig.Threshold + 1) * pityConfig.Step
+		if gamble.RollPercent() < bonus {
+			log.Printf("rollRarityForChat: Сработал гарант легендарки в чате %d (%d игр без легендарки, бонус %d%%)", chatID, gamesWithoutLegendary, bonus)
+			rarity = legendary
+		}
+	}
+
+	return rarity
+}
+
+// Функция для обновления счетчика гаранта после выдачи плашки (по фактически выданной редкости)
+func recordPityResult(chatID int64, awarded Rarity) {
+	if redisClient == nil || pityConfig == nil || pityConfig.Step <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	field := strconv.FormatInt(chatID, 10)
+	var err error
+	if awarded == topRarity() {
+		err = redisClient.HDel(ctx, pityKey, field).Err()
+	} else {
+		err = redisClient.HIncrBy(ctx, pityKey, field, 1).Err()
+	}
+	if err != nil {
+		log.Printf("recordPityResult: Ошибка сохранения счетчика для чата %d: %v", chatID, err)
+	}
+}
+
+// Переменные для управления игрой
+var gameMessageID int
+var gameChatID int64
+var isGameActive bool
+var gameInProgress bool  // Флаг, что идет процесс игры (чтобы предотвратить запуск нескольких игр)
+var gameCancel chan bool // Канал для отмены активной игры
+var totalRounds int
+var currentRound int
+var bettingPhase string
+var currentGameNumber int64 // Порядковый номер текущей игры (для истории предметов)
+
+// Задачи фоновых горутин, которые выполняются в основном цикле обработки обновлений.
+// Балансы, банк и штрафы хранятся в обычных картах, поэтому менять их можно только из основного цикла
+var mainLoopTasks = make(chan func(), 64)
+
+// Функция для передачи задачи в основной цикл (вызывается из фоновых горутин)
+func runOnMainLoop(task func()) {
+	mainLoopTasks <- task
+}
+
+// Переменные для управления ставками
+var initialBets = make(map[string]Bet)  // Ставки на начальном этапе (ключ: username игрока)
+var finalBets = make(map[string]Bet)    // Ставки на финальном этапе (ключ: username игрока)
+var bettingParticipants []string        // Участники для ставок (сортированные алфавитно)
+var initialBettingParticipants []string // Сохраняем первоначальный список для ставок
+var finalBettingNumbers []int           // Номера для финальных ставок
+
+// Map для хранения username/ID участников (ключ: имя, значение: user ID)
+// ТЕСТОВЫЙ СПИСОК ИЗ 5 УЧАСТНИКОВ
+var participantIDs = map[string]string{
+	"Арсений Квятковский": "Arsenkwait",
+	"Василий Гончаров":    "BroisHelmut",
+	"Виктория Григорьева": "sweerty_yv",
+	"Владислав Рыбаков":   "mbr3unk",
+	"Глеб Сушкевич":       "glbmsk",
+	"Дарья Шилина":        "quasarqs0",
+	"Екатерина Гнедова":   "Katharina_gn",
+	"Игнат Пикта":         "LilakGnatius",
+	"Максим Хваль":        "Whereisthesenses",
+	"Мария Князькова":     "tomazzeto",
+	"Назар Закревский":    "Zakrevski_05",
+	"Настя Павлюченко":    "kuvillin",
+	"Никита Янович":       "nktstrltz",
+	"Ольга Легостаева":    "legostaevaa",
+	"Ольга Васильева":     "olgavas8",
+	"Рома Болдырев":       "woistmeinemutter",
+	"Софья Цыбукова":      "Stelul003",
+	"Вероника Войтех":     "veronikavoiteh",
+	"Юля Луцевич":         "iuliia_lutsevich",
+	"Глеб Гусев":          "hunnidstooblue",
+	"Никита Шакалов":      "iamnothiding",
+	"Алексей Баранов":     "barrrraaa",
+}
+
+// Map для хранения хэшей участников (ключ: имя участника, значение: SHA-256 хэш)
+var participantHashes = make(map[string]string)
+var eliminatedParticipants []string // Выбывшие участники
+
+// Map для хранения балансов игроков (ключ: username, значение: баланс)
+var playerBalances = make(map[string]int)
+var playerBanks = make(map[string]int)
+var playerFines = make(map[string]int)           // Штрафы за ограбления (ключ: username, значение: сумма штрафа)
+var playerFineDates = make(map[string]time.Time) // Дата последнего обновления штрафа
+
+// Структура для личных ограничений азартных игр (ответственная игра)
+type GamblingLimits struct {
+	DailyLossLimit    int                     `json:"dailyLossLimit,omitempty"`  // Лимит проигрыша за день (0 - без лимита)
+	WeeklyLossLimit   int                     `json:"weeklyLossLimit,omitempty"` // Лимит проигрыша за 7 дней (0 - без лимита)
+	MaxStake          int                     `json:"maxStake,omitempty"`        // Максимальная ставка (0 - без лимита)
+	CoinCooldown      int                     `json:"coinCooldown,omitempty"`    // Пауза между /coin в секундах (0 - без паузы)
+	SelfExcludedUntil time.Time               `json:"selfExcludedUntil"`         // Самоисключение из /bet, /coin и /rob до этой даты
+	LastCoinAt        time.Time               `json:"lastCoinAt"`                // Время последнего броска монеты
+	DailyResults      map[string]int          `json:"dailyResults,omitempty"`    // Чистый результат игр по дням (ключ: 2006-01-02)
+	PendingLimits     map[string]PendingLimit `json:"pendingLimits,omitempty"`   // Ослабления лимитов, ожидающие окончания паузы (ключ: daily, weekly, stake, cooldown)
+}
+
+// Структура для отложенного ослабления лимита
+type PendingLimit struct {
+	Value   int       `json:"value"`   // Новое значение (0 - без лимита)
+	ApplyAt time.Time `json:"applyAt"` // Время вступления в силу
+}
+
+// Пауза перед вступлением в силу повышения или снятия лимита (ужесточение действует сразу)
+const limitCoolingOff = 24 * time.Hour
+
+// Map для хранения ограничений игроков (ключ: username)
+var playerLimits = make(map[string]GamblingLimits)
+
+// Redis клиент для персистентного хранения балансов
+var redisClient *redis.Client
+
+// Цитаты для команды /giveplate
+var giveplateQuotes = []string{
+	"💝 Щедрость - это добродетель!",
+	"🎁 Дарение - это искусство делиться радостью!",
+	"❤️ Лучше отдать, чем держать при себе!",
+	"🤝 Настоящая дружба - это когда делишься самым ценным!",
+	"✨ Щедрость возвращается сторицей!",
+	"🌟 Поделись счастьем с друзьями!",
+	"💎 Драгоценности ценнее, когда ими делятся!",
+	"🎉 Пусть каждый подарок принесет улыбку!",
+	"🌈 Щедрость окрашивает мир в яркие цвета!",
+	"💫 Дарить - значит любить!",
+	"🎊 Пусть этот подарок станет началом чего-то прекрасного!",
+	"🌸 Щедрость - цветок, который никогда не вянет!",
+	"🎨 Твори добро - делись красотой!",
+	"🌟 Звезды светят ярче, когда ими делятся!",
+	"💫 Волшебство начинается с щедрости!",
+	"🎭 Жизнь - это театр, а щедрость - лучший спектакль!",
+	"🌺 Пусть этот дар расцветет в сердце друга!",
+	"🎪 Цирк жизни: щедрость - главный артист!",
+	"🌙 Под луной щедрости все желания сбываются!",
+	"🎨 Палитра жизни ярче от щедрых мазков!",
+	"🌟 Звездопад щедрости освещает путь к счастью!",
+	"💫 Магия дарения: один подарок - тысяча улыбок!",
+	"🎭 Театр жизни: щедрость - лучший режиссер!",
+	"🌺 Сад души расцветает от семян щедрости!",
+	"🎪 Шапито чудес: щедрость - главный фокусник!",
+}
+
+// Функция для выбора случайной цитаты для /giveplate
+func getRandomGiveplateQuote() string {
+	if len(giveplateQuotes) == 0 {
+		return "💝 Щедрость - это добродетель!"
+	}
+	randomIndex := crand.Intn(len(giveplateQuotes))
+	return giveplateQuotes[randomIndex]
+}
+
+// Цитаты для доски позора должников
+var shameBoardQuotes = []string{
+	"🚨 ПОЗОР! Должник номер один в списке неплательщиков!",
+	"⚡ КАКОЙ СТЫД! Общественный враг номер один!",
+	"🏛️ БЕЗСОВЕСТНЫЙ! Позорит всю страну своими долгами!",
+	"🚔 КРИМИНАЛ! Худший должник в истории!",
+	"⚖️ СТЫД И ПОЗОР! Предатель коллектива и государства!",
+	"🏛️ ОБЩЕСТВО В ШОКЕ! Такого должника еще не было!",
+	"🚨 БЕЗДУШНЫЙ! Все платят, а этот - чемпион по долгам!",
+	"⚖️ КАКОЕ БЕЗОБРАЗИЕ! Рекордсмен по безответственности!",
+	"🏛️ ПОЗОР ДЛЯ СЕМЬИ! Дети такого должника страдают!",
+	"🚔 КРИМИНАЛЬНЫЙ ЭЛЕМЕНТ! Угроза экономической безопасности!",
+	"⚡ НРАВСТВЕННЫЙ УРОД! Долги - это его хобби!",
+	"⚖️ ОБЩЕСТВЕННЫЙ ВРАГ! Номера один в списке позора!",
+	"🏛️ ТЫ СЛИШКОМ НИЗКО ПАЛ! Дно должников!",
+	"🚨 СТЫДНО ДО СЛЁЗ! Чемпион среди неплательщиков!",
+	"⚡ ПОЛНОЕ РАЗОЧАРОВАНИЕ! Образец для антигероев!",
+	"🏛️ ПОЗОР ДЛЯ КОЛЛЕКТИВА! Все краснеют за такого!",
+	"🚔 КРИМИНАЛ И ДОЛГИ! Двойная угроза обществу!",
+	"⚖️ НИКАКОЙ СОВЕСТИ! Долги превышают все нормы!",
+	"🏛️ ОБЩЕСТВО ОСЖДАЕТ! Исправься, позор коллектива!",
+	"🚨 КАКОЙ КОНФУЗ! Рекордсмен по аморальности!",
+	"⚡ ПОТЕРЯЛ СОВЕСТЬ! Долги - его главное достижение!",
+	"⚖️ СТЫДНЫЙ РЕКОРД! Никто не должен повторять!",
+	"🏛️ БЕЗ ЧЕСТИ И СОВЕСТИ! Абсолютный чемпион по долгам!",
+	"🚔 КРИМИНАЛЬНАЯ НАТУРА! Долги - его вторая натура!",
+	"⚡ БЕЗ ПРИНЦИПОВ! Долги - это его философия!",
+}
+
+// Агрессивные цитаты для должников при грабеже
+var debtRobQuotes = []string{
+	"🚨 ПОЗОР! Должник взялся за грабёж вместо оплаты долгов!",
+	"⚡ КАКОЙ СТЫД! Ты должен государству, а грабишь честных людей!",
+	"🏛️ БЕЗСОВЕСТНЫЙ! Оплати штрафы, прежде чем позорить общество!",
+	"🚔 КРИМИНАЛ! Долги не платит, зато грабит - это же аморально!",
+	"⚖️ СТЫД И ПОЗОР! Ты предатель коллектива, должник-грабитель!",
+	"⚡ НИЧЕГО СВЯТОГО! Даже долг не остановил тебя от преступления!",
+	"🏛️ ОБЩЕСТВО В ШОКЕ! Должник вместо исправления - грабит!",
+	"🚨 БЕЗДУШНЫЙ! Другие платят штрафы, а ты грабишь их!",
+	"⚖️ КАКОЕ БЕЗОБРАЗИЕ! Должник позорит честь гражданина!",
+	"🏛️ ПОТЕРЯЛ СОВЕСТЬ! Оплати долги, потом грабь если хочешь!",
+	"🚔 КРИМИНАЛЬНЫЙ ЭЛЕМЕНТ! Долги не пугают, зато грабёж - да!",
+	"⚡ НРАВСТВЕННЫЙ УРОД! Должник - и грабитель одновременно!",
+	"⚖️ ОБЩЕСТВЕННЫЙ ВРАГ! Не платишь штрафы, зато обворовываешь!",
+	"🏛️ ТЫ СЛИШКОМ НИЗКО ПАЛ! Должник взялся за уголовщину!",
+	"🚨 СТЫДНО ДО СЛЁЗ! Грабить, имея долги перед государством!",
+	"⚡ БЕЗ ПРИНЦИПОВ! Долги - фигня, главное - награбить!",
+	"🏛️ ПОЗОР ДЛЯ СЕМЬИ! Должник позорит всех родственников!",
+	"🚔 КРИМИНАЛ И ДОЛГИ! Ты - угроза обществу!",
+	"⚖️ НИКАКОЙ СОВЕСТИ! Грабит тех, кто честно работает!",
+	"🏛️ ОБЩЕСТВО ОСЖДАЕТ! Исправься, должник-грабитель!",
+	"🚨 КАКОЙ КОНФУЗ! Должник вместо оплаты - ворует!",
+	"⚡ ПОЛНОЕ РАЗОЧАРОВАНИЕ! Ты подвёл весь коллектив!",
+	"⚖️ СТЫДНЫЙ ПОСТУПОК! Долги не мешают тебе грабить!",
+	"🏛️ БЕЗ ЧЕСТИ И СОВЕСТИ! Должник - уголовник!",
+	"🚔 КРИМИНАЛЬНАЯ НАТУРА! Даже штрафы не останавливают!",
+}
+
+// Цитаты про долг/закон в духе СССР
+var debtQuotes = []string{
+	"⚖️ Долг перед законом - святое дело! Выполняй свой гражданский долг!",
+	"🚔 Законопослушный гражданин не имеет долгов перед государством!",
+	"⚡ В нашем обществе долги - это позор! Расплатись и живи с чистой совестью!",
+	"🏛️ Государство в тебя верит! Оплати штрафы и будь примером для других!",
+	"⚖️ Закон - это основа нашего общества! Не позорь свою страну долгами!",
+	"🚨 Долги - это цепи, которые сковывают свободного человека!",
+	"⚡ Выполняй свои обязательства перед обществом! Оплати штрафы!",
+	"🏛️ Чистота перед законом - залог счастливой жизни!",
+	"⚖️ В нашем государстве долги - это преступление против общества!",
+	"🚔 Закон суров, но справедлив! Расплатись с долгами!",
+	"⚖️ Долги - это яд для души! Очистись от них законом!",
+	"🏛️ В социалистическом обществе долг - это предательство идеалов!",
+	"⚡ Государство не прощает должников! Исправься немедленно!",
+	"🚨 Долги калечат человека! Будь достойным гражданином!",
+	"⚖️ Закон - твой друг! Он поможет избавиться от долгов!",
+	"🏛️ Общество осуждает должников! Встань на путь исправления!",
+	"🚔 Долги - это кандалы на ногах прогресса!",
+	"⚡ Каждый рубль долга - это удар по твоей чести!",
+	"⚖️ Справедливость требует оплаты долгов! Не медли!",
+	"🏛️ Государство протягивает руку помощи, но требует дисциплины!",
+	"🚨 Должник - это позор для коллектива! Исправься!",
+	"⚖️ Закон карает, но и милует! Оплати долги и живи свободно!",
+	"🏛️ В нашем обществе долг - это не норма, а исключение!",
+	"⚡ Долги мешают строить коммунизм! Расплатись!",
+	"🚔 Закон - это справедливость! Он защитит тебя от долгов!",
+	"⚖️ Долги - это бремя для общества! Сними его с плеч народа!",
+	"🏛️ Государство верит в твоё исправление! Оплати штрафы!",
+	"🚨 Должник теряет доверие коллектива! Восстанови его!",
+	"⚡ Закон требует справедливости! Оплати свои долги!",
+	"⚖️ В социалистическом праве долг - это несчастье, которое можно исправить!",
+	"🏛️ Общество ждёт твоего возвращения к честной жизни!",
+	"🚔 Долги - это тень на твоей репутации! Рассеи её!",
+	"⚡ Государство поможет тебе, но ты должен помочь себе!",
+	"⚖️ Закон - это свет справедливости! Следуй за ним!",
+	"🏛️ Долги - это преграда на пути к счастью!",
+	"🚨 Исправься перед законом и обществом!",
+	"⚡ Должник - это человек, который сам себя наказывает!",
+	"⚖️ Справедливость восторжествует! Оплати долги!",
+	"🏛️ Государство даёт второй шанс! Не упусти его!",
+	"🚔 Закон суров к должникам, но справедлив к исправляющимся!",
+	"⚡ Долги - это болезнь души! Вылечи её законом!",
+	"⚖️ В нашем обществе долг - это вызов системе!",
+	"🏛️ Общество простит, но требует исправления!",
+	"🚨 Должник - это слабое звено! Стань сильнее!",
+	"⚡ Закон - это справедливый судья! Он ждёт твоего раскаяния!",
+	"⚖️ Долги мешают мирному труду! Освободись от них!",
+	"🏛️ Государство заботится о каждом гражданине! Заботься о долгах!",
+	"🚔 Законопослушание - основа счастья! Начни с оплаты штрафов!",
+	"⚡ Долги - это цепи капитализма! Сбрось их!",
+	"⚖️ Справедливость требует дисциплины! Будь дисциплинирован!",
+	"🏛️ В социализме долг - это ошибка, которую можно исправить!",
+	"🚨 Государство поможет тебе встать на путь истинный!",
+	"⚡ Закон - это твоя защита от долгов и бед!",
+	"⚖️ Долги - это бремя прошлого! Создай светлое будущее!",
+	"🏛️ Общество ждёт твоего вклада! Оплати долги и внеси его!",
+}
+
+// Функция для выбора случайной цитаты про долг
+func getRandomDebtQuote() string {
+	if len(debtQuotes) == 0 {
+		return "⚖️ Оплати свои долги перед законом!"
+	}
+	randomIndex := crand.Intn(len(debtQuotes))
+	return debtQuotes[randomIndex]
+}
+
+// Функция для выбора случайной агрессивной цитаты для должника при грабеже
+func getRandomDebtRobQuote() string {
+	if len(debtRobQuotes) == 0 {
+		return "🚨 ПОЗОР! Должник взялся за грабёж вместо оплаты долгов!"
+	}
+	randomIndex := crand.Intn(len(debtRobQuotes))
+	return debtRobQuotes[randomIndex]
+}
+
+// Функция для выбора случайной цитаты позора для доски позора
+func getRandomShameQuote() string {
+	if len(shameBoardQuotes) == 0 {
+		return "🚨 ПОЗОР! Должник в списке неплательщиков!"
+	}
 	randomIndex := crand.Intn(len(shameBoardQuotes))
 	return shameBoardQuotes[randomIndex]
 }
 
-// Функция для проверки большого долга (>10000)
-func checkLargeDebt(userName string) (hasLargeDebt bool, debtAmount int) {
-	debtAmount = playerFines[userName]
-	return debtAmount > 10000, debtAmount
+// Функция для проверки большого долга (>10000)
+func checkLargeDebt(userName string) (hasLargeDebt bool, debtAmount int) {
+	debtAmount = playerFines[userName]
+	return debtAmount > 10000, debtAmount
+}
+
+// Функция для добавления уведомления о долге к сообщению
+func addDebtNotificationToMessage(userName string, messageText string) string {
+	if hasLargeDebt, debtAmount := checkLargeDebt(userName); hasLargeDebt {
+		return fmt.Sprintf("⚠️ **ДОЛГ ПО ШТРАФУ: %d %s**\n💸 Выплатить: /payfine\n\n%s\n\n%s",
+			debtAmount, getChipsWord(debtAmount), getRandomDebtQuote(), messageText)
+	}
+	return messageText
+}
+
+// Функция для разбора длительности с поддержкой дней (например: 30m, 12h, 7d)
+func parseDurationWithDays(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("некорректное количество дней: %s", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("некорректная длительность: %s", value)
+	}
+	return duration, nil
+}
+
+// Функция для сохранения ограничений игрока в Redis
+func saveLimitsToRedis(username string) {
+	if redisClient == nil {
+		return
+	}
+
+	data, err := json.Marshal(playerLimits[username])
+	if err != nil {
+		log.Printf("saveLimitsToRedis: Ошибка маршалинга ограничений %s: %v", username, err)
+		return
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("limits:%s", username)
+	if err := redisClient.Set(ctx, key, data, 0).Err(); err != nil {
+		log.Printf("saveLimitsToRedis: Ошибка сохранения ограничений %s: %v", username, err)
+	}
+}
+
+// Функция для загрузки ограничений всех игроков из Redis
+func loadAllLimitsFromRedis() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "limits:*")
+	if err != nil {
+		log.Printf("Ошибка загрузки ограничений из Redis: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "limits:")
+		val, err := redisClient.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+
+		var limits GamblingLimits
+		if err := json.Unmarshal([]byte(val), &limits); err != nil {
+			log.Printf("Ошибка парсинга ограничений %s: %v", username, err)
+			continue
+		}
+		playerLimits[username] = limits
+	}
+
+	log.Printf("Загружено %d профилей ограничений из Redis", len(playerLimits))
+}
+
+// Функция для получения указателя на значение лимита по названию настройки
+func limitField(limits *GamblingLimits, setting string) *int {
+	switch setting {
+	case "daily":
+		return &limits.DailyLossLimit
+	case "weekly":
+		return &limits.WeeklyLossLimit
+	case "stake":
+		return &limits.MaxStake
+	case "cooldown":
+		return &limits.CoinCooldown
+	}
+	return nil
+}
+
+// Функция для проверки, ослабляет ли новое значение лимит (0 - без лимита; для паузы /coin ослабление - уменьшение)
+func isLimitLoosening(setting string, current, value int) bool {
+	if current <= 0 {
+		return false
+	}
+	if value <= 0 {
+		return true
+	}
+	if setting == "cooldown" {
+		return value < current
+	}
+	return value > current
+}
+
+// Функция для применения отложенных ослаблений лимитов, у которых закончилась пауза
+func applyPendingLimits(username string) {
+	limits := playerLimits[username]
+	if len(limits.PendingLimits) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for setting, pending := range limits.PendingLimits {
+		if now.Before(pending.ApplyAt) {
+			continue
+		}
+		if field := limitField(&limits, setting); field != nil {
+			*field = pending.Value
+			log.Printf("applyPendingLimits: %s: %s = %d вступило в силу", username, setting, pending.Value)
+		}
+		delete(limits.PendingLimits, setting)
+	}
+
+	playerLimits[username] = limits
+	saveLimitsToRedis(username)
+}
+
+// Функция для подсчета проигрыша игрока за сегодня и за последние 7 дней
+func getGamblingLosses(username string) (dailyLoss int, weeklyLoss int) {
+	limits := playerLimits[username]
+	now := time.Now()
+
+	weeklyNet := 0
+	for i := 0; i < 7; i++ {
+		day := now.AddDate(0, 0, -i).Format("2006-01-02")
+		weeklyNet += limits.DailyResults[day]
+	}
+
+	dailyNet := limits.DailyResults[now.Format("2006-01-02")]
+	if dailyNet < 0 {
+		dailyLoss = -dailyNet
+	}
+	if weeklyNet < 0 {
+		weeklyLoss = -weeklyNet
+	}
+	return dailyLoss, weeklyLoss
+}
+
+// Функция для учета результата азартной игры (отрицательная сумма - проигрыш)
+func recordGamblingResult(username string, amount int) {
+	limits := playerLimits[username]
+	if limits.DailyResults == nil {
+		limits.DailyResults = make(map[string]int)
+	}
+
+	now := time.Now()
+	limits.DailyResults[now.Format("2006-01-02")] += amount
+
+	// Удаляем записи старше недели
+	weekAgo := now.AddDate(0, 0, -7).Format("2006-01-02")
+	for day := range limits.DailyResults {
+		if day < weekAgo {
+			delete(limits.DailyResults, day)
+		}
+	}
+
+	playerLimits[username] = limits
+	saveLimitsToRedis(username)
+}
+
+// Функция для проверки самоисключения игрока
+func checkSelfExclusion(username string) (isExcluded bool, until time.Time) {
+	until = playerLimits[username].SelfExcludedUntil
+	return time.Now().Before(until), until
+}
+
+// Функция для централизованной проверки ограничений перед ставкой (game: "bet" или "coin")
+func checkGamblingAllowed(username string, stake int, game string) error {
+	applyPendingLimits(username)
+	limits := playerLimits[username]
+
+	if err := checkNotJailed(username); err != nil {
+		return err
+	}
+
+	if isExcluded, until := checkSelfExclusion(username); isExcluded {
+		return fmt.Errorf("🚫 Вы исключили себя из азартных игр до %s.\n\n🧘 Досрочно снять самоисключение нельзя.",
+			until.Format("02.01.2006 15:04"))
+	}
+
+	if game == "coin" && limits.CoinCooldown > 0 {
+		nextCoinAt := limits.LastCoinAt.Add(time.Duration(limits.CoinCooldown) * time.Second)
+		if time.Now().Before(nextCoinAt) {
+			wait := int(time.Until(nextCoinAt).Seconds()) + 1
+			return fmt.Errorf("⏳ Пауза между бросками монеты! Подождите ещё %d сек.\n\n⚙️ Настройки: /limits", wait)
+		}
+	}
+
+	if until, bankrupt := getBankruptUntil(username); bankrupt && stake > economyConfig.Bankruptcy.MaxStake {
+		return fmt.Errorf("⚖️ Вы банкрот до %s! Максимальная ставка: %d %s",
+			until.Format("02.01.2006"), economyConfig.Bankruptcy.MaxStake, getChipsWord(economyConfig.Bankruptcy.MaxStake))
+	}
+
+	if limits.MaxStake > 0 && stake > limits.MaxStake {
+		return fmt.Errorf("🚫 Ставка %d %s превышает ваш лимит ставки (%d %s)!\n\n⚙️ Настройки: /limits",
+			stake, getChipsWord(stake), limits.MaxStake, getChipsWord(limits.MaxStake))
+	}
+
+	dailyLoss, weeklyLoss := getGamblingLosses(username)
+	if limits.DailyLossLimit > 0 && dailyLoss+stake > limits.DailyLossLimit {
+		return fmt.Errorf("🚫 Дневной лимит проигрыша достигнут!\n\n📉 Проиграно сегодня: %d %s\n🛑 Лимит: %d %s\n💰 Ставка: %d %s\n\n⚙️ Настройки: /limits",
+			dailyLoss, getChipsWord(dailyLoss), limits.DailyLossLimit, getChipsWord(limits.DailyLossLimit), stake, getChipsWord(stake))
+	}
+	if limits.WeeklyLossLimit > 0 && weeklyLoss+stake > limits.WeeklyLossLimit {
+		return fmt.Errorf("🚫 Недельный лимит проигрыша достигнут!\n\n📉 Проиграно за 7 дней: %d %s\n🛑 Лимит: %d %s\n💰 Ставка: %d %s\n\n⚙️ Настройки: /limits",
+			weeklyLoss, getChipsWord(weeklyLoss), limits.WeeklyLossLimit, getChipsWord(limits.WeeklyLossLimit), stake, getChipsWord(stake))
+	}
+
+	return nil
+}
+
+// Функция для отметки броска монеты (для паузы между бросками)
+func markCoinToss(username string) {
+	limits := playerLimits[username]
+	limits.LastCoinAt = time.Now()
+	playerLimits[username] = limits
+	saveLimitsToRedis(username)
+}
+
+// Функция для форматирования текущих ограничений игрока
+func formatGamblingLimits(username string) string {
+	applyPendingLimits(username)
+	limits := playerLimits[username]
+	dailyLoss, weeklyLoss := getGamblingLosses(username)
+
+	limitText := func(value int) string {
+		if value <= 0 {
+			return "без лимита"
+		}
+		return fmt.Sprintf("%d %s", value, getChipsWord(value))
+	}
+
+	text := "⚙️ **ОТВЕТСТВЕННАЯ ИГРА**\n\n"
+	text += fmt.Sprintf("📅 Дневной лимит проигрыша: %s\n", limitText(limits.DailyLossLimit))
+	text += fmt.Sprintf("🗓️ Недельный лимит проигрыша: %s\n", limitText(limits.WeeklyLossLimit))
+	text += fmt.Sprintf("💰 Максимальная ставка: %s\n", limitText(limits.MaxStake))
+	if limits.CoinCooldown > 0 {
+		text += fmt.Sprintf("⏳ Пауза между /coin: %d сек.\n", limits.CoinCooldown)
+	} else {
+		text += "⏳ Пауза между /coin: нет\n"
+	}
+	if isExcluded, until := checkSelfExclusion(username); isExcluded {
+		text += fmt.Sprintf("🧘 Самоисключение до: %s\n", until.Format("02.01.2006 15:04"))
+	}
+	for _, setting := range []string{"daily", "weekly", "stake", "cooldown"} {
+		if pending, ok := limits.PendingLimits[setting]; ok {
+			value := limitText(pending.Value)
+			if setting == "cooldown" && pending.Value > 0 {
+				value = fmt.Sprintf("%d сек.", pending.Value)
+			}
+			text += fmt.Sprintf("🕒 %s -> %s с %s\n", setting, value, pending.ApplyAt.Format("02.01.2006 15:04"))
+		}
+	}
+
+	text += fmt.Sprintf("\n📉 Проиграно сегодня: %d %s\n", dailyLoss, getChipsWord(dailyLoss))
+	text += fmt.Sprintf("📉 Проиграно за 7 дней: %d %s\n", weeklyLoss, getChipsWord(weeklyLoss))
+
+	text += "\n📋 Команды:\n" +
+		"• /limits daily 5000 - дневной лимит проигрыша\n" +
+		"• /limits weekly 20000 - недельный лимит проигрыша\n" +
+		"• /limits stake 1000 - максимальная ставка\n" +
+		"• /limits cooldown 60 - пауза между /coin (сек)\n" +
+		"• /limits daily off - убрать лимит\n" +
+		"⚠️ Повышение и снятие лимита вступает в силу через 24 ч, понижение - сразу\n" +
+		"• /limits exclude 7d - самоисключение из /bet, /coin и /rob (снять досрочно нельзя!)"
+	return text
+}
+
+// Функция для перемешивания слайса с использованием crypto/rand
+func shuffleParticipants() {
+	for i := len(participants) - 1; i > 0; i-- {
+		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		j := int(randomIndex.Int64())
+		participants[i], participants[j] = participants[j], participants[i]
+	}
+}
+
+// Функция для генерации SHA-256 хэша участника
+func hashParticipant(name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return fmt.Sprintf("%x", hash)
+}
+
+// Ключ счетчика, из которого выдаются идентификаторы предметов
+const itemSeqKey = "items:seq"
+
+// Смещение счетчика, чтобы идентификаторы были не короче 4 символов (36^3 = "1000")
+const itemIDOffset = 36 * 36 * 36
+
+// Функция для получения ключа глобальной записи о предмете (не зависит от владельца)
+func itemRecordKey(itemID string) string {
+	return fmt.Sprintf("item:%s", itemID)
+}
+
+// Функция для выдачи нового глобально уникального идентификатора предмета
+func generateItemID(owner string, item InventoryItem) (string, error) {
+	if redisClient == nil {
+		return "", fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	for attempt := 0; attempt < 10; attempt++ {
+		seq, err := redisClient.Incr(ctx, itemSeqKey).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to get next item id: %v", err)
+		}
+		itemID := strconv.FormatInt(seq+itemIDOffset, 36)
+
+		// Резервируем запись о предмете; если она уже есть - идентификатор занят
+		created, err := redisClient.HSetNX(ctx, itemRecordKey(itemID), "id", itemID).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to reserve item id: %v", err)
+		}
+		if !created {
+			log.Printf("generateItemID: Коллизия идентификатора %s (запись уже существует), пробуем следующий", itemID)
+			continue
+		}
+
+		// Старые 6-символьные хэши могли остаться в инвентарях без глобальной записи
+		if owned, _ := redisClient.HExists(ctx, itemOwnersKey, itemID).Result(); owned {
+			log.Printf("generateItemID: Коллизия идентификатора %s со старым предметом, пробуем следующий", itemID)
+			continue
+		}
+
+		record := map[string]interface{}{
+			"prizeName": item.PrizeName,
+			"rarity":    item.Rarity,
+			"cost":      item.Cost,
+			"owner":     owner,
+			"createdAt": time.Now().Unix(),
+		}
+		if item.Serial > 0 {
+			record["serial"] = item.Serial
+			record["maxSupply"] = item.MaxSupply
+		}
+		if item.PrizeID != "" {
+			record["prizeId"] = item.PrizeID
+		}
+		if item.Source != "" {
+			record["source"] = item.Source
+		}
+		err = redisClient.HSet(ctx, itemRecordKey(itemID), record).Err()
+		if err != nil {
+			return "", fmt.Errorf("failed to save item record: %v", err)
+		}
+
+		return itemID, nil
+	}
+
+	return "", fmt.Errorf("не удалось подобрать уникальный идентификатор предмета")
+}
+
+// ItemEvent - событие в истории владения предметом
+type ItemEvent struct {
+	Type string    `json:"type"` // won, bought, stolen, gifted, sold, used, split, crafted, opened
+	At   time.Time `json:"at"`
+	From string    `json:"from,omitempty"`
+	To   string    `json:"to,omitempty"`
+	Game int64     `json:"game,omitempty"`
+	Note string    `json:"note,omitempty"`
+}
+
+// Функция для получения ключа списка истории предмета
+func itemHistoryKey(itemID string) string {
+	return fmt.Sprintf("item:%s:history", itemID)
+}
+
+// Функция для добавления события в историю предмета (список только дополняется)
+func appendItemHistory(itemID string, event ItemEvent) {
+	if redisClient == nil || itemID == "" {
+		return
+	}
+
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("appendItemHistory: Ошибка маршалинга события для %s: %v", itemID, err)
+		return
+	}
+
+	ctx := context.Background()
+	if err := redisClient.RPush(ctx, itemHistoryKey(itemID), data).Err(); err != nil {
+		log.Printf("appendItemHistory: Ошибка сохранения события %s для %s: %v", event.Type, itemID, err)
+	}
+}
+
+// Функция для получения всей истории предмета
+func getItemHistory(itemID string) ([]ItemEvent, error) {
+	if redisClient == nil {
+		return nil, fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	values, err := redisClient.LRange(ctx, itemHistoryKey(itemID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item history: %v", err)
+	}
+
+	history := make([]ItemEvent, 0, len(values))
+	for _, val := range values {
+		var event ItemEvent
+		if err := json.Unmarshal([]byte(val), &event); err != nil {
+			log.Printf("getItemHistory: Ошибка распаковки события предмета %s: %v", itemID, err)
+			continue
+		}
+		history = append(history, event)
+	}
+
+	return history, nil
+}
+
+// Функция для переноса истории на предмет, отделенный от стопки с другим идентификатором
+func copyItemHistory(fromID, toID string) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	values, err := redisClient.LRange(ctx, itemHistoryKey(fromID), 0, -1).Result()
+	if err != nil || len(values) == 0 {
+		return
+	}
+
+	args := make([]interface{}, len(values))
+	for i, val := range values {
+		args[i] = val
+	}
+	if err := redisClient.RPush(ctx, itemHistoryKey(toID), args...).Err(); err != nil {
+		log.Printf("copyItemHistory: Ошибка копирования истории %s -> %s: %v", fromID, toID, err)
+	}
+}
+
+// Функция для форматирования события истории предмета
+func formatItemEvent(event ItemEvent) string {
+	date := event.At.Format("02.01.2006 15:04")
+	switch event.Type {
+	case "won":
+		if event.Game > 0 {
+			return fmt.Sprintf("🏆 %s: выиграна @%s в игре #%d", date, event.To, event.Game)
+		}
+		return fmt.Sprintf("🏆 %s: выиграна @%s", date, event.To)
+	case "bought":
+		return fmt.Sprintf("🛒 %s: куплена @%s в магазине", date, event.To)
+	case "stolen":
+		return fmt.Sprintf("🔫 %s: украдена у @%s игроком @%s", date, event.From, event.To)
+	case "gifted":
+		return fmt.Sprintf("🎁 %s: передана от @%s к @%s", date, event.From, event.To)
+	case "sold":
+		return fmt.Sprintf("💰 %s: продана игроком @%s", date, event.From)
+	case "used":
+		return fmt.Sprintf("🔧 %s: использована игроком @%s", date, event.From)
+	case "split":
+		return fmt.Sprintf("✂️ %s: отделена от стопки %s", date, event.Note)
+	case "opened":
+		return fmt.Sprintf("📦 %s: выпала @%s из ящика «%s»", date, event.To, event.Note)
+	case "crafted":
+		if event.To != "" {
+			return fmt.Sprintf("⚒️ %s: скрафчена @%s из %s", date, event.To, event.Note)
+		}
+		if event.Note != "" {
+			return fmt.Sprintf("🔥 %s: переплавлена @%s в %s", date, event.From, event.Note)
+		}
+		return fmt.Sprintf("💥 %s: сгорела при неудачном крафте у @%s", date, event.From)
+	default:
+		return fmt.Sprintf("• %s: %s", date, event.Type)
+	}
+}
+
+// Функция для получения глобальной записи о предмете по идентификатору
+func getItemRecord(itemID string) (map[string]string, error) {
+	if redisClient == nil {
+		return nil, fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	record, err := redisClient.HGetAll(ctx, itemRecordKey(itemID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item record: %v", err)
+	}
+	if len(record) == 0 {
+		return nil, fmt.Errorf("предмет %s не найден", itemID)
+	}
+	if name, ok := prizeNamesByID()[record["prizeId"]]; ok {
+		record["prizeName"] = name
+	}
+
+	return record, nil
+}
+
+// Функция для инициализации хэшей всех участников
+func initParticipantHashes() {
+	for name, username := range participantIDs {
+		participantHashes[name] = hashParticipant(username)
+	}
+}
+
+// Функция для форматирования имени участника
+func formatParticipantName(name string) string {
+	return name
+}
+
+// Функция для форматирования имени участника с @username
+func formatParticipantNameWithUsername(name string) string {
+	username := participantIDs[name]
+	baseName := name
+
+	if username != "" {
+		baseName = fmt.Sprintf("%s (@%s)", name, username)
+	}
+
+	// Проверяем, есть ли надетая плашка
+	if username != "" {
+		wornData, err := getWornItem(username)
+		if err == nil && wornData != nil {
+			// Добавляем плашку к имени
+			itemName := wornData["name"]
+			if wornData["serial"] != "" {
+				itemName += " " + wornData["serial"]
+			}
+			baseName = fmt.Sprintf("%s %s", baseName, itemName)
+		}
+	}
+
+	return baseName
+}
+
+// Функция для форматирования имени участника только с плашкой (без username)
+func formatParticipantNameWithItem(name string) string {
+	username := participantIDs[name]
+	baseName := name
+
+	// Проверяем, есть ли надетая плашка
+	if username != "" {
+		wornData, err := getWornItem(username)
+		if err == nil && wornData != nil {
+			// Добавляем плашку к имени
+			itemName := wornData["name"]
+			if wornData["serial"] != "" {
+				itemName += " " + wornData["serial"]
+			}
+			baseName = fmt.Sprintf("%s %s", baseName, itemName)
+		}
+	}
+
+	return baseName
+}
+
+// Функция для правильного склонения слова "фишка"
+func getChipsWord(count int) string {
+	lastDigit := count % 10
+	lastTwoDigits := count % 100
+
+	// Исключения для чисел 11-14
+	if lastTwoDigits >= 11 && lastTwoDigits <= 14 {
+		return "фишек"
+	}
+
+	// Основные правила
+	switch lastDigit {
+	case 1:
+		return "фишка"
+	case 2, 3, 4:
+		return "фишки"
+	default:
+		return "фишек"
+	}
+}
+
+// Функция для правильного склонения результатов броска монеты
+func getCoinResultText(result gamble.CoinResult) string {
+	switch result {
+	case gamble.Heads:
+		return "выпал орел (1)"
+	case gamble.Tails:
+		return "выпала решка (2)"
+	case gamble.Edge:
+		return "выпало ребро (3)"
+	default:
+		return fmt.Sprintf("выпала %s", result)
+	}
+}
+
+// Функция для преобразования цифры монеты в название
+func getCoinSideName(side string) string {
+	switch side {
+	case "1":
+		return "1 (орел)"
+	case "2":
+		return "2 (решка)"
+	case "3":
+		return "3 (ребро)"
+	default:
+		return side
+	}
+}
+
+// Функция для надевания плашки пользователем
+func wearItem(username, itemHash string) error {
+	log.Printf("wearItem: Пользователь %s надевает плашку с хэшем %s", username, itemHash)
+
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+
+	// Проверяем, есть ли такой предмет у пользователя
+	item, err := getInventoryItem(username, itemHash)
+	if err != nil {
+		log.Printf("wearItem: Предмет с хэшем %s не найден у пользователя %s: %v", itemHash, username, err)
+		return fmt.Errorf("предмет не найден в инвентаре")
+	}
+
+	// Сохраняем информацию о надетой плашке
+	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
+	wornData := map[string]string{
+		"hash":      itemHash,
+		"prizeId":   item.PrizeID,
+		"name":      item.PrizeName,
+		"rarity":    item.Rarity,
+		"timestamp": fmt.Sprintf("%d", time.Now().Unix()),
+	}
+	if item.Serial > 0 {
+		wornData["serial"] = fmt.Sprintf("#%d/%d", item.Serial, item.MaxSupply)
+	}
+
+	data, err := json.Marshal(wornData)
+	if err != nil {
+		log.Printf("wearItem: Ошибка маршалинга данных плашки: %v", err)
+		return fmt.Errorf("ошибка сохранения")
+	}
+
+	err = redisClient.Set(ctx, profileKey, data, 0).Err()
+	if err != nil {
+		log.Printf("wearItem: Ошибка сохранения надетой плашки: %v", err)
+		return fmt.Errorf("ошибка сохранения профиля")
+	}
+
+	log.Printf("wearItem: Плашка %s успешно надета пользователем %s", item.PrizeName, username)
+	return nil
+}
+
+// Функция для снятия плашки пользователем
+func unwearItem(username string) error {
+	log.Printf("unwearItem: Пользователь %s снимает плашку", username)
+
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
+
+	// Проверяем, есть ли надетая плашка
+	exists, err := redisClient.Exists(ctx, profileKey).Result()
+	if err != nil {
+		log.Printf("unwearItem: Ошибка проверки профиля: %v", err)
+		return fmt.Errorf("ошибка проверки профиля")
+	}
+
+	if exists == 0 {
+		log.Printf("unwearItem: У пользователя %s нет надетой плашки", username)
+		return fmt.Errorf("нет надетой плашки")
+	}
+
+	// Удаляем информацию о надетой плашке
+	err = redisClient.Del(ctx, profileKey).Err()
+	if err != nil {
+		log.Printf("unwearItem: Ошибка удаления надетой плашки: %v", err)
+		return fmt.Errorf("ошибка снятия плашки")
+	}
+
+	log.Printf("unwearItem: Плашка успешно снята у пользователя %s", username)
+	return nil
+}
+
+// Функция для получения информации о надетой плашке
+func getWornItem(username string) (map[string]string, error) {
+	if redisClient == nil {
+		return nil, fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
+
+	data, err := redisClient.Get(ctx, profileKey).Result()
+	if err != nil {
+		return nil, err // Возвращаем ошибку, если плашка не надета
+	}
+
+	var wornData map[string]string
+	err = json.Unmarshal([]byte(data), &wornData)
+	if err != nil {
+		log.Printf("getWornItem: Ошибка парсинга данных плашки для %s: %v", username, err)
+		return nil, err
+	}
+	if wornData["prizeId"] != "" {
+		if name, ok := prizeNamesByID()[wornData["prizeId"]]; ok {
+			wornData["name"] = name
+		}
+	}
+
+	return wornData, nil
+}
+
+// Функция для получения имени участника по username
+func getParticipantNameByUsername(username string) string {
+	for name, uname := range participantIDs {
+		if uname == username {
+			return name
+		}
+	}
+	return username // Если не найдено, возвращаем username
+}
+
+// Функция для выплаты выигрышей по ставкам и формирования текста результатов
+func payoutWinnings(bot *tgbotapi.BotAPI, winner string, loser string) string {
+	log.Printf("💰 payoutWinnings: === НАЧАЛО ВЫПЛАТЫ ВЫИГРЫШЕЙ ===")
+	log.Printf("payoutWinnings: Функция ВЫЗВАНА! Победитель: %s, Проигравший: %s", winner, loser)
+	log.Printf("payoutWinnings: isGameActive=%t", isGameActive)
+	log.Printf("payoutWinnings: Количество ставок - initial: %d, final: %d", len(initialBets), len(finalBets))
+
+	// DEBUG: Показать все ставки
+	log.Printf("payoutWinnings: DEBUG: Initial ставки:")
+	for username, bet := range initialBets {
+		log.Printf("payoutWinnings:   %s -> %s (хэш: %s)", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...")
+	}
+	log.Printf("payoutWinnings: DEBUG: Final ставки:")
+	for username, bet := range finalBets {
+		log.Printf("payoutWinnings:   %s -> %s (хэш: %s)", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...")
+	}
+
+	// DEBUG: Показать все хэши участников
+	log.Printf("payoutWinnings: DEBUG: Все хэши участников:")
+	for name, hash := range participantHashes {
+		log.Printf("payoutWinnings:   %s -> %s (username: %s)", name, hash[:8]+"...", participantIDs[name])
+	}
+
+	// Всегда формируем сообщение с результатами ставок
+	resultsText := "🏆 РЕЗУЛЬТАТЫ СТАВОК:\n\n"
+
+	// Если нет ставок, все равно показываем сообщение с результатами
+	if len(initialBets) == 0 && len(finalBets) == 0 {
+		log.Printf("payoutWinnings: ❌ Нет ставок для обработки")
+		resultsText += "❌ В этом раунде ставок не было сделано.\n"
+		log.Printf("payoutWinnings: Возвращаем сообщение без ставок: '%s'", resultsText)
+		return resultsText
+	}
+
+	log.Printf("payoutWinnings: ✅ Есть ставки для обработки")
+
+	// Получаем хэш победителя
+	winnerHash := participantHashes[winner]
+	if winnerHash == "" {
+		log.Printf("payoutWinnings: Ошибка: хэш победителя %s не найден", winner)
+		log.Printf("payoutWinnings: DEBUG: доступные хэши участников:")
+		for name, hash := range participantHashes {
+			log.Printf("payoutWinnings:   %s -> %s (первые 5: %s)", name, hash, hash[:5])
+		}
+		return resultsText
+	}
+
+	log.Printf("payoutWinnings: Победитель %s имеет хэш %s (первые 5: %s)", winner, winnerHash, winnerHash[:5])
+
+	// Выплачиваем выигрыши по начальным ставкам (коэффициент x30)
+	if len(initialBets) > 0 {
+		log.Printf("payoutWinnings: 🎯 Обрабатываем начальные ставки (x30), количество: %d", len(initialBets))
+		resultsText += "💰 *Начальные ставки (x30):*\n"
+		log.Printf("payoutWinnings: Начальные ставки найдены, добавляем в resultsText")
+		for username, bet := range initialBets {
+			log.Printf("payoutWinnings: Проверяем начальную ставку %s: ставка на %s (хэш %s), сумма %d", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...", bet.Amount)
+			log.Printf("payoutWinnings: Победитель: %s (хэш %s)", winner, winnerHash[:8]+"...")
+
+			if bet.ParticipantName == winner {
+				// Ставка выиграла! Выплачиваем 30 фишек
+				winnings := bet.Amount * 30
+				log.Printf("payoutWinnings: Начальная ставка выиграла! %s ставил на %s, выигрыш %d фишек", username, bet.ParticipantName, winnings)
+				oldBalance := playerBalances[username]
+				withheld, _ := creditPlayer(username, winnings)
+				// Лимиты игрока хранятся в карте, поэтому учет выигрыша выполняется в основном цикле
+				runOnMainLoop(func() { recordGamblingResult(username, winnings) })
+				log.Printf("payoutWinnings: ✅ ВЫИГРЫШ! Баланс %s изменен с %d на %d (выигрыш %d фишек)", username, oldBalance, playerBalances[username], winnings)
+
+				resultsText += fmt.Sprintf("✅ @%s: +%d фишек (ставка %d на %s)\n",
+					username, winnings, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+				if withheld > 0 {
+					resultsText += fmt.Sprintf("   🏛️ удержано в счет штрафа: %d фишек\n", withheld)
+				}
+
+				log.Printf("payoutWinnings: Выплачен выигрыш по начальной ставке: %s выиграл %d фишек (ставка %d)", username, winnings, bet.Amount)
+			} else {
+				log.Printf("payoutWinnings: ❌ ПРОИГРЫШ: ставка %s на %s (не победитель)", username, bet.ParticipantName)
+				resultsText += fmt.Sprintf("❌ @%s: проигрыш (ставка %d на %s)\n",
+					username, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+
+				log.Printf("payoutWinnings: Проиграна начальная ставка: %s (ставка %d)", username, bet.Amount)
+			}
+		}
+		resultsText += "\n"
+	} else {
+		log.Printf("payoutWinnings: Начальных ставок нет")
+	}
+
+	// Выплачиваем выигрыши по финальным ставкам (коэффициент x2)
+	if len(finalBets) > 0 {
+		log.Printf("payoutWinnings: 🎯 Обрабатываем финальные ставки (x2), количество: %d", len(finalBets))
+		resultsText += "💰 *Финальные ставки (x2):*\n"
+		log.Printf("payoutWinnings: Финальные ставки найдены, добавляем в resultsText")
+		for username, bet := range finalBets {
+			log.Printf("payoutWinnings: Проверяем финальную ставку %s: ставка на %s (хэш %s), сумма %d", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...", bet.Amount)
+			log.Printf("payoutWinnings: Победитель: %s (хэш %s)", winner, winnerHash[:8]+"...")
+
+			if bet.ParticipantName == winner {
+				// Ставка выиграла! Выплачиваем 2 фишки
+				winnings := bet.Amount * 2
+				log.Printf("payoutWinnings: Финальная ставка выиграла! %s ставил на %s, выигрыш %d фишек", username, bet.ParticipantName, winnings)
+				oldBalance := playerBalances[username]
+				withheld, _ := creditPlayer(username, winnings)
+				// Лимиты игрока хранятся в карте, поэтому учет выигрыша выполняется в основном цикле
+				runOnMainLoop(func() { recordGamblingResult(username, winnings) })
+				log.Printf("payoutWinnings: ✅ ВЫИГРЫШ! Баланс %s изменен с %d на %d (выигрыш %d фишек)", username, oldBalance, playerBalances[username], winnings)
+
+				resultsText += fmt.Sprintf("✅ @%s: +%d фишек (ставка %d на %s)\n",
+					username, winnings, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+				if withheld > 0 {
+					resultsText += fmt.Sprintf("   🏛️ удержано в счет штрафа: %d фишек\n", withheld)
+				}
+
+				log.Printf("payoutWinnings: Выплачен выигрыш по финальной ставке: %s выиграл %d фишек (ставка %d)", username, winnings, bet.Amount)
+			} else {
+				log.Printf("payoutWinnings: ❌ ПРОИГРЫШ: финальная ставка %s на %s (не победитель)", username, bet.ParticipantName)
+				resultsText += fmt.Sprintf("❌ @%s: проигрыш (ставка %d на %s)\n",
+					username, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+
+				log.Printf("payoutWinnings: Проиграна финальная ставка: %s (ставка %d)", username, bet.Amount)
+			}
+		}
+	} else {
+		log.Printf("payoutWinnings: Финальных ставок нет")
+	}
+
+	// Очищаем ставки после выплаты
+	log.Printf("payoutWinnings: Очищаем ставки после выплаты")
+	initialBets = make(map[string]Bet)
+	finalBets = make(map[string]Bet)
+	log.Printf("payoutWinnings: Ставки очищены в памяти")
+
+	// Очищаем Redis
+	if redisClient != nil {
+		ctx := context.Background()
+		err := redisClient.Del(ctx, "game:initialBets", "game:finalBets").Err()
+		if err != nil {
+			log.Printf("payoutWinnings: ❌ Ошибка очистки ставок в Redis: %v", err)
+		} else {
+			log.Printf("payoutWinnings: ✅ Ставки очищены в Redis")
+		}
+	} else {
+		log.Printf("payoutWinnings: Redis клиент недоступен, ставки очищены только в памяти")
+	}
+
+	// Выдаем приз победителю - используем плашку, выбранную в начале игры
+	log.Printf("payoutWinnings: Выдаем приз победителю %s", winner)
+	log.Printf("payoutWinnings: Используем плашку из игры: %s (%s)", currentPrize.Name, currentPrize.Rarity)
+
+	if currentPrize.Name == "" {
+		log.Printf("payoutWinnings: ОШИБКА: currentPrize пустой!")
+		resultsText += fmt.Sprintf("\n\n🎁 Ошибка: плашка не была выбрана!")
+	} else {
+		// Находим username победителя
+		winnerUsername := participantIDs[winner]
+		log.Printf("payoutWinnings: participantIDs содержит %d записей", len(participantIDs))
+		for name, uname := range participantIDs {
+			log.Printf("payoutWinnings: participantIDs[%s] = %s", name, uname)
+		}
+		log.Printf("payoutWinnings: Ищем username для winner='%s'", winner)
+		winnerUsername = participantIDs[winner]
+		log.Printf("payoutWinnings: Победитель %s, username: %s", winner, winnerUsername)
+
+		if winnerUsername == "" {
+			log.Printf("payoutWinnings: ОШИБКА: username победителя пустой!")
+			resultsText += fmt.Sprintf("\n\n🎁 Ошибка определения победителя!")
+		} else {
+			wonItem, err := givePrizeToWinner(winnerUsername, currentPrize, currentPrizeSerial)
+			if err == nil {
+				// Зарезервированный номер использован и больше не возвращается в тираж
+				currentPrizeSerial = 0
+				recordPityResult(gameChatID, Rarity(currentPrize.Rarity))
+			}
+			if err != nil {
+				log.Printf("payoutWinnings: Ошибка выдачи приза: %v", err)
+				resultsText += fmt.Sprintf("\n\n🎁 Ошибка выдачи приза!")
+			} else {
+				log.Printf("payoutWinnings: Приз %s успешно выдан победителю %s", currentPrize.Name, winnerUsername)
+				card := PlateCard{
+					Prize:      currentPrize,
+					ItemID:     wonItem.Hash,
+					Serial:     wonItem.Serial,
+					MaxSupply:  wonItem.MaxSupply,
+					Owner:      winnerUsername,
+					ObtainedAt: time.Now(),
+				}
+				resultsText += "\n\n🎁 Победитель получает плашку:\n" + formatPlateCard(card)
+			}
+		}
+	}
+
+	log.Printf("payoutWinnings: === ВЫПЛАТА ВЫИГРЫШЕЙ ЗАВЕРШЕНА ===")
+	previewLen := 100
+	if len(resultsText) < previewLen {
+		previewLen = len(resultsText)
+	}
+	log.Printf("payoutWinnings: Финальный resultsText длина = %d, первые %d символов: '%s...'", len(resultsText), previewLen, resultsText[:previewLen])
+	log.Printf("payoutWinnings: Возвращаемый текст результатов: '%s'", resultsText)
+	return resultsText
+}
+
+// Функция для выполнения раунда игры
+func performGameRound(bot *tgbotapi.BotAPI, roundNumber int) string {
+	log.Printf("performGameRound: Вызвана с roundNumber=%d, len(participants)=%d, totalRounds=%d, isGameActive=%t", roundNumber, len(participants), totalRounds, isGameActive)
+	log.Printf("performGameRound: Участники: %v", participants)
+	if len(participants) == 0 {
+		isGameActive = false
+		return "Игра уже окончена!"
+	} else if len(participants) == 1 {
+		// Финальный раунд: последний участник выигрывает
+		winner := participants[0]
+
+		// Показываем полную информацию о выигранной плашке
+		finalText := fmt.Sprintf("🏆🏆🏆 %s, ПОЗДРАВЛЯЕМ!! Вы выиграли плашку:\n%s\n\n🐩 Игра окончена!", formatParticipantNameWithUsername(winner), formatPlateCard(currentGamePlateCard()))
+		participants = []string{} // Полностью очищаем список
+		isGameActive = false
+		return finalText
+	} else if len(participants) == 2 {
+		log.Printf("🎯 performGameRound: === НАЧАЛО ФИНАЛЬНОЙ ИГРЫ ===")
+		log.Printf("performGameRound: Осталось 2 участника, начинаем финальную последовательность")
+		log.Printf("performGameRound: Участники финала: %v", participants)
+
+		// ФАЗА 1: Финальный раунд (30 секунд)
+		log.Printf("performGameRound: ФАЗА 1 - Показываем финальный раунд на 30 секунд")
+		finalRoundText := "🎯 ФИНАЛЬНЫЙ РАУНД!\n\n"
+		finalRoundText += "🏆 ФИНАЛИСТЫ:\n"
+		for i, participant := range participants {
+			finalRoundText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
+		}
+		finalRoundText += "\n⏰ Через 5 секунд начнутся финальные ставки!"
+
+		// Отправляем новое сообщение вместо редактирования старого
+		roundMsg := tgbotapi.NewMessage(gameChatID, finalRoundText)
+		if _, err := bot.Send(roundMsg); err != nil {
+			log.Printf("performGameRound: Ошибка отправки сообщения финального раунда: %v", err)
+		}
+
+		log.Printf("performGameRound: Ждем 5 секунд финального раунда...")
+		select {
+		case <-time.After(5 * time.Second):
+			log.Printf("performGameRound: Финальный раунд завершен")
+		case <-gameCancel:
+			log.Printf("performGameRound: Финальный раунд отменен")
+			return "Игра была отменена"
+		}
+
+		// ФАЗА 2: Финальные ставки (30 секунд)
+		log.Printf("performGameRound: ФАЗА 2 - Запускаем финальные ставки на 30 секунд")
+		bettingPhase = "final"
+
+		// Для финальных ставок используем простые номера 1 и 2
+		bettingParticipants = make([]string, len(participants))
+		copy(bettingParticipants, participants)
+		finalBettingNumbers = []int{1, 2}
+
+		finalBetText := "🎯 ФИНАЛЬНЫЕ СТАВКИ!\n\n"
+		finalBetText += "🏆 ОСТАЛИСЬ ДВА УЧАСТНИКА:\n"
+		for i, participant := range bettingParticipants {
+			finalBetText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
+		}
+		finalBetText += "\n💰 ФИНАЛЬНЫЕ СТАВКИ ОТКРЫТЫ!\n"
+		finalBetText += "🎯 Ставьте на победителя: /bet N СУММА\n"
+		finalBetText += "💎 Коэффициент: x2\n"
+		finalBetText += "⏰ Время на ставки: 30 сек\n"
+
+		// Отправляем новое сообщение вместо редактирования старого
+		betMsg := tgbotapi.NewMessage(gameChatID, finalBetText)
+		if _, err := bot.Send(betMsg); err != nil {
+			log.Printf("performGameRound: Ошибка отправки сообщения финальных ставок: %v", err)
+		}
+
+		log.Printf("performGameRound: Ждем 30 секунд финальных ставок...")
+		startTime := time.Now()
+		time.Sleep(30 * time.Second)
+		elapsed := time.Since(startTime)
+		log.Printf("performGameRound: Финальные ставки завершены, прошло времени: %.2f секунд", elapsed.Seconds())
+
+		bettingPhase = "closed"
+		log.Printf("performGameRound: Финальные ставки завершены, переходим к определению победителя")
+
+		// Проводим финальную игру
+		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(2))
+		winnerIndex := int(randomIndex.Int64())
+		winner := participants[winnerIndex]
+		loser := participants[1-winnerIndex]
+
+		log.Printf("performGameRound: 🎲 Рандомизация завершена:")
+		log.Printf("performGameRound:   randomIndex = %d", randomIndex)
+		log.Printf("performGameRound:   winnerIndex = %d", winnerIndex)
+		log.Printf("performGameRound:   winner = %s, loser = %s", winner, loser)
+		log.Printf("performGameRound:   winner hash = %s", participantHashes[winner])
+
+		winnerUsername := participantIDs[winner]
+		loserUsername := participantIDs[loser]
+
+		log.Printf("performGameRound: Username финалистов:")
+		log.Printf("performGameRound:   winnerUsername: %s", winnerUsername)
+		log.Printf("performGameRound:   loserUsername: %s", loserUsername)
+
+		finalResultText := fmt.Sprintf("☹️ К сожалению! %s не получает плашку в финале!\n", formatParticipantNameWithUsername(loser))
+		finalResultText += "ничего страшного, повезет в следующей игре 🍀!\n\n"
+
+		// Показываем полную информацию о выигранной плашке
+		finalResultText += fmt.Sprintf("🏆🏆🏆 %s, ПОЗДРАВЛЯЕМ!! Вы выиграли плашку:\n%s\n", formatParticipantNameWithUsername(winner), formatPlateCard(currentGamePlateCard()))
+
+		finalResultText += "\n\n🐩 Игра окончена!"
+
+		log.Printf("performGameRound: Финальное сообщение сформировано")
+		log.Printf("performGameRound: Очищаем список участников и завершаем игру")
+
+		participants = []string{} // Полностью очищаем список
+		isGameActive = false
+
+		// Отправляем НОВОЕ сообщение с результатами игры (не редактируем старое)
+		log.Printf("performGameRound: Отправляем новое сообщение с финальными результатами")
+		gameResultMsg := tgbotapi.NewMessage(gameChatID, finalResultText)
+		if _, err := bot.Send(gameResultMsg); err != nil {
+			log.Printf("performGameRound: Ошибка отправки сообщения с результатами игры: %v", err)
+		} else {
+			log.Printf("performGameRound: Новое сообщение с результатами игры отправлено успешно")
+		}
+
+		log.Printf("performGameRound: Игра окончена, вызываем payoutWinnings")
+		log.Printf("performGameRound: Финальные ставки для выплат: %d ставок", len(finalBets))
+
+		// Выплачиваем выигрыши и получаем текст результатов ставок
+		log.Printf("performGameRound: Начинаем выплаты. Победитель: %s, Проигравший: %s", winner, loser)
+		betsResultsText := payoutWinnings(bot, winner, loser)
+		log.Printf("performGameRound: betsResultsText длина = %d, пустой = %t", len(betsResultsText), betsResultsText == "")
+		log.Printf("performGameRound: betsResultsText = '%s'", betsResultsText)
+
+		// Отправляем сообщение с результатами ставок только если есть ставки
+		if betsResultsText != "" {
+			log.Printf("performGameRound: Отправляем сообщение с результатами ставок в чат %d", gameChatID)
+			betsMsg := tgbotapi.NewMessage(gameChatID, betsResultsText)
+			betsMsg.ParseMode = "Markdown"
+			sentMsg, err := bot.Send(betsMsg)
+			if err != nil {
+				log.Printf("performGameRound: Ошибка отправки сообщения с результатами ставок: %v", err)
+				log.Printf("performGameRound: Текст сообщения: %s", betsResultsText)
+			} else {
+				log.Printf("performGameRound: Сообщение с результатами ставок отправлено успешно, messageID: %d", sentMsg.MessageID)
+			}
+		} else {
+			log.Printf("performGameRound: Нет ставок, сообщение с результатами не отправляется")
+		}
+
+		log.Printf("performGameRound: payoutWinnings завершен")
+		log.Printf("performGameRound: === ФИНАЛЬНАЯ ИГРА ЗАВЕРШЕНА ===")
+
+		return ""
+	} else {
+		// Обычный раунд: выбираем случайного участника для удаления
+		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(int64(len(participants))))
+		loserIndex := int(randomIndex.Int64())
+		removedParticipant := participants[loserIndex]
+
+		// Добавляем в список выбывших и удаляем из активных участников
+		eliminatedParticipants = append(eliminatedParticipants, removedParticipant)
+		participants = append(participants[:loserIndex], participants[loserIndex+1:]...)
+
+		// Формируем полное обновляемое сообщение
+		gameText := "🎮 ИГРА ИДЁТ!\n\n"
+
+		// Показываем редкость будущей плашки
+		rarityText := rarityLabel(currentPrize.Rarity)
+		gameText += fmt.Sprintf("🎁 БУДЕТ РАЗЫГРАНА %s ПЛАШКА!\n\n", rarityText)
+
+		// Текущие участники
+		if len(participants) > 0 {
+			gameText += "🏆 ТЕКУЩИЕ УЧАСТНИКИ:\n"
+			for i, participant := range participants {
+				gameText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
+			}
+		}
+
+		// Выбывшие участники
+		if len(eliminatedParticipants) > 0 {
+			gameText += "\n💀 ВЫБЫВШИЕ УЧАСТНИКИ:\n"
+			for _, participant := range eliminatedParticipants {
+				gameText += fmt.Sprintf("❌ %s\n", formatParticipantNameWithItem(participant))
+			}
+		}
+
+		// Сообщение о выбывшем участнике
+		gameText += fmt.Sprintf("\n☹️ В этом раунде выбывает: %s\n", formatParticipantName(removedParticipant))
+		gameText += "@" + participantIDs[removedParticipant] + ", ничего страшного, повезет в следующей игре 😊🍀!\n"
+
+		remaining := len(participants)
+		if remaining > 1 {
+			gameText += fmt.Sprintf("\nОсталось участников: %d", remaining)
+		} else if remaining == 1 {
+			gameText += "\n🏆 Остался последний участник!"
+		}
+
+		return gameText
+	}
+}
+
+// Функция для управления сессией игры
+func runGameSession(bot *tgbotapi.BotAPI) {
+	log.Printf("runGameSession: Начало игры, totalRounds=%d, currentRound=%d, len(participants)=%d", totalRounds, currentRound, len(participants))
+
+	// Цикл для всех раундов
+	for isGameActive && currentRound <= totalRounds {
+		// Проверяем, не была ли игра отменена
+		select {
+		case <-gameCancel:
+			log.Printf("runGameSession: Игра отменена во время выполнения")
+			return
+		default:
+			// Продолжаем игру
+		}
+
+		log.Printf("runGameSession: НАЧАЛО РАУНДА %d (%d-й по порядку), isGameActive=%t, len(participants)=%d", currentRound, currentRound+1, isGameActive, len(participants))
+
+		// Выполняем раунд
+		roundResult := performGameRound(bot, currentRound)
+		log.Printf("runGameSession: Раунд %d выполнен, isGameActive=%t, roundResult содержит 'ПОДГОТОВКА': %t", currentRound, isGameActive, strings.Contains(roundResult, "ПОДГОТОВКА"))
+
+		// Если игра закончилась, показываем финальный результат
+		if !isGameActive {
+			log.Printf("Игра закончилась после раунда %d", currentRound)
+			// Для финальной игры результаты уже отправлены отдельными сообщениями
+			if roundResult != "" {
+				log.Printf("runGameSession: Отправляем финальное сообщение: %s", roundResult)
+				editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, roundResult)
+				_, err := bot.Send(editMsg)
+				if err != nil {
+					log.Printf("runGameSession: Ошибка отправки финального сообщения: %v", err)
+				} else {
+					log.Printf("runGameSession: Финальное сообщение отправлено успешно")
+				}
+			}
+			log.Printf("runGameSession: игра завершена")
+			return
+		}
+
+		// Проверяем, последний ли это раунд
+		if currentRound >= totalRounds {
+			// Последний раунд - показываем результат и завершаем
+			log.Printf("runGameSession: Последний раунд %d завершен", currentRound)
+			if roundResult != "" {
+				editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, roundResult)
+				if _, err := bot.Send(editMsg); err != nil {
+					log.Printf("runGameSession: Ошибка отправки сообщения последнего раунда: %v", err)
+				}
+			}
+			currentRound++
+			break
+		}
+
+		// Есть следующий раунд - показываем результат + отсчёт до следующего раунда
+		nextRoundText := fmt.Sprintf("%s\n\n🎮 РАУНД %d/%d\n⏰ До следующего раунда: 5 сек",
+			roundResult, currentRound+1, totalRounds)
+
+		log.Printf("Показываем результат раунда %d с отсчётом до раунда %d", currentRound, currentRound+1)
+		editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, nextRoundText)
+		if _, err := bot.Send(editMsg); err != nil {
+			log.Printf("Ошибка редактирования сообщения: %v", err)
+			isGameActive = false
+			break
+		}
+
+		// Ждём 5 секунд до следующего раунда с проверкой отмены
+		select {
+		case <-time.After(5 * time.Second):
+			// Время вышло, продолжаем
+		case <-gameCancel:
+			log.Printf("runGameSession: Игра отменена во время паузы между раундами")
+			return
+		}
+
+		currentRound++
+		log.Printf("runGameSession: Переходим к раунду %d", currentRound)
+
+		// Небольшая пауза между раундами
+		if isGameActive && len(participants) > 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	log.Printf("runGameSession: Цикл завершен, isGameActive=%t, currentRound=%d, totalRounds=%d", isGameActive, currentRound, totalRounds)
+
+	// Сбрасываем состояние после завершения игры
+	if !isGameActive {
+		log.Printf("runGameSession: Игра завершена, сбрасываем состояние")
+		bettingPhase = "closed"
+		currentRound = 0
+		initialBets = make(map[string]Bet)
+		finalBets = make(map[string]Bet)
+		finalBettingNumbers = []int{}
+		releaseGamePrize()
+		gameInProgress = false // Сбрасываем флаг процесса игры
+	}
+}
+
+// Функция для инициализации Redis клиента
+func initRedis() {
+	// Получаем адрес Redis из переменной окружения или используем по умолчанию
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379" // По умолчанию localhost
+	}
+
+	redisClient = redis.NewClient(&redis.Options{
+		Addr:     redisAddr, // Redis сервер
+		Password: "",        // Пароль (пустой по умолчанию)
+		DB:       0,         // База данных (0 по умолчанию)
+	})
+
+	// Проверяем подключение
+	ctx := context.Background()
+	_, err := redisClient.Ping(ctx).Result()
+	if err != nil {
+		log.Printf("Ошибка подключения к Redis (%s): %v", redisAddr, err)
+		log.Printf("Балансы будут храниться только в памяти!")
+	} else {
+		log.Printf("Redis подключен успешно (%s)", redisAddr)
+	}
+}
+
+// Функция для сохранения баланса в Redis
+func saveBalanceToRedis(username string, balance int) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("balance:%s", username)
+	err := redisClient.Set(ctx, key, balance, 0).Err()
+	if err != nil {
+		log.Printf("Ошибка сохранения баланса для %s: %v", username, err)
+	}
+}
+
+// Функция для сохранения всех балансов в Redis
+func saveBalancesToRedis() error {
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	for username, balance := range playerBalances {
+		key := fmt.Sprintf("balance:%s", username)
+		err := redisClient.Set(ctx, key, balance, 0).Err()
+		if err != nil {
+			log.Printf("Ошибка сохранения баланса для %s: %v", username, err)
+			return fmt.Errorf("failed to save balance for %s: %v", username, err)
+		}
+	}
+
+	log.Printf("saveBalancesToRedis: Сохранено %d балансов в Redis", len(playerBalances))
+	return nil
+}
+
+// Функция для загрузки баланса из Redis
+func loadBalanceFromRedis(username string) (int, bool) {
+	if redisClient == nil {
+		return 0, false
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("balance:%s", username)
+	val, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return 0, false
+	}
+
+	balance, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+
+	return balance, true
+}
+
+// Функция для загрузки всех балансов из Redis
+func loadAllBalancesFromRedis() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "balance:*")
+	if err != nil {
+		log.Printf("Ошибка загрузки балансов из Redis: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "balance:")
+		if balance, ok := loadBalanceFromRedis(username); ok {
+			playerBalances[username] = balance
+		}
+	}
+
+	log.Printf("Загружено %d балансов из Redis", len(playerBalances))
+}
+
+// Функция для сохранения банковских счетов в Redis
+func saveBanksToRedis() error {
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	for username, bank := range playerBanks {
+		key := fmt.Sprintf("bank:%s", username)
+		err := redisClient.Set(ctx, key, bank, 0).Err()
+		if err != nil {
+			log.Printf("Ошибка сохранения банка для %s: %v", username, err)
+			return fmt.Errorf("failed to save bank for %s: %v", username, err)
+		}
+	}
+
+	log.Printf("saveBanksToRedis: Сохранено %d банковских счетов в Redis", len(playerBanks))
+	return nil
+}
+
+// Функция для загрузки банковского счета из Redis
+func loadBankFromRedis(username string) (int, bool) {
+	if redisClient == nil {
+		return 0, false
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("bank:%s", username)
+	val, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return 0, false
+	}
+
+	bank, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+
+	return bank, true
+}
+
+// Функция для загрузки всех банковских счетов из Redis
+func loadAllBanksFromRedis() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "bank:*")
+	if err != nil {
+		log.Printf("Ошибка загрузки банковских счетов из Redis: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "bank:")
+		if bank, ok := loadBankFromRedis(username); ok {
+			playerBanks[username] = bank
+		}
+	}
+
+	log.Printf("Загружено %d банковских счетов из Redis", len(playerBanks))
+}
+
+// Ключ Redis с датами последнего начисления процентов на штрафы (hash: username -> unix)
+const fineDatesKey = "fines:dates"
+
+// Функция для сохранения штрафов в Redis
+func saveFinesToRedis() error {
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	ctx := context.Background()
+	for username, fine := range playerFines {
+		key := fmt.Sprintf("fine:%s", username)
+		err := redisClient.Set(ctx, key, fine, 0).Err()
+		if err != nil {
+			log.Printf("Ошибка сохранения штрафа для %s: %v", username, err)
+			return fmt.Errorf("failed to save fine for %s: %v", username, err)
+		}
+		if date, exists := playerFineDates[username]; exists {
+			redisClient.HSet(ctx, fineDatesKey, username, date.Unix())
+		}
+	}
+
+	log.Printf("saveFinesToRedis: Сохранено %d штрафов в Redis", len(playerFines))
+	return nil
+}
+
+// Функция для загрузки штрафа из Redis
+func loadFineFromRedis(username string) (int, bool) {
+	if redisClient == nil {
+		return 0, false
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("fine:%s", username)
+	val, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return 0, false
+	}
+
+	fine, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+
+	return fine, true
+}
+
+// Функция для загрузки всех штрафов из Redis
+func loadAllFinesFromRedis() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "fine:*")
+	if err != nil {
+		log.Printf("Ошибка загрузки штрафов из Redis: %v", err)
+		return
+	}
+
+	dates, err := redisClient.HGetAll(ctx, fineDatesKey).Result()
+	if err != nil {
+		log.Printf("Ошибка загрузки дат штрафов из Redis: %v", err)
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "fine:")
+		if fine, ok := loadFineFromRedis(username); ok {
+			playerFines[username] = fine
+			// Дата последнего начисления берется из Redis, иначе отсчет начинается заново
+			playerFineDates[username] = time.Now()
+			if unix, err := strconv.ParseInt(dates[username], 10, 64); err == nil {
+				playerFineDates[username] = time.Unix(unix, 0)
+			}
+		}
+	}
+
+	log.Printf("Загружено %d штрафов из Redis", len(playerFines))
+}
+
+// Функция для ежедневного увеличения штрафов
+func updateFinesDaily() {
+	now := time.Now()
+	for username, fine := range playerFines {
+		if fine <= 0 {
+			continue
+		}
+
+		lastUpdate, exists := playerFineDates[username]
+		if !exists {
+			playerFineDates[username] = now
+			continue
+		}
+
+		// Проверяем, прошли ли сутки
+		daysSinceUpdate := int(now.Sub(lastUpdate).Hours() / 24)
+		if daysSinceUpdate > 0 {
+			// Увеличиваем штраф на 10% за каждый день
+			for i := 0; i < daysSinceUpdate; i++ {
+				fine = int(float64(fine) * 1.1) // Увеличение на 10%
+			}
+			playerFines[username] = fine
+			playerFineDates[username] = lastUpdate.Add(time.Duration(daysSinceUpdate) * 24 * time.Hour)
+			log.Printf("Штраф игрока %s увеличен до %d (прошло %d дней)", username, fine, daysSinceUpdate)
+		}
+	}
+
+	// Сохраняем обновленные штрафы
+	if err := saveFinesToRedis(); err != nil {
+		log.Printf("Ошибка сохранения обновленных штрафов: %v", err)
+	}
+}
+
+// Ключ Redis с временем последнего запуска фоновых задач (hash: имя задачи -> unix)
+const jobsLastRunKey = "jobs:lastrun"
+
+// Фоновая задача планировщика
+type ScheduledJob struct {
+	Name     string
+	Title    string
+	Interval time.Duration
+	Run      func(bot *tgbotapi.BotAPI, periods int) // periods - сколько интервалов прошло (больше 1 после простоя)
+}
+
+// Функция для получения списка фоновых задач по текущим настройкам
+func scheduledJobs() []ScheduledJob {
+	jobs := []ScheduledJob{
+		{Name: "fines", Title: "Начисление процентов на штрафы", Interval: time.Hour, Run: runFinesJob},
+		{Name: "bank_interest", Title: "Проценты по банковским счетам", Interval: 24 * time.Hour, Run: runBankInterestJob},
+		{Name: "deposits", Title: "Выплата срочных вкладов", Interval: time.Hour, Run: runDepositsJob},
+		{Name: "loans", Title: "Списание платежей по кредитам", Interval: time.Hour, Run: runLoansJob},
+		{Name: "season", Title: "Смена сезона", Interval: time.Duration(economyConfig.Jobs.SeasonDays) * 24 * time.Hour, Run: runSeasonJob},
+	}
+	for _, announcement := range economyConfig.Jobs.Announcements {
+		text := announcement.Text
+		jobs = append(jobs, ScheduledJob{
+			Name:     "announce:" + announcement.ID,
+			Title:    "Объявление " + announcement.ID,
+			Interval: time.Duration(announcement.EveryHours) * time.Hour,
+			Run: func(bot *tgbotapi.BotAPI, periods int) {
+				announce(bot, text)
+			},
+		})
+	}
+	return jobs
+}
+
+// Функция для чтения времени последнего запуска задач
+func getJobsLastRun() map[string]time.Time {
+	lastRun := make(map[string]time.Time)
+	if redisClient == nil {
+		return lastRun
+	}
+
+	ctx := context.Background()
+	fields, err := redisClient.HGetAll(ctx, jobsLastRunKey).Result()
+	if err != nil {
+		log.Printf("getJobsLastRun: Ошибка чтения времени запуска задач: %v", err)
+		return lastRun
+	}
+	for name, value := range fields {
+		if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+			lastRun[name] = time.Unix(unix, 0)
+		}
+	}
+	return lastRun
+}
+
+// Функция для запуска задач, у которых подошел срок (пропущенные за время простоя интервалы догоняются)
+func runDueJobs(bot *tgbotapi.BotAPI) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	lastRun := getJobsLastRun()
+	now := time.Now()
+	for _, job := range scheduledJobs() {
+		last, exists := lastRun[job.Name]
+		if !exists {
+			// Новая задача: отсчитываем интервал от текущего момента
+			redisClient.HSet(ctx, jobsLastRunKey, job.Name, now.Unix())
+			continue
+		}
+
+		periods := int(now.Sub(last) / job.Interval)
+		if periods < 1 {
+			continue
+		}
+
+		log.Printf("runDueJobs: Запускаем задачу %s (интервалов: %d)", job.Name, periods)
+		job.Run(bot, periods)
+
+		// Сохраняем фазу расписания, чтобы задачи не сдвигались от времени запуска
+		next := last.Add(time.Duration(periods) * job.Interval)
+		if err := redisClient.HSet(ctx, jobsLastRunKey, job.Name, next.Unix()).Err(); err != nil {
+			log.Printf("runDueJobs: Ошибка сохранения времени запуска %s: %v", job.Name, err)
+		}
+	}
+}
+
+// Функция для фонового планировщика задач (сами задачи выполняются в основном цикле)
+func runScheduler(bot *tgbotapi.BotAPI) {
+	runOnMainLoop(func() { runDueJobs(bot) })
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		runOnMainLoop(func() { runDueJobs(bot) })
+	}
+}
+
+// Задача начисления процентов на штрафы (сроки считаются по сохраненным датам штрафов)
+func runFinesJob(bot *tgbotapi.BotAPI, periods int) {
+	updateFinesDaily()
+}
+
+// Задача начисления процентов по банковским счетам (ставка зависит от суммы на счету)
+func runBankInterestJob(bot *tgbotapi.BotAPI, periods int) {
+	credited := make(map[string]int)
+	total := 0
+	for username, bank := range playerBanks {
+		if bank <= 0 {
+			continue
+		}
+		newBank := bank
+		for i := 0; i < periods; i++ {
+			newBank += bankInterest(newBank)
+		}
+		if newBank > bank {
+			playerBanks[username] = newBank
+			credited[username] = newBank - bank
+			total += newBank - bank
+		}
+	}
+
+	if err := saveBanksToRedis(); err != nil {
+		log.Printf("runBankInterestJob: Ошибка сохранения банковских счетов: %v", err)
+		return
+	}
+	for username, interest := range credited {
+		appendJournal(username, JournalEntry{Type: "interest", Amount: interest, Note: fmt.Sprintf("дней: %d", periods)})
+	}
+	log.Printf("runBankInterestJob: Начислено %d фишек процентов по счетам (дней: %d)", total, periods)
+}
+
+// Функция для отправки объявления в чат из настроек (economy.json: jobs.announcementChatId)
+func announce(bot *tgbotapi.BotAPI, text string) {
+	chatID := economyConfig.Jobs.AnnouncementChatID
+	if chatID == 0 {
+		log.Printf("announce: Чат для объявлений не настроен, объявление пропущено: %s", text)
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		log.Printf("announce: Ошибка отправки объявления: %v", err)
+	}
+}
+
+// Ключ Redis с капиталом игроков (баланс + банк) на начало текущего сезона
+const seasonStartKey = "season:start"
+
+// Функция для снимка капитала игроков на начало сезона (вызывается при первом запуске и при смене сезона)
+func snapshotSeasonStart() {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, seasonStartKey)
+		for username, balance := range playerBalances {
+			pipe.HSet(ctx, seasonStartKey, username, balance+playerBanks[username])
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("snapshotSeasonStart: Ошибка сохранения капитала на начало сезона: %v", err)
+	}
+}
+
+// Функция для создания снимка начала сезона, если его еще нет
+func ensureSeasonStart() {
+	if redisClient == nil {
+		return
+	}
+	ctx := context.Background()
+	if exists, err := redisClient.Exists(ctx, seasonStartKey).Result(); err == nil && exists == 0 {
+		snapshotSeasonStart()
+	}
+}
+
+// Задача смены сезона. Очки сезона - прирост капитала (баланс + банк) с начала сезона:
+// итоги сохраняются в Redis и объявляются в чате, затем очки обнуляются новым снимком капитала.
+// Сами балансы, банк, инвентари и долги при смене сезона не меняются.
+func runSeasonJob(bot *tgbotapi.BotAPI, periods int) {
+	ctx := context.Background()
+	starts, err := redisClient.HGetAll(ctx, seasonStartKey).Result()
+	if err != nil {
+		log.Printf("runSeasonJob: Ошибка чтения начала сезона: %v", err)
+		return
+	}
+	season, err := redisClient.Incr(ctx, "season:number").Result()
+	if err != nil {
+		log.Printf("runSeasonJob: Ошибка смены сезона: %v", err)
+		return
+	}
+
+	type standing struct {
+		Username string `json:"username"`
+		Gain     int    `json:"gain"`
+	}
+	var standings []standing
+	for username, balance := range playerBalances {
+		start := 1000 // Игроки, появившиеся за сезон, начинали с начального баланса
+		if value, ok := starts[username]; ok {
+			start, _ = strconv.Atoi(value)
+		}
+		standings = append(standings, standing{Username: username, Gain: balance + playerBanks[username] - start})
+	}
+	sort.Slice(standings, func(i, j int) bool { return standings[i].Gain > standings[j].Gain })
+	if len(standings) > 10 {
+		standings = standings[:10]
+	}
+
+	if data, err := json.Marshal(standings); err == nil {
+		redisClient.Set(ctx, fmt.Sprintf("season:%d:results", season), data, 0)
+	}
+	snapshotSeasonStart()
+
+	text := fmt.Sprintf("🏁 СЕЗОН %d ЗАВЕРШЕН!\n\n🏆 Итоги (прирост баланса и банка за сезон):\n", season)
+	for i, entry := range standings {
+		text += fmt.Sprintf("%d. @%s: %+d %s\n", i+1, entry.Username, entry.Gain, getChipsWord(entry.Gain))
+	}
+	text += fmt.Sprintf("\n🚀 Начинается сезон %d! Очки сезона обнулены.", season+1)
+	announce(bot, text)
+}
+
+// Функция для форматирования расписания задач (/jobs)
+func formatJobs() string {
+	lastRun := getJobsLastRun()
+	text := "🗓️ ФОНОВЫЕ ЗАДАЧИ\n"
+	for _, job := range scheduledJobs() {
+		text += fmt.Sprintf("\n⚙️ %s (%s)\n", job.Title, job.Name)
+		last, exists := lastRun[job.Name]
+		if !exists {
+			text += "   Еще не запускалась\n"
+			continue
+		}
+		text += fmt.Sprintf("   Последний запуск: %s\n   Следующий запуск: %s\n",
+			last.Format("02.01.2006 15:04"), last.Add(job.Interval).Format("02.01.2006 15:04"))
+	}
+	return text
+}
+
+// Запись журнала операций игрока
+type JournalEntry struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Amount int       `json:"amount"`
+	Note   string    `json:"note,omitempty"`
+}
+
+// Подписи типов операций журнала
+var journalTypeLabels = map[string]string{
+	"interest":         "💹 Проценты по счету",
+	"deposit_open":     "🔒 Открыт вклад",
+	"deposit_matured":  "✅ Вклад закрыт в срок",
+	"deposit_withdraw": "⚠️ Вклад закрыт досрочно",
+	"loan_taken":       "🤝 Получен кредит",
+	"loan_installment": "💳 Платеж по кредиту",
+	"loan_repaid":      "✅ Кредит погашен",
+	"loan_default":     "🚨 Кредит переведен в штраф",
+	"bankrupt":         "⚖️ Банкротство",
+	"transfer_out":     "📤 Перевод",
+	"transfer_in":      "📥 Получен перевод",
+}
+
+// Функция для получения ключа журнала операций игрока
+func journalKey(username string) string {
+	return fmt.Sprintf("journal:%s", username)
+}
+
+// Функция для записи операции в журнал (хранятся последние 100 записей)
+func appendJournal(username string, entry JournalEntry) {
+	if redisClient == nil {
+		return
+	}
+
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("appendJournal: Ошибка сериализации записи для %s: %v", username, err)
+		return
+	}
+
+	ctx := context.Background()
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, journalKey(username), data)
+		pipe.LTrim(ctx, journalKey(username), 0, 99)
+		return nil
+	})
+	if err != nil {
+		log.Printf("appendJournal: Ошибка записи журнала для %s: %v", username, err)
+	}
+}
+
+// Функция для чтения последних операций из журнала
+func getJournal(username string, limit int) []JournalEntry {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	values, err := redisClient.LRange(ctx, journalKey(username), 0, int64(limit-1)).Result()
+	if err != nil {
+		log.Printf("getJournal: Ошибка чтения журнала %s: %v", username, err)
+		return nil
+	}
+
+	entries := make([]JournalEntry, 0, len(values))
+	for _, value := range values {
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(value), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Функция для получения дневной ставки по счету в зависимости от суммы
+func bankInterestRate(balance int) float64 {
+	rate := 0.0
+	for _, tier := range economyConfig.Bank.Tiers {
+		if balance >= tier.MinBalance {
+			rate = tier.Rate
+		}
+	}
+	return rate
+}
+
+// Функция для расчета дневных процентов по счету
+func bankInterest(balance int) int {
+	return int(float64(balance) * bankInterestRate(balance) / 100)
+}
+
+// Срочный вклад (/bank deposit)
+type Deposit struct {
+	ID        string    `json:"id"`
+	Amount    int       `json:"amount"`
+	Days      int       `json:"days"`
+	Rate      float64   `json:"rate"`
+	OpenedAt  time.Time `json:"openedAt"`
+	MaturesAt time.Time `json:"maturesAt"`
+}
+
+// Функция для расчета выплаты по вкладу в срок
+func (d Deposit) Payout() int {
+	return d.Amount + int(float64(d.Amount)*d.Rate*float64(d.Days)/100)
+}
+
+// Функция для расчета стоимости вклада сейчас: созревший - с процентами, до срока - только сумма вклада
+func (d Deposit) ValueAt(now time.Time) int {
+	if now.Before(d.MaturesAt) {
+		return d.Amount
+	}
+	return d.Payout()
+}
+
+// Функция для получения ключа вкладов игрока (hash: id -> JSON вклада)
+func depositsKey(username string) string {
+	return fmt.Sprintf("deposits:%s", username)
+}
+
+// Функция для поиска срока вклада в настройках
+func findDepositTerm(days int) (DepositTerm, bool) {
+	for _, term := range economyConfig.Bank.Deposits {
+		if term.Days == days {
+			return term, true
+		}
+	}
+	return DepositTerm{}, false
+}
+
+// Функция для загрузки вкладов игрока (по сроку окончания)
+func getDeposits(username string) []Deposit {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	fields, err := redisClient.HGetAll(ctx, depositsKey(username)).Result()
+	if err != nil {
+		log.Printf("getDeposits: Ошибка чтения вкладов %s: %v", username, err)
+		return nil
+	}
+
+	deposits := make([]Deposit, 0, len(fields))
+	for id, data := range fields {
+		var deposit Deposit
+		if err := json.Unmarshal([]byte(data), &deposit); err != nil {
+			log.Printf("getDeposits: Некорректный вклад %s у %s: %v", id, username, err)
+			continue
+		}
+		deposits = append(deposits, deposit)
+	}
+	sort.Slice(deposits, func(i, j int) bool { return deposits[i].MaturesAt.Before(deposits[j].MaturesAt) })
+	return deposits
+}
+
+// Функция для открытия срочного вклада (деньги переводятся с банковского счета и блокируются до срока)
+func openDeposit(username string, amount int, term DepositTerm) (Deposit, error) {
+	if redisClient == nil {
+		return Deposit{}, fmt.Errorf("Redis client not available")
+	}
+	if playerBanks[username] < amount {
+		return Deposit{}, fmt.Errorf("недостаточно средств на банковском счете")
+	}
+
+	ctx := context.Background()
+	number, err := redisClient.Incr(ctx, "deposit:counter").Result()
+	if err != nil {
+		return Deposit{}, fmt.Errorf("failed to get deposit number: %v", err)
+	}
+
+	now := time.Now()
+	deposit := Deposit{
+		ID:        strconv.FormatInt(number, 10),
+		Amount:    amount,
+		Days:      term.Days,
+		Rate:      term.Rate,
+		OpenedAt:  now,
+		MaturesAt: now.AddDate(0, 0, term.Days),
+	}
+	data, err := json.Marshal(deposit)
+	if err != nil {
+		return Deposit{}, err
+	}
+
+	// Счет и вклад сохраняются одной транзакцией
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf("bank:%s", username), playerBanks[username]-amount, 0)
+		pipe.HSet(ctx, depositsKey(username), deposit.ID, data)
+		return nil
+	})
+	if err != nil {
+		return Deposit{}, fmt.Errorf("failed to save deposit: %v", err)
+	}
+	playerBanks[username] -= amount
+
+	appendJournal(username, JournalEntry{Type: "deposit_open", Amount: -amount,
+		Note: fmt.Sprintf("вклад #%s на %d дн. под %.2f%% в день", deposit.ID, deposit.Days, deposit.Rate)})
+	log.Printf("openDeposit: %s открыл вклад #%s на %d фишек (%d дн.)", username, deposit.ID, amount, term.Days)
+	return deposit, nil
+}
+
+// Функция для закрытия вклада с возвратом денег на банковский счет (досрочно - со штрафом и без процентов)
+func closeDeposit(username string, deposit Deposit) (payout int, penalty int, err error) {
+	ctx := context.Background()
+	matured := !time.Now().Before(deposit.MaturesAt)
+	payout = deposit.Payout()
+	if !matured {
+		penalty = deposit.Amount * economyConfig.Bank.EarlyPenaltyPercent / 100
+		payout = deposit.Amount - penalty
+	}
+
+	// Закрывает вклад только тот, кто успел удалить его из hash
+	err = redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.HExists(ctx, depositsKey(username), deposit.ID).Result()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("вклад #%s уже закрыт", deposit.ID)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, depositsKey(username), deposit.ID)
+			pipe.Set(ctx, fmt.Sprintf("bank:%s", username), playerBanks[username]+payout, 0)
+			return nil
+		})
+		return err
+	}, depositsKey(username))
+	if err == redis.TxFailedErr {
+		return 0, 0, fmt.Errorf("вклад #%s изменился, попробуйте еще раз", deposit.ID)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	playerBanks[username] += payout
+
+	if matured {
+		appendJournal(username, JournalEntry{Type: "deposit_matured", Amount: payout,
+			Note: fmt.Sprintf("вклад #%s, проценты %d", deposit.ID, payout-deposit.Amount)})
+	} else {
+		appendJournal(username, JournalEntry{Type: "deposit_withdraw", Amount: payout,
+			Note: fmt.Sprintf("вклад #%s, штраф %d", deposit.ID, penalty)})
+	}
+	log.Printf("closeDeposit: Вклад #%s игрока %s закрыт (выплата %d, штраф %d)", deposit.ID, username, payout, penalty)
+	return payout, penalty, nil
+}
+
+// Задача выплаты вкладов, срок которых подошел
+func runDepositsJob(bot *tgbotapi.BotAPI, periods int) {
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "deposits:*")
+	if err != nil {
+		log.Printf("runDepositsJob: Ошибка поиска вкладов: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "deposits:")
+		for _, deposit := range getDeposits(username) {
+			if time.Now().Before(deposit.MaturesAt) {
+				continue
+			}
+			if _, _, err := closeDeposit(username, deposit); err != nil {
+				log.Printf("runDepositsJob: Ошибка закрытия вклада #%s игрока %s: %v", deposit.ID, username, err)
+			}
+		}
+	}
+}
+
+// Функция для форматирования банковского счета с прогнозом дохода (/bank)
+func formatBankAccount(username string) string {
+	bankBalance := playerBanks[username]
+	rate := bankInterestRate(bankBalance)
+	daily := bankInterest(bankBalance)
+	month := bankBalance
+	for i := 0; i < 30; i++ {
+		month += bankInterest(month)
+	}
+
+	text := fmt.Sprintf("🏦 БАНК - безопасное хранение фишек!\n\n"+
+		"💰 На счету: %d %s\n"+
+		"💵 На руках: %d %s\n\n"+
+		"💹 Ставка: %.2f%% в день\n"+
+		"📈 Прогноз: +%d %s завтра, +%d %s за 30 дней\n",
+		bankBalance, getChipsWord(bankBalance), playerBalances[username], getChipsWord(playerBalances[username]),
+		rate, daily, getChipsWord(daily), month-bankBalance, getChipsWord(month-bankBalance))
+
+	if deposits := getDeposits(username); len(deposits) > 0 {
+		text += "\n🔒 ВКЛАДЫ:\n"
+		for _, deposit := range deposits {
+			payout := deposit.Payout()
+			text += fmt.Sprintf("#%s: %d %s на %d дн., до %s → %d %s\n",
+				deposit.ID, deposit.Amount, getChipsWord(deposit.Amount), deposit.Days,
+				deposit.MaturesAt.Format("02.01.2006 15:04"), payout, getChipsWord(payout))
+		}
+	}
+
+	text += "\n📊 СТАВКИ ПО СЧЕТУ:\n"
+	for _, tier := range economyConfig.Bank.Tiers {
+		text += fmt.Sprintf("• от %d %s: %.2f%% в день\n", tier.MinBalance, getChipsWord(tier.MinBalance), tier.Rate)
+	}
+	text += "\n📊 СРОЧНЫЕ ВКЛАДЫ:\n"
+	for _, term := range economyConfig.Bank.Deposits {
+		text += fmt.Sprintf("• %dd: %.2f%% в день, выплата в конце срока\n", term.Days, term.Rate)
+	}
+	text += fmt.Sprintf("⚠️ Досрочное закрытие: штраф %d%% и без процентов\n", economyConfig.Bank.EarlyPenaltyPercent)
+
+	if entries := getJournal(username, 5); len(entries) > 0 {
+		text += "\n🧾 ПОСЛЕДНИЕ ОПЕРАЦИИ:\n"
+		for _, entry := range entries {
+			text += fmt.Sprintf("%s %s: %+d", entry.Time.Format("02.01 15:04"), journalTypeLabels[entry.Type], entry.Amount)
+			if entry.Note != "" {
+				text += " (" + entry.Note + ")"
+			}
+			text += "\n"
+		}
+	}
+
+	text += "\n📋 Команды:\n" +
+		"• /bank add 1000 - положить 1000 фишек в банк\n" +
+		"• /bank add all - положить все деньги в банк\n" +
+		"• /bank get 500 - снять 500 фишек из банка\n" +
+		"• /bank deposit 5000 7d - открыть вклад со счета\n" +
+		"• /bank withdraw номер - закрыть вклад досрочно\n\n" +
+		"⚠️ Фишки в банке нельзя тратить на ставки!"
+	return text
+}
+
+// Функция для получения ключа кредитной истории игрока (hash: счетчики)
+func creditStatsKey(username string) string {
+	return fmt.Sprintf("credit:%s", username)
+}
+
+// Функция для увеличения счетчика кредитной истории (fines_cleared, loans_repaid, loans_defaulted)
+func incrCreditStat(username, field string) {
+	addCreditStat(username, field, 1)
+}
+
+// Функция для прибавления суммы к показателю кредитной истории (wagered - сумма всех ставок)
+func addCreditStat(username, field string, amount int) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if err := redisClient.HIncrBy(ctx, creditStatsKey(username), field, int64(amount)).Err(); err != nil {
+		log.Printf("addCreditStat: Ошибка обновления %s для %s: %v", field, username, err)
+	}
+}
+
+// Функция для ограничения слагаемого кредитного рейтинга
+func clampScore(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// Функция для расчета кредитного рейтинга (0-1000) и его составляющих для вывода
+func getCreditScore(username string) (int, []string) {
+	stats := make(map[string]int)
+	if redisClient != nil {
+		ctx := context.Background()
+		fields, err := redisClient.HGetAll(ctx, creditStatsKey(username)).Result()
+		if err != nil {
+			log.Printf("getCreditScore: Ошибка чтения кредитной истории %s: %v", username, err)
+		}
+		for field, value := range fields {
+			stats[field], _ = strconv.Atoi(value)
+		}
+	}
+
+	return calcCreditScore(stats, playerBalances[username]+playerBanks[username], playerFines[username])
+}
+
+// Функция для расчета кредитного рейтинга по показателям кредитной истории, капиталу и штрафу
+func calcCreditScore(stats map[string]int, capital, fine int) (int, []string) {
+	// Игры учитываются по сумме ставок, а не по их числу: иначе рейтинг набирается ставками по 1 фишке
+	games := clampScore(stats["wagered"]/500, 0, 200)
+	fines := clampScore(stats["fines_cleared"]*25, 0, 150)
+	worth := clampScore(capital/1000, 0, 150)
+	loans := clampScore(stats["loans_repaid"]*50, 0, 150) - stats["loans_defaulted"]*150
+	debt := clampScore(fine/100, 0, 200)
+
+	score := clampScore(300+games+fines+worth+loans-debt, 0, 1000)
+	details := []string{
+		fmt.Sprintf("🎲 Ставки (%d %s): +%d", stats["wagered"], getChipsWord(stats["wagered"]), games),
+		fmt.Sprintf("🏛️ Погашенные штрафы (%d): +%d", stats["fines_cleared"], fines),
+		fmt.Sprintf("💰 Капитал: +%d", worth),
+		fmt.Sprintf("🤝 Кредиты (погашено %d, просрочено %d): %+d", stats["loans_repaid"], stats["loans_defaulted"], loans),
+		fmt.Sprintf("💸 Текущий долг по штрафу: -%d", debt),
+	}
+	return score, details
+}
+
+// Функция для расчета лимита кредита по рейтингу
+func getLoanLimit(username string, score int) int {
+	if _, bankrupt := getBankruptUntil(username); bankrupt || score < economyConfig.Loan.MinScore {
+		return 0
+	}
+	return score * economyConfig.Loan.LimitPerPoint
+}
+
+// Кредит игрока с графиком платежей
+type Loan struct {
+	Principal   int       `json:"principal"`   // Сумма кредита
+	Total       int       `json:"total"`       // Сумма к возврату с процентами
+	Paid        int       `json:"paid"`        // Сколько уже выплачено
+	Installment int       `json:"installment"` // Размер платежа
+	NextDue     time.Time `json:"nextDue"`     // Дата следующего платежа
+	Missed      int       `json:"missed"`      // Пропущенные платежи подряд
+	TakenAt     time.Time `json:"takenAt"`
+}
+
+// Функция для получения ключа кредита игрока
+func loanKey(username string) string {
+	return fmt.Sprintf("loan:%s", username)
+}
+
+// Функция для загрузки кредита игрока (false - кредита нет)
+func getLoan(username string) (Loan, bool) {
+	var loan Loan
+	if redisClient == nil {
+		return loan, false
+	}
+
+	ctx := context.Background()
+	data, err := redisClient.Get(ctx, loanKey(username)).Bytes()
+	if err != nil {
+		return loan, false
+	}
+	if err := json.Unmarshal(data, &loan); err != nil {
+		log.Printf("getLoan: Некорректный кредит %s: %v", username, err)
+		return loan, false
+	}
+	return loan, true
+}
+
+// Функция для сохранения кредита игрока
+func saveLoan(username string, loan Loan) error {
+	data, err := json.Marshal(loan)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return redisClient.Set(ctx, loanKey(username), data, 0).Err()
+}
+
+// Функция для выдачи кредита
+func takeLoan(username string, amount int) (Loan, error) {
+	if fine := playerFines[username]; fine > 0 {
+		return Loan{}, fmt.Errorf("сначала оплатите штраф (%d %s): /payfine", fine, getChipsWord(fine))
+	}
+	if redisClient == nil {
+		return Loan{}, fmt.Errorf("Redis client not available")
+	}
+	if _, exists := getLoan(username); exists {
+		return Loan{}, fmt.Errorf("у вас уже есть непогашенный кредит")
+	}
+
+	config := economyConfig.Loan
+	total := amount + amount*config.InterestPercent/100
+	loan := Loan{
+		Principal:   amount,
+		Total:       total,
+		Installment: (total + config.Installments - 1) / config.Installments,
+		NextDue:     time.Now().AddDate(0, 0, config.InstallmentDays),
+		TakenAt:     time.Now(),
+	}
+
+	// Кредит создается только если его еще нет (защита от двойной выдачи)
+	data, err := json.Marshal(loan)
+	if err != nil {
+		return Loan{}, err
+	}
+	ctx := context.Background()
+	created, err := redisClient.SetNX(ctx, loanKey(username), data, 0).Result()
+	if err != nil {
+		return Loan{}, fmt.Errorf("failed to save loan: %v", err)
+	}
+	if !created {
+		return Loan{}, fmt.Errorf("у вас уже есть непогашенный кредит")
+	}
+
+	if !changeBalance(username, amount) {
+		redisClient.Del(ctx, loanKey(username))
+		return Loan{}, fmt.Errorf("не удалось зачислить кредит")
+	}
+
+	appendJournal(username, JournalEntry{Type: "loan_taken", Amount: amount, Note: fmt.Sprintf("к возврату %d", total)})
+	log.Printf("takeLoan: %s взял кредит %d (к возврату %d)", username, amount, total)
+	return loan, nil
+}
+
+// Функция для списания платежа по кредиту: сначала с рук, затем со счета в банке (false - денег не хватило)
+func debitLoanPayment(username string, amount int) bool {
+	if playerBalances[username]+playerBanks[username] < amount {
+		return false
+	}
+
+	fromBalance := amount
+	if fromBalance > playerBalances[username] {
+		fromBalance = playerBalances[username]
+	}
+	fromBank := amount - fromBalance
+
+	if fromBalance > 0 && !changeBalance(username, -fromBalance) {
+		return false
+	}
+	if fromBank > 0 {
+		playerBanks[username] -= fromBank
+		if err := saveBanksToRedis(); err != nil {
+			log.Printf("debitLoanPayment: Ошибка сохранения банка %s: %v", username, err)
+		}
+	}
+	return true
+}
+
+// Разбивка платежа по кредиту
+type LoanPayment struct {
+	Applied   int  // Сколько пошло в погашение кредита
+	Principal int  // Из них в счет основного долга
+	Interest  int  // Из них в счет процентов
+	Overpaid  int  // Переплата сверх остатка (возвращается на баланс)
+	Repaid    bool // Кредит выплачен полностью
 }
 
-// Функция для добавления уведомления о долге к сообщению
-func addDebtNotificationToMessage(userName string, messageText string) string {
-	if hasLargeDebt, debtAmount := checkLargeDebt(userName); hasLargeDebt {
-		return fmt.Sprintf("⚠️ **ДОЛГ ПО ШТРАФУ: %d %s**\n💸 Выплатить: /payfine\n\n%s\n\n%s",
-			debtAmount, getChipsWord(debtAmount), getRandomDebtQuote(), messageText)
+// Функция для расчета платежа по кредиту без сохранения (проценты гасятся пропорционально их доле в сумме к возврату)
+func settleLoanPayment(loan Loan, amount int) (Loan, LoanPayment) {
+	payment := LoanPayment{Applied: amount}
+	if remaining := loan.Total - loan.Paid; payment.Applied > remaining {
+		payment.Applied = remaining
 	}
-	return messageText
+	if payment.Applied < 0 {
+		payment.Applied = 0
+	}
+	payment.Overpaid = amount - payment.Applied
+
+	// Доля процентов считается от накопленной суммы, чтобы округления не копились: к концу выплачены ровно все проценты
+	if loan.Total > 0 {
+		interestTotal := loan.Total - loan.Principal
+		payment.Interest = (loan.Paid+payment.Applied)*interestTotal/loan.Total - loan.Paid*interestTotal/loan.Total
+	}
+	payment.Principal = payment.Applied - payment.Interest
+
+	loan.Paid += payment.Applied
+	loan.Missed = 0
+	payment.Repaid = loan.Paid >= loan.Total
+	if !payment.Repaid {
+		loan.NextDue = loan.NextDue.AddDate(0, 0, economyConfig.Loan.InstallmentDays)
+	}
+	return loan, payment
 }
 
-// Функция для перемешивания слайса с использованием crypto/rand
-func shuffleParticipants() {
-	for i := len(participants) - 1; i > 0; i-- {
-		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
-		j := int(randomIndex.Int64())
-		participants[i], participants[j] = participants[j], participants[i]
+// Функция для погашения платежа по кредиту (сумма amount уже списана с игрока, переплата возвращается)
+func applyLoanPayment(username string, loan Loan, amount int) (Loan, LoanPayment, error) {
+	loan, payment := settleLoanPayment(loan, amount)
+	split := fmt.Sprintf("основной долг %d, проценты %d", payment.Principal, payment.Interest)
+
+	if payment.Repaid {
+		ctx := context.Background()
+		if err := redisClient.Del(ctx, loanKey(username)).Err(); err != nil {
+			return loan, payment, err
+		}
+		incrCreditStat(username, "loans_repaid")
+		appendJournal(username, JournalEntry{Type: "loan_repaid", Amount: -payment.Applied, Note: "кредит погашен: " + split})
+		log.Printf("applyLoanPayment: %s полностью погасил кредит", username)
+	} else {
+		if err := saveLoan(username, loan); err != nil {
+			return loan, payment, err
+		}
+		appendJournal(username, JournalEntry{Type: "loan_installment", Amount: -payment.Applied,
+			Note: fmt.Sprintf("%s, осталось %d", split, loan.Total-loan.Paid)})
+	}
+
+	if payment.Overpaid > 0 {
+		changeBalance(username, payment.Overpaid)
+		log.Printf("applyLoanPayment: %s переплатил %d, переплата возвращена", username, payment.Overpaid)
+	}
+	return loan, payment, nil
+}
+
+// Функция для перевода просроченного кредита в штраф
+func defaultLoan(username string, loan Loan) {
+	remaining := loan.Total - loan.Paid
+
+	ctx := context.Background()
+	if err := redisClient.Del(ctx, loanKey(username)).Err(); err != nil {
+		log.Printf("defaultLoan: Ошибка удаления кредита %s: %v", username, err)
+		return
+	}
+
+	playerFines[username] += remaining
+	playerFineDates[username] = time.Now()
+	if err := saveFinesToRedis(); err != nil {
+		log.Printf("defaultLoan: Ошибка сохранения штрафа %s: %v", username, err)
+	}
+	incrCreditStat(username, "loans_defaulted")
+	appendJournal(username, JournalEntry{Type: "loan_default", Amount: 0, Note: fmt.Sprintf("в штраф переведено %d", remaining)})
+	log.Printf("defaultLoan: Кредит %s просрочен, %d переведено в штраф", username, remaining)
+}
+
+// Задача автоматического списания платежей по кредитам (по одному платежу за запуск; после простоя бота график сдвигается)
+func runLoansJob(bot *tgbotapi.BotAPI, periods int) {
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "loan:*")
+	if err != nil {
+		log.Printf("runLoansJob: Ошибка поиска кредитов: %v", err)
+		return
+	}
+
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "loan:")
+		loan, exists := getLoan(username)
+		if !exists || time.Now().Before(loan.NextDue) {
+			continue
+		}
+
+		// Задача пропускала запуски - бот был недоступен. Платежи за это время не списываются
+		// и не считаются пропущенными: график сдвигается, а заемщик получает предупреждение
+		if periods > 1 {
+			for !time.Now().Before(loan.NextDue) {
+				loan.NextDue = loan.NextDue.AddDate(0, 0, economyConfig.Loan.InstallmentDays)
+			}
+			if err := saveLoan(username, loan); err != nil {
+				log.Printf("runLoansJob: Ошибка сохранения кредита %s: %v", username, err)
+				continue
+			}
+			notifyPlayer(bot, username, fmt.Sprintf("🤖 бот был недоступен, поэтому платежи по кредиту за это время не списывались и не считаются пропущенными. Следующий платеж %d %s - %s",
+				loan.Installment, getChipsWord(loan.Installment), loan.NextDue.Format("02.01.2006 15:04")))
+			continue
+		}
+
+		amount := loan.Installment
+		if remaining := loan.Total - loan.Paid; amount > remaining {
+			amount = remaining
+		}
+
+		if debitLoanPayment(username, amount) {
+			loan, payment, err := applyLoanPayment(username, loan, amount)
+			if err != nil {
+				log.Printf("runLoansJob: Ошибка сохранения кредита %s: %v", username, err)
+				continue
+			}
+			if payment.Repaid {
+				notifyPlayer(bot, username, "🤝 кредит полностью погашен!")
+			} else {
+				notifyPlayer(bot, username, fmt.Sprintf("💳 списан платеж по кредиту %d %s. Осталось выплатить %d %s, следующий платеж %s",
+					amount, getChipsWord(amount), loan.Total-loan.Paid, getChipsWord(loan.Total-loan.Paid), loan.NextDue.Format("02.01.2006 15:04")))
+			}
+			continue
+		}
+
+		loan.Missed++
+		if loan.Missed >= economyConfig.Loan.MaxMissed {
+			defaultLoan(username, loan)
+			notifyPlayer(bot, username, fmt.Sprintf("🚨 кредит не выплачен! Остаток %d %s переведен в штраф: /payfine",
+				loan.Total-loan.Paid, getChipsWord(loan.Total-loan.Paid)))
+			continue
+		}
+		loan.NextDue = loan.NextDue.AddDate(0, 0, economyConfig.Loan.InstallmentDays)
+		if err := saveLoan(username, loan); err != nil {
+			log.Printf("runLoansJob: Ошибка сохранения кредита %s: %v", username, err)
+			continue
+		}
+		notifyPlayer(bot, username, fmt.Sprintf("⚠️ не хватило денег на платеж по кредиту (%d %s), пропущено %d из %d! Следующий платеж %s. "+
+			"После %d пропусков подряд остаток долга станет штрафом",
+			amount, getChipsWord(amount), loan.Missed, economyConfig.Loan.MaxMissed, loan.NextDue.Format("02.01.2006 15:04"), economyConfig.Loan.MaxMissed))
+	}
+}
+
+// Функция для форматирования кредитного рейтинга и кредита (/loan)
+func formatLoanStatus(username string) string {
+	config := economyConfig.Loan
+	score, details := getCreditScore(username)
+	limit := getLoanLimit(username, score)
+
+	text := fmt.Sprintf("🤝 КРЕДИТ\n\n📊 Кредитный рейтинг: %d/1000\n", score)
+	for _, line := range details {
+		text += "   " + line + "\n"
+	}
+
+	if loan, exists := getLoan(username); exists {
+		remaining := loan.Total - loan.Paid
+		text += fmt.Sprintf("\n💳 ТЕКУЩИЙ КРЕДИТ:\n"+
+			"💰 Взято: %d %s\n"+
+			"💸 Осталось выплатить: %d %s из %d\n"+
+			"📅 Следующий платеж: %d %s, %s\n",
+			loan.Principal, getChipsWord(loan.Principal), remaining, getChipsWord(remaining), loan.Total,
+			loan.Installment, getChipsWord(loan.Installment), loan.NextDue.Format("02.01.2006 15:04"))
+		if loan.Missed > 0 {
+			text += fmt.Sprintf("⚠️ Пропущено платежей: %d/%d\n", loan.Missed, config.MaxMissed)
+		}
+		text += "\n💡 Погасить досрочно: /loan repay"
+		return text
+	}
+
+	if fine := playerFines[username]; fine > 0 {
+		text += fmt.Sprintf("\n🚫 Кредит недоступен, пока не оплачен штраф (%d %s): /payfine\n", fine, getChipsWord(fine))
+	} else if limit > 0 {
+		text += fmt.Sprintf("\n💳 Доступно: до %d %s\n", limit, getChipsWord(limit))
+	} else if until, bankrupt := getBankruptUntil(username); bankrupt {
+		text += fmt.Sprintf("\n🚫 Кредит недоступен: вы банкрот до %s\n", until.Format("02.01.2006"))
+	} else {
+		text += fmt.Sprintf("\n🚫 Кредит недоступен: нужен рейтинг от %d\n", config.MinScore)
+	}
+	text += fmt.Sprintf("\n📋 Условия: %d%% сверху, %d платежей раз в %d дн.\n"+
+		"🏦 Платежи списываются автоматически (с рук, затем из банка)\n"+
+		"🚨 После %d пропущенных платежей остаток становится штрафом\n\n"+
+		"💡 Взять кредит: /loan сумма",
+		config.InterestPercent, config.Installments, config.InstallmentDays, config.MaxMissed)
+	return text
+}
+
+// Функция для получения цены выкупа предмета (как в /sell)
+func itemSellPrice(item InventoryItem) int {
+	if item.Rarity == "shop" {
+		return shopSellPrice(item.PrizeName)
+	}
+	if item.Source != "" {
+		return item.Cost * crateSellPercent(item.Source) / 100
+	}
+	return item.Cost
+}
+
+// Функция для получения ключа статуса банкрота (значение - время окончания статуса)
+func bankruptKey(username string) string {
+	return fmt.Sprintf("bankrupt:%s", username)
+}
+
+// Функция для проверки статуса банкрота
+func getBankruptUntil(username string) (time.Time, bool) {
+	return getRobUntil(bankruptKey(username))
+}
+
+// Итоги банкротства
+type BankruptcyResult struct {
+	Debt          int // Долг до банкротства (штраф и остаток кредита)
+	CashValue     int // Изъято с баланса
+	BankValue     int // Списано с банковского счета
+	DepositsValue int // Изъято со срочных вкладов (созревшие - с процентами)
+	Items         int // Сколько предметов продано
+	ItemsValue    int // Выручка от продажи инвентаря
+	Paid          int // Погашено из выручки
+	WrittenOff    int // Списанный остаток долга
+	Returned      int // Остаток выручки, возвращенный на баланс
+	Until         time.Time
+}
+
+// Функция для получения денег игрока, которыми можно погасить долг: баланс, банк и вклады
+func getLiquidAssets(username string) int {
+	total := playerBalances[username] + playerBanks[username]
+	now := time.Now()
+	for _, deposit := range getDeposits(username) {
+		total += deposit.ValueAt(now)
+	}
+	return total
+}
+
+// Функция для банкротства: баланс, банк, вклады и инвентарь идут в погашение долга, остаток долга списывается
+func declareBankruptcy(username string) (BankruptcyResult, error) {
+	var result BankruptcyResult
+	if redisClient == nil {
+		return result, fmt.Errorf("Redis client not available")
+	}
+
+	// Обновляем штрафы перед расчетом долга
+	updateFinesDaily()
+
+	loan, hasLoan := getLoan(username)
+	if hasLoan {
+		result.Debt += loan.Total - loan.Paid
+	}
+	result.Debt += playerFines[username]
+	if result.Debt <= 0 {
+		return result, fmt.Errorf("у вас нет долгов")
+	}
+
+	// Статус банкрота, изъятие имущества и закрытие долгов записываются одной транзакцией:
+	// при сбое не остается ни полуликвидированного игрока, ни статуса без списания долга
+	days := economyConfig.Bankruptcy.Days
+	result.Until = time.Now().AddDate(0, 0, days)
+	ctx := context.Background()
+	wornKey := fmt.Sprintf("profile:%s:worn_item", username)
+	var inventory []InventoryItem
+
+	err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		flagged, err := tx.Exists(ctx, bankruptKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		if flagged > 0 {
+			return fmt.Errorf("вы уже банкрот")
+		}
+
+		// Вклады и инвентарь перечитываем внутри транзакции
+		now := time.Now()
+		depositFields, err := tx.HGetAll(ctx, depositsKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		for _, data := range depositFields {
+			var deposit Deposit
+			if json.Unmarshal([]byte(data), &deposit) == nil {
+				result.DepositsValue += deposit.ValueAt(now)
+			}
+		}
+
+		inventoryFields, err := tx.HGetAll(ctx, inventoryKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		for itemHash, data := range inventoryFields {
+			var item InventoryItem
+			if err := json.Unmarshal([]byte(data), &item); err != nil {
+				log.Printf("declareBankruptcy: Некорректный предмет %s у %s: %v", itemHash, username, err)
+				continue
+			}
+			item.Hash = itemHash
+			inventory = append(inventory, item)
+			result.Items += item.Count
+			result.ItemsValue += itemSellPrice(item) * item.Count
+		}
+
+		result.CashValue = playerBalances[username]
+		result.BankValue = playerBanks[username]
+		proceeds := result.CashValue + result.BankValue + result.DepositsValue + result.ItemsValue
+		result.Paid = proceeds
+		if result.Paid > result.Debt {
+			result.Paid = result.Debt
+		}
+		result.WrittenOff = result.Debt - result.Paid
+		result.Returned = proceeds - result.Paid
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, bankruptKey(username), result.Until.Unix(), time.Until(result.Until))
+
+			// Наличные и банк изымаются, на баланс возвращается остаток выручки
+			pipe.Set(ctx, fmt.Sprintf("balance:%s", username), result.Returned, 0)
+			pipe.Set(ctx, fmt.Sprintf("bank:%s", username), 0, 0)
+
+			// Закрываем все вклады, в том числе не созревшие
+			pipe.Del(ctx, depositsKey(username))
+
+			// Продаем инвентарь по цене выкупа
+			pipe.Del(ctx, wornKey)
+			pipe.Del(ctx, inventoryKey(username))
+			for _, item := range inventory {
+				pipe.HDel(ctx, itemOwnersKey, item.Hash)
+				pipe.HSet(ctx, itemRecordKey(item.Hash), "owner", "")
+			}
+
+			// Кредит и штраф закрываются целиком
+			if hasLoan {
+				pipe.Del(ctx, loanKey(username))
+				pipe.HIncrBy(ctx, creditStatsKey(username), "loans_defaulted", 1)
+			}
+			pipe.Del(ctx, fmt.Sprintf("fine:%s", username))
+			pipe.HDel(ctx, fineDatesKey, username)
+			pipe.HIncrBy(ctx, creditStatsKey(username), "bankruptcies", 1)
+			return nil
+		})
+		return err
+	}, bankruptKey(username), depositsKey(username), inventoryKey(username), wornKey, loanKey(username))
+
+	if err != nil {
+		log.Printf("declareBankruptcy: Транзакция банкротства %s не выполнена: %v", username, err)
+		if err == redis.TxFailedErr {
+			return result, fmt.Errorf("имущество изменилось во время банкротства, попробуйте еще раз")
+		}
+		return result, err
+	}
+
+	playerBalances[username] = result.Returned
+	playerBanks[username] = 0
+	delete(playerFines, username)
+	delete(playerFineDates, username)
+	for _, item := range inventory {
+		appendItemHistory(item.Hash, ItemEvent{Type: "sold", From: username, Note: "банкротство"})
+	}
+
+	appendJournal(username, JournalEntry{Type: "bankrupt", Amount: result.Returned,
+		Note: fmt.Sprintf("долг %d, погашено %d, списано %d", result.Debt, result.Paid, result.WrittenOff)})
+	log.Printf("declareBankruptcy: %s объявлен банкротом до %s (долг %d, погашено %d, списано %d)",
+		username, result.Until.Format("02.01.2006"), result.Debt, result.Paid, result.WrittenOff)
+	return result, nil
+}
+
+// Функция для получения списка банкротов (username -> окончание статуса)
+func getBankrupts() map[string]time.Time {
+	bankrupts := make(map[string]time.Time)
+	if redisClient == nil {
+		return bankrupts
+	}
+
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, "bankrupt:*")
+	if err != nil {
+		log.Printf("getBankrupts: Ошибка поиска банкротов: %v", err)
+		return bankrupts
+	}
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "bankrupt:")
+		if until, active := getBankruptUntil(username); active {
+			bankrupts[username] = until
+		}
+	}
+	return bankrupts
+}
+
+// Ключ хэша с датой появления аккаунта (username -> unix время)
+const accountsSinceKey = "accounts:since"
+
+// Ключ-отметка о том, что аккаунтам, существовавшим до учета возраста, уже выставлена дата
+const accountsBackfilledKey = "accounts:backfilled"
+
+// Ключ списка подозрительных переводов для администраторов
+const transferAlertsKey = "transfer:alerts"
+
+// Функция для регистрации даты появления аккаунта (существующая дата не перезаписывается)
+func registerAccount(username string) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if err := redisClient.HSetNX(ctx, accountsSinceKey, username, time.Now().Unix()).Err(); err != nil {
+		log.Printf("registerAccount: Ошибка сохранения даты аккаунта %s: %v", username, err)
+	}
+}
+
+// Функция для получения возраста аккаунта, при котором суточный лимит переводов достигает максимума
+func accountMaturityDays() int {
+	config := economyConfig.Transfer
+	if config.LimitPerDay <= 0 || config.MaxDailyLimit <= config.BaseDailyLimit {
+		return 0
+	}
+	return (config.MaxDailyLimit - config.BaseDailyLimit + config.LimitPerDay - 1) / config.LimitPerDay
+}
+
+// Функция для однократной отметки существующих аккаунтов как старых (до учета возраста их дата неизвестна)
+func backfillAccountAges(usernames []string) {
+	if redisClient == nil || len(usernames) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	first, err := redisClient.SetNX(ctx, accountsBackfilledKey, time.Now().Unix(), 0).Result()
+	if err != nil {
+		log.Printf("backfillAccountAges: Ошибка проверки отметки: %v", err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	// Перезаписываем и даты, выставленные при первом запуске учета возраста: это время деплоя, а не появления аккаунта
+	since := time.Now().AddDate(0, 0, -accountMaturityDays()).Unix()
+	values := make(map[string]interface{}, len(usernames))
+	for _, username := range usernames {
+		values[username] = since
+	}
+	if err := redisClient.HSet(ctx, accountsSinceKey, values).Err(); err != nil {
+		log.Printf("backfillAccountAges: Ошибка сохранения дат аккаунтов: %v", err)
+		redisClient.Del(ctx, accountsBackfilledKey)
+		return
+	}
+	log.Printf("backfillAccountAges: %d существующих аккаунтов отмечены как старые (%d дн.)", len(usernames), accountMaturityDays())
+}
+
+// Функция для получения возраста аккаунта в полных днях (аккаунт без даты считается новым)
+func getAccountAgeDays(username string) int {
+	if redisClient == nil {
+		return 0
+	}
+
+	ctx := context.Background()
+	since, err := redisClient.HGet(ctx, accountsSinceKey, username).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("getAccountAgeDays: Ошибка чтения даты аккаунта %s: %v", username, err)
+		} else {
+			log.Printf("getAccountAgeDays: Дата аккаунта %s не найдена, считаем аккаунт новым", username)
+		}
+		return 0
+	}
+	return int(time.Since(time.Unix(since, 0)) / (24 * time.Hour))
+}
+
+// Функция для получения суточного лимита переводов (растет с возрастом аккаунта)
+func getTransferLimit(username string) int {
+	config := economyConfig.Transfer
+	limit := config.BaseDailyLimit + getAccountAgeDays(username)*config.LimitPerDay
+	if limit > config.MaxDailyLimit {
+		limit = config.MaxDailyLimit
+	}
+	return limit
+}
+
+// Функция для получения ключа суммы исходящих переводов игрока за сегодня
+func transferOutKey(username string) string {
+	return fmt.Sprintf("transfer:out:%s:%s", username, time.Now().Format("2006-01-02"))
+}
+
+// Функция для получения суммы исходящих переводов за сегодня
+func getTransferredToday(username string) int {
+	if redisClient == nil {
+		return 0
+	}
+
+	ctx := context.Background()
+	sent, err := redisClient.Get(ctx, transferOutKey(username)).Int()
+	if err != nil && err != redis.Nil {
+		log.Printf("getTransferredToday: Ошибка чтения переводов %s: %v", username, err)
+	}
+	return sent
+}
+
+// Функция для расчета налога на перевод
+func transferTax(value int) int {
+	return value * economyConfig.Transfer.TaxPercent / 100
+}
+
+// Функция для получения общего долга игрока (штраф и остаток кредита)
+func getPlayerDebt(username string) int {
+	debt := playerFines[username]
+	if loan, ok := getLoan(username); ok {
+		debt += loan.Total - loan.Paid
+	}
+	return debt
+}
+
+// Функция для проверки, может ли игрок перевести ценности на указанную сумму
+func checkTransferAllowed(username string, value int) error {
+	if debt := getPlayerDebt(username); debt > 0 {
+		return fmt.Errorf("🚫 Переводы недоступны, пока у вас есть долг (%d %s)! Погасить: /payfine или /loan repay", debt, getChipsWord(debt))
+	}
+
+	limit := getTransferLimit(username)
+	sent := getTransferredToday(username)
+	if sent+value > limit {
+		left := limit - sent
+		if left < 0 {
+			left = 0
+		}
+		return fmt.Errorf("🚫 Превышен суточный лимит переводов! Лимит: %d, осталось сегодня: %d %s\n📅 Лимит растет с возрастом аккаунта (%d дн.)",
+			limit, left, getChipsWord(left), getAccountAgeDays(username))
+	}
+	return nil
+}
+
+// Подозрительный встречный поток переводов между двумя игроками
+type TransferAlert struct {
+	Time     time.Time `json:"time"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Forward  int64     `json:"forward"`  // Переводов From -> To за окно
+	Backward int64     `json:"backward"` // Переводов To -> From за окно
+}
+
+// Функция для получения ключа счетчика переводов от одного игрока другому (окно продлевается с каждым переводом)
+func transferPairKey(from, to string) string {
+	return fmt.Sprintf("transfer:pair:%s:%s", from, to)
+}
+
+// Функция для учета перевода: суточная сумма, счетчик пары и проверка встречных потоков
+func recordTransfer(bot *tgbotapi.BotAPI, from, to string, value int) {
+	if redisClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	config := economyConfig.Transfer
+	window := time.Duration(config.CircularHours) * time.Hour
+	var forward *redis.IntCmd
+	var backward *redis.StringCmd
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, transferOutKey(from), int64(value))
+		pipe.Expire(ctx, transferOutKey(from), 48*time.Hour)
+		forward = pipe.Incr(ctx, transferPairKey(from, to))
+		pipe.Expire(ctx, transferPairKey(from, to), window)
+		backward = pipe.Get(ctx, transferPairKey(to, from))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		log.Printf("recordTransfer: Ошибка учета перевода %s -> %s: %v", from, to, err)
+		return
+	}
+
+	backwardCount, _ := backward.Int64()
+	if forward.Val() < int64(config.CircularThreshold) || backwardCount < int64(config.CircularThreshold) {
+		return
+	}
+
+	// Одна тревога на пару за окно
+	pair := []string{from, to}
+	sort.Strings(pair)
+	alertedKey := fmt.Sprintf("transfer:alerted:%s:%s", pair[0], pair[1])
+	fresh, err := redisClient.SetNX(ctx, alertedKey, 1, window).Result()
+	if err != nil || !fresh {
+		return
+	}
+
+	alert := TransferAlert{Time: time.Now(), From: from, To: to, Forward: forward.Val(), Backward: backwardCount}
+	data, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("recordTransfer: Ошибка сериализации тревоги: %v", err)
+		return
+	}
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, transferAlertsKey, data)
+		pipe.LTrim(ctx, transferAlertsKey, 0, 49)
+		return nil
+	})
+	if err != nil {
+		log.Printf("recordTransfer: Ошибка сохранения тревоги: %v", err)
+	}
+
+	log.Printf("recordTransfer: Встречные переводы между %s и %s (%d/%d)", from, to, alert.Forward, alert.Backward)
+	notifyAdmins(bot, fmt.Sprintf("🚨 Подозрительные встречные переводы: @%s → @%s (%d) и обратно (%d) за %d ч.\nПодробнее: /alerts",
+		from, to, alert.Forward, alert.Backward, config.CircularHours))
+}
+
+// Функция для получения последних тревог по переводам
+func getTransferAlerts(limit int) []TransferAlert {
+	if redisClient == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	values, err := redisClient.LRange(ctx, transferAlertsKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		log.Printf("getTransferAlerts: Ошибка чтения тревог: %v", err)
+		return nil
+	}
+
+	alerts := make([]TransferAlert, 0, len(values))
+	for _, value := range values {
+		var alert TransferAlert
+		if err := json.Unmarshal([]byte(value), &alert); err == nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// Функция для формирования списка тревог по переводам
+func formatTransferAlerts() string {
+	alerts := getTransferAlerts(20)
+	if len(alerts) == 0 {
+		return "✅ Подозрительных переводов не обнаружено."
+	}
+
+	text := "🚨 **ПОДОЗРИТЕЛЬНЫЕ ПЕРЕВОДЫ**\n\n"
+	for _, alert := range alerts {
+		text += fmt.Sprintf("%s @%s ⇄ @%s: %d туда, %d обратно\n",
+			alert.Time.Format("02.01 15:04"), alert.From, alert.To, alert.Forward, alert.Backward)
+	}
+	text += fmt.Sprintf("\n📋 Порог: %d перевода(ов) в каждую сторону за %d ч.",
+		economyConfig.Transfer.CircularThreshold, economyConfig.Transfer.CircularHours)
+	return text
+}
+
+// Функция для сохранения количества туров в Redis
+func saveTotalRoundsToRedis(rounds int) {
+	if redisClient == nil {
+		return
 	}
-}
 
-// Функция для генерации SHA-256 хэша участника
-func hashParticipant(name string) string {
-	hash := sha256.Sum256([]byte(name))
-	return fmt.Sprintf("%x", hash)
+	ctx := context.Background()
+	err := redisClient.Set(ctx, "game:totalRounds", rounds, 0).Err()
+	if err != nil {
+		log.Printf("Ошибка сохранения количества туров: %v", err)
+	}
 }
 
-// Функция для генерации хэша предмета инвентаря
-func generateItemHash(username, prizeName string) string {
-	data := fmt.Sprintf("%s:%s:%d", username, prizeName, time.Now().UnixNano())
-	hash := sha256.Sum256([]byte(data))
-	return fmt.Sprintf("%x", hash)[:6] // Берем первые 6 символов для короткого хэша
-}
+// Функция для получения номера следующей игры
+func nextGameNumber() int64 {
+	if redisClient == nil {
+		return 0
+	}
 
-// Функция для инициализации хэшей всех участников
-func initParticipantHashes() {
-	for name, username := range participantIDs {
-		participantHashes[name] = hashParticipant(username)
+	ctx := context.Background()
+	number, err := redisClient.Incr(ctx, "game:counter").Result()
+	if err != nil {
+		log.Printf("nextGameNumber: Ошибка увеличения счетчика игр: %v", err)
+		return 0
 	}
-}
 
-// Функция для форматирования имени участника
-func formatParticipantName(name string) string {
-	return name
+	return number
 }
 
-// Функция для форматирования имени участника с @username
-func formatParticipantNameWithUsername(name string) string {
-	username := participantIDs[name]
-	baseName := name
+// Функция для загрузки количества туров из Redis
+func loadTotalRoundsFromRedis() (int, bool) {
+	if redisClient == nil {
+		return 0, false
+	}
 
-	if username != "" {
-		baseName = fmt.Sprintf("%s (@%s)", name, username)
+	ctx := context.Background()
+	val, err := redisClient.Get(ctx, "game:totalRounds").Result()
+	if err != nil {
+		return 0, false
 	}
 
-	// Проверяем, есть ли надетая плашка
-	if username != "" {
-		wornData, err := getWornItem(username)
-		if err == nil && wornData != nil {
-			// Добавляем плашку к имени
-			itemName := wornData["name"]
-			baseName = fmt.Sprintf("%s %s", baseName, itemName)
-		}
+	rounds, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
 	}
 
-	return baseName
+	return rounds, true
 }
 
-// Функция для форматирования имени участника только с плашкой (без username)
-func formatParticipantNameWithItem(name string) string {
-	username := participantIDs[name]
-	baseName := name
+// Функция для сохранения ставок в Redis
+func saveBetsToRedis(bets map[string]Bet, key string) {
+	if redisClient == nil {
+		return
+	}
 
-	// Проверяем, есть ли надетая плашка
-	if username != "" {
-		wornData, err := getWornItem(username)
-		if err == nil && wornData != nil {
-			// Добавляем плашку к имени
-			itemName := wornData["name"]
-			baseName = fmt.Sprintf("%s %s", baseName, itemName)
-		}
+	ctx := context.Background()
+	data, err := json.Marshal(bets)
+	if err != nil {
+		log.Printf("Ошибка сериализации ставок: %v", err)
+		return
 	}
 
-	return baseName
+	err = redisClient.Set(ctx, key, data, 0).Err()
+	if err != nil {
+		log.Printf("Ошибка сохранения ставок: %v", err)
+	}
 }
 
-// Функция для правильного склонения слова "фишка"
-func getChipsWord(count int) string {
-	lastDigit := count % 10
-	lastTwoDigits := count % 100
+// Функция для загрузки ставок из Redis
+func loadBetsFromRedis(key string) (map[string]Bet, error) {
+	if redisClient == nil {
+		return make(map[string]Bet), nil
+	}
 
-	// Исключения для чисел 11-14
-	if lastTwoDigits >= 11 && lastTwoDigits <= 14 {
-		return "фишек"
+	ctx := context.Background()
+	val, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return make(map[string]Bet), err
 	}
 
-	// Основные правила
-	switch lastDigit {
-	case 1:
-		return "фишка"
-	case 2, 3, 4:
-		return "фишки"
-	default:
-		return "фишек"
+	var bets map[string]Bet
+	err = json.Unmarshal([]byte(val), &bets)
+	if err != nil {
+		return make(map[string]Bet), err
 	}
+
+	return bets, nil
 }
 
-// Функция для правильного склонения результатов броска монеты
-func getCoinResultText(result gamble.CoinResult) string {
-	switch result {
-	case gamble.Heads:
-		return "выпал орел (1)"
-	case gamble.Tails:
-		return "выпала решка (2)"
-	case gamble.Edge:
-		return "выпало ребро (3)"
-	default:
-		return fmt.Sprintf("выпала %s", result)
-	}
+// Ключ Redis-хэша каталога призов (поле: название приза, значение: JSON приза)
+const prizesKey = "prizes"
+
+// Ключ глобального индекса предметов (поле: хэш предмета, значение: username владельца)
+const itemOwnersKey = "items:owner"
+
+// Функция для получения ключа Redis-хэша инвентаря игрока
+func inventoryKey(username string) string {
+	return fmt.Sprintf("inv:%s", username)
 }
 
-// Функция для преобразования цифры монеты в название
-func getCoinSideName(side string) string {
-	switch side {
-	case "1":
-		return "1 (орел)"
-	case "2":
-		return "2 (решка)"
-	case "3":
-		return "3 (ребро)"
-	default:
-		return side
+// Функция для обхода ключей по шаблону через SCAN (не блокирует Redis, в отличие от KEYS)
+func scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := redisClient.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
 	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
 }
 
-// Функция для надевания плашки пользователем
-func wearItem(username, itemHash string) error {
-	log.Printf("wearItem: Пользователь %s надевает плашку с хэшем %s", username, itemHash)
-
+// Функция для сохранения приза в Redis
+func savePrizeToRedis(prize Prize) error {
 	if redisClient == nil {
 		return fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
 
-	// Проверяем, есть ли такой предмет у пользователя
-	itemKey := fmt.Sprintf("inventory:%s:%s", username, itemHash)
-	itemData, err := redisClient.Get(ctx, itemKey).Result()
+	data, err := json.Marshal(prize)
 	if err != nil {
-		log.Printf("wearItem: Предмет с хэшем %s не найден у пользователя %s", itemHash, username)
-		return fmt.Errorf("предмет не найден в инвентаре")
+		return fmt.Errorf("failed to marshal prize: %v", err)
 	}
 
-	// Парсим данные предмета
-	var item InventoryItem
-	err = json.Unmarshal([]byte(itemData), &item)
+	err = redisClient.HSet(ctx, prizesKey, prize.Name, data).Err()
 	if err != nil {
-		log.Printf("wearItem: Ошибка парсинга предмета %s: %v", itemHash, err)
-		return fmt.Errorf("ошибка обработки предмета")
+		return fmt.Errorf("failed to save prize to Redis: %v", err)
 	}
 
-	// Сохраняем информацию о надетой плашке
-	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
-	wornData := map[string]string{
-		"hash":      itemHash,
-		"name":      item.PrizeName,
-		"rarity":    item.Rarity,
-		"timestamp": fmt.Sprintf("%d", time.Now().Unix()),
+	return nil
+}
+
+// Функция для загрузки приза из Redis
+func loadPrizeFromRedis(name string) (Prize, error) {
+	if redisClient == nil {
+		return Prize{}, fmt.Errorf("Redis client not available")
 	}
 
-	data, err := json.Marshal(wornData)
+	ctx := context.Background()
+
+	val, err := redisClient.HGet(ctx, prizesKey, name).Result()
 	if err != nil {
-		log.Printf("wearItem: Ошибка маршалинга данных плашки: %v", err)
-		return fmt.Errorf("ошибка сохранения")
+		return Prize{}, fmt.Errorf("failed to get prize from Redis: %v", err)
 	}
 
-	err = redisClient.Set(ctx, profileKey, data, 0).Err()
+	var prize Prize
+	err = json.Unmarshal([]byte(val), &prize)
 	if err != nil {
-		log.Printf("wearItem: Ошибка сохранения надетой плашки: %v", err)
-		return fmt.Errorf("ошибка сохранения профиля")
+		return Prize{}, fmt.Errorf("failed to unmarshal prize: %v", err)
 	}
 
-	log.Printf("wearItem: Плашка %s успешно надета пользователем %s", item.PrizeName, username)
-	return nil
+	return prize, nil
 }
 
-// Функция для снятия плашки пользователем
-func unwearItem(username string) error {
-	log.Printf("unwearItem: Пользователь %s снимает плашку", username)
-
+// Функция для загрузки всех призов из Redis
+func loadAllPrizesFromRedis() ([]Prize, error) {
 	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+		return nil, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
-
-	// Проверяем, есть ли надетая плашка
-	exists, err := redisClient.Exists(ctx, profileKey).Result()
+	values, err := redisClient.HGetAll(ctx, prizesKey).Result()
 	if err != nil {
-		log.Printf("unwearItem: Ошибка проверки профиля: %v", err)
-		return fmt.Errorf("ошибка проверки профиля")
+		return nil, fmt.Errorf("failed to get prizes: %v", err)
 	}
 
-	if exists == 0 {
-		log.Printf("unwearItem: У пользователя %s нет надетой плашки", username)
-		return fmt.Errorf("нет надетой плашки")
-	}
+	var prizes []Prize
+	for name, val := range values {
+		var prize Prize
+		err = json.Unmarshal([]byte(val), &prize)
+		if err != nil {
+			log.Printf("Warning: failed to unmarshal prize %s: %v", name, err)
+			continue
+		}
 
-	// Удаляем информацию о надетой плашке
-	err = redisClient.Del(ctx, profileKey).Err()
-	if err != nil {
-		log.Printf("unwearItem: Ошибка удаления надетой плашки: %v", err)
-		return fmt.Errorf("ошибка снятия плашки")
+		prizes = append(prizes, prize)
 	}
 
-	log.Printf("unwearItem: Плашка успешно снята у пользователя %s", username)
-	return nil
+	return prizes, nil
 }
 
-// Функция для получения информации о надетой плашке
-func getWornItem(username string) (map[string]string, error) {
+// Функция для удаления всех призов из Redis
+func removeAllPrizesFromRedis() error {
 	if redisClient == nil {
-		return nil, fmt.Errorf("Redis client not available")
+		return fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	profileKey := fmt.Sprintf("profile:%s:worn_item", username)
-
-	data, err := redisClient.Get(ctx, profileKey).Result()
+	count, err := redisClient.HLen(ctx, prizesKey).Result()
 	if err != nil {
-		return nil, err // Возвращаем ошибку, если плашка не надета
+		return fmt.Errorf("failed to count prizes: %v", err)
 	}
 
-	var wornData map[string]string
-	err = json.Unmarshal([]byte(data), &wornData)
+	if count == 0 {
+		return nil // Нет призов для удаления
+	}
+
+	err = redisClient.Del(ctx, prizesKey).Err()
 	if err != nil {
-		log.Printf("getWornItem: Ошибка парсинга данных плашки для %s: %v", username, err)
-		return nil, err
+		return fmt.Errorf("failed to delete prizes from Redis: %v", err)
 	}
 
-	return wornData, nil
+	log.Printf("Удалено %d призов из Redis", count)
+	return nil
 }
 
-// Функция для получения имени участника по username
-func getParticipantNameByUsername(username string) string {
-	for name, uname := range participantIDs {
-		if uname == username {
-			return name
-		}
-	}
-	return username // Если не найдено, возвращаем username
-}
+// Файл каталога призов
+const prizesFile = "prizes.json"
 
-// Функция для выплаты выигрышей по ставкам и формирования текста результатов
-func payoutWinnings(bot *tgbotapi.BotAPI, winner string, loser string) string {
-	log.Printf("💰 payoutWinnings: === НАЧАЛО ВЫПЛАТЫ ВЫИГРЫШЕЙ ===")
-	log.Printf("payoutWinnings: Функция ВЫЗВАНА! Победитель: %s, Проигравший: %s", winner, loser)
-	log.Printf("payoutWinnings: isGameActive=%t", isGameActive)
-	log.Printf("payoutWinnings: Количество ставок - initial: %d, final: %d", len(initialBets), len(finalBets))
+// Ключ версии каталога призов (увеличивается при каждом изменении)
+const prizesVersionKey = "prizes:version"
 
-	// DEBUG: Показать все ставки
-	log.Printf("payoutWinnings: DEBUG: Initial ставки:")
-	for username, bet := range initialBets {
-		log.Printf("payoutWinnings:   %s -> %s (хэш: %s)", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...")
-	}
-	log.Printf("payoutWinnings: DEBUG: Final ставки:")
-	for username, bet := range finalBets {
-		log.Printf("payoutWinnings:   %s -> %s (хэш: %s)", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...")
+// Функция для чтения конфига призов из файла
+func readPrizeConfigFile() (PrizeConfig, error) {
+	var config PrizeConfig
+
+	data, err := os.ReadFile(prizesFile)
+	if err != nil {
+		return config, fmt.Errorf("failed to read %s: %v", prizesFile, err)
 	}
 
-	// DEBUG: Показать все хэши участников
-	log.Printf("payoutWinnings: DEBUG: Все хэши участников:")
-	for name, hash := range participantHashes {
-		log.Printf("payoutWinnings:   %s -> %s (username: %s)", name, hash[:8]+"...", participantIDs[name])
+	// Неизвестные поля считаем ошибкой схемы (например, опечатка "rarty")
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %v", prizesFile, err)
 	}
 
-	// Всегда формируем сообщение с результатами ставок
-	resultsText := "🏆 РЕЗУЛЬТАТЫ СТАВОК:\n\n"
+	return config, nil
+}
 
-	// Если нет ставок, все равно показываем сообщение с результатами
-	if len(initialBets) == 0 && len(finalBets) == 0 {
-		log.Printf("payoutWinnings: ❌ Нет ставок для обработки")
-		resultsText += "❌ В этом раунде ставок не было сделано.\n"
-		log.Printf("payoutWinnings: Возвращаем сообщение без ставок: '%s'", resultsText)
-		return resultsText
+// Функция для записи конфига призов в файл (через временный файл, чтобы не оставить его битым)
+func writePrizeConfigFile(config PrizeConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal prize config: %v", err)
 	}
 
-	log.Printf("payoutWinnings: ✅ Есть ставки для обработки")
-
-	// Получаем хэш победителя
-	winnerHash := participantHashes[winner]
-	if winnerHash == "" {
-		log.Printf("payoutWinnings: Ошибка: хэш победителя %s не найден", winner)
-		log.Printf("payoutWinnings: DEBUG: доступные хэши участников:")
-		for name, hash := range participantHashes {
-			log.Printf("payoutWinnings:   %s -> %s (первые 5: %s)", name, hash, hash[:5])
-		}
-		return resultsText
+	tmpFile := prizesFile + ".tmp"
+	if err := os.WriteFile(tmpFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", tmpFile, err)
 	}
 
-	log.Printf("payoutWinnings: Победитель %s имеет хэш %s (первые 5: %s)", winner, winnerHash, winnerHash[:5])
+	return os.Rename(tmpFile, prizesFile)
+}
 
-	// Выплачиваем выигрыши по начальным ставкам (коэффициент x30)
-	if len(initialBets) > 0 {
-		log.Printf("payoutWinnings: 🎯 Обрабатываем начальные ставки (x30), количество: %d", len(initialBets))
-		resultsText += "💰 *Начальные ставки (x30):*\n"
-		log.Printf("payoutWinnings: Начальные ставки найдены, добавляем в resultsText")
-		for username, bet := range initialBets {
-			log.Printf("payoutWinnings: Проверяем начальную ставку %s: ставка на %s (хэш %s), сумма %d", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...", bet.Amount)
-			log.Printf("payoutWinnings: Победитель: %s (хэш %s)", winner, winnerHash[:8]+"...")
+// Функция для получения текущей версии каталога призов
+func getPrizeCatalogVersion() int64 {
+	if redisClient == nil {
+		return 0
+	}
 
-			if bet.ParticipantName == winner {
-				// Ставка выиграла! Выплачиваем 30 фишек
-				winnings := bet.Amount * 30
-				log.Printf("payoutWinnings: Начальная ставка выиграла! %s ставил на %s, выигрыш %d фишек", username, bet.ParticipantName, winnings)
-				oldBalance := playerBalances[username]
-				changeBalance(username, winnings)
-				log.Printf("payoutWinnings: ✅ ВЫИГРЫШ! Баланс %s изменен с %d на %d (выигрыш %d фишек)", username, oldBalance, playerBalances[username], winnings)
+	ctx := context.Background()
+	version, err := redisClient.Get(ctx, prizesVersionKey).Int64()
+	if err != nil {
+		return 0
+	}
 
-				resultsText += fmt.Sprintf("✅ @%s: +%d фишек (ставка %d на %s)\n",
-					username, winnings, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+	return version
+}
 
-				log.Printf("payoutWinnings: Выплачен выигрыш по начальной ставке: %s выиграл %d фишек (ставка %d)", username, winnings, bet.Amount)
-			} else {
-				log.Printf("payoutWinnings: ❌ ПРОИГРЫШ: ставка %s на %s (не победитель)", username, bet.ParticipantName)
-				resultsText += fmt.Sprintf("❌ @%s: проигрыш (ставка %d на %s)\n",
-					username, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+// Функция для загрузки призов из JSON файла в Redis
+func loadPrizesFromFileToRedis() error {
+	// Загружаем призы из файла
+	config, err := readPrizeConfigFile()
+	if err != nil {
+		return err
+	}
 
-				log.Printf("payoutWinnings: Проиграна начальная ставка: %s (ставка %d)", username, bet.Amount)
-			}
-		}
-		resultsText += "\n"
-	} else {
-		log.Printf("payoutWinnings: Начальных ставок нет")
+	if errs := validatePrizeConfig(config); len(errs) > 0 {
+		return fmt.Errorf("prizes.json не прошел проверку: %s", strings.Join(errs, "; "))
 	}
 
-	// Выплачиваем выигрыши по финальным ставкам (коэффициент x2)
-	if len(finalBets) > 0 {
-		log.Printf("payoutWinnings: 🎯 Обрабатываем финальные ставки (x2), количество: %d", len(finalBets))
-		resultsText += "💰 *Финальные ставки (x2):*\n"
-		log.Printf("payoutWinnings: Финальные ставки найдены, добавляем в resultsText")
-		for username, bet := range finalBets {
-			log.Printf("payoutWinnings: Проверяем финальную ставку %s: ставка на %s (хэш %s), сумма %d", username, bet.ParticipantName, bet.ParticipantHash[:8]+"...", bet.Amount)
-			log.Printf("payoutWinnings: Победитель: %s (хэш %s)", winner, winnerHash[:8]+"...")
+	return applyPrizeConfig(config)
+}
 
-			if bet.ParticipantName == winner {
-				// Ставка выиграла! Выплачиваем 2 фишки
-				winnings := bet.Amount * 2
-				log.Printf("payoutWinnings: Финальная ставка выиграла! %s ставил на %s, выигрыш %d фишек", username, bet.ParticipantName, winnings)
-				oldBalance := playerBalances[username]
-				changeBalance(username, winnings)
-				log.Printf("payoutWinnings: ✅ ВЫИГРЫШ! Баланс %s изменен с %d на %d (выигрыш %d фишек)", username, oldBalance, playerBalances[username], winnings)
+// Функция для проверки конфига призов по схеме, возвращает список ошибок
+func validatePrizeConfig(config PrizeConfig) []string {
+	var errs []string
 
-				resultsText += fmt.Sprintf("✅ @%s: +%d фишек (ставка %d на %s)\n",
-					username, winnings, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+	if err := validateRarityTiers(config.Rarities); err != nil {
+		errs = append(errs, err.Error())
+	}
+	tiers := config.Rarities
+	if len(tiers) == 0 {
+		tiers = defaultRarityTiers
+	}
+	knownRarities := make(map[string]bool, len(tiers))
+	for _, tier := range tiers {
+		knownRarities[tier.Name] = true
+	}
 
-				log.Printf("payoutWinnings: Выплачен выигрыш по финальной ставке: %s выиграл %d фишек (ставка %d)", username, winnings, bet.Amount)
-			} else {
-				log.Printf("payoutWinnings: ❌ ПРОИГРЫШ: финальная ставка %s на %s (не победитель)", username, bet.ParticipantName)
-				resultsText += fmt.Sprintf("❌ @%s: проигрыш (ставка %d на %s)\n",
-					username, bet.Amount, formatParticipantNameWithUsername(bet.ParticipantName))
+	if len(config.Prizes) == 0 {
+		errs = append(errs, "список prizes пуст")
+	}
 
-				log.Printf("payoutWinnings: Проиграна финальная ставка: %s (ставка %d)", username, bet.Amount)
+	names := make(map[string]bool)
+	ids := make(map[string]bool)
+	for i, prize := range config.Prizes {
+		where := fmt.Sprintf("приз #%d (%s)", i+1, prize.Name)
+		if strings.TrimSpace(prize.Name) == "" {
+			errs = append(errs, fmt.Sprintf("приз #%d: пустое название", i+1))
+		}
+		if names[strings.ToLower(prize.Name)] {
+			errs = append(errs, where+": название повторяется")
+		}
+		names[strings.ToLower(prize.Name)] = true
+		if prize.ID != "" {
+			if ids[prize.ID] {
+				errs = append(errs, where+": id "+prize.ID+" повторяется")
 			}
+			ids[prize.ID] = true
 		}
-	} else {
-		log.Printf("payoutWinnings: Финальных ставок нет")
-	}
-
-	// Очищаем ставки после выплаты
-	log.Printf("payoutWinnings: Очищаем ставки после выплаты")
-	initialBets = make(map[string]Bet)
-	finalBets = make(map[string]Bet)
-	log.Printf("payoutWinnings: Ставки очищены в памяти")
-
-	// Очищаем Redis
-	if redisClient != nil {
-		ctx := context.Background()
-		err := redisClient.Del(ctx, "game:initialBets", "game:finalBets").Err()
-		if err != nil {
-			log.Printf("payoutWinnings: ❌ Ошибка очистки ставок в Redis: %v", err)
-		} else {
-			log.Printf("payoutWinnings: ✅ Ставки очищены в Redis")
+		if !knownRarities[prize.Rarity] {
+			errs = append(errs, where+": неизвестная редкость "+prize.Rarity)
+		}
+		if prize.Cost <= 0 {
+			errs = append(errs, where+": стоимость должна быть положительной")
+		}
+		if prize.MaxSupply < 0 || prize.Weight < 0 {
+			errs = append(errs, where+": тираж и вес не могут быть отрицательными")
 		}
-	} else {
-		log.Printf("payoutWinnings: Redis клиент недоступен, ставки очищены только в памяти")
 	}
 
-	// Выдаем приз победителю - используем плашку, выбранную в начале игры
-	log.Printf("payoutWinnings: Выдаем приз победителю %s", winner)
-	log.Printf("payoutWinnings: Используем плашку из игры: %s (%s)", currentPrize.Name, currentPrize.Rarity)
+	if config.Pity != nil && (config.Pity.Threshold < 0 || config.Pity.Step < 0) {
+		errs = append(errs, "pity: threshold и step не могут быть отрицательными")
+	}
 
-	if currentPrize.Name == "" {
-		log.Printf("payoutWinnings: ОШИБКА: currentPrize пустой!")
-		resultsText += fmt.Sprintf("\n\n🎁 Ошибка: плашка не была выбрана!")
-	} else {
-		// Находим username победителя
-		winnerUsername := participantIDs[winner]
-		log.Printf("payoutWinnings: participantIDs содержит %d записей", len(participantIDs))
-		for name, uname := range participantIDs {
-			log.Printf("payoutWinnings: participantIDs[%s] = %s", name, uname)
-		}
-		log.Printf("payoutWinnings: Ищем username для winner='%s'", winner)
-		winnerUsername = participantIDs[winner]
-		log.Printf("payoutWinnings: Победитель %s, username: %s", winner, winnerUsername)
+	return errs
+}
 
-		if winnerUsername == "" {
-			log.Printf("payoutWinnings: ОШИБКА: username победителя пустой!")
-			resultsText += fmt.Sprintf("\n\n🎁 Ошибка определения победителя!")
-		} else {
-			err := givePrizeToWinner(winnerUsername, currentPrize)
-			if err != nil {
-				log.Printf("payoutWinnings: Ошибка выдачи приза: %v", err)
-				resultsText += fmt.Sprintf("\n\n🎁 Ошибка выдачи приза!")
-			} else {
-				log.Printf("payoutWinnings: Приз %s успешно выдан победителю %s", currentPrize.Name, winnerUsername)
-				resultsText += fmt.Sprintf("\n\n🎁 Победитель получает плашку: **%s**!", currentPrize.Name)
+// Функция для поиска приза из каталога, соответствующего призу из файла (по id, затем по названию)
+func matchCatalogPrize(catalog []Prize, prize Prize) (Prize, bool) {
+	if prize.ID != "" {
+		for _, existing := range catalog {
+			if existing.ID == prize.ID {
+				return existing, true
 			}
 		}
 	}
+	for _, existing := range catalog {
+		if existing.Name == prize.Name && (existing.ID == "" || prize.ID == "" || existing.ID == prize.ID) {
+			return existing, true
+		}
+	}
+	return Prize{}, false
+}
 
-	log.Printf("payoutWinnings: === ВЫПЛАТА ВЫИГРЫШЕЙ ЗАВЕРШЕНА ===")
-	previewLen := 100
-	if len(resultsText) < previewLen {
-		previewLen = len(resultsText)
+// Функция для описания изменившихся полей приза
+func describePrizeChanges(old, new Prize) []string {
+	var changes []string
+	if old.ID != new.ID {
+		changes = append(changes, fmt.Sprintf("id: %q → %q", old.ID, new.ID))
 	}
-	log.Printf("payoutWinnings: Финальный resultsText длина = %d, первые %d символов: '%s...'", len(resultsText), previewLen, resultsText[:previewLen])
-	log.Printf("payoutWinnings: Возвращаемый текст результатов: '%s'", resultsText)
-	return resultsText
+	if old.Name != new.Name {
+		changes = append(changes, fmt.Sprintf("название: %s → %s", old.Name, new.Name))
+	}
+	if old.Rarity != new.Rarity {
+		changes = append(changes, fmt.Sprintf("редкость: %s → %s", old.Rarity, new.Rarity))
+	}
+	if old.Cost != new.Cost {
+		changes = append(changes, fmt.Sprintf("стоимость: %d → %d", old.Cost, new.Cost))
+	}
+	if old.Description != new.Description || old.Emoji != new.Emoji {
+		changes = append(changes, "описание/эмодзи")
+	}
+	if old.MaxSupply != new.MaxSupply {
+		changes = append(changes, fmt.Sprintf("тираж: %d → %d", old.MaxSupply, new.MaxSupply))
+	}
+	if old.Weight != new.Weight {
+		changes = append(changes, fmt.Sprintf("вес: %d → %d", old.Weight, new.Weight))
+	}
+	if old.Disabled != new.Disabled {
+		changes = append(changes, fmt.Sprintf("выключена: %t → %t", old.Disabled, new.Disabled))
+	}
+	return changes
 }
 
-// Функция для выполнения раунда игры
-func performGameRound(bot *tgbotapi.BotAPI, roundNumber int) string {
-	log.Printf("performGameRound: Вызвана с roundNumber=%d, len(participants)=%d, totalRounds=%d, isGameActive=%t", roundNumber, len(participants), totalRounds, isGameActive)
-	log.Printf("performGameRound: Участники: %v", participants)
-	if len(participants) == 0 {
-		isGameActive = false
-		return "Игра уже окончена!"
-	} else if len(participants) == 1 {
-		// Финальный раунд: последний участник выигрывает
-		winner := participants[0]
+// Функция для построения текста различий между каталогом в Redis и конфигом из файла
+// (пустая строка - различий нет)
+func diffPrizeConfig(catalog []Prize, config PrizeConfig) string {
+	var added, changed, removed []string
 
-		// Показываем полную информацию о выигранной плашке
-		rarityText := ""
-		switch currentPrize.Rarity {
-		case "common":
-			rarityText = "ОБЫЧНАЯ"
-		case "rare":
-			rarityText = "РЕДКАЯ"
-		case "legendary":
-			rarityText = "ЛЕГЕНДАРНАЯ"
-		default:
-			rarityText = "НЕИЗВЕСТНАЯ"
+	matched := make(map[string]bool)
+	for _, prize := range config.Prizes {
+		existing, ok := matchCatalogPrize(catalog, prize)
+		if !ok {
+			added = append(added, fmt.Sprintf("➕ %s [%s, %d фишек]", prize.Name, prize.Rarity, prize.Cost))
+			continue
 		}
-
-		finalText := fmt.Sprintf("🏆🏆🏆 %s, ПОЗДРАВЛЯЕМ!! Вы выиграли плашку \"%s\" (%s)!\n\n🐩 Игра окончена!", formatParticipantNameWithUsername(winner), currentPrize.Name, rarityText)
-		participants = []string{} // Полностью очищаем список
-		isGameActive = false
-		return finalText
-	} else if len(participants) == 2 {
-		log.Printf("🎯 performGameRound: === НАЧАЛО ФИНАЛЬНОЙ ИГРЫ ===")
-		log.Printf("performGameRound: Осталось 2 участника, начинаем финальную последовательность")
-		log.Printf("performGameRound: Участники финала: %v", participants)
-
-		// ФАЗА 1: Финальный раунд (30 секунд)
-		log.Printf("performGameRound: ФАЗА 1 - Показываем финальный раунд на 30 секунд")
-		finalRoundText := "🎯 ФИНАЛЬНЫЙ РАУНД!\n\n"
-		finalRoundText += "🏆 ФИНАЛИСТЫ:\n"
-		for i, participant := range participants {
-			finalRoundText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
+		matched[existing.Name] = true
+		if changes := describePrizeChanges(existing, prize); len(changes) > 0 {
+			changed = append(changed, fmt.Sprintf("✏️ %s: %s", existing.Name, strings.Join(changes, ", ")))
 		}
-		finalRoundText += "\n⏰ Через 5 секунд начнутся финальные ставки!"
+	}
 
-		// Отправляем новое сообщение вместо редактирования старого
-		roundMsg := tgbotapi.NewMessage(gameChatID, finalRoundText)
-		if _, err := bot.Send(roundMsg); err != nil {
-			log.Printf("performGameRound: Ошибка отправки сообщения финального раунда: %v", err)
+	circulation, _ := getPrizeCirculation()
+	for _, existing := range catalog {
+		if matched[existing.Name] {
+			continue
 		}
-
-		log.Printf("performGameRound: Ждем 5 секунд финального раунда...")
-		select {
-		case <-time.After(5 * time.Second):
-			log.Printf("performGameRound: Финальный раунд завершен")
-		case <-gameCancel:
-			log.Printf("performGameRound: Финальный раунд отменен")
-			return "Игра была отменена"
+		line := fmt.Sprintf("➖ %s [%s]", existing.Name, existing.Rarity)
+		if n := circulation[existing.Name]; n > 0 {
+			line += fmt.Sprintf(" ⚠️ у игроков %d экз.", n)
 		}
+		removed = append(removed, line)
+	}
 
-		// ФАЗА 2: Финальные ставки (30 секунд)
-		log.Printf("performGameRound: ФАЗА 2 - Запускаем финальные ставки на 30 секунд")
-		bettingPhase = "final"
+	text := ""
+	for _, section := range [][]string{added, changed, removed} {
+		for _, line := range section {
+			text += line + "\n"
+		}
+	}
 
-		// Для финальных ставок используем простые номера 1 и 2
-		bettingParticipants = make([]string, len(participants))
-		copy(bettingParticipants, participants)
-		finalBettingNumbers = []int{1, 2}
+	// Уровни редкости и гарант сравниваем целиком
+	newTiers := config.Rarities
+	if len(newTiers) == 0 {
+		newTiers = defaultRarityTiers
+	}
+	oldTiersJSON, _ := json.Marshal(rarityTiers)
+	newTiersJSON, _ := json.Marshal(newTiers)
+	if !bytes.Equal(oldTiersJSON, newTiersJSON) {
+		text += "⚙️ Изменены уровни редкости\n"
+	}
+	oldPityJSON, _ := json.Marshal(pityConfig)
+	newPityJSON, _ := json.Marshal(config.Pity)
+	if !bytes.Equal(oldPityJSON, newPityJSON) {
+		text += "⚙️ Изменены настройки гаранта легендарки\n"
+	}
 
-		finalBetText := "🎯 ФИНАЛЬНЫЕ СТАВКИ!\n\n"
-		finalBetText += "🏆 ОСТАЛИСЬ ДВА УЧАСТНИКА:\n"
-		for i, participant := range bettingParticipants {
-			finalBetText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
-		}
-		finalBetText += "\n💰 ФИНАЛЬНЫЕ СТАВКИ ОТКРЫТЫ!\n"
-		finalBetText += "🎯 Ставьте на победителя: /bet N СУММА\n"
-		finalBetText += "💎 Коэффициент: x2\n"
-		finalBetText += "⏰ Время на ставки: 30 сек\n"
+	return text
+}
 
-		// Отправляем новое сообщение вместо редактирования старого
-		betMsg := tgbotapi.NewMessage(gameChatID, finalBetText)
-		if _, err := bot.Send(betMsg); err != nil {
-			log.Printf("performGameRound: Ошибка отправки сообщения финальных ставок: %v", err)
+// Функция для получения актуальных названий призов по id
+func prizeNamesByID() map[string]string {
+	names := make(map[string]string)
+	catalog, err := loadAllPrizesFromRedis()
+	if err != nil {
+		log.Printf("prizeNamesByID: Ошибка загрузки каталога: %v", err)
+		return names
+	}
+	for _, prize := range catalog {
+		if prize.ID != "" {
+			names[prize.ID] = prize.Name
 		}
+	}
+	return names
+}
 
-		log.Printf("performGameRound: Ждем 30 секунд финальных ставок...")
-		startTime := time.Now()
-		time.Sleep(30 * time.Second)
-		elapsed := time.Since(startTime)
-		log.Printf("performGameRound: Финальные ставки завершены, прошло времени: %.2f секунд", elapsed.Seconds())
-
-		bettingPhase = "closed"
-		log.Printf("performGameRound: Финальные ставки завершены, переходим к определению победителя")
+// Функция для подстановки в предмет текущего названия приза (после переименования по id)
+func resolveItemPrizeName(item *InventoryItem, names map[string]string) {
+	if item.PrizeID == "" {
+		return
+	}
+	if name, ok := names[item.PrizeID]; ok {
+		item.PrizeName = name
+	}
+}
 
-		// Проводим финальную игру
-		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(2))
-		winnerIndex := int(randomIndex.Int64())
-		winner := participants[winnerIndex]
-		loser := participants[1-winnerIndex]
+// Функция для выдачи нового id приза, добавленного через /prizeadmin
+func newPrizeID(catalog []Prize) string {
+	used := make(map[string]bool, len(catalog))
+	for _, prize := range catalog {
+		used[prize.ID] = true
+	}
+	for n := len(catalog) + 1; ; n++ {
+		if id := fmt.Sprintf("prize_%d", n); !used[id] {
+			return id
+		}
+	}
+}
 
-		log.Printf("performGameRound: 🎲 Рандомизация завершена:")
-		log.Printf("performGameRound:   randomIndex = %d", randomIndex)
-		log.Printf("performGameRound:   winnerIndex = %d", winnerIndex)
-		log.Printf("performGameRound:   winner = %s, loser = %s", winner, loser)
-		log.Printf("performGameRound:   winner hash = %s", participantHashes[winner])
+// Функция для применения проверенного конфига призов: переименования по id, удаления, версия
+func applyPrizeConfig(config PrizeConfig) error {
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
 
-		winnerUsername := participantIDs[winner]
-		loserUsername := participantIDs[loser]
+	ctx := context.Background()
+	catalog, err := loadAllPrizesFromRedis()
+	if err != nil {
+		return err
+	}
+	changed := diffPrizeConfig(catalog, config) != ""
 
-		log.Printf("performGameRound: Username финалистов:")
-		log.Printf("performGameRound:   winnerUsername: %s", winnerUsername)
-		log.Printf("performGameRound:   loserUsername: %s", loserUsername)
+	if err := applyRarityTiers(config.Rarities); err != nil {
+		return fmt.Errorf("invalid rarities in prizes.json: %v", err)
+	}
+	pityConfig = config.Pity
 
-		finalResultText := fmt.Sprintf("☹️ К сожалению! %s не получает плашку в финале!\n", formatParticipantNameWithUsername(loser))
-		finalResultText += "ничего страшного, повезет в следующей игре 🍀!\n\n"
+	matched := make(map[string]bool)
+	for _, prize := range config.Prizes {
+		if existing, ok := matchCatalogPrize(catalog, prize); ok {
+			matched[existing.Name] = true
 
-		// Показываем полную информацию о выигранной плашке
-		rarityText := ""
-		switch currentPrize.Rarity {
-		case "common":
-			rarityText = "ОБЫЧНАЯ"
-		case "rare":
-			rarityText = "РЕДКАЯ"
-		case "legendary":
-			rarityText = "ЛЕГЕНДАРНАЯ"
-		default:
-			rarityText = "НЕИЗВЕСТНАЯ"
+			// Переименование по id: предметы игроков ссылаются на id и получат новое название сами
+			if existing.Name != prize.Name {
+				redisClient.HDel(ctx, prizesKey, existing.Name)
+				log.Printf("applyPrizeConfig: Приз %s переименован в %s", existing.Name, prize.Name)
+			}
+
+			// Счетчик тиража переезжает, если ключ приза сменился (появился id)
+			if oldKey, newKey := prizeKey(existing), prizeKey(prize); oldKey != newKey {
+				if minted, err := redisClient.HGet(ctx, prizeMintedKey, oldKey).Int(); err == nil {
+					redisClient.HIncrBy(ctx, prizeMintedKey, newKey, int64(minted))
+					redisClient.HDel(ctx, prizeMintedKey, oldKey)
+				}
+				if free, err := redisClient.ZRangeWithScores(ctx, prizeFreeSerialsKey(oldKey), 0, -1).Result(); err == nil && len(free) > 0 {
+					redisClient.ZAdd(ctx, prizeFreeSerialsKey(newKey), free...)
+					redisClient.Del(ctx, prizeFreeSerialsKey(oldKey))
+				}
+			}
 		}
 
-		finalResultText += fmt.Sprintf("🏆🏆🏆 %s, ПОЗДРАВЛЯЕМ!! Вы выиграли плашку \"%s\" (%s)!\n", formatParticipantNameWithUsername(winner), currentPrize.Name, rarityText)
+		if err := savePrizeToRedis(prize); err != nil {
+			log.Printf("Warning: failed to save prize %s: %v", prize.Name, err)
+		}
+	}
 
-		finalResultText += "\n\n🐩 Игра окончена!"
+	// Призы, которых больше нет в файле, удаляем из каталога (предметы игроков остаются)
+	for _, existing := range catalog {
+		if !matched[existing.Name] {
+			redisClient.HDel(ctx, prizesKey, existing.Name)
+			log.Printf("applyPrizeConfig: Приз %s удален из каталога", existing.Name)
+		}
+	}
 
-		log.Printf("performGameRound: Финальное сообщение сформировано")
-		log.Printf("performGameRound: Очищаем список участников и завершаем игру")
+	// Версия каталога не должна откатываться назад при повторной загрузке файла
+	if config.Version > getPrizeCatalogVersion() {
+		redisClient.Set(ctx, prizesVersionKey, config.Version, 0)
+	} else if changed {
+		redisClient.Incr(ctx, prizesVersionKey)
+	}
 
-		participants = []string{} // Полностью очищаем список
-		isGameActive = false
+	log.Printf("Загружено %d призов в Redis из prizes.json (версия каталога %d)", len(config.Prizes), getPrizeCatalogVersion())
+	return nil
+}
 
-		// Отправляем НОВОЕ сообщение с результатами игры (не редактируем старое)
-		log.Printf("performGameRound: Отправляем новое сообщение с финальными результатами")
-		gameResultMsg := tgbotapi.NewMessage(gameChatID, finalResultText)
-		if _, err := bot.Send(gameResultMsg); err != nil {
-			log.Printf("performGameRound: Ошибка отправки сообщения с результатами игры: %v", err)
-		} else {
-			log.Printf("performGameRound: Новое сообщение с результатами игры отправлено успешно")
-		}
+// Ожидающая подтверждения перезагрузка prizes.json
+type PrizeReload struct {
+	Config  PrizeConfig
+	Diff    string
+	Version int64 // версия каталога, с которой сравнивался файл
+}
 
-		log.Printf("performGameRound: Игра окончена, вызываем payoutWinnings")
-		log.Printf("performGameRound: Финальные ставки для выплат: %d ставок", len(finalBets))
+var pendingPrizeReload *PrizeReload
+var prizeReloadMu sync.Mutex
 
-		// Выплачиваем выигрыши и получаем текст результатов ставок
-		log.Printf("performGameRound: Начинаем выплаты. Победитель: %s, Проигравший: %s", winner, loser)
-		betsResultsText := payoutWinnings(bot, winner, loser)
-		log.Printf("performGameRound: betsResultsText длина = %d, пустой = %t", len(betsResultsText), betsResultsText == "")
-		log.Printf("performGameRound: betsResultsText = '%s'", betsResultsText)
+// Ключ Redis с личными чатами игроков (username -> id пользователя Telegram)
+const userChatsKey = "users:chat"
 
-		// Отправляем сообщение с результатами ставок только если есть ставки
-		if betsResultsText != "" {
-			log.Printf("performGameRound: Отправляем сообщение с результатами ставок в чат %d", gameChatID)
-			betsMsg := tgbotapi.NewMessage(gameChatID, betsResultsText)
-			betsMsg.ParseMode = "Markdown"
-			sentMsg, err := bot.Send(betsMsg)
-			if err != nil {
-				log.Printf("performGameRound: Ошибка отправки сообщения с результатами ставок: %v", err)
-				log.Printf("performGameRound: Текст сообщения: %s", betsResultsText)
-			} else {
-				log.Printf("performGameRound: Сообщение с результатами ставок отправлено успешно, messageID: %d", sentMsg.MessageID)
-			}
-		} else {
-			log.Printf("performGameRound: Нет ставок, сообщение с результатами не отправляется")
-		}
+// Администраторы, которым приходят служебные уведомления
+var adminUsernames = []string{"hunnidstooblue", "iamnothiding"}
 
-		log.Printf("performGameRound: payoutWinnings завершен")
-		log.Printf("performGameRound: === ФИНАЛЬНАЯ ИГРА ЗАВЕРШЕНА ===")
+// Функция для запоминания id пользователя: по нему бот пишет игроку в личные сообщения
+func rememberUserChat(username string, userID int64) {
+	if redisClient == nil || username == "" {
+		return
+	}
+	ctx := context.Background()
+	redisClient.HSet(ctx, userChatsKey, username, userID)
+}
 
-		return ""
-	} else {
-		// Обычный раунд: выбираем случайного участника для удаления
-		randomIndex, _ := rand.Int(rand.Reader, big.NewInt(int64(len(participants))))
-		loserIndex := int(randomIndex.Int64())
-		removedParticipant := participants[loserIndex]
+// Функция для отправки личного сообщения игроку (false - бот не знает игрока или тот не начал с ботом диалог)
+func notifyUser(bot *tgbotapi.BotAPI, username, text string) bool {
+	if redisClient == nil {
+		return false
+	}
 
-		// Добавляем в список выбывших и удаляем из активных участников
-		eliminatedParticipants = append(eliminatedParticipants, removedParticipant)
-		participants = append(participants[:loserIndex], participants[loserIndex+1:]...)
+	ctx := context.Background()
+	userID, err := redisClient.HGet(ctx, userChatsKey, username).Int64()
+	if err != nil {
+		log.Printf("notifyUser: Личный чат %s неизвестен", username)
+		return false
+	}
 
-		// Формируем полное обновляемое сообщение
-		gameText := "🎮 ИГРА ИДЁТ!\n\n"
+	if _, err := bot.Send(tgbotapi.NewMessage(userID, text)); err != nil {
+		log.Printf("notifyUser: Ошибка отправки сообщения %s: %v", username, err)
+		return false
+	}
+	return true
+}
 
-		// Показываем редкость будущей плашки
-		rarityText := ""
-		switch currentPrize.Rarity {
-		case "common":
-			rarityText = "ОБЫЧНАЯ"
-		case "rare":
-			rarityText = "РЕДКАЯ"
-		case "legendary":
-			rarityText = "ЛЕГЕНДАРНАЯ"
-		}
-		gameText += fmt.Sprintf("🎁 БУДЕТ РАЗЫГРАНА %s ПЛАШКА!\n\n", rarityText)
+// Функция для уведомления игрока: в личные сообщения, а если не вышло - в чат объявлений с упоминанием
+func notifyPlayer(bot *tgbotapi.BotAPI, username, text string) {
+	if notifyUser(bot, username, text) {
+		return
+	}
+	announce(bot, fmt.Sprintf("@%s, %s", username, text))
+}
 
-		// Текущие участники
-		if len(participants) > 0 {
-			gameText += "🏆 ТЕКУЩИЕ УЧАСТНИКИ:\n"
-			for i, participant := range participants {
-				gameText += fmt.Sprintf("%d - %s\n", i+1, formatParticipantNameWithItem(participant))
-			}
+// Функция для отправки уведомления администраторам в личные сообщения
+func notifyAdmins(bot *tgbotapi.BotAPI, text string) {
+	delivered := false
+	for _, admin := range adminUsernames {
+		if notifyUser(bot, admin, text) {
+			delivered = true
 		}
+	}
+	if !delivered {
+		log.Printf("notifyAdmins: Уведомление не доставлено ни одному администратору: %s", text)
+	}
+}
 
-		// Выбывшие участники
-		if len(eliminatedParticipants) > 0 {
-			gameText += "\n💀 ВЫБЫВШИЕ УЧАСТНИКИ:\n"
-			for _, participant := range eliminatedParticipants {
-				gameText += fmt.Sprintf("❌ %s\n", formatParticipantNameWithItem(participant))
-			}
-		}
+// Функция для подготовки перезагрузки prizes.json: проверка схемы и текст различий.
+// Возвращает текст для администраторов и признак, что есть что применять.
+func preparePrizeReload() (string, bool) {
+	config, err := readPrizeConfigFile()
+	if err != nil {
+		return fmt.Sprintf("❌ prizes.json не читается: %v", err), false
+	}
 
-		// Сообщение о выбывшем участнике
-		gameText += fmt.Sprintf("\n☹️ В этом раунде выбывает: %s\n", formatParticipantName(removedParticipant))
-		gameText += "@" + participantIDs[removedParticipant] + ", ничего страшного, повезет в следующей игре 😊🍀!\n"
+	if errs := validatePrizeConfig(config); len(errs) > 0 {
+		return "❌ prizes.json не прошел проверку, изменения не применены:\n\n• " + strings.Join(errs, "\n• "), false
+	}
 
-		remaining := len(participants)
-		if remaining > 1 {
-			gameText += fmt.Sprintf("\nОсталось участников: %d", remaining)
-		} else if remaining == 1 {
-			gameText += "\n🏆 Остался последний участник!"
-		}
+	version := getPrizeCatalogVersion()
+	catalog, err := loadAllPrizesFromRedis()
+	if err != nil {
+		return fmt.Sprintf("❌ Ошибка загрузки текущего каталога: %v", err), false
+	}
 
-		return gameText
+	diff := diffPrizeConfig(catalog, config)
+	if diff == "" {
+		return "✅ prizes.json совпадает с текущим каталогом, применять нечего.", false
 	}
+
+	prizeReloadMu.Lock()
+	pendingPrizeReload = &PrizeReload{Config: config, Diff: diff, Version: version}
+	prizeReloadMu.Unlock()
+
+	return "📝 Изменения в prizes.json:\n\n" + diff + "\nДля применения введите:\n`/loadfromfile confirm`", true
 }
 
-// Функция для управления сессией игры
-func runGameSession(bot *tgbotapi.BotAPI) {
-	log.Printf("runGameSession: Начало игры, totalRounds=%d, currentRound=%d, len(participants)=%d", totalRounds, currentRound, len(participants))
+// Функция для применения подготовленной перезагрузки prizes.json
+func confirmPrizeReload() (string, error) {
+	prizeReloadMu.Lock()
+	reload := pendingPrizeReload
+	pendingPrizeReload = nil
+	prizeReloadMu.Unlock()
 
-	// Цикл для всех раундов
-	for isGameActive && currentRound <= totalRounds {
-		// Проверяем, не была ли игра отменена
-		select {
-		case <-gameCancel:
-			log.Printf("runGameSession: Игра отменена во время выполнения")
-			return
-		default:
-			// Продолжаем игру
-		}
+	if reload == nil {
+		return "", fmt.Errorf("нет изменений, ожидающих подтверждения (сначала /loadfromfile)")
+	}
 
-		log.Printf("runGameSession: НАЧАЛО РАУНДА %d (%d-й по порядку), isGameActive=%t, len(participants)=%d", currentRound, currentRound+1, isGameActive, len(participants))
+	// Каталог мог измениться после показа различий (/prizeadmin, другая перезагрузка):
+	// применять устаревший файл нельзя, иначе он откатит эти изменения
+	if version := getPrizeCatalogVersion(); version != reload.Version {
+		log.Printf("confirmPrizeReload: Версия каталога изменилась (%d -> %d), перезагрузка отменена", reload.Version, version)
+		return "", fmt.Errorf("каталог изменился после /loadfromfile (версия %d -> %d), проверьте различия заново", reload.Version, version)
+	}
 
-		// Выполняем раунд
-		roundResult := performGameRound(bot, currentRound)
-		log.Printf("runGameSession: Раунд %d выполнен, isGameActive=%t, roundResult содержит 'ПОДГОТОВКА': %t", currentRound, isGameActive, strings.Contains(roundResult, "ПОДГОТОВКА"))
+	if err := applyPrizeConfig(reload.Config); err != nil {
+		return "", err
+	}
 
-		// Если игра закончилась, показываем финальный результат
-		if !isGameActive {
-			log.Printf("Игра закончилась после раунда %d", currentRound)
-			// Для финальной игры результаты уже отправлены отдельными сообщениями
-			if roundResult != "" {
-				log.Printf("runGameSession: Отправляем финальное сообщение: %s", roundResult)
-				editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, roundResult)
-				_, err := bot.Send(editMsg)
-				if err != nil {
-					log.Printf("runGameSession: Ошибка отправки финального сообщения: %v", err)
-				} else {
-					log.Printf("runGameSession: Финальное сообщение отправлено успешно")
-				}
-			}
-			log.Printf("runGameSession: игра завершена")
-			return
-		}
+	return reload.Diff, nil
+}
 
-		// Проверяем, последний ли это раунд
-		if currentRound >= totalRounds {
-			// Последний раунд - показываем результат и завершаем
-			log.Printf("runGameSession: Последний раунд %d завершен", currentRound)
-			if roundResult != "" {
-				editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, roundResult)
-				if _, err := bot.Send(editMsg); err != nil {
-					log.Printf("runGameSession: Ошибка отправки сообщения последнего раунда: %v", err)
-				}
-			}
-			currentRound++
-			break
-		}
+// Функция для отслеживания изменений prizes.json (опрос времени изменения файла)
+func watchPrizesFile(bot *tgbotapi.BotAPI) {
+	var lastModTime time.Time
+	if info, err := os.Stat(prizesFile); err == nil {
+		lastModTime = info.ModTime()
+	}
 
-		// Есть следующий раунд - показываем результат + отсчёт до следующего раунда
-		nextRoundText := fmt.Sprintf("%s\n\n🎮 РАУНД %d/%d\n⏰ До следующего раунда: 5 сек",
-			roundResult, currentRound+1, totalRounds)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
 
-		log.Printf("Показываем результат раунда %d с отсчётом до раунда %d", currentRound, currentRound+1)
-		editMsg := tgbotapi.NewEditMessageText(gameChatID, gameMessageID, nextRoundText)
-		if _, err := bot.Send(editMsg); err != nil {
-			log.Printf("Ошибка редактирования сообщения: %v", err)
-			isGameActive = false
-			break
+	for range ticker.C {
+		info, err := os.Stat(prizesFile)
+		if err != nil || !info.ModTime().After(lastModTime) {
+			continue
 		}
+		lastModTime = info.ModTime()
+
+		// Сравнение с текущими редкостями и каталогом выполняется в основном цикле
+		log.Printf("watchPrizesFile: Обнаружено изменение %s", prizesFile)
+		runOnMainLoop(func() {
+			text, _ := preparePrizeReload()
+			if strings.HasPrefix(text, "✅") {
+				// Файл изменен самим ботом (/prizeadmin) или без изменений каталога
+				return
+			}
+			notifyAdmins(bot, "🔄 "+text)
+		})
+	}
+}
 
-		// Ждём 5 секунд до следующего раунда с проверкой отмены
-		select {
-		case <-time.After(5 * time.Second):
-			// Время вышло, продолжаем
-		case <-gameCancel:
-			log.Printf("runGameSession: Игра отменена во время паузы между раундами")
-			return
-		}
+// Функция для переноса данных из старого формата хранения (ключ на каждый предмет и приз) в хэши
+func migrateLegacyInventoryKeys() {
+	if redisClient == nil {
+		return
+	}
 
-		currentRound++
-		log.Printf("runGameSession: Переходим к раунду %d", currentRound)
+	ctx := context.Background()
 
-		// Небольшая пауза между раундами
-		if isGameActive && len(participants) > 1 {
-			time.Sleep(500 * time.Millisecond)
+	// Старые призы: prize:<название> -> хэш prizes
+	prizeKeys, err := scanKeys(ctx, "prize:*")
+	if err != nil {
+		log.Printf("migrateLegacyInventoryKeys: Ошибка поиска старых призов: %v", err)
+		return
+	}
+	for _, key := range prizeKeys {
+		val, err := redisClient.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+		name := strings.TrimPrefix(key, "prize:")
+		if err := redisClient.HSetNX(ctx, prizesKey, name, val).Err(); err != nil {
+			log.Printf("migrateLegacyInventoryKeys: Ошибка переноса приза %s: %v", name, err)
+			continue
 		}
+		redisClient.Del(ctx, key)
 	}
 
-	log.Printf("runGameSession: Цикл завершен, isGameActive=%t, currentRound=%d, totalRounds=%d", isGameActive, currentRound, totalRounds)
-
-	// Сбрасываем состояние после завершения игры
-	if !isGameActive {
-		log.Printf("runGameSession: Игра завершена, сбрасываем состояние")
-		bettingPhase = "closed"
-		currentRound = 0
-		initialBets = make(map[string]Bet)
-		finalBets = make(map[string]Bet)
-		finalBettingNumbers = []int{}
-		currentPrize = Prize{}
-		gameInProgress = false // Сбрасываем флаг процесса игры
+	// Старые предметы: inventory:<username>:<хэш> -> хэш inv:<username> + глобальный индекс
+	itemKeys, err := scanKeys(ctx, "inventory:*:*")
+	if err != nil {
+		log.Printf("migrateLegacyInventoryKeys: Ошибка поиска старых предметов: %v", err)
+		return
 	}
-}
+	for _, key := range itemKeys {
+		parts := strings.SplitN(strings.TrimPrefix(key, "inventory:"), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		username, itemHash := parts[0], parts[1]
 
-// Функция для инициализации Redis клиента
-func initRedis() {
-	// Получаем адрес Redis из переменной окружения или используем по умолчанию
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379" // По умолчанию localhost
+		val, err := redisClient.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+
+		_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, inventoryKey(username), itemHash, val)
+			pipe.HSet(ctx, itemOwnersKey, itemHash, username)
+			pipe.Del(ctx, key)
+			return nil
+		})
+		if err != nil {
+			log.Printf("migrateLegacyInventoryKeys: Ошибка переноса предмета %s: %v", key, err)
+		}
 	}
 
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     redisAddr, // Redis сервер
-		Password: "",        // Пароль (пустой по умолчанию)
-		DB:       0,         // База данных (0 по умолчанию)
-	})
-
-	// Проверяем подключение
-	ctx := context.Background()
-	_, err := redisClient.Ping(ctx).Result()
-	if err != nil {
-		log.Printf("Ошибка подключения к Redis (%s): %v", redisAddr, err)
-		log.Printf("Балансы будут храниться только в памяти!")
-	} else {
-		log.Printf("Redis подключен успешно (%s)", redisAddr)
+	if len(prizeKeys) > 0 || len(itemKeys) > 0 {
+		log.Printf("migrateLegacyInventoryKeys: Перенесено %d призов и %d предметов в индексированное хранилище", len(prizeKeys), len(itemKeys))
 	}
 }
 
-// Функция для сохранения баланса в Redis
-func saveBalanceToRedis(username string, balance int) {
+// Функция для создания глобальных записей о предметах, выданных до появления item:<id>, и привязки старых предметов к id приза
+func backfillItemRecords() {
 	if redisClient == nil {
 		return
 	}
 
 	ctx := context.Background()
-	key := fmt.Sprintf("balance:%s", username)
-	err := redisClient.Set(ctx, key, balance, 0).Err()
+	keys, err := scanKeys(ctx, "inv:*")
 	if err != nil {
-		log.Printf("Ошибка сохранения баланса для %s: %v", username, err)
+		log.Printf("backfillItemRecords: Ошибка поиска инвентарей: %v", err)
+		return
 	}
-}
 
-// Функция для сохранения всех балансов в Redis
-func saveBalancesToRedis() error {
-	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+	// Старые предметы хранят только название: привязываем их к id приза из каталога
+	idsByName := make(map[string]string)
+	if catalog, err := loadAllPrizesFromRedis(); err == nil {
+		for _, prize := range catalog {
+			if prize.ID != "" {
+				idsByName[prize.Name] = prize.ID
+			}
+		}
 	}
 
-	ctx := context.Background()
-	for username, balance := range playerBalances {
-		key := fmt.Sprintf("balance:%s", username)
-		err := redisClient.Set(ctx, key, balance, 0).Err()
+	for _, key := range keys {
+		username := strings.TrimPrefix(key, "inv:")
+		values, err := redisClient.HGetAll(ctx, key).Result()
 		if err != nil {
-			log.Printf("Ошибка сохранения баланса для %s: %v", username, err)
-			return fmt.Errorf("failed to save balance for %s: %v", username, err)
+			continue
 		}
-	}
 
-	log.Printf("saveBalancesToRedis: Сохранено %d балансов в Redis", len(playerBalances))
-	return nil
+		pipe := redisClient.Pipeline()
+		for itemHash, val := range values {
+			var item InventoryItem
+			if err := json.Unmarshal([]byte(val), &item); err != nil {
+				continue
+			}
+			recordKey := itemRecordKey(itemHash)
+			if id, ok := idsByName[item.PrizeName]; ok && item.PrizeID == "" && item.Rarity != "shop" {
+				item.PrizeID = id
+				if data, err := json.Marshal(item); err == nil {
+					pipe.HSet(ctx, key, itemHash, data)
+				}
+				pipe.HSet(ctx, recordKey, "prizeId", id)
+			}
+			pipe.HSetNX(ctx, recordKey, "id", itemHash)
+			pipe.HSetNX(ctx, recordKey, "prizeName", item.PrizeName)
+			pipe.HSetNX(ctx, recordKey, "rarity", item.Rarity)
+			pipe.HSetNX(ctx, recordKey, "cost", item.Cost)
+			pipe.HSet(ctx, recordKey, "owner", username)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("backfillItemRecords: Ошибка создания записей для %s: %v", username, err)
+		}
+	}
 }
 
-// Функция для загрузки баланса из Redis
-func loadBalanceFromRedis(username string) (int, bool) {
+// Функция для получения предмета из инвентаря игрока по хэшу
+func getInventoryItem(username, itemHash string) (InventoryItem, error) {
 	if redisClient == nil {
-		return 0, false
+		return InventoryItem{}, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	key := fmt.Sprintf("balance:%s", username)
-	val, err := redisClient.Get(ctx, key).Result()
+	val, err := redisClient.HGet(ctx, inventoryKey(username), itemHash).Result()
 	if err != nil {
-		return 0, false
+		return InventoryItem{}, fmt.Errorf("item not found in inventory")
 	}
 
-	balance, err := strconv.Atoi(val)
-	if err != nil {
-		return 0, false
+	var item InventoryItem
+	if err := json.Unmarshal([]byte(val), &item); err != nil {
+		return InventoryItem{}, fmt.Errorf("failed to parse item data: %v", err)
+	}
+	if item.PrizeID != "" {
+		resolveItemPrizeName(&item, prizeNamesByID())
 	}
 
-	return balance, true
+	return item, nil
 }
 
-// Функция для загрузки всех балансов из Redis
-func loadAllBalancesFromRedis() {
+// Функция для сохранения предмета в инвентарь игрока (вместе с глобальным индексом)
+func saveInventoryItem(username string, item InventoryItem) error {
 	if redisClient == nil {
-		return
+		return fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "balance:*").Result()
+	data, err := json.Marshal(item)
 	if err != nil {
-		log.Printf("Ошибка загрузки балансов из Redis: %v", err)
-		return
+		return fmt.Errorf("failed to marshal inventory item: %v", err)
 	}
 
-	for _, key := range keys {
-		username := strings.TrimPrefix(key, "balance:")
-		if balance, ok := loadBalanceFromRedis(username); ok {
-			playerBalances[username] = balance
-		}
+	ctx := context.Background()
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, inventoryKey(username), item.Hash, data)
+		pipe.HSet(ctx, itemOwnersKey, item.Hash, username)
+		pipe.HSet(ctx, itemRecordKey(item.Hash), "owner", username)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save inventory item: %v", err)
 	}
 
-	log.Printf("Загружено %d балансов из Redis", len(playerBalances))
+	return nil
 }
 
-// Функция для сохранения банковских счетов в Redis
-func saveBanksToRedis() error {
+// Функция для удаления предмета из инвентаря игрока (вместе с глобальным индексом)
+func deleteInventoryItem(username, itemHash string) error {
 	if redisClient == nil {
 		return fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	for username, bank := range playerBanks {
-		key := fmt.Sprintf("bank:%s", username)
-		err := redisClient.Set(ctx, key, bank, 0).Err()
-		if err != nil {
-			log.Printf("Ошибка сохранения банка для %s: %v", username, err)
-			return fmt.Errorf("failed to save bank for %s: %v", username, err)
-		}
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, inventoryKey(username), itemHash)
+		pipe.HDel(ctx, itemOwnersKey, itemHash)
+		pipe.HSet(ctx, itemRecordKey(itemHash), "owner", "")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove item from Redis: %v", err)
 	}
 
-	log.Printf("saveBanksToRedis: Сохранено %d банковских счетов в Redis", len(playerBanks))
 	return nil
 }
 
-// Функция для загрузки банковского счета из Redis
-func loadBankFromRedis(username string) (int, bool) {
-	if redisClient == nil {
-		return 0, false
-	}
+// Функция для разбора предметов из Redis-хэша инвентаря
+func parseInventoryHash(username string, values map[string]string) []InventoryItem {
+	inventory := make([]InventoryItem, 0, len(values))
+	var prizeByName map[string]Prize
+	var namesByID map[string]string
 
-	ctx := context.Background()
-	key := fmt.Sprintf("bank:%s", username)
-	val, err := redisClient.Get(ctx, key).Result()
-	if err != nil {
-		return 0, false
-	}
+	for itemHash, val := range values {
+		var item InventoryItem
+		if err := json.Unmarshal([]byte(val), &item); err != nil {
+			log.Printf("parseInventoryHash: Ошибка распаковки предмета %s игрока %s: %v", itemHash, username, err)
+			continue
+		}
+		if item.PrizeID != "" {
+			if namesByID == nil {
+				namesByID = prizeNamesByID()
+			}
+			resolveItemPrizeName(&item, namesByID)
+		}
 
-	bank, err := strconv.Atoi(val)
-	if err != nil {
-		return 0, false
+		// Исправляем данные для предметов, которые были неправильно сохранены
+		if item.Rarity == "shop" {
+			if prizeByName == nil {
+				prizeByName = make(map[string]Prize)
+				if allPrizes, err := loadAllPrizesFromRedis(); err == nil {
+					for _, prize := range allPrizes {
+						prizeByName[prize.Name] = prize
+					}
+				}
+			}
+
+			// Проверяем, является ли этот предмет плашкой из prizes.json
+			if prizeInfo, ok := prizeByName[item.PrizeName]; ok {
+				log.Printf("parseInventoryHash: Исправляем данные для плашки %s: rarity shop->%s, cost %d->%d",
+					item.PrizeName, prizeInfo.Rarity, item.Cost, prizeInfo.Cost)
+				item.Rarity = prizeInfo.Rarity
+				item.Cost = prizeInfo.Cost
+
+				// Сохраняем исправленные данные обратно в Redis
+				if err := saveInventoryItem(username, item); err != nil {
+					log.Printf("parseInventoryHash: Ошибка сохранения исправленной плашки %s: %v", item.PrizeName, err)
+				}
+			}
+		}
+
+		inventory = append(inventory, item)
 	}
 
-	return bank, true
+	return inventory
 }
 
-// Функция для загрузки всех банковских счетов из Redis
-func loadAllBanksFromRedis() {
-	if redisClient == nil {
-		return
-	}
+// Функция для выдачи приза победителю (serial - номер, зарезервированный при выборе плашки)
+func givePrizeToWinner(winnerUsername string, prize Prize, serial int) (InventoryItem, error) {
+	return grantReservedPrize(winnerUsername, prize, serial, "", ItemEvent{Type: "won", To: winnerUsername, Game: currentGameNumber})
+}
 
-	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "bank:*").Result()
-	if err != nil {
-		log.Printf("Ошибка загрузки банковских счетов из Redis: %v", err)
-		return
-	}
+// Функция для выбора плашки текущей игры с резервированием номера лимитированного экземпляра
+func selectGamePrize(rarity Rarity) error {
+	// Тираж мог закончиться между выбором и резервированием - пробуем другую плашку той же редкости
+	for attempt := 0; attempt < 3; attempt++ {
+		prize, err := selectRandomPrizeByRarity(rarity)
+		if err != nil {
+			return err
+		}
 
-	for _, key := range keys {
-		username := strings.TrimPrefix(key, "bank:")
-		if bank, ok := loadBankFromRedis(username); ok {
-			playerBanks[username] = bank
+		serial := 0
+		if prize.MaxSupply > 0 {
+			if serial, err = reservePrizeSerial(prize); err != nil {
+				log.Printf("selectGamePrize: %v, выбираем другую плашку", err)
+				continue
+			}
 		}
+
+		currentPrize = prize
+		currentPrizeSerial = serial
+		return nil
 	}
 
-	log.Printf("Загружено %d банковских счетов из Redis", len(playerBanks))
+	return fmt.Errorf("не удалось зарезервировать плашку редкости %s", rarity)
 }
 
-// Функция для сохранения штрафов в Redis
-func saveFinesToRedis() error {
+// Функция для сборки карточки плашки текущей игры (с зарезервированным номером экземпляра)
+func currentGamePlateCard() PlateCard {
+	card := PlateCard{Prize: currentPrize}
+	if currentPrizeSerial > 0 {
+		card.Serial = currentPrizeSerial
+		card.MaxSupply = currentPrize.MaxSupply
+	}
+	return card
+}
+
+// Функция для сброса плашки текущей игры (неразыгранный номер возвращается в тираж)
+func releaseGamePrize() {
+	releasePrizeSerial(currentPrize, currentPrizeSerial)
+	currentPrize = Prize{}
+	currentPrizeSerial = 0
+}
+
+// Функция для выдачи новой плашки игроку (source - ящик, если плашка из ящика; event - первое событие в истории предмета)
+func grantPrize(username string, prize Prize, source string, event ItemEvent) (InventoryItem, error) {
+	return grantReservedPrize(username, prize, 0, source, event)
+}
+
+// Функция для выдачи плашки с заранее зарезервированным номером (serial 0 - номер резервируется при выдаче)
+func grantReservedPrize(username string, prize Prize, serial int, source string, event ItemEvent) (InventoryItem, error) {
+	log.Printf("grantPrize: Начинаем выдачу приза %s игроку %s", prize.Name, username)
+
 	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+		log.Printf("grantPrize: Redis client not available")
+		return InventoryItem{}, fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-	for username, fine := range playerFines {
-		key := fmt.Sprintf("fine:%s", username)
-		err := redisClient.Set(ctx, key, fine, 0).Err()
+	// Создаем новый элемент инвентаря
+	item := InventoryItem{
+		PrizeID:   prize.ID,
+		PrizeName: prize.Name,
+		Rarity:    prize.Rarity,
+		Cost:      prize.Cost,
+		Count:     1, // Каждый предмет хранится отдельно
+		Source:    source,
+	}
+
+	// Резервируем номер экземпляра, если он не был зарезервирован заранее (для лимитированных плашек проверяется тираж)
+	if serial == 0 {
+		var err error
+		serial, err = reservePrizeSerial(prize)
 		if err != nil {
-			log.Printf("Ошибка сохранения штрафа для %s: %v", username, err)
-			return fmt.Errorf("failed to save fine for %s: %v", username, err)
+			log.Printf("grantPrize: Ошибка резервирования номера: %v", err)
+			return InventoryItem{}, err
 		}
 	}
+	if prize.MaxSupply > 0 {
+		item.Serial = serial
+		item.MaxSupply = prize.MaxSupply
+	}
 
-	log.Printf("saveFinesToRedis: Сохранено %d штрафов в Redis", len(playerFines))
-	return nil
+	// Выдаем глобально уникальный идентификатор для этого предмета
+	itemHash, err := generateItemID(username, item)
+	if err != nil {
+		log.Printf("grantPrize: Ошибка выдачи идентификатора: %v", err)
+		return InventoryItem{}, err
+	}
+	item.Hash = itemHash
+
+	if err := saveInventoryItem(username, item); err != nil {
+		log.Printf("grantPrize: Ошибка сохранения в Redis: %v", err)
+		return InventoryItem{}, err
+	}
+
+	appendItemHistory(itemHash, event)
+
+	log.Printf("grantPrize: Приз %s успешно выдан игроку %s (хэш: %s)", formatItemName(item), username, itemHash)
+	return item, nil
 }
 
-// Функция для загрузки штрафа из Redis
-func loadFineFromRedis(username string) (int, bool) {
+// Функция для получения инвентаря игрока
+func getPlayerInventory(username string) ([]InventoryItem, error) {
 	if redisClient == nil {
-		return 0, false
+		log.Printf("getPlayerInventory: Redis client not available")
+		return nil, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	key := fmt.Sprintf("fine:%s", username)
-	val, err := redisClient.Get(ctx, key).Result()
-	if err != nil {
-		return 0, false
-	}
-
-	fine, err := strconv.Atoi(val)
+	values, err := redisClient.HGetAll(ctx, inventoryKey(username)).Result()
 	if err != nil {
-		return 0, false
+		log.Printf("getPlayerInventory: Ошибка получения инвентаря %s: %v", username, err)
+		return nil, fmt.Errorf("failed to get inventory: %v", err)
 	}
 
-	return fine, true
+	inventory := parseInventoryHash(username, values)
+	log.Printf("getPlayerInventory: Инвентарь %s содержит %d предметов", username, len(inventory))
+	return inventory, nil
 }
 
-// Функция для загрузки всех штрафов из Redis
-func loadAllFinesFromRedis() {
+// Функция для получения инвентарей нескольких игроков одним конвейером запросов
+func getInventoriesForUsers(usernames []string) (map[string][]InventoryItem, error) {
 	if redisClient == nil {
-		return
+		return nil, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "fine:*").Result()
-	if err != nil {
-		log.Printf("Ошибка загрузки штрафов из Redis: %v", err)
-		return
+	pipe := redisClient.Pipeline()
+	cmds := make(map[string]*redis.MapStringStringCmd, len(usernames))
+	for _, username := range usernames {
+		cmds[username] = pipe.HGetAll(ctx, inventoryKey(username))
 	}
 
-	for _, key := range keys {
-		username := strings.TrimPrefix(key, "fine:")
-		if fine, ok := loadFineFromRedis(username); ok {
-			playerFines[username] = fine
-			// Устанавливаем дату последнего обновления на текущую
-			playerFineDates[username] = time.Now()
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get inventories: %v", err)
+	}
+
+	inventories := make(map[string][]InventoryItem, len(usernames))
+	for username, cmd := range cmds {
+		values, err := cmd.Result()
+		if err != nil {
+			log.Printf("getInventoriesForUsers: Ошибка получения инвентаря %s: %v", username, err)
+			continue
 		}
+		inventories[username] = parseInventoryHash(username, values)
 	}
 
-	log.Printf("Загружено %d штрафов из Redis", len(playerFines))
+	return inventories, nil
 }
 
-// Функция для ежедневного увеличения штрафов
-func updateFinesDaily() {
-	now := time.Now()
-	for username, fine := range playerFines {
-		if fine <= 0 {
-			continue
-		}
+// Функция для получения всех экземпляров предмета игрока (для продажи)
+func getPlayerItemInstances(username, prizeName string) ([]InventoryItem, error) {
+	log.Printf("getPlayerItemInstances: Получаем все экземпляры %s для пользователя %s", prizeName, username)
 
-		lastUpdate, exists := playerFineDates[username]
-		if !exists {
-			playerFineDates[username] = now
-			continue
-		}
+	inventory, err := getPlayerInventory(username)
+	if err != nil {
+		return nil, err
+	}
 
-		// Проверяем, прошли ли сутки
-		daysSinceUpdate := int(now.Sub(lastUpdate).Hours() / 24)
-		if daysSinceUpdate > 0 {
-			// Увеличиваем штраф на 10% за каждый день
-			for i := 0; i < daysSinceUpdate; i++ {
-				fine = int(float64(fine) * 1.1) // Увеличение на 10%
-			}
-			playerFines[username] = fine
-			playerFineDates[username] = now
-			log.Printf("Штраф игрока %s увеличен до %d (прошло %d дней)", username, fine, daysSinceUpdate)
+	var instances []InventoryItem
+	for _, item := range inventory {
+		// Ищем предметы с нужным именем
+		if item.PrizeName == prizeName {
+			instances = append(instances, item)
 		}
 	}
 
-	// Сохраняем обновленные штрафы
-	if err := saveFinesToRedis(); err != nil {
-		log.Printf("Ошибка сохранения обновленных штрафов: %v", err)
+	log.Printf("getPlayerItemInstances: Найдено %d экземпляров предмета %s", len(instances), prizeName)
+	return instances, nil
+}
+
+// Ключ Redis-хэша с количеством выпущенных экземпляров каждого приза
+const prizeMintedKey = "prizes:minted"
+
+// Функция для получения ключа возвращенных номеров приза (sorted set: номера, которые выдаются повторно)
+func prizeFreeSerialsKey(key string) string {
+	return fmt.Sprintf("prizes:freeserials:%s", key)
+}
+
+// Функция для получения ключа приза в счетчиках тиража (ID, если задан, иначе название)
+func prizeKey(prize Prize) string {
+	if prize.ID != "" {
+		return prize.ID
 	}
+	return prize.Name
 }
 
-// Функция для сохранения количества туров в Redis
-func saveTotalRoundsToRedis(rounds int) {
+// Функция для получения количества выпущенных экземпляров всех призов
+func getPrizeMintedCounts() (map[string]int, error) {
 	if redisClient == nil {
-		return
+		return nil, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	err := redisClient.Set(ctx, "game:totalRounds", rounds, 0).Err()
+	values, err := redisClient.HGetAll(ctx, prizeMintedKey).Result()
 	if err != nil {
-		log.Printf("Ошибка сохранения количества туров: %v", err)
+		return nil, fmt.Errorf("failed to get minted counts: %v", err)
+	}
+
+	minted := make(map[string]int, len(values))
+	for key, val := range values {
+		if n, err := strconv.Atoi(val); err == nil {
+			minted[key] = n
+		}
+	}
+
+	// Возвращенные номера снова доступны и не считаются выпущенными
+	pipe := redisClient.Pipeline()
+	free := make(map[string]*redis.IntCmd, len(minted))
+	for key := range minted {
+		free[key] = pipe.ZCard(ctx, prizeFreeSerialsKey(key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get free serials: %v", err)
+	}
+	for key, cmd := range free {
+		minted[key] -= int(cmd.Val())
 	}
+
+	return minted, nil
 }
 
-// Функция для загрузки количества туров из Redis
-func loadTotalRoundsFromRedis() (int, bool) {
+// Функция для проверки, исчерпан ли тираж приза
+func isPrizeExhausted(prize Prize, minted map[string]int) bool {
+	return prize.MaxSupply > 0 && minted[prizeKey(prize)] >= prize.MaxSupply
+}
+
+// Функция для резервирования порядкового номера экземпляра приза (с учетом тиража)
+func reservePrizeSerial(prize Prize) (int, error) {
 	if redisClient == nil {
-		return 0, false
+		return 0, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	val, err := redisClient.Get(ctx, "game:totalRounds").Result()
+
+	// Сначала выдаем самый маленький из возвращенных номеров
+	free, err := redisClient.ZPopMin(ctx, prizeFreeSerialsKey(prizeKey(prize)), 1).Result()
 	if err != nil {
-		return 0, false
+		return 0, fmt.Errorf("failed to reserve prize serial: %v", err)
+	}
+	if len(free) > 0 {
+		if serial, err := strconv.Atoi(fmt.Sprint(free[0].Member)); err == nil {
+			return serial, nil
+		}
+		log.Printf("reservePrizeSerial: Некорректный возвращенный номер %v плашки %s", free[0].Member, prize.Name)
 	}
 
-	rounds, err := strconv.Atoi(val)
+	serial, err := redisClient.HIncrBy(ctx, prizeMintedKey, prizeKey(prize), 1).Result()
 	if err != nil {
-		return 0, false
+		return 0, fmt.Errorf("failed to reserve prize serial: %v", err)
 	}
 
-	return rounds, true
+	if prize.MaxSupply > 0 && int(serial) > prize.MaxSupply {
+		// Счетчик уже за пределом тиража: номера выше тиража никому не выдаются, поэтому откат безопасен
+		redisClient.HIncrBy(ctx, prizeMintedKey, prizeKey(prize), -1)
+		return 0, fmt.Errorf("тираж плашки %s исчерпан (%d/%d)", prize.Name, prize.MaxSupply, prize.MaxSupply)
+	}
+
+	return int(serial), nil
 }
 
-// Функция для сохранения ставок в Redis
-func saveBetsToRedis(bets map[string]Bet, key string) {
-	if redisClient == nil {
+// Функция для возврата неиспользованного номера экземпляра (счетчик не уменьшается: после этого номера
+// могли быть выпущены следующие, поэтому номер попадает в список возвращенных и выдается повторно)
+func releasePrizeSerial(prize Prize, serial int) {
+	if redisClient == nil || serial <= 0 {
 		return
 	}
 
 	ctx := context.Background()
-	data, err := json.Marshal(bets)
-	if err != nil {
-		log.Printf("Ошибка сериализации ставок: %v", err)
-		return
-	}
-
-	err = redisClient.Set(ctx, key, data, 0).Err()
-	if err != nil {
-		log.Printf("Ошибка сохранения ставок: %v", err)
+	if err := redisClient.ZAdd(ctx, prizeFreeSerialsKey(prizeKey(prize)), redis.Z{Score: float64(serial), Member: serial}).Err(); err != nil {
+		log.Printf("releasePrizeSerial: Ошибка возврата номера #%d плашки %s: %v", serial, prize.Name, err)
 	}
 }
 
-// Функция для загрузки ставок из Redis
-func loadBetsFromRedis(key string) (map[string]Bet, error) {
+// Функция для подсчета экземпляров призов, находящихся в инвентарях (по названию)
+func getPrizeCirculation() (map[string]int, error) {
 	if redisClient == nil {
-		return make(map[string]Bet), nil
+		return nil, fmt.Errorf("Redis client not available")
 	}
 
 	ctx := context.Background()
-	val, err := redisClient.Get(ctx, key).Result()
+	keys, err := scanKeys(ctx, "inv:*")
 	if err != nil {
-		return make(map[string]Bet), err
+		return nil, fmt.Errorf("failed to scan inventories: %v", err)
 	}
 
-	var bets map[string]Bet
-	err = json.Unmarshal([]byte(val), &bets)
+	usernames := make([]string, 0, len(keys))
+	for _, key := range keys {
+		usernames = append(usernames, strings.TrimPrefix(key, "inv:"))
+	}
+
+	inventories, err := getInventoriesForUsers(usernames)
 	if err != nil {
-		return make(map[string]Bet), err
+		return nil, err
 	}
 
-	return bets, nil
+	circulation := make(map[string]int)
+	for _, inventory := range inventories {
+		for _, item := range inventory {
+			if item.Rarity != "shop" {
+				circulation[item.PrizeName] += item.Count
+			}
+		}
+	}
+
+	return circulation, nil
 }
 
-// Функция для сохранения приза в Redis
-func savePrizeToRedis(prize Prize) error {
-	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+// Функция для выбора случайного приза по редкости
+func selectRandomPrizeByRarity(rarity Rarity) (Prize, error) {
+	log.Printf("selectRandomPrizeByRarity: Выбираем приз для редкости %s", rarity)
+
+	// Загружаем все призы из Redis
+	prizes, err := loadAllPrizesFromRedis()
+	if err != nil {
+		log.Printf("selectRandomPrizeByRarity: Ошибка загрузки призов: %v", err)
+		return Prize{}, fmt.Errorf("failed to load prizes: %v", err)
 	}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("prize:%s", prize.Name)
+	log.Printf("selectRandomPrizeByRarity: Загружено %d призов из Redis", len(prizes))
 
-	data, err := json.Marshal(prize)
+	// Лимитированные плашки с исчерпанным тиражом больше не разыгрываются
+	minted, err := getPrizeMintedCounts()
 	if err != nil {
-		return fmt.Errorf("failed to marshal prize: %v", err)
+		log.Printf("selectRandomPrizeByRarity: Ошибка загрузки тиражей: %v", err)
+		minted = map[string]int{}
 	}
 
-	err = redisClient.Set(ctx, key, data, 0).Err()
-	if err != nil {
-		return fmt.Errorf("failed to save prize to Redis: %v", err)
+	// Фильтруем призы по редкости
+	var filteredPrizes []Prize
+	for _, prize := range prizes {
+		if prize.Rarity == string(rarity) && !prize.Disabled && !isPrizeExhausted(prize, minted) {
+			filteredPrizes = append(filteredPrizes, prize)
+		}
 	}
 
-	return nil
-}
+	log.Printf("selectRandomPrizeByRarity: Найдено %d призов для редкости %s", len(filteredPrizes), rarity)
 
-// Функция для загрузки приза из Redis
-func loadPrizeFromRedis(name string) (Prize, error) {
-	if redisClient == nil {
-		return Prize{}, fmt.Errorf("Redis client not available")
+	if len(filteredPrizes) == 0 {
+		log.Printf("selectRandomPrizeByRarity: Не найдено призов для редкости %s", rarity)
+		return Prize{}, fmt.Errorf("no prizes found for rarity %s", rarity)
 	}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("prize:%s", name)
+	// Выбираем случайный приз из отфильтрованных с учетом весов
+	weights := make([]int, len(filteredPrizes))
+	for i, prize := range filteredPrizes {
+		weights[i] = prize.Weight
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+	randomIndex := gamble.WeightedIndex(weights)
+	selectedPrize := filteredPrizes[randomIndex]
 
-	val, err := redisClient.Get(ctx, key).Result()
+	log.Printf("selectRandomPrizeByRarity: Выбрана плашка '%s' (индекс %d из %d)", selectedPrize.Name, randomIndex, len(filteredPrizes))
+	return selectedPrize, nil
+}
+
+// Функция для получения стоимости плашки по имени
+func getPrizeCostByName(prizeName string) (int, error) {
+	log.Printf("getPrizeCostByName: Получаем стоимость для плашки %s", prizeName)
+
+	// Загружаем все призы из Redis
+	prizes, err := loadAllPrizesFromRedis()
 	if err != nil {
-		return Prize{}, fmt.Errorf("failed to get prize from Redis: %v", err)
+		log.Printf("getPrizeCostByName: Ошибка загрузки призов: %v", err)
+		return 0, fmt.Errorf("failed to load prizes: %v", err)
 	}
 
-	var prize Prize
-	err = json.Unmarshal([]byte(val), &prize)
-	if err != nil {
-		return Prize{}, fmt.Errorf("failed to unmarshal prize: %v", err)
+	// Ищем приз по имени
+	for _, prize := range prizes {
+		if prize.Name == prizeName {
+			log.Printf("getPrizeCostByName: Найдена стоимость %d для плашки %s", prize.Cost, prizeName)
+			return prize.Cost, nil
+		}
 	}
 
-	return prize, nil
+	log.Printf("getPrizeCostByName: Плашка %s не найдена в списке призов", prizeName)
+	return 0, fmt.Errorf("prize %s not found", prizeName)
 }
 
-// Функция для загрузки всех призов из Redis
-func loadAllPrizesFromRedis() ([]Prize, error) {
-	if redisClient == nil {
-		return nil, fmt.Errorf("Redis client not available")
-	}
+// Функция для получения полной информации о плашке по имени
+func getPrizeInfoByName(prizeName string) (Prize, error) {
+	log.Printf("getPrizeInfoByName: Получаем информацию для плашки %s", prizeName)
 
-	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "prize:*").Result()
+	// Загружаем все призы из Redis
+	prizes, err := loadAllPrizesFromRedis()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get prize keys: %v", err)
+		log.Printf("getPrizeInfoByName: Ошибка загрузки призов: %v", err)
+		return Prize{}, fmt.Errorf("failed to load prizes: %v", err)
 	}
 
-	var prizes []Prize
-	for _, key := range keys {
-		val, err := redisClient.Get(ctx, key).Result()
-		if err != nil {
-			log.Printf("Warning: failed to get prize %s: %v", key, err)
-			continue
+	// Ищем приз по имени
+	for _, prize := range prizes {
+		if prize.Name == prizeName {
+			log.Printf("getPrizeInfoByName: Найдена плашка %s (редкость: %s, стоимость: %d)", prize.Name, prize.Rarity, prize.Cost)
+			return prize, nil
 		}
+	}
 
-		var prize Prize
-		err = json.Unmarshal([]byte(val), &prize)
-		if err != nil {
-			log.Printf("Warning: failed to unmarshal prize %s: %v", key, err)
-			continue
+	log.Printf("getPrizeInfoByName: Плашка %s не найдена в списке призов", prizeName)
+	return Prize{}, fmt.Errorf("prize %s not found", prizeName)
+}
+
+// Функция для проверки приза перед сохранением в каталог (originalName - прежнее название при редактировании)
+func validatePrize(prize Prize, catalog []Prize, originalName string) error {
+	if strings.TrimSpace(prize.Name) == "" {
+		return fmt.Errorf("название не может быть пустым")
+	}
+	if strings.Contains(prize.Name, "|") {
+		return fmt.Errorf("название не может содержать символ |")
+	}
+	if _, ok := getRarityTier(prize.Rarity); !ok {
+		known := make([]string, 0, len(rarityTiers))
+		for _, tier := range sortedRarityTiers() {
+			known = append(known, tier.Name)
 		}
+		return fmt.Errorf("неизвестная редкость %q (доступны: %s)", prize.Rarity, strings.Join(known, ", "))
+	}
+	if prize.Cost <= 0 {
+		return fmt.Errorf("стоимость должна быть положительной")
+	}
 
-		prizes = append(prizes, prize)
+	for _, existing := range catalog {
+		if existing.Name == originalName {
+			continue
+		}
+		if strings.EqualFold(existing.Name, prize.Name) {
+			return fmt.Errorf("плашка с названием %q уже существует", existing.Name)
+		}
 	}
 
-	return prizes, nil
+	return nil
 }
 
-// Функция для удаления всех призов из Redis
-func removeAllPrizesFromRedis() error {
+// Функция для сохранения изменения каталога: Redis, версия и prizes.json
+func commitPrizeCatalogChange(prize Prize, originalName string) (int64, error) {
 	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+		return 0, fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "prize:*").Result()
+	data, err := json.Marshal(prize)
 	if err != nil {
-		return fmt.Errorf("failed to get prize keys: %v", err)
-	}
-
-	if len(keys) == 0 {
-		return nil // Нет ключей для удаления
+		return 0, fmt.Errorf("failed to marshal prize: %v", err)
 	}
 
-	err = redisClient.Del(ctx, keys...).Err()
+	ctx := context.Background()
+	var versionCmd *redis.IntCmd
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if originalName != "" && originalName != prize.Name {
+			pipe.HDel(ctx, prizesKey, originalName)
+		}
+		pipe.HSet(ctx, prizesKey, prize.Name, data)
+		versionCmd = pipe.Incr(ctx, prizesVersionKey)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete prizes from Redis: %v", err)
+		return 0, fmt.Errorf("failed to save prize: %v", err)
 	}
+	version := versionCmd.Val()
 
-	log.Printf("Удалено %d призов из Redis", len(keys))
-	return nil
-}
-
-// Функция для загрузки призов из JSON файла в Redis
-func loadPrizesFromFileToRedis() error {
-	// Загружаем призы из файла
-	data, err := os.ReadFile("prizes.json")
+	// Переносим изменение в prizes.json, чтобы /loadfromfile не откатил его
+	config, err := readPrizeConfigFile()
 	if err != nil {
-		return fmt.Errorf("failed to read prizes.json: %v", err)
+		log.Printf("commitPrizeCatalogChange: Не удалось прочитать %s: %v", prizesFile, err)
+		return version, nil
 	}
 
-	var config PrizeConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse prizes.json: %v", err)
+	replaced := false
+	for i := range config.Prizes {
+		if config.Prizes[i].Name == originalName || config.Prizes[i].Name == prize.Name {
+			config.Prizes[i] = prize
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		config.Prizes = append(config.Prizes, prize)
 	}
+	config.Version = version
 
-	// Сохраняем каждый приз в Redis
-	for _, prize := range config.Prizes {
-		if err := savePrizeToRedis(prize); err != nil {
-			log.Printf("Warning: failed to save prize %s: %v", prize.Name, err)
-		}
+	if err := writePrizeConfigFile(config); err != nil {
+		log.Printf("commitPrizeCatalogChange: Не удалось записать %s: %v", prizesFile, err)
 	}
 
-	log.Printf("Загружено %d призов в Redis из prizes.json", len(config.Prizes))
-	return nil
+	return version, nil
 }
 
-// Функция для выдачи приза победителю
-func givePrizeToWinner(winnerUsername string, prize Prize) error {
-	log.Printf("givePrizeToWinner: Начинаем выдачу приза %s игроку %s", prize.Name, winnerUsername)
-
-	if redisClient == nil {
-		log.Printf("givePrizeToWinner: Redis client not available")
-		return fmt.Errorf("Redis client not available")
+// Функция для поиска приза в каталоге по названию (без учета регистра)
+func findPrizeInCatalog(catalog []Prize, name string) (Prize, bool) {
+	for _, prize := range catalog {
+		if strings.EqualFold(prize.Name, name) {
+			return prize, true
+		}
 	}
+	return Prize{}, false
+}
 
-	ctx := context.Background()
+// Функция для разбора аргументов, разделенных символом |
+func splitPipeArgs(args string) []string {
+	parts := strings.Split(args, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
 
-	// Генерируем уникальный хэш для этого предмета
-	itemHash := generateItemHash(winnerUsername, prize.Name)
-	key := fmt.Sprintf("inventory:%s:%s", winnerUsername, itemHash)
-	log.Printf("givePrizeToWinner: Используем ключ %s для нового предмета", key)
+// Функция для обработки /prizeadmin (add|edit|disable|enable|list), возвращает текст ответа
+func handlePrizeAdminCommand(args string) string {
+	usage := "🛠 Управление каталогом плашек:\n\n" +
+		"/prizeadmin list - список плашек\n" +
+		"/prizeadmin add Название | редкость | стоимость [| описание | эмодзи]\n" +
+		"/prizeadmin edit Название | поле | значение (поля: name, rarity, cost, description, emoji)\n" +
+		"/prizeadmin disable Название - плашка больше не выпадает\n" +
+		"/prizeadmin enable Название - вернуть плашку в розыгрыш"
 
-	// Создаем новый элемент инвентаря
-	item := InventoryItem{
-		PrizeName: prize.Name,
-		Rarity:    prize.Rarity,
-		Cost:      prize.Cost,
-		Count:     1, // Каждый предмет хранится отдельно
-		Hash:      itemHash,
+	subcommand, rest := args, ""
+	if idx := strings.Index(args, " "); idx >= 0 {
+		subcommand, rest = args[:idx], strings.TrimSpace(args[idx+1:])
 	}
+	subcommand = strings.ToLower(subcommand)
 
-	// Сохраняем в Redis
-	data, err := json.Marshal(item)
+	catalog, err := loadAllPrizesFromRedis()
 	if err != nil {
-		log.Printf("givePrizeToWinner: Ошибка маршалинга: %v", err)
-		return fmt.Errorf("failed to marshal inventory item: %v", err)
+		log.Printf("handlePrizeAdminCommand: Ошибка загрузки каталога: %v", err)
+		return "❌ Ошибка загрузки каталога плашек!"
 	}
 
-	err = redisClient.Set(ctx, key, data, 0).Err()
-	if err != nil {
-		log.Printf("givePrizeToWinner: Ошибка сохранения в Redis: %v", err)
-		return fmt.Errorf("failed to save inventory item: %v", err)
-	}
+	switch subcommand {
+	case "list":
+		sort.Slice(catalog, func(i, j int) bool {
+			if catalog[i].Rarity != catalog[j].Rarity {
+				return rarityOrder(catalog[i].Rarity) > rarityOrder(catalog[j].Rarity)
+			}
+			return catalog[i].Name < catalog[j].Name
+		})
+
+		text := fmt.Sprintf("📚 Каталог плашек (версия %d, всего %d):\n\n", getPrizeCatalogVersion(), len(catalog))
+		for _, prize := range catalog {
+			line := fmt.Sprintf("%s %s [%s] - %d фишек", prize.Emoji, prize.Name, prize.Rarity, prize.Cost)
+			if prize.Disabled {
+				line += " 🚫 выключена"
+			}
+			text += strings.TrimSpace(line) + "\n"
+		}
+		return text
 
-	log.Printf("givePrizeToWinner: Приз %s успешно выдан игроку %s (хэш: %s)", prize.Name, winnerUsername, itemHash)
+	case "add":
+		parts := splitPipeArgs(rest)
+		if len(parts) < 3 || len(parts) > 5 {
+			return usage
+		}
 
-	// Проверяем, что предмет действительно сохранен
-	_, testErr := redisClient.Get(ctx, key).Result()
-	if testErr != nil {
-		log.Printf("givePrizeToWinner: ОШИБКА: не удалось проверить сохраненный предмет: %v", testErr)
-	} else {
-		log.Printf("givePrizeToWinner: Проверка пройдена - предмет сохранен под ключом %s", key)
-	}
+		cost, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return "❌ Стоимость должна быть числом!"
+		}
 
-	return nil
-}
+		prize := Prize{ID: newPrizeID(catalog), Name: parts[0], Rarity: strings.ToLower(parts[1]), Cost: cost}
+		if len(parts) > 3 {
+			prize.Description = parts[3]
+		}
+		if len(parts) > 4 {
+			prize.Emoji = parts[4]
+		}
 
-// Функция для получения инвентаря игрока
-func getPlayerInventory(username string) ([]InventoryItem, error) {
-	log.Printf("getPlayerInventory: Получаем инвентарь для пользователя %s", username)
+		if err := validatePrize(prize, catalog, ""); err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
 
-	if redisClient == nil {
-		log.Printf("getPlayerInventory: Redis client not available")
-		return nil, fmt.Errorf("Redis client not available")
-	}
+		version, err := commitPrizeCatalogChange(prize, "")
+		if err != nil {
+			log.Printf("handlePrizeAdminCommand: Ошибка добавления плашки %s: %v", prize.Name, err)
+			return "❌ Ошибка сохранения плашки!"
+		}
 
-	ctx := context.Background()
-	pattern := fmt.Sprintf("inventory:%s:*", username)
-	log.Printf("getPlayerInventory: Ищем ключи по паттерну %s", pattern)
+		log.Printf("handlePrizeAdminCommand: Добавлена плашка %s (%s, %d), версия каталога %d", prize.Name, prize.Rarity, prize.Cost, version)
+		return fmt.Sprintf("✅ Плашка \"%s\" (%s, %d фишек) добавлена!\n📚 Версия каталога: %d", prize.Name, rarityLabel(prize.Rarity), prize.Cost, version)
 
-	keys, err := redisClient.Keys(ctx, pattern).Result()
-	if err != nil {
-		log.Printf("getPlayerInventory: Ошибка получения ключей: %v", err)
-		return nil, fmt.Errorf("failed to get inventory keys: %v", err)
-	}
+	case "edit":
+		parts := splitPipeArgs(rest)
+		if len(parts) != 3 {
+			return usage
+		}
+
+		prize, ok := findPrizeInCatalog(catalog, parts[0])
+		if !ok {
+			return fmt.Sprintf("❌ Плашка \"%s\" не найдена!", parts[0])
+		}
+		originalName := prize.Name
+		field, value := strings.ToLower(parts[1]), parts[2]
+
+		switch field {
+		case "name":
+			// Предметы находят приз по id; у старых плашек без id переименование потеряло бы связь
+			if prize.ID == "" {
+				return fmt.Sprintf("❌ У плашки \"%s\" нет id: задайте его в prizes.json, чтобы переименовать", prize.Name)
+			}
+			prize.Name = value
+		case "rarity":
+			prize.Rarity = strings.ToLower(value)
+		case "cost":
+			cost, err := strconv.Atoi(value)
+			if err != nil {
+				return "❌ Стоимость должна быть числом!"
+			}
+			prize.Cost = cost
+		case "description":
+			prize.Description = value
+		case "emoji":
+			prize.Emoji = value
+		default:
+			return usage
+		}
 
-	log.Printf("getPlayerInventory: Найдено %d ключей: %v", len(keys), keys)
+		if err := validatePrize(prize, catalog, originalName); err != nil {
+			return fmt.Sprintf("❌ %v", err)
+		}
 
-	var inventory []InventoryItem
-	for _, key := range keys {
-		log.Printf("getPlayerInventory: Обрабатываем ключ %s", key)
-		val, err := redisClient.Get(ctx, key).Result()
+		version, err := commitPrizeCatalogChange(prize, originalName)
 		if err != nil {
-			log.Printf("getPlayerInventory: Ошибка получения значения для ключа %s: %v", key, err)
-			continue
+			log.Printf("handlePrizeAdminCommand: Ошибка изменения плашки %s: %v", originalName, err)
+			return "❌ Ошибка сохранения плашки!"
 		}
 
-		log.Printf("getPlayerInventory: Значение для ключа %s: %s", key, val)
+		log.Printf("handlePrizeAdminCommand: Плашка %s изменена (%s = %s), версия каталога %d", originalName, field, value, version)
+		return fmt.Sprintf("✅ Плашка \"%s\" изменена: %s = %s\n📚 Версия каталога: %d", prize.Name, field, value, version)
+
+	case "disable", "enable":
+		prize, ok := findPrizeInCatalog(catalog, rest)
+		if !ok {
+			return fmt.Sprintf("❌ Плашка \"%s\" не найдена!", rest)
+		}
 
-		var item InventoryItem
-		err = json.Unmarshal([]byte(val), &item)
+		prize.Disabled = subcommand == "disable"
+		version, err := commitPrizeCatalogChange(prize, prize.Name)
 		if err != nil {
-			log.Printf("getPlayerInventory: Ошибка распаковки для ключа %s: %v", key, err)
-			continue
+			log.Printf("handlePrizeAdminCommand: Ошибка изменения плашки %s: %v", prize.Name, err)
+			return "❌ Ошибка сохранения плашки!"
 		}
 
-		// Исправляем данные для предметов, которые были неправильно сохранены
-		if item.Rarity == "shop" {
-			// Проверяем, является ли этот предмет плашкой из prizes.json
-			if prizeInfo, infoErr := getPrizeInfoByName(item.PrizeName); infoErr == nil {
-				log.Printf("getPlayerInventory: Исправляем данные для плашки %s: rarity shop->%s, cost %d->%d",
-					item.PrizeName, prizeInfo.Rarity, item.Cost, prizeInfo.Cost)
-				item.Rarity = prizeInfo.Rarity
-				item.Cost = prizeInfo.Cost
-
-				// Сохраняем исправленные данные обратно в Redis
-				updatedData, marshalErr := json.Marshal(item)
-				if marshalErr == nil {
-					redisClient.Set(ctx, key, updatedData, 0)
-					log.Printf("getPlayerInventory: Исправленные данные сохранены для %s", item.PrizeName)
-				}
-			}
+		if prize.Disabled {
+			return fmt.Sprintf("🚫 Плашка \"%s\" выключена: больше не выпадает, но остается у владельцев.\n📚 Версия каталога: %d", prize.Name, version)
 		}
+		return fmt.Sprintf("✅ Плашка \"%s\" снова участвует в розыгрыше.\n📚 Версия каталога: %d", prize.Name, version)
 
-		log.Printf("getPlayerInventory: Добавляем предмет: %s (хэш: %s, редкость: %s)", item.PrizeName, item.Hash, item.Rarity)
-		inventory = append(inventory, item)
+	default:
+		return usage
 	}
+}
 
-	log.Printf("getPlayerInventory: Возвращаем %d предметов", len(inventory))
-	return inventory, nil
+// Структура для карточки плашки (текстовой и картинкой)
+type PlateCard struct {
+	Prize      Prize
+	ItemID     string    // Пусто для карточки из каталога
+	Serial     int       // Номер экземпляра лимитированной плашки
+	MaxSupply  int       // Тираж лимитированной плашки
+	Owner      string    // username владельца (пусто - нет владельца)
+	ObtainedAt time.Time // Когда текущий владелец получил плашку
 }
 
-// Функция для получения всех экземпляров предмета игрока (для продажи)
-func getPlayerItemInstances(username, prizeName string) ([]InventoryItem, error) {
-	log.Printf("getPlayerItemInstances: Получаем все экземпляры %s для пользователя %s", prizeName, username)
+// Функция для получения эмодзи плашки (свое или эмодзи редкости)
+func plateCardEmoji(card PlateCard) string {
+	if card.Prize.Emoji != "" {
+		return card.Prize.Emoji
+	}
+	if tier, ok := getRarityTier(card.Prize.Rarity); ok {
+		return tier.Emoji
+	}
+	return "🏷️"
+}
 
-	if redisClient == nil {
-		return nil, fmt.Errorf("Redis client not available")
+// Функция для форматирования карточки плашки текстом
+func formatPlateCard(card PlateCard) string {
+	text := fmt.Sprintf("%s %s ПЛАШКА\n", plateCardEmoji(card), rarityLabel(card.Prize.Rarity))
+	text += fmt.Sprintf("«%s»", card.Prize.Name)
+	if card.Serial > 0 && card.MaxSupply > 0 {
+		text += fmt.Sprintf(" #%d/%d", card.Serial, card.MaxSupply)
 	}
+	text += "\n"
 
-	ctx := context.Background()
-	pattern := fmt.Sprintf("inventory:%s:*", username)
+	if card.Prize.Description != "" {
+		text += fmt.Sprintf("📝 %s\n", card.Prize.Description)
+	}
+	text += fmt.Sprintf("💰 Стоимость: %d %s\n", card.Prize.Cost, getChipsWord(card.Prize.Cost))
+	if card.Prize.MaxSupply > 0 && card.Serial == 0 {
+		text += fmt.Sprintf("🔢 Лимитированная серия: %d экз.\n", card.Prize.MaxSupply)
+	}
+	if card.Owner != "" {
+		text += fmt.Sprintf("👤 Владелец: @%s\n", card.Owner)
+	}
+	if !card.ObtainedAt.IsZero() {
+		text += fmt.Sprintf("📅 Получена: %s\n", card.ObtainedAt.Format("02.01.2006 15:04"))
+	}
+	if card.ItemID != "" {
+		text += fmt.Sprintf("🔑 Хэш: %s\n", card.ItemID)
+	}
+
+	return strings.TrimRight(text, "\n")
+}
 
-	keys, err := redisClient.Keys(ctx, pattern).Result()
+// Функция для сборки карточки конкретного экземпляра плашки по его идентификатору
+func buildItemPlateCard(itemID string) (PlateCard, error) {
+	record, err := getItemRecord(itemID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get inventory keys: %v", err)
+		return PlateCard{}, err
 	}
 
-	var instances []InventoryItem
-	for _, key := range keys {
-		val, err := redisClient.Get(ctx, key).Result()
-		if err != nil {
-			continue
-		}
+	cost, _ := strconv.Atoi(record["cost"])
+	prize, err := getPrizeInfoByName(record["prizeName"])
+	if err != nil {
+		// Приза уже нет в каталоге - показываем то, что сохранилось в записи предмета
+		prize = Prize{Name: record["prizeName"], Rarity: record["rarity"], Cost: cost}
+	}
 
-		var item InventoryItem
-		err = json.Unmarshal([]byte(val), &item)
-		if err != nil {
-			continue
-		}
+	card := PlateCard{Prize: prize, ItemID: itemID, Owner: record["owner"]}
+	card.Serial, _ = strconv.Atoi(record["serial"])
+	card.MaxSupply, _ = strconv.Atoi(record["maxSupply"])
 
-		// Ищем предметы с нужным именем
-		if item.PrizeName == prizeName {
-			instances = append(instances, item)
+	// Дата получения - последнее событие, в котором плашка перешла к текущему владельцу
+	if history, err := getItemHistory(itemID); err == nil {
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].To == card.Owner && card.Owner != "" {
+				card.ObtainedAt = history[i].At
+				break
+			}
+		}
+	}
+	if card.ObtainedAt.IsZero() {
+		if createdAt, err := strconv.ParseInt(record["createdAt"], 10, 64); err == nil {
+			card.ObtainedAt = time.Unix(createdAt, 0)
 		}
 	}
 
-	log.Printf("getPlayerItemInstances: Найдено %d экземпляров предмета %s", len(instances), prizeName)
-	return instances, nil
+	return card, nil
 }
 
-// Функция для выбора случайного приза по редкости
-func selectRandomPrizeByRarity(rarity Rarity) (Prize, error) {
-	log.Printf("selectRandomPrizeByRarity: Выбираем приз для редкости %s", rarity)
+// Функция для сборки карточки по хэшу предмета или названию плашки из каталога
+func findPlateCard(query string) (PlateCard, error) {
+	if card, err := buildItemPlateCard(query); err == nil {
+		return card, nil
+	}
 
-	// Загружаем все призы из Redis
-	prizes, err := loadAllPrizesFromRedis()
+	catalog, err := loadAllPrizesFromRedis()
 	if err != nil {
-		log.Printf("selectRandomPrizeByRarity: Ошибка загрузки призов: %v", err)
-		return Prize{}, fmt.Errorf("failed to load prizes: %v", err)
+		return PlateCard{}, err
 	}
-
-	log.Printf("selectRandomPrizeByRarity: Загружено %d призов из Redis", len(prizes))
-
-	// Фильтруем призы по редкости
-	var filteredPrizes []Prize
-	for _, prize := range prizes {
-		if prize.Rarity == string(rarity) {
-			filteredPrizes = append(filteredPrizes, prize)
+	for _, prize := range catalog {
+		if prize.ID == query {
+			return PlateCard{Prize: prize}, nil
 		}
 	}
+	if prize, ok := findPrizeInCatalog(catalog, query); ok {
+		return PlateCard{Prize: prize}, nil
+	}
 
-	log.Printf("selectRandomPrizeByRarity: Найдено %d призов для редкости %s", len(filteredPrizes), rarity)
+	return PlateCard{}, fmt.Errorf("плашка %q не найдена", query)
+}
 
-	if len(filteredPrizes) == 0 {
-		log.Printf("selectRandomPrizeByRarity: Не найдено призов для редкости %s", rarity)
-		return Prize{}, fmt.Errorf("no prizes found for rarity %s", rarity)
+// Функция для отрисовки карточки плашки картинкой
+func renderPlateCardImage(card PlateCard) ([]byte, error) {
+	plate := render.PlateCard{
+		Title:       rarityLabel(card.Prize.Rarity) + " ПЛАШКА",
+		Name:        card.Prize.Name,
+		Description: card.Prize.Description,
+		Color:       rarityColor(card.Prize.Rarity),
+	}
+	if card.Serial > 0 && card.MaxSupply > 0 {
+		plate.Serial = fmt.Sprintf("#%d/%d", card.Serial, card.MaxSupply)
 	}
 
-	// Выбираем случайный приз из отфильтрованных
-	randomIndex := crand.Intn(len(filteredPrizes))
-	selectedPrize := filteredPrizes[randomIndex]
+	plate.Details = append(plate.Details, fmt.Sprintf("Стоимость: %d %s", card.Prize.Cost, getChipsWord(card.Prize.Cost)))
+	if card.Prize.MaxSupply > 0 && card.Serial == 0 {
+		plate.Details = append(plate.Details, fmt.Sprintf("Лимитированная серия: %d экз.", card.Prize.MaxSupply))
+	}
+	if card.Owner != "" {
+		plate.Details = append(plate.Details, "Владелец: @"+card.Owner)
+	}
+	if !card.ObtainedAt.IsZero() {
+		plate.Details = append(plate.Details, "Получена: "+card.ObtainedAt.Format("02.01.2006 15:04"))
+	}
 
-	log.Printf("selectRandomPrizeByRarity: Выбрана плашка '%s' (индекс %d из %d)", selectedPrize.Name, randomIndex, len(filteredPrizes))
-	return selectedPrize, nil
+	return render.RenderPlateCard(plate)
 }
 
-// Функция для получения стоимости плашки по имени
-func getPrizeCostByName(prizeName string) (int, error) {
-	log.Printf("getPrizeCostByName: Получаем стоимость для плашки %s", prizeName)
-
-	// Загружаем все призы из Redis
-	prizes, err := loadAllPrizesFromRedis()
-	if err != nil {
-		log.Printf("getPrizeCostByName: Ошибка загрузки призов: %v", err)
-		return 0, fmt.Errorf("failed to load prizes: %v", err)
-	}
+// Функция для получения места игрока в рейтинге по сумме баланса и банка
+func getWealthRank(username string) (int, int) {
+	usernames := make([]string, 0, len(playerBalances))
+	for name := range playerBalances {
+		usernames = append(usernames, name)
+	}
+	sort.Slice(usernames, func(i, j int) bool {
+		wi := playerBalances[usernames[i]] + playerBanks[usernames[i]]
+		wj := playerBalances[usernames[j]] + playerBanks[usernames[j]]
+		if wi != wj {
+			return wi > wj
+		}
+		return usernames[i] < usernames[j]
+	})
 
-	// Ищем приз по имени
-	for _, prize := range prizes {
-		if prize.Name == prizeName {
-			log.Printf("getPrizeCostByName: Найдена стоимость %d для плашки %s", prize.Cost, prizeName)
-			return prize.Cost, nil
+	for i, name := range usernames {
+		if name == username {
+			return i + 1, len(usernames)
 		}
 	}
-
-	log.Printf("getPrizeCostByName: Плашка %s не найдена в списке призов", prizeName)
-	return 0, fmt.Errorf("prize %s not found", prizeName)
+	return 0, len(usernames)
 }
 
-// Функция для получения полной информации о плашке по имени
-func getPrizeInfoByName(prizeName string) (Prize, error) {
-	log.Printf("getPrizeInfoByName: Получаем информацию для плашки %s", prizeName)
-
-	// Загружаем все призы из Redis
-	prizes, err := loadAllPrizesFromRedis()
-	if err != nil {
-		log.Printf("getPrizeInfoByName: Ошибка загрузки призов: %v", err)
-		return Prize{}, fmt.Errorf("failed to load prizes: %v", err)
+// Функция для сборки профиля игрока (текст для подписи и данные для картинки)
+func buildProfileCard(username string) (string, render.ProfileCard) {
+	name := getParticipantNameByUsername(username)
+	if name == "" {
+		name = username
+	}
+	balance := playerBalances[username]
+	bank := playerBanks[username]
+	rank, total := getWealthRank(username)
+
+	card := render.ProfileCard{
+		Name:     name,
+		Username: username,
+		Rank:     fmt.Sprintf("#%d из %d", rank, total),
+		Stats: []string{
+			fmt.Sprintf("Баланс: %d %s", balance, getChipsWord(balance)),
+			fmt.Sprintf("В банке: %d %s", bank, getChipsWord(bank)),
+			fmt.Sprintf("Итого: %d %s", balance+bank, getChipsWord(balance+bank)),
+		},
 	}
 
-	// Ищем приз по имени
-	for _, prize := range prizes {
-		if prize.Name == prizeName {
-			log.Printf("getPrizeInfoByName: Найдена плашка %s (редкость: %s, стоимость: %d)", prize.Name, prize.Rarity, prize.Cost)
-			return prize, nil
+	plateText := "нет"
+	if wornData, err := getWornItem(username); err == nil && wornData != nil {
+		card.PlateName = wornData["name"]
+		if wornData["serial"] != "" {
+			card.PlateName += " " + wornData["serial"]
 		}
+		card.PlateColor = rarityColor(wornData["rarity"])
+		plateText = card.PlateName
 	}
 
-	log.Printf("getPrizeInfoByName: Плашка %s не найдена в списке призов", prizeName)
-	return Prize{}, fmt.Errorf("prize %s not found", prizeName)
+	text := fmt.Sprintf("👤 ПРОФИЛЬ %s (@%s)\n\n"+
+		"🏷️ Плашка: %s\n"+
+		"💰 Баланс: %d %s\n"+
+		"🏦 В банке: %d %s\n"+
+		"🏆 Место в рейтинге: %s",
+		name, username, plateText, balance, getChipsWord(balance), bank, getChipsWord(bank), card.Rank)
+
+	return text, card
+}
+
+// Функция для отправки картинки с подписью в ответ на сообщение
+func sendPhotoReply(bot *tgbotapi.BotAPI, chatID int64, replyTo int, fileName string, data []byte, caption string) error {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	photo.Caption = caption
+	photo.ReplyToMessageID = replyTo
+	_, err := bot.Send(photo)
+	return err
 }
 
 // Функция для безопасного изменения баланса (гарантирует отсутствие отрицательных значений)
@@ -1828,6 +6943,71 @@ func changeBalance(username string, amount int) bool {
 	return true
 }
 
+// Функция для зачисления дохода с автоматическим взысканием части в счет штрафа (возвращает удержанную сумму)
+func creditPlayer(username string, amount int) (int, bool) {
+	withheld := garnishAmount(username, amount)
+	if !changeBalance(username, amount-withheld) {
+		return 0, false
+	}
+	if withheld > 0 {
+		reduceFine(username, withheld)
+		log.Printf("creditPlayer: У %s удержано %d из %d в счет штрафа", username, withheld, amount)
+	}
+	return withheld, true
+}
+
+// Функция для расчета удержания из зачисления в счет штрафа (не больше самого штрафа)
+func garnishAmount(username string, amount int) int {
+	fine := playerFines[username]
+	if fine <= 0 || amount <= 0 {
+		return 0
+	}
+	withheld := amount * economyConfig.Garnish.Percent / 100
+	if withheld > fine {
+		withheld = fine
+	}
+	return withheld
+}
+
+// Функция для уменьшения штрафа (при полном погашении штраф удаляется)
+func reduceFine(username string, amount int) {
+	playerFines[username] -= amount
+	if playerFines[username] > 0 {
+		if err := saveFinesToRedis(); err != nil {
+			log.Printf("reduceFine: Ошибка сохранения штрафов: %v", err)
+		}
+		return
+	}
+
+	incrCreditStat(username, "fines_cleared")
+	clearFine(username)
+}
+
+// Функция для удаления штрафа игрока из памяти и Redis
+func clearFine(username string) {
+	delete(playerFines, username)
+	delete(playerFineDates, username)
+	if redisClient != nil {
+		ctx := context.Background()
+		if err := redisClient.Del(ctx, fmt.Sprintf("fine:%s", username)).Err(); err != nil {
+			log.Printf("clearFine: Ошибка удаления штрафа %s из Redis: %v", username, err)
+		}
+		redisClient.HDel(ctx, fineDatesKey, username)
+	}
+}
+
+// Функция для текста об удержании в счет штрафа (пусто, если ничего не удержано)
+func formatWithheld(username string, withheld int) string {
+	if withheld <= 0 {
+		return ""
+	}
+	if fine := playerFines[username]; fine > 0 {
+		return fmt.Sprintf("\n🏛️ В счет штрафа удержано: %d %s (осталось долга: %d %s)",
+			withheld, getChipsWord(withheld), fine, getChipsWord(fine))
+	}
+	return fmt.Sprintf("\n🏛️ В счет штрафа удержано: %d %s - долг погашен!", withheld, getChipsWord(withheld))
+}
+
 // Функция для проверки доступа пользователя к боту
 func isUserAllowed(username string) bool {
 	// Проверяем, есть ли пользователь в списке участников
@@ -1847,8 +7027,6 @@ func addItemToInventory(username, itemName string, cost int) error {
 		return fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-
 	// Ищем существующий предмет такого типа у пользователя
 	inventory, err := getPlayerInventory(username)
 	if err != nil {
@@ -1867,201 +7045,439 @@ func addItemToInventory(username, itemName string, cost int) error {
 	if existingItem != nil {
 		// Увеличиваем счетчик существующего предмета
 		existingItem.Count++
-		key := fmt.Sprintf("inventory:%s:%s", username, existingItem.Hash)
-
-		// Сохраняем обновленный предмет
-		data, err := json.Marshal(existingItem)
-		if err != nil {
-			log.Printf("addItemToInventory: Ошибка маршалинга обновленного предмета: %v", err)
-			return fmt.Errorf("failed to marshal updated inventory item: %v", err)
-		}
 
-		err = redisClient.Set(ctx, key, data, 0).Err()
-		if err != nil {
+		if err := saveInventoryItem(username, *existingItem); err != nil {
 			log.Printf("addItemToInventory: Ошибка сохранения обновленного предмета в Redis: %v", err)
-			return fmt.Errorf("failed to save updated item to Redis: %v", err)
+			return err
 		}
 
+		appendItemHistory(existingItem.Hash, ItemEvent{Type: "bought", To: username})
 		log.Printf("addItemToInventory: Счетчик предмета %s увеличен до %d для игрока %s", itemName, existingItem.Count, username)
 	} else {
 		// Создаем новый предмет
-		itemHash := generateItemHash(username, itemName)
-		key := fmt.Sprintf("inventory:%s:%s", username, itemHash)
-
 		item := InventoryItem{
 			PrizeName: itemName,
 			Rarity:    "shop",
 			Cost:      cost,
 			Count:     1,
-			Hash:      itemHash,
 		}
 
-		// Сохраняем в Redis
-		data, err := json.Marshal(item)
+		itemID, err := generateItemID(username, item)
+		if err != nil {
+			log.Printf("addItemToInventory: Ошибка выдачи идентификатора: %v", err)
+			return err
+		}
+		item.Hash = itemID
+
+		if err := saveInventoryItem(username, item); err != nil {
+			log.Printf("addItemToInventory: Ошибка сохранения нового предмета в Redis: %v", err)
+			return err
+		}
+
+		appendItemHistory(item.Hash, ItemEvent{Type: "bought", To: username})
+		log.Printf("addItemToInventory: Новый предмет %s добавлен в инвентарь игрока %s", itemName, username)
+	}
+
+	return nil
+}
+
+// Функция для использования (удаления) магазинного предмета с нужным эффектом из инвентаря
+func useItemFromInventory(username, effect string) error {
+	log.Printf("useItemFromInventory: Используем предмет с эффектом %s у игрока %s", effect, username)
+
+	if redisClient == nil {
+		return fmt.Errorf("Redis client not available")
+	}
+
+	// Ищем предмет в инвентаре
+	inventory, err := getPlayerInventory(username)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory: %v", err)
+	}
+
+	// Ищем предмет, который по каталогу магазина дает нужный эффект
+	var foundItem *InventoryItem
+	for i := range inventory {
+		if inventory[i].Rarity != "shop" {
+			continue
+		}
+		if shopItem, ok := findShopItemByName(inventory[i].PrizeName); ok && shopItem.Effect == effect {
+			foundItem = &inventory[i]
+			break
+		}
+	}
+
+	if foundItem == nil {
+		return fmt.Errorf("item not found in inventory")
+	}
+
+	if err := removeItemByHash(username, foundItem.Hash); err != nil {
+		return err
+	}
+	appendItemHistory(foundItem.Hash, ItemEvent{Type: "used", From: username})
+
+	log.Printf("useItemFromInventory: Предмет %s успешно использован игроком %s", foundItem.PrizeName, username)
+	return nil
+}
+
+// Функция для удаления конкретного предмета по хэшу из инвентаря
+func removeItemByHash(username, itemHash string) error {
+	log.Printf("removeItemByHash: Удаляем предмет с хэшем %s у игрока %s", itemHash, username)
+
+	// Получаем предмет из Redis
+	item, err := getInventoryItem(username, itemHash)
+	if err != nil {
+		log.Printf("removeItemByHash: Предмет с хэшем %s не найден у пользователя %s: %v", itemHash, username, err)
+		return err
+	}
+
+	// Уменьшаем счетчик предмета
+	item.Count--
+
+	if item.Count <= 0 {
+		// Если предметов больше нет, удаляем запись полностью
+		if err := deleteInventoryItem(username, itemHash); err != nil {
+			log.Printf("removeItemByHash: Ошибка удаления предмета %s: %v", itemHash, err)
+			return err
+		}
+		log.Printf("removeItemByHash: Последний предмет %s удален из инвентаря игрока %s", item.PrizeName, username)
+	} else {
+		// Сохраняем обновленный предмет с уменьшенным счетчиком
+		if err := saveInventoryItem(username, item); err != nil {
+			log.Printf("removeItemByHash: Ошибка сохранения обновленного предмета в Redis: %v", err)
+			return err
+		}
+		log.Printf("removeItemByHash: Счетчик предмета %s уменьшен до %d для игрока %s", item.PrizeName, item.Count, username)
+	}
+
+	return nil
+}
+
+// Результат крафта плашек
+type CraftResult struct {
+	Rarity   string          // Редкость переплавленных плашек
+	Consumed []InventoryItem // Переплавленные плашки (по одной записи на хэш, до списания)
+	Item     InventoryItem   // Новая плашка (пусто при неудаче)
+	Failed   bool            // Крафт не удался: плашки и плата сгорели
+	WasWorn  bool            // С игрока автоматически снята надетая плашка
+}
+
+// Функция для крафта: плашки одной редкости переплавляются в случайную плашку следующей редкости.
+// Списание плашек и платы, снятие надетой плашки и выдача новой выполняются одной транзакцией.
+func craftPlates(username string, hashes []string) (CraftResult, error) {
+	var result CraftResult
+
+	if redisClient == nil {
+		return result, fmt.Errorf("Redis client not available")
+	}
+
+	if len(hashes) != economyConfig.Craft.Inputs {
+		return result, fmt.Errorf("для крафта нужно ровно %d плашки одной редкости", economyConfig.Craft.Inputs)
+	}
+
+	// Одну стопку можно указать несколько раз, если в ней хватает плашек
+	needed := make(map[string]int)
+	var order []string
+	for _, itemHash := range hashes {
+		if needed[itemHash] == 0 {
+			order = append(order, itemHash)
+		}
+		needed[itemHash]++
+	}
+
+	for _, itemHash := range order {
+		item, err := getInventoryItem(username, itemHash)
+		if err != nil {
+			return result, fmt.Errorf("плашка %s не найдена в вашем инвентаре", itemHash)
+		}
+		item.Hash = itemHash
+		if item.Rarity == "shop" {
+			return result, fmt.Errorf("%s - не плашка, ее нельзя переплавить", item.PrizeName)
+		}
+		if item.Count < needed[itemHash] {
+			return result, fmt.Errorf("в стопке %s всего %d шт.", itemHash, item.Count)
+		}
+		if result.Rarity == "" {
+			result.Rarity = item.Rarity
+		} else if item.Rarity != result.Rarity {
+			return result, fmt.Errorf("все плашки для крафта должны быть одной редкости")
+		}
+		result.Consumed = append(result.Consumed, item)
+	}
+
+	next, ok := nextRarityTier(result.Rarity)
+	if !ok {
+		return result, fmt.Errorf("%s плашки уже самые ценные, крафтить их не во что", rarityLabel(result.Rarity))
+	}
+
+	fee := economyConfig.Craft.Fee
+	if playerBalances[username] < fee {
+		return result, fmt.Errorf("недостаточно фишек для крафта! Нужно: %d %s", fee, getChipsWord(fee))
+	}
+
+	// Исход решается заранее, чтобы новую плашку можно было подготовить до транзакции
+	result.Failed = gamble.RollPercent() < economyConfig.Craft.FailChance
+
+	ctx := context.Background()
+	var prize Prize
+	var serial int
+	if !result.Failed {
+		var err error
+		prize, err = selectRandomPrizeByRarity(Rarity(next.Name))
+		if err != nil {
+			log.Printf("craftPlates: Ошибка выбора плашки редкости %s: %v", next.Name, err)
+			return result, fmt.Errorf("нет доступных плашек редкости %s", next.Label)
+		}
+
+		item := InventoryItem{PrizeID: prize.ID, PrizeName: prize.Name, Rarity: prize.Rarity, Cost: prize.Cost, Count: 1}
+		// Плашка из плашек ящиков выкупается как плашка ящика (по самому низкому проценту среди исходных)
+		for _, consumed := range result.Consumed {
+			if consumed.Source != "" && (item.Source == "" || crateSellPercent(consumed.Source) < crateSellPercent(item.Source)) {
+				item.Source = consumed.Source
+			}
+		}
+		serial, err = reservePrizeSerial(prize)
+		if err != nil {
+			return result, err
+		}
+		if prize.MaxSupply > 0 {
+			item.Serial = serial
+			item.MaxSupply = prize.MaxSupply
+		}
+
+		item.Hash, err = generateItemID(username, item)
 		if err != nil {
-			log.Printf("addItemToInventory: Ошибка маршалинга нового предмета: %v", err)
-			return fmt.Errorf("failed to marshal new inventory item: %v", err)
+			releasePrizeSerial(prize, serial)
+			return result, err
 		}
+		result.Item = item
+	}
+
+	wornKey := fmt.Sprintf("profile:%s:worn_item", username)
+	newBalance := playerBalances[username] - fee
 
-		err = redisClient.Set(ctx, key, data, 0).Err()
+	err := redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		// Перепроверяем плашки: они могли уйти из инвентаря, пока готовился крафт
+		values, err := tx.HMGet(ctx, inventoryKey(username), order...).Result()
 		if err != nil {
-			log.Printf("addItemToInventory: Ошибка сохранения нового предмета в Redis: %v", err)
-			return fmt.Errorf("failed to save new item to Redis: %v", err)
+			return err
+		}
+		for i, value := range values {
+			var item InventoryItem
+			data, ok := value.(string)
+			if !ok || json.Unmarshal([]byte(data), &item) != nil || item.Count < needed[order[i]] {
+				return fmt.Errorf("плашка %s пропала из инвентаря во время крафта", order[i])
+			}
+			item.Hash = order[i]
+			result.Consumed[i] = item
 		}
 
-		log.Printf("addItemToInventory: Новый предмет %s добавлен в инвентарь игрока %s", itemName, username)
-	}
+		wornHash := ""
+		if data, err := tx.Get(ctx, wornKey).Result(); err == nil {
+			var wornData map[string]string
+			if json.Unmarshal([]byte(data), &wornData) == nil {
+				wornHash = wornData["hash"]
+			}
+		}
 
-	return nil
-}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, item := range result.Consumed {
+				itemHash := order[i]
+				item.Count -= needed[itemHash]
+				if item.Count > 0 {
+					data, err := json.Marshal(item)
+					if err != nil {
+						return err
+					}
+					pipe.HSet(ctx, inventoryKey(username), itemHash, data)
+				} else {
+					pipe.HDel(ctx, inventoryKey(username), itemHash)
+					pipe.HDel(ctx, itemOwnersKey, itemHash)
+					pipe.HSet(ctx, itemRecordKey(itemHash), "owner", "")
+				}
 
-// Функция для использования (удаления) предмета из инвентаря
-func useItemFromInventory(username, itemName string) error {
-	log.Printf("useItemFromInventory: Используем предмет %s у игрока %s", itemName, username)
+				// Надетую плашку снимаем, как при продаже
+				if itemHash == wornHash {
+					pipe.Del(ctx, wornKey)
+					result.WasWorn = true
+				}
+			}
 
-	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
-	}
+			pipe.Set(ctx, fmt.Sprintf("balance:%s", username), newBalance, 0)
 
-	ctx := context.Background()
+			if !result.Failed {
+				data, err := json.Marshal(result.Item)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(ctx, inventoryKey(username), result.Item.Hash, data)
+				pipe.HSet(ctx, itemOwnersKey, result.Item.Hash, username)
+			}
+			return nil
+		})
+		return err
+	}, inventoryKey(username), wornKey)
 
-	// Ищем предмет в инвентаре
-	inventory, err := getPlayerInventory(username)
 	if err != nil {
-		return fmt.Errorf("failed to get inventory: %v", err)
-	}
-
-	// Ищем предмет "Оборудование для грабежа"
-	var foundItem *InventoryItem
-	for i := range inventory {
-		if inventory[i].PrizeName == itemName && inventory[i].Rarity == "shop" {
-			foundItem = &inventory[i]
-			break
+		log.Printf("craftPlates: Транзакция крафта для %s не выполнена: %v", username, err)
+		result.WasWorn = false
+		if !result.Failed {
+			// Возвращаем зарезервированный номер и отвязываем несостоявшуюся плашку
+			releasePrizeSerial(prize, serial)
+			redisClient.HSet(ctx, itemRecordKey(result.Item.Hash), "owner", "")
 		}
+		if err == redis.TxFailedErr {
+			return result, fmt.Errorf("инвентарь изменился во время крафта, попробуйте еще раз")
+		}
+		return result, err
 	}
 
-	if foundItem == nil {
-		return fmt.Errorf("item not found in inventory")
-	}
-
-	// Уменьшаем счетчик предмета
-	foundItem.Count--
-
-	key := fmt.Sprintf("inventory:%s:%s", username, foundItem.Hash)
+	playerBalances[username] = newBalance
 
-	if foundItem.Count <= 0 {
-		// Если предметов больше нет, удаляем запись полностью
-		err = redisClient.Del(ctx, key).Err()
-		if err != nil {
-			log.Printf("useItemFromInventory: Ошибка удаления предмета %s: %v", foundItem.Hash, err)
-			return fmt.Errorf("failed to remove item from Redis: %v", err)
-		}
-		log.Printf("useItemFromInventory: Последний предмет %s удален из инвентаря игрока %s", itemName, username)
+	for _, itemHash := range order {
+		appendItemHistory(itemHash, ItemEvent{Type: "crafted", From: username, Note: result.Item.Hash})
+	}
+	if !result.Failed {
+		appendItemHistory(result.Item.Hash, ItemEvent{Type: "crafted", To: username, Note: strings.Join(order, ", ")})
+		log.Printf("craftPlates: %s скрафтил %s (хэш: %s) из %v", username, formatItemName(result.Item), result.Item.Hash, hashes)
 	} else {
-		// Сохраняем обновленный предмет с уменьшенным счетчиком
-		data, err := json.Marshal(foundItem)
-		if err != nil {
-			log.Printf("useItemFromInventory: Ошибка маршалинга обновленного предмета: %v", err)
-			return fmt.Errorf("failed to marshal updated inventory item: %v", err)
-		}
-
-		err = redisClient.Set(ctx, key, data, 0).Err()
-		if err != nil {
-			log.Printf("useItemFromInventory: Ошибка сохранения обновленного предмета в Redis: %v", err)
-			return fmt.Errorf("failed to save updated item to Redis: %v", err)
-		}
-		log.Printf("useItemFromInventory: Счетчик предмета %s уменьшен до %d для игрока %s", itemName, foundItem.Count, username)
+		log.Printf("craftPlates: Крафт %s из %v не удался, плашки сгорели", username, hashes)
 	}
 
-	log.Printf("useItemFromInventory: Предмет %s успешно использован игроком %s", itemName, username)
-	return nil
+	return result, nil
 }
 
-// Функция для удаления конкретного предмета по хэшу из инвентаря
-func removeItemByHash(username, itemHash string) error {
-	log.Printf("removeItemByHash: Удаляем предмет с хэшем %s у игрока %s", itemHash, username)
-
+// Функция для открытия ящика: ящик списывается, игрок получает плашку выпавшей редкости.
+// Списание ящика и выдача плашки выполняются одной транзакцией.
+func openCrate(username, itemHash string) (ShopItem, InventoryItem, error) {
 	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+		return ShopItem{}, InventoryItem{}, fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-
-	// Получаем предмет из Redis
-	key := fmt.Sprintf("inventory:%s:%s", username, itemHash)
-	itemData, err := redisClient.Get(ctx, key).Result()
+	crateItem, err := getInventoryItem(username, itemHash)
 	if err != nil {
-		log.Printf("removeItemByHash: Предмет с хэшем %s не найден у пользователя %s", itemHash, username)
-		return fmt.Errorf("item not found in inventory")
+		return ShopItem{}, InventoryItem{}, fmt.Errorf("предмет не найден в вашем инвентаре")
+	}
+	shopItem, ok := findShopItemByName(crateItem.PrizeName)
+	if crateItem.Rarity != "shop" || !ok || shopItem.Effect != shopEffectCrate {
+		return ShopItem{}, InventoryItem{}, fmt.Errorf("%s - это не ящик", formatItemName(crateItem))
+	}
+	crate, ok := findCrate(shopItem.Crate)
+	if !ok {
+		return shopItem, InventoryItem{}, fmt.Errorf("для ящика %s не настроены шансы", shopItem.Name)
 	}
 
-	// Парсим данные предмета
-	var item InventoryItem
-	err = json.Unmarshal([]byte(itemData), &item)
+	// Плашку выбираем до списания ящика: если выпавшая редкость закончилась, ящик остается у игрока
+	rarity, err := rollCrateRarity(crate)
 	if err != nil {
-		log.Printf("removeItemByHash: Ошибка парсинга предмета %s: %v", itemHash, err)
-		return fmt.Errorf("failed to parse item data: %v", err)
+		return shopItem, InventoryItem{}, err
+	}
+	prize, err := selectRandomPrizeByRarity(rarity)
+	if err != nil {
+		log.Printf("openCrate: Нет плашек редкости %s для ящика %s: %v", rarity, crate.ID, err)
+		return shopItem, InventoryItem{}, fmt.Errorf("в ящике пусто: плашки редкости %s закончились, попробуйте позже", rarityLabel(string(rarity)))
 	}
 
-	// Уменьшаем счетчик предмета
-	item.Count--
+	// Номер и идентификатор новой плашки готовим до транзакции
+	item := InventoryItem{PrizeID: prize.ID, PrizeName: prize.Name, Rarity: prize.Rarity, Cost: prize.Cost, Count: 1, Source: crate.ID}
+	serial, err := reservePrizeSerial(prize)
+	if err != nil {
+		return shopItem, InventoryItem{}, err
+	}
+	if prize.MaxSupply > 0 {
+		item.Serial = serial
+		item.MaxSupply = prize.MaxSupply
+	}
+	item.Hash, err = generateItemID(username, item)
+	if err != nil {
+		releasePrizeSerial(prize, serial)
+		return shopItem, InventoryItem{}, err
+	}
 
-	if item.Count <= 0 {
-		// Если предметов больше нет, удаляем запись полностью
-		err = redisClient.Del(ctx, key).Err()
+	ctx := context.Background()
+	err = redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		// Перепроверяем ящик: он мог уйти из инвентаря, пока готовилась плашка
+		data, err := tx.HGet(ctx, inventoryKey(username), itemHash).Result()
 		if err != nil {
-			log.Printf("removeItemByHash: Ошибка удаления предмета %s: %v", itemHash, err)
-			return fmt.Errorf("failed to remove item from Redis: %v", err)
+			return fmt.Errorf("ящик пропал из инвентаря во время открытия")
 		}
-		log.Printf("removeItemByHash: Последний предмет %s удален из инвентаря игрока %s", item.PrizeName, username)
-	} else {
-		// Сохраняем обновленный предмет с уменьшенным счетчиком
-		data, err := json.Marshal(item)
-		if err != nil {
-			log.Printf("removeItemByHash: Ошибка маршалинга обновленного предмета: %v", err)
-			return fmt.Errorf("failed to marshal updated inventory item: %v", err)
+		var current InventoryItem
+		if err := json.Unmarshal([]byte(data), &current); err != nil || current.Count < 1 {
+			return fmt.Errorf("ящик пропал из инвентаря во время открытия")
 		}
+		current.Hash = itemHash
+		current.Count--
 
-		err = redisClient.Set(ctx, key, data, 0).Err()
+		itemData, err := json.Marshal(item)
 		if err != nil {
-			log.Printf("removeItemByHash: Ошибка сохранения обновленного предмета в Redis: %v", err)
-			return fmt.Errorf("failed to save updated item to Redis: %v", err)
+			return err
 		}
-		log.Printf("removeItemByHash: Счетчик предмета %s уменьшен до %d для игрока %s", item.PrizeName, item.Count, username)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if current.Count > 0 {
+				crateData, err := json.Marshal(current)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(ctx, inventoryKey(username), itemHash, crateData)
+			} else {
+				pipe.HDel(ctx, inventoryKey(username), itemHash)
+				pipe.HDel(ctx, itemOwnersKey, itemHash)
+				pipe.HSet(ctx, itemRecordKey(itemHash), "owner", "")
+			}
+
+			pipe.HSet(ctx, inventoryKey(username), item.Hash, itemData)
+			pipe.HSet(ctx, itemOwnersKey, item.Hash, username)
+			pipe.HSet(ctx, itemRecordKey(item.Hash), "owner", username)
+			return nil
+		})
+		return err
+	}, inventoryKey(username))
+
+	if err != nil {
+		log.Printf("openCrate: Транзакция открытия ящика %s для %s не выполнена: %v", itemHash, username, err)
+		// Возвращаем зарезервированный номер и отвязываем несостоявшуюся плашку
+		releasePrizeSerial(prize, serial)
+		redisClient.HSet(ctx, itemRecordKey(item.Hash), "owner", "")
+		if err == redis.TxFailedErr {
+			return shopItem, InventoryItem{}, fmt.Errorf("инвентарь изменился во время открытия ящика, попробуйте еще раз")
+		}
+		return shopItem, InventoryItem{}, err
 	}
 
-	log.Printf("removeItemByHash: Предмет %s успешно удален из инвентаря игрока %s", item.PrizeName, username)
-	return nil
+	appendItemHistory(itemHash, ItemEvent{Type: "used", From: username})
+	appendItemHistory(item.Hash, ItemEvent{Type: "opened", To: username, Note: shopItem.Name})
+
+	log.Printf("openCrate: %s открыл %s и получил %s (хэш: %s)", username, shopItem.Name, formatItemName(item), item.Hash)
+	return shopItem, item, nil
 }
 
-// Функция для добавления украденного предмета в инвентарь (группирует одинаковые предметы)
-func addStolenItemToInventory(username string, item InventoryItem) error {
+// Функция для добавления украденного или переданного предмета в инвентарь.
+// Магазинные предметы группируются по имени и цене, плашки сохраняют свой идентификатор.
+// Возвращает идентификатор, под которым предмет оказался у нового владельца.
+func addStolenItemToInventory(username string, item InventoryItem) (string, error) {
 	log.Printf("addStolenItemToInventory: Добавляем предмет %s (хэш: %s, редкость: %s, цена: %d) игроку %s", item.PrizeName, item.Hash, item.Rarity, item.Cost, username)
 
 	if redisClient == nil {
-		return fmt.Errorf("Redis client not available")
+		return "", fmt.Errorf("Redis client not available")
 	}
 
-	ctx := context.Background()
-
-	// Ищем существующий предмет с таким же именем и характеристиками
+	// Ищем существующий предмет с тем же идентификатором (или такой же магазинный предмет)
 	inventory, err := getPlayerInventory(username)
 	if err != nil {
 		log.Printf("addStolenItemToInventory: Ошибка получения инвентаря: %v", err)
-		return fmt.Errorf("failed to get inventory: %v", err)
+		return "", fmt.Errorf("failed to get inventory: %v", err)
 	}
 
 	var existingItem *InventoryItem
 	for i := range inventory {
-		// Для магазинных предметов группируем по имени и цене
-		if item.Rarity == "shop" && inventory[i].Rarity == "shop" &&
-			inventory[i].PrizeName == item.PrizeName && inventory[i].Cost == item.Cost {
+		if inventory[i].Hash == item.Hash {
 			existingItem = &inventory[i]
 			break
 		}
-		// Для плашек группируем по имени и редкости
-		if item.Rarity != "shop" && inventory[i].Rarity == item.Rarity &&
-			inventory[i].PrizeName == item.PrizeName {
+		// Для магазинных предметов группируем по имени и цене
+		if item.Rarity == "shop" && inventory[i].Rarity == "shop" &&
+			inventory[i].PrizeName == item.PrizeName && inventory[i].Cost == item.Cost {
 			existingItem = &inventory[i]
 			break
 		}
@@ -2073,44 +7489,38 @@ func addStolenItemToInventory(username string, item InventoryItem) error {
 			existingItem.PrizeName, existingItem.Count, existingItem.Count+item.Count)
 
 		existingItem.Count += item.Count
-		key := fmt.Sprintf("inventory:%s:%s", username, existingItem.Hash)
-
-		// Сохраняем обновленный предмет
-		data, err := json.Marshal(existingItem)
-		if err != nil {
-			log.Printf("addStolenItemToInventory: Ошибка маршалинга обновленного предмета: %v", err)
-			return fmt.Errorf("failed to marshal updated inventory item: %v", err)
-		}
-
-		err = redisClient.Set(ctx, key, data, 0).Err()
-		if err != nil {
+		if err := saveInventoryItem(username, *existingItem); err != nil {
 			log.Printf("addStolenItemToInventory: Ошибка сохранения обновленного предмета в Redis: %v", err)
-			return fmt.Errorf("failed to save updated item to Redis: %v", err)
+			return "", err
 		}
 
 		log.Printf("addStolenItemToInventory: Предмет %s успешно добавлен к существующему (общий счетчик: %d)", item.PrizeName, existingItem.Count)
-		return nil
+		return existingItem.Hash, nil
 	}
 
-	// Существующего предмета не найдено, создаем новый с переданным хэшем
-	log.Printf("addStolenItemToInventory: Создаем новый предмет %s с хэшем %s", item.PrizeName, item.Hash)
-	key := fmt.Sprintf("inventory:%s:%s", username, item.Hash)
-
-	// Сохраняем предмет
-	data, err := json.Marshal(item)
-	if err != nil {
-		log.Printf("addStolenItemToInventory: Ошибка маршалинга предмета: %v", err)
-		return fmt.Errorf("failed to marshal item: %v", err)
+	// Если идентификатор все еще занят (часть стопки осталась у прежнего владельца) - выдаем новый
+	ctx := context.Background()
+	currentOwner, err := redisClient.HGet(ctx, itemOwnersKey, item.Hash).Result()
+	if err == nil && currentOwner != username {
+		newID, idErr := generateItemID(username, item)
+		if idErr != nil {
+			log.Printf("addStolenItemToInventory: Ошибка выдачи нового идентификатора: %v", idErr)
+			return "", idErr
+		}
+		log.Printf("addStolenItemToInventory: Идентификатор %s занят игроком %s, предмет получает новый %s", item.Hash, currentOwner, newID)
+		copyItemHistory(item.Hash, newID)
+		appendItemHistory(newID, ItemEvent{Type: "split", Note: item.Hash})
+		item.Hash = newID
 	}
 
-	err = redisClient.Set(ctx, key, data, 0).Err()
-	if err != nil {
+	log.Printf("addStolenItemToInventory: Создаем новый предмет %s с хэшем %s", item.PrizeName, item.Hash)
+	if err := saveInventoryItem(username, item); err != nil {
 		log.Printf("addStolenItemToInventory: Ошибка сохранения предмета в Redis: %v", err)
-		return fmt.Errorf("failed to save item to Redis: %v", err)
+		return "", err
 	}
 
 	log.Printf("addStolenItemToInventory: Предмет %s успешно добавлен в инвентарь игрока %s", item.PrizeName, username)
-	return nil
+	return item.Hash, nil
 }
 
 // Функция для инициализации балансов участников
@@ -2119,6 +7529,14 @@ func initializeBalances() {
 	loadAllBalancesFromRedis()
 	loadAllBanksFromRedis()
 	loadAllFinesFromRedis()
+	loadAllLimitsFromRedis()
+
+	// Аккаунты, появившиеся до учета возраста, считаются старыми (для лимитов переводов)
+	existing := make([]string, 0, len(playerBalances))
+	for username := range playerBalances {
+		existing = append(existing, username)
+	}
+	backfillAccountAges(existing)
 
 	// Для новых участников, у которых нет баланса, устанавливаем начальный баланс
 	for _, username := range participantIDs {
@@ -2126,6 +7544,7 @@ func initializeBalances() {
 			if _, exists := playerBalances[username]; !exists {
 				playerBalances[username] = 1000 // Начальный баланс 1000
 				saveBalanceToRedis(username, 1000)
+				registerAccount(username)
 			}
 		}
 	}
@@ -2192,6 +7611,11 @@ func main() {
 	initParticipantHashes()
 	log.Printf("main: Хэши инициализированы для %d участников", len(participantHashes))
 
+	// Загружаем настройки экономики (до балансов: по лимитам переводов определяется возраст старых аккаунтов)
+	if err := loadEconomyConfig(); err != nil {
+		log.Printf("main: Ошибка загрузки настроек экономики, используются значения по умолчанию: %v", err)
+	}
+
 	// Инициализируем балансы участников
 	log.Printf("main: Инициализируем балансы участников")
 	initializeBalances()
@@ -2202,6 +7626,17 @@ func main() {
 	shuffleParticipants()
 	log.Printf("main: Участники после перемешивания: %v", participants)
 
+	// Переносим предметы и призы из старого формата хранения
+	log.Printf("main: Проверяем старый формат хранения инвентарей")
+	migrateLegacyInventoryKeys()
+	backfillItemRecords()
+
+	// Загружаем каталог магазина (после настроек экономики: ящики ссылаются на их таблицы шансов)
+	if err := loadShopCatalog(); err != nil {
+		log.Printf("main: Ошибка загрузки каталога магазина, используется каталог по умолчанию: %v", err)
+		initShopStock()
+	}
+
 	// Загружаем призы из файла в Redis при запуске
 	log.Printf("main: Загружаем призы из prizes.json в Redis")
 	if err := loadPrizesFromFileToRedis(); err != nil {
@@ -2226,8 +7661,33 @@ func main() {
 
 	updates := bot.GetUpdatesChan(u)
 
-	// Обрабатываем обновления
-	for update := range updates {
+	// Следим за prizes.json и предлагаем администраторам применить изменения
+	go watchPrizesFile(bot)
+
+	// Возобновляем ограбления, начатые до перезапуска
+	resumeHeists(bot)
+
+	// Возвращаем фишки за просроченные награды
+	go watchBountyExpiry(bot)
+
+	// Запускаем планировщик фоновых задач (штрафы, проценты, сезоны, объявления)
+	ensureSeasonStart()
+	go runScheduler(bot)
+
+	// Обрабатываем обновления и задачи фоновых горутин
+	for {
+		var update tgbotapi.Update
+		select {
+		case task := <-mainLoopTasks:
+			task()
+			continue
+		case next, ok := <-updates:
+			if !ok {
+				return
+			}
+			update = next
+		}
+
 		log.Printf("Получено обновление: %v", update.UpdateID)
 		if update.Message != nil { // Если это сообщение
 			log.Printf("Получено сообщение от %s: %s", update.Message.From.UserName, update.Message.Text)
@@ -2249,6 +7709,9 @@ func main() {
 
 				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
 
+				// Запоминаем id пользователя для личных уведомлений (администраторам - об изменении prizes.json)
+				rememberUserChat(userName, update.Message.From.ID)
+
 				switch update.Message.Command() {
 				case "bet":
 					log.Printf("🎯 Команда /bet от %s: isGameActive=%t, bettingPhase=%s", userName, isGameActive, bettingPhase)
@@ -2366,6 +7829,13 @@ func main() {
 						break
 					}
 
+					// Проверяем личные ограничения игрока
+					if err := checkGamblingAllowed(userName, betAmount, "bet"); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Получаем хэш участника
 					participantHash := participantHashes[participantName]
 
@@ -2382,6 +7852,8 @@ func main() {
 						msg.Text = "🚫 Ошибка при списании средств!"
 						break
 					}
+					recordGamblingResult(userName, -betAmount)
+					addCreditStat(userName, "wagered", betAmount)
 
 					// Сохраняем ставку
 					if bettingPhase == "initial" {
@@ -2422,13 +7894,12 @@ func main() {
 					bettingPhase = "initial"
 
 					// Выбираем плашку для этой игры (всегда новая при каждом запуске)
-					rarity := GenerateRandomRarity()
-					selectedPrize, err := selectRandomPrizeByRarity(rarity)
-					if err != nil {
+					rarity := rollRarityForChat(update.Message.Chat.ID)
+					releaseGamePrize()
+					if err := selectGamePrize(rarity); err != nil {
 						log.Printf("Ошибка выбора плашки: %v, используем дефолтную", err)
 						currentPrize = Prize{Name: "ЧМО", Rarity: "common", Cost: 300}
 					} else {
-						currentPrize = selectedPrize
 						log.Printf("Выбрана плашка для игры: %s (%s редкость)", currentPrize.Name, currentPrize.Rarity)
 					}
 
@@ -2468,15 +7939,7 @@ func main() {
 					gameText := "🎮 НАЧИНАЕМ ИГРУ!\n\n"
 
 					// Показываем редкость будущей плашки
-					rarityText := ""
-					switch currentPrize.Rarity {
-					case "common":
-						rarityText = "ОБЫЧНАЯ"
-					case "rare":
-						rarityText = "РЕДКАЯ"
-					case "legendary":
-						rarityText = "ЛЕГЕНДАРНАЯ"
-					}
+					rarityText := rarityLabel(currentPrize.Rarity)
 					gameText += fmt.Sprintf("🎁 БУДЕТ РАЗЫГРАНА %s ПЛАШКА!\n\n", rarityText)
 
 					gameText += "🏆 УЧАСТНИКИ:\n"
@@ -2509,6 +7972,7 @@ func main() {
 					// Теперь устанавливаем флаги игры
 					isGameActive = true   // Устанавливаем после успешной отправки сообщения
 					gameInProgress = true // Помечаем, что процесс игры запущен
+					currentGameNumber = nextGameNumber()
 
 					// Сохраняем ID сообщения для редактирования
 					gameMessageID = sentMsg.MessageID
@@ -2567,7 +8031,7 @@ func main() {
 					gameInProgress = false
 					currentRound = 0
 					bettingPhase = "closed"
-					currentPrize = Prize{}
+					releaseGamePrize()
 
 					// Очищаем все ставки
 					initialBets = make(map[string]Bet)
@@ -2631,16 +8095,22 @@ func main() {
 
 					ctx := context.Background()
 
-					// Ищем все ключи инвентаря
-					pattern := "inventory:*:*"
-					keys, err := redisClient.Keys(ctx, pattern).Result()
+					// Считаем предметы по глобальному индексу и ищем все хэши инвентарей
+					deletedCount, err := redisClient.HLen(ctx, itemOwnersKey).Result()
+					if err != nil {
+						log.Printf("Команда /clearallinv: Ошибка подсчета предметов: %v", err)
+						msg.Text = "❌ Ошибка получения списка инвентарей!"
+						break
+					}
+
+					keys, err := scanKeys(ctx, "inv:*")
 					if err != nil {
 						log.Printf("Команда /clearallinv: Ошибка получения ключей инвентаря: %v", err)
 						msg.Text = "❌ Ошибка получения списка инвентарей!"
 						break
 					}
 
-					log.Printf("Команда /clearallinv: Найдено %d ключей инвентаря для удаления", len(keys))
+					log.Printf("Команда /clearallinv: Найдено %d инвентарей (%d предметов) для удаления", len(keys), deletedCount)
 
 					if len(keys) == 0 {
 						msg.Text = "🧹 Все инвентари уже пусты!"
@@ -2648,8 +8118,20 @@ func main() {
 						break
 					}
 
-					// Удаляем все ключи инвентаря
-					deletedCount, err := redisClient.Del(ctx, keys...).Result()
+					// Глобальные записи о предметах остаются, но без владельца
+					itemIDs, err := redisClient.HKeys(ctx, itemOwnersKey).Result()
+					if err == nil && len(itemIDs) > 0 {
+						pipe := redisClient.Pipeline()
+						for _, itemID := range itemIDs {
+							pipe.HSet(ctx, itemRecordKey(itemID), "owner", "")
+						}
+						if _, err := pipe.Exec(ctx); err != nil {
+							log.Printf("Команда /clearallinv: Ошибка сброса владельцев предметов: %v", err)
+						}
+					}
+
+					// Удаляем все инвентари вместе с глобальным индексом
+					err = redisClient.Del(ctx, append(keys, itemOwnersKey)...).Err()
 					if err != nil {
 						log.Printf("Команда /clearallinv: Ошибка удаления инвентарей: %v", err)
 						msg.Text = "❌ Ошибка очистки инвентарей!"
@@ -2733,8 +8215,8 @@ func main() {
 					finalBets = make(map[string]Bet)
 					finalBettingNumbers = []int{}
 
-					// Сбрасываем выбранную плашку
-					currentPrize = Prize{}
+					// Сбрасываем выбранную плашку и возвращаем зарезервированный номер в тираж
+					releaseGamePrize()
 
 					msg.Text = "🛑 Игра остановлена!"
 
@@ -2847,14 +8329,26 @@ func main() {
 					if args == "" {
 						msg.Text = fmt.Sprintf("🎁 Текущая плашка: \"%s\" (%s редкость)\nУкажите ID или название плашки! Пример: /setprize chmo", currentPrize.Name, currentPrize.Rarity)
 					} else {
-						// Ищем плашку по ID или названию
+						// Ищем плашку по ID или названию в каталоге
+						prizes, _ := loadAllPrizesFromRedis()
 						found := false
 						for _, prize := range prizes {
 							if prize.ID == args || prize.Name == args {
+								found = true
 								oldPrize := currentPrize
+								oldSerial := currentPrizeSerial
+								serial := 0
+								if prize.MaxSupply > 0 {
+									var err error
+									if serial, err = reservePrizeSerial(prize); err != nil {
+										msg.Text = "🚫 " + err.Error()
+										break
+									}
+								}
 								currentPrize = prize
+								currentPrizeSerial = serial
+								releasePrizeSerial(oldPrize, oldSerial)
 								msg.Text = fmt.Sprintf("🎁 Плашка изменена!\nБыло: \"%s\" (%s)\nСтало: \"%s\" (%s)", oldPrize.Name, oldPrize.Rarity, currentPrize.Name, currentPrize.Rarity)
-								found = true
 								break
 							}
 						}
@@ -2907,16 +8401,12 @@ func main() {
 					}
 
 				case "prize":
-					rarityText := ""
-					switch currentPrize.Rarity {
-					case "common":
-						rarityText = "ОБЫЧНАЯ"
-					case "rare":
-						rarityText = "РЕДКАЯ"
-					case "legendary":
-						rarityText = "ЛЕГЕНДАРНАЯ"
-					}
+					rarityText := rarityLabel(currentPrize.Rarity)
 					msg.Text = fmt.Sprintf("🎁 В этой игре будет разыграна %s плашка для победителя!", rarityText)
+					if currentPrize.MaxSupply > 0 && currentPrizeSerial > 0 {
+						msg.Text += fmt.Sprintf("\n🔢 Лимитированная серия: победитель получит экземпляр #%d/%d",
+							currentPrizeSerial, currentPrize.MaxSupply)
+					}
 
 				case "balance":
 					userName := update.Message.From.UserName
@@ -2941,6 +8431,17 @@ func main() {
 							balanceText += fmt.Sprintf("\n\n⚠️ **ДОЛГ ПО ШТРАФУ:** %d %s\n💸 Выплатить: /payfine", fineBalance, getChipsWord(fineBalance))
 						}
 
+						if until, bankrupt := getBankruptUntil(userName); bankrupt {
+							balanceText += fmt.Sprintf("\n\n⚖️ **БАНКРОТ** до %s (ставки до %d %s, кредиты недоступны)",
+								until.Format("02.01.2006 15:04"), economyConfig.Bankruptcy.MaxStake, getChipsWord(economyConfig.Bankruptcy.MaxStake))
+						}
+
+						if until, jailed := getJailUntil(userName); jailed {
+							bail := getBailAmount(until)
+							balanceText += fmt.Sprintf("\n\n⛓️ **В ТЮРЬМЕ** до %s\n💰 Залог: %d %s (/bail)",
+								until.Format("02.01.2006 15:04"), bail, getChipsWord(bail))
+						}
+
 						msg := tgbotapi.NewMessage(update.Message.Chat.ID, balanceText)
 						msg.ReplyToMessageID = update.Message.MessageID
 						if _, err := bot.Send(msg); err != nil {
@@ -2960,15 +8461,90 @@ func main() {
 					args := update.Message.CommandArguments()
 
 					if args == "" {
-						// Показать справку по банку
-						bankBalance := playerBanks[userName] // 0 если не существует
-						msg.Text = fmt.Sprintf("🏦 БАНК - безопасное хранение фишек!\n\n💰 На счету: %d %s\n💵 На руках: %d %s\n\n📋 Команды:\n• /bank add 1000 - положить 1000 фишек в банк\n• /bank add all - положить все деньги в банк\n• /bank get 500 - снять 500 фишек из банка\n\n⚠️ Фишки в банке нельзя тратить на ставки!",
-							bankBalance, getChipsWord(bankBalance), playerBalances[userName], getChipsWord(playerBalances[userName]))
+						// Показать счет, вклады и прогноз дохода
+						msg.Text = formatBankAccount(userName)
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
 					parts := strings.Split(args, " ")
+
+					// Срочные вклады: /bank deposit 5000 7d и /bank withdraw номер
+					if operation := strings.ToLower(parts[0]); operation == "deposit" {
+						if len(parts) < 3 {
+							msg.Text = "🏦 Укажите сумму и срок вклада! Пример: /bank deposit 5000 7d"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						amount, err := strconv.Atoi(parts[1])
+						if err != nil || amount < economyConfig.Bank.MinDeposit {
+							msg.Text = fmt.Sprintf("🏦 Минимальная сумма вклада: %d %s", economyConfig.Bank.MinDeposit, getChipsWord(economyConfig.Bank.MinDeposit))
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						days, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(parts[2]), "d"))
+						term, ok := findDepositTerm(days)
+						if err != nil || !ok {
+							msg.Text = "🏦 Такого срока вклада нет! Доступные сроки: /bank"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+
+						deposit, err := openDeposit(userName, amount, term)
+						if err != nil {
+							msg.Text = fmt.Sprintf("🏦 Не удалось открыть вклад: %v\n💰 На счету: %d %s",
+								err, playerBanks[userName], getChipsWord(playerBanks[userName]))
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+
+						payout := deposit.Payout()
+						msg.Text = fmt.Sprintf("🏦 ✅ Открыт вклад #%s!\n\n"+
+							"🔒 Сумма: %d %s на %d дн.\n"+
+							"💹 Ставка: %.2f%% в день\n"+
+							"📅 Срок: до %s\n"+
+							"💰 К выплате: %d %s\n\n"+
+							"⚠️ Досрочное закрытие: штраф %d%% и без процентов",
+							deposit.ID, deposit.Amount, getChipsWord(deposit.Amount), deposit.Days, deposit.Rate,
+							deposit.MaturesAt.Format("02.01.2006 15:04"), payout, getChipsWord(payout), economyConfig.Bank.EarlyPenaltyPercent)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					} else if operation == "withdraw" {
+						if len(parts) < 2 {
+							msg.Text = "🏦 Укажите номер вклада! Пример: /bank withdraw 1"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						id := strings.TrimPrefix(parts[1], "#")
+						var found *Deposit
+						for _, deposit := range getDeposits(userName) {
+							if deposit.ID == id {
+								found = &deposit
+								break
+							}
+						}
+						if found == nil {
+							msg.Text = fmt.Sprintf("🏦 Вклад #%s не найден! Ваши вклады: /bank", id)
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+
+						payout, penalty, err := closeDeposit(userName, *found)
+						if err != nil {
+							msg.Text = fmt.Sprintf("🏦 Не удалось закрыть вклад: %v", err)
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+
+						msg.Text = fmt.Sprintf("🏦 Вклад #%s закрыт!\n\n💰 Возвращено на счет: %d %s\n", found.ID, payout, getChipsWord(payout))
+						if penalty > 0 {
+							msg.Text += fmt.Sprintf("⚠️ Штраф за досрочное закрытие: %d %s\n", penalty, getChipsWord(penalty))
+						}
+						msg.Text += fmt.Sprintf("🏦 На счету: %d %s", playerBanks[userName], getChipsWord(playerBanks[userName]))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					if len(parts) < 2 {
 						msg.Text = "🏦 Укажите операцию и сумму!\nПримеры:\n• /bank add 1000\n• /bank add all\n• /bank get 500"
 						msg.ReplyToMessageID = update.Message.MessageID
@@ -3067,10 +8643,149 @@ func main() {
 						msg.ReplyToMessageID = update.Message.MessageID
 
 					} else {
-						msg.Text = "🏦 Неизвестная операция!\nИспользуйте: add или get"
+						msg.Text = "🏦 Неизвестная операция!\nИспользуйте: add, get, deposit или withdraw"
+						msg.ReplyToMessageID = update.Message.MessageID
+					}
+
+				case "loan":
+					log.Printf("Команда /loan от %s", userName)
+					args := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+
+					if args == "" {
+						msg.Text = formatLoanStatus(userName)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					if args == "repay" {
+						loan, exists := getLoan(userName)
+						if !exists {
+							msg.Text = "✅ У вас нет кредита!"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						remaining := loan.Total - loan.Paid
+						if playerBalances[userName] < remaining || !changeBalance(userName, -remaining) {
+							msg.Text = fmt.Sprintf("🚫 Недостаточно средств для досрочного погашения!\n\n💸 Осталось выплатить: %d %s\n💵 Ваш баланс: %d %s",
+								remaining, getChipsWord(remaining), playerBalances[userName], getChipsWord(playerBalances[userName]))
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						if _, _, err := applyLoanPayment(userName, loan, remaining); err != nil {
+							log.Printf("Команда /loan: Ошибка погашения кредита %s: %v", userName, err)
+							changeBalance(userName, remaining)
+							msg.Text = "🚫 Ошибка погашения кредита! Попробуйте позже."
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						msg.Text = fmt.Sprintf("✅ **КРЕДИТ ПОГАШЕН!**\n\n💸 Выплачено: %d %s\n💵 Ваш баланс: %d %s\n\n📈 Кредитный рейтинг растет!",
+							remaining, getChipsWord(remaining), playerBalances[userName], getChipsWord(playerBalances[userName]))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					amount, err := strconv.Atoi(args)
+					if err != nil || amount <= 0 {
+						msg.Text = "🚫 Укажите сумму кредита! Пример: /loan 1000\n\n📊 Рейтинг и лимит: /loan"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					score, _ := getCreditScore(userName)
+					if limit := getLoanLimit(userName, score); amount > limit {
+						msg.Text = fmt.Sprintf("🚫 Сумма превышает ваш лимит!\n\n📊 Кредитный рейтинг: %d/1000\n💳 Доступно: %d %s",
+							score, limit, getChipsWord(limit))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					loan, err := takeLoan(userName, amount)
+					if err != nil {
+						msg.Text = fmt.Sprintf("🚫 Кредит не выдан: %v", err)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					msg.Text = fmt.Sprintf("🤝 **КРЕДИТ ВЫДАН!**\n\n"+
+						"💰 Получено: %d %s\n"+
+						"💸 К возврату: %d %s\n"+
+						"📅 Платежи: по %d %s раз в %d дн., первый %s\n"+
+						"🏦 Платежи списываются автоматически\n\n"+
+						"💵 Ваш баланс: %d %s",
+						loan.Principal, getChipsWord(loan.Principal), loan.Total, getChipsWord(loan.Total),
+						loan.Installment, getChipsWord(loan.Installment), economyConfig.Loan.InstallmentDays,
+						loan.NextDue.Format("02.01.2006 15:04"), playerBalances[userName], getChipsWord(playerBalances[userName]))
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "bankrupt":
+					log.Printf("Команда /bankrupt от %s", userName)
+					bankruptConfig := economyConfig.Bankruptcy
+
+					if until, bankrupt := getBankruptUntil(userName); bankrupt {
+						msg.Text = fmt.Sprintf("⚖️ Вы уже банкрот до %s!", until.Format("02.01.2006 15:04"))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					loan, hasLoan := getLoan(userName)
+					debt := playerFines[userName]
+					if hasLoan {
+						debt += loan.Total - loan.Paid
+					}
+					if debt <= 0 {
+						msg.Text = "✅ У вас нет долгов - банкротиться не из-за чего!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					if assets := getLiquidAssets(userName); assets >= debt {
+						msg.Text = fmt.Sprintf("🚫 У вас хватает денег, чтобы расплатиться: долг %d %s, на балансе, в банке и на вкладах %d %s!\n\n"+
+							"💸 Оплатить штраф: /payfine\n🤝 Погасить кредит: /loan repay\n🏦 Снять деньги: /bank get, /bank withdraw",
+							debt, getChipsWord(debt), assets, getChipsWord(assets))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					if strings.TrimSpace(update.Message.CommandArguments()) != "confirm" {
+						msg.Text = fmt.Sprintf("⚖️ **БАНКРОТСТВО**\n\n"+
+							"💸 Ваш долг: %d %s\n\n"+
+							"📋 Что произойдет:\n"+
+							"• Баланс, банковский счет и все вклады (даже не созревшие) изымаются\n"+
+							"• Весь инвентарь продается по цене выкупа\n"+
+							"• Выручка идет в погашение долга, остаток долга списывается\n"+
+							"• %d дн. вы банкрот: ставки не больше %d %s, кредиты недоступны\n"+
+							"• Вы попадаете на /shameboard\n\n"+
+							"✍️ Подтвердить: /bankrupt confirm",
+							debt, getChipsWord(debt), bankruptConfig.Days, bankruptConfig.MaxStake, getChipsWord(bankruptConfig.MaxStake))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					result, err := declareBankruptcy(userName)
+					if err != nil {
+						msg.Text = fmt.Sprintf("🚫 Банкротство не проведено: %v", err)
 						msg.ReplyToMessageID = update.Message.MessageID
+						break
 					}
 
+					msg.Text = fmt.Sprintf("⚖️ **@%s ОБЪЯВЛЕН БАНКРОТОМ!**\n\n"+
+						"💸 Долг: %d %s\n"+
+						"💵 Изъято с баланса: %d %s\n"+
+						"🏦 Списано со счета: %d %s\n"+
+						"🔒 Изъято со вкладов: %d %s\n"+
+						"🎒 Продано предметов: %d на %d %s\n"+
+						"✅ Погашено: %d %s\n"+
+						"🗑️ Списано долга: %d %s\n",
+						userName, result.Debt, getChipsWord(result.Debt),
+						result.CashValue, getChipsWord(result.CashValue),
+						result.BankValue, getChipsWord(result.BankValue),
+						result.DepositsValue, getChipsWord(result.DepositsValue),
+						result.Items, result.ItemsValue, getChipsWord(result.ItemsValue),
+						result.Paid, getChipsWord(result.Paid), result.WrittenOff, getChipsWord(result.WrittenOff))
+					if result.Returned > 0 {
+						msg.Text += fmt.Sprintf("💰 Остаток выручки на баланс: %d %s\n", result.Returned, getChipsWord(result.Returned))
+					}
+					msg.Text += fmt.Sprintf("\n🪦 Статус банкрота до %s: ставки не больше %d %s, кредиты недоступны",
+						result.Until.Format("02.01.2006 15:04"), bankruptConfig.MaxStake, getChipsWord(bankruptConfig.MaxStake))
+					msg.ReplyToMessageID = update.Message.MessageID
+
 				case "fuck":
 					userName := update.Message.From.UserName
 					args := update.Message.CommandArguments()
@@ -3247,33 +8962,52 @@ func main() {
 						break
 					}
 
-					// Проверяем баланс отправителя
+					// Проверяем долг и суточный лимит переводов
+					if err := checkTransferAllowed(userName, amount); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Проверяем баланс отправителя (налог платит отправитель)
+					tax := transferTax(amount)
 					senderBalance, exists := playerBalances[userName]
-					if !exists || senderBalance < amount {
-						msg.Text = fmt.Sprintf("🚫 Недостаточно средств! Ваш баланс: %d %s",
-							senderBalance, getChipsWord(senderBalance))
+					if !exists || senderBalance < amount+tax {
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств! Нужно: %d %s (включая налог %d)\n💰 Ваш баланс: %d %s",
+							amount+tax, getChipsWord(amount+tax), tax, senderBalance, getChipsWord(senderBalance))
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
 					// Выполняем перевод
-					if !changeBalance(userName, -amount) {
+					if !changeBalance(userName, -(amount + tax)) {
 						msg.Text = "🚫 Ошибка при списании средств!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
-					if !changeBalance(recipientUsername, amount) {
+					withheld, ok := creditPlayer(recipientUsername, amount)
+					if !ok {
 						// Возвращаем фишки отправителю в случае ошибки
-						changeBalance(userName, amount)
+						changeBalance(userName, amount+tax)
 						msg.Text = "🚫 Ошибка при зачислении средств получателю!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
+					recordTransfer(bot, userName, recipientUsername, amount)
+					appendJournal(userName, JournalEntry{Type: "transfer_out", Amount: -(amount + tax),
+						Note: fmt.Sprintf("@%s, налог %d", recipientUsername, tax)})
+					appendJournal(recipientUsername, JournalEntry{Type: "transfer_in", Amount: amount, Note: "от @" + userName})
 
-					log.Printf("Команда /pay: %s перевел %d фишек пользователю %s", userName, amount, recipientUsername)
+					log.Printf("Команда /pay: %s перевел %d фишек пользователю %s (налог %d)", userName, amount, recipientUsername, tax)
 					msg.Text = fmt.Sprintf("✅ Успешно переведено %d %s пользователю @%s!\n💰 Ваш баланс: %d %s",
 						amount, getChipsWord(amount), recipientUsername, playerBalances[userName], getChipsWord(playerBalances[userName]))
+					if tax > 0 {
+						msg.Text += fmt.Sprintf("\n🧾 Налог на перевод: %d %s", tax, getChipsWord(tax))
+					}
+					if withheld > 0 {
+						msg.Text += fmt.Sprintf("\n🏛️ У @%s в счет штрафа удержано: %d %s", recipientUsername, withheld, getChipsWord(withheld))
+					}
 					msg.ReplyToMessageID = update.Message.MessageID
 
 				case "coin":
@@ -3346,8 +9080,16 @@ func main() {
 						break
 					}
 
+					// Проверяем личные ограничения игрока
+					if err := checkGamblingAllowed(userName, betAmount, "coin"); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Снимаем ставку сразу
 					changeBalance(userName, -betAmount)
+					markCoinToss(userName)
 
 					// Делаем бросок монеты
 					result := gamble.TossCoin()
@@ -3355,6 +9097,7 @@ func main() {
 
 					log.Printf("🪙 Бросок монеты: игрок %s поставил на %s %d фишек, выпало %s (x%d)",
 						userName, coinSide, betAmount, result, multiplier)
+					addCreditStat(userName, "wagered", betAmount)
 
 					// Определяем результат ставки
 					var winAmount int
@@ -3364,7 +9107,10 @@ func main() {
 					if result == gamble.CoinResult(coinSide) {
 						// Выигрыш! Возвращаем ставку + выигрыш
 						winAmount = betAmount * multiplier
-						changeBalance(userName, winAmount)
+						// Ставка возвращается целиком, в счет штрафа взыскивается только чистый выигрыш
+						changeBalance(userName, betAmount)
+						withheld, _ := creditPlayer(userName, winAmount-betAmount)
+						recordGamblingResult(userName, winAmount-betAmount)
 						resultEmoji = "🎉"
 						if isAllIn {
 							resultText = fmt.Sprintf("💥 МЕГА-ВЫИГРЫШ! %s!\n💰 +%d %s (x%d)\n🔥 ВСЁ ИЛИ НИЧЕГО! 🔥",
@@ -3373,8 +9119,10 @@ func main() {
 							resultText = fmt.Sprintf("✅ ВЫИГРЫШ! %s!\n💰 +%d %s (x%d)",
 								getCoinResultText(result), winAmount, getChipsWord(winAmount), multiplier)
 						}
+						resultText += formatWithheld(userName, withheld)
 					} else {
 						// Проигрыш (ставка уже снята)
+						recordGamblingResult(userName, -betAmount)
 						resultEmoji = "😞"
 						if isAllIn {
 							resultText = fmt.Sprintf("💀 КАТАСТРОФИЧЕСКИЙ ПРОИГРЫШ! %s!\n💰 -%d %s\n😵 ВСЁ ПРОИГРАНО! ВСЁ!",
@@ -3397,6 +9145,26 @@ func main() {
 						resultEmoji, resultText, playerBalances[userName], getChipsWord(playerBalances[userName]))
 					msg.ReplyToMessageID = update.Message.MessageID
 
+				case "jobs":
+					// Проверяем, является ли пользователь администратором
+					if userName != "hunnidstooblue" && userName != "iamnothiding" {
+						msg.Text = "🚫 Только администраторы могут просматривать фоновые задачи!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					msg.Text = formatJobs()
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "alerts":
+					// Проверяем, является ли пользователь администратором
+					if userName != "hunnidstooblue" && userName != "iamnothiding" {
+						msg.Text = "🚫 Только администраторы могут просматривать тревоги по переводам!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					msg.Text = formatTransferAlerts()
+					msg.ReplyToMessageID = update.Message.MessageID
+
 				case "debug":
 					// Проверяем, является ли пользователь администратором
 					if userName != "hunnidstooblue" && userName != "iamnothiding" {
@@ -3450,23 +9218,25 @@ func main() {
 					inventoryValues := make(map[string]int)
 					inventoryItems := make(map[string][]InventoryItem)
 
-					// Для каждого участника считаем стоимость его инвентаря
-					for participantName, username := range participantIDs {
-						log.Printf("Команда /leaderboard: обрабатываем участника %s (username: %s)", participantName, username)
-						inventory, err := getPlayerInventory(username)
-						if err != nil {
-							log.Printf("Ошибка получения инвентаря для %s: %v", username, err)
-							continue
-						}
+					// Загружаем инвентари всех участников одним конвейером запросов
+					usernames := make([]string, 0, len(participantIDs))
+					for _, username := range participantIDs {
+						usernames = append(usernames, username)
+					}
+					inventories, err := getInventoriesForUsers(usernames)
+					if err != nil {
+						log.Printf("Ошибка получения инвентарей: %v", err)
+					}
 
+					// Для каждого участника считаем стоимость его инвентаря
+					for username, inventory := range inventories {
 						totalValue := 0
 						for _, item := range inventory {
 							totalValue += item.Cost
-							log.Printf("Команда /leaderboard: предмет %s стоит %d, итого %d", item.PrizeName, item.Cost, totalValue)
 						}
 						inventoryValues[username] = totalValue
 						inventoryItems[username] = inventory
-						log.Printf("Команда /leaderboard: участник %s имеет стоимость инвентаря %d", participantName, totalValue)
+						log.Printf("Команда /leaderboard: участник %s имеет стоимость инвентаря %d", username, totalValue)
 					}
 
 					log.Printf("Команда /leaderboard: собрано данных для %d участников", len(inventoryValues))
@@ -3733,15 +9503,23 @@ func main() {
 					msg.Text = "🔍 **ПРОВЕРКА ШТРАФОВ В REDIS**\n\n"
 
 					ctx := context.Background()
-					keys, err := redisClient.Keys(ctx, "fine:*").Result()
+					keys, err := scanKeys(ctx, "fine:*")
 					if err != nil {
 						msg.Text += fmt.Sprintf("❌ Ошибка получения ключей: %v", err)
 					} else {
 						msg.Text += fmt.Sprintf("📊 Найдено ключей в Redis: %d\n\n", len(keys))
 
-						for _, key := range keys {
+						// Читаем все штрафы одним конвейером запросов
+						pipe := redisClient.Pipeline()
+						cmds := make([]*redis.StringCmd, len(keys))
+						for i, key := range keys {
+							cmds[i] = pipe.Get(ctx, key)
+						}
+						pipe.Exec(ctx)
+
+						for i, key := range keys {
 							username := strings.TrimPrefix(key, "fine:")
-							val, err := redisClient.Get(ctx, key).Result()
+							val, err := cmds[i].Result()
 							if err != nil {
 								msg.Text += fmt.Sprintf("❌ %s: ошибка чтения (%v)\n", username, err)
 							} else {
@@ -3840,6 +9618,14 @@ func main() {
 						msg.Text += "🏛️ **ГОСУДАРСТВО ТРЕБУЕТ ОПЛАТЫ ШТРАФОВ!**\n💸 Используйте: /payfine"
 					}
 
+					// Банкроты отмечаются отдельно
+					if bankrupts := getBankrupts(); len(bankrupts) > 0 {
+						msg.Text += "\n\n⚖️ **БАНКРОТЫ:**\n"
+						for username, until := range bankrupts {
+							msg.Text += fmt.Sprintf("🪦 %s - банкрот до %s\n", getParticipantNameByUsername(username), until.Format("02.01.2006"))
+						}
+					}
+
 					// Отвечаем на сообщение пользователя
 					msg.ReplyToMessageID = update.Message.MessageID
 
@@ -3859,30 +9645,50 @@ func main() {
 						"/bank - управление банковским счетом\n" +
 						"/bank add (сумма/all) - положить фишки в банк\n" +
 						"/bank get (сумма) - снять фишки из банка\n" +
+						"/bank deposit (сумма) (срок, например 7d) - открыть срочный вклад\n" +
+						"/bank withdraw (номер) - закрыть вклад досрочно\n" +
+						"/loan [сумма|repay] - кредитный рейтинг, взять или погасить кредит\n" +
+						"/bankrupt [confirm] - объявить банкротство (инвентарь и банк в счет долга, остаток списывается)\n" +
 						"/shop - магазин \n" +
-						"/shop buy 1/2 [кол-во] - купить оборудование (1=грабеж, 2=разведка)\n" +
-						"/sell (хэш) - продать предмет (оборудование: 500)\n" +
+						"/shop buy (номер или ID) [кол-во] - купить оборудование или ящик с плашкой (шансы в /shop)\n" +
+						"/open (хэш) - открыть ящик\n" +
+						"/use (хэш) - использовать предмет (включить сейф)\n" +
+						"/sell (хэш) - продать предмет (цена выкупа указана в /shop)\n" +
 						"/inv - посмотреть свой инвентарь плашек\n" +
 						"/sell (хэш) - продать плашку\n" +
+						"/craft (хэш хэш хэш) - переплавить плашки одной редкости в плашку следующей редкости\n" +
+						"/item (хэш) - история предмета: откуда взялся и у кого побывал\n" +
+						"/plate (хэш или название) - карточка плашки\n" +
+						"/profile [@username] - профиль игрока: плашка, баланс и место в рейтинге\n" +
 						"/giveplate (@username) (хэш) [кол-во] - передать плашку(и) игроку\n" +
 						"/give (@username) (хэш) [кол-во] - передать любой предмет игроку\n" +
 						"/fuck (@username) - трахнуть участника\n" +
 						"/wear (хэш) - надеть плашку\n" +
 						"/unwear - снять плашку\n" +
-						"/pay (@username сумма) - перевести фишки другому игроку\n" +
-						"/payfine - оплатить штраф (если есть долг)\n" +
+						"/pay (@username сумма) - перевести фишки другому игроку (налог и суточный лимит, при долге недоступно)\n" +
+						"/payfine [сумма] - оплатить штраф целиком или частью (если есть долг)\n" +
 						"/checkfines - диагностика штрафов (для отладки)\n" +
+						"/limits - лимиты проигрыша, ставки, паузы и самоисключение\n" +
 						"/bet (номер сумма) - сделать ставку на участника\n" +
 						"/bet (номер all) - поставить все деньги\n" +
 						"/coin (1/2/3 сумма/all) - бросок монеты (1=орел, 2=решка, 3=ребро, all=весь баланс)\n" +
 						"/rob (@username) - ограбить игрока (30% успех, 30% штраф, 40% бегство)\n" +
 						"/platerob (@username) - ограбить плашку игрока (с надетой или из инвентаря)\n" +
+						"/robstatus [@username] - когда можно грабить и когда вас снова можно ограбить\n" +
+						"/bail [@username] - выйти из тюрьмы под залог или выкупить друга\n" +
+						"/heist start @username | join номер - совместное ограбление бандой\n" +
+						"/bounty @username сумма - назначить награду за голову игрока\n" +
+						"/bounties - доска наград\n" +
 						"/scout (@username) - разведка игрока (70% успех)\n\n" +
 						"👑 АДМИНИСТРАТОРСКИЕ КОМАНДЫ:\n" +
 						"/add (Имя Фамилия username) - добавить участника\n" +
 						"/remove (Имя Фамилия) - удалить участника\n" +
 						"/setprize (ID плашки) - установить плашку для игры\n" +
-						"/loadfromfile - загрузить призы из prizes.json в Redis\n" +
+						"/loadfromfile [confirm] - показать изменения prizes.json и применить их\n" +
+						"/supply - тиражи плашек и количество в обороте\n" +
+						"/jobs - фоновые задачи: когда запускались и когда запустятся\n" +
+						"/alerts - подозрительные встречные переводы между игроками\n" +
+						"/prizeadmin - добавить, изменить или выключить плашку в каталоге\n" +
 						"/poll - голосование\n" +
 						"/givefunds (@username сумма) - дать деньги игроку\n" +
 						"/withdrawfunds (@username сумма) - снять деньги у игрока\n" +
@@ -3906,9 +9712,7 @@ func main() {
 						totalValue := 0
 
 						// Группируем по редкости для красивого отображения
-						commonItems := []InventoryItem{}
-						rareItems := []InventoryItem{}
-						legendaryItems := []InventoryItem{}
+						itemsByRarity := make(map[string][]InventoryItem)
 						shopItems := []InventoryItem{}
 
 						for _, item := range inventory {
@@ -3922,22 +9726,13 @@ func main() {
 							}
 
 							if item.Rarity == "shop" {
-								if item.PrizeName == "Оборудование для разведки" {
-									itemValue = 50 * item.Count // Оборудование для разведки оценивается в 50
-								} else {
-									itemValue = 500 * item.Count // Оборудование для грабежа оценивается в 500
-								}
+								itemValue = shopSellPrice(item.PrizeName) * item.Count // Магазинные предметы оцениваются по цене выкупа
 							}
 							totalValue += itemValue
-							switch item.Rarity {
-							case "common":
-								commonItems = append(commonItems, item)
-							case "rare":
-								rareItems = append(rareItems, item)
-							case "legendary":
-								legendaryItems = append(legendaryItems, item)
-							case "shop":
+							if item.Rarity == "shop" {
 								shopItems = append(shopItems, item)
+							} else {
+								itemsByRarity[item.Rarity] = append(itemsByRarity[item.Rarity], item)
 							}
 						}
 
@@ -3945,44 +9740,31 @@ func main() {
 						if len(shopItems) > 0 {
 							msg.Text += "\n🛒 **МАГАЗИННЫЕ ПРЕДМЕТЫ:**\n"
 							for _, item := range shopItems {
-								var sellPrice int
-								if item.PrizeName == "Оборудование для разведки" {
-									sellPrice = 50 // Оборудование для разведки продается за 50
-								} else {
-									sellPrice = 500 // Оборудование для грабежа продается за 500
-								}
+								sellPrice := shopSellPrice(item.PrizeName)
 
 								countText := ""
 								if item.Count > 1 {
 									countText = fmt.Sprintf(" x%d", item.Count)
 								}
 
-								msg.Text += fmt.Sprintf("  %s%s [хэш: %s] (%d фишек) - /sell %s\n",
-									item.PrizeName, countText, item.Hash, sellPrice, item.Hash)
+								action := "/sell"
+								if shopItem, ok := findShopItemByName(item.PrizeName); ok && shopItem.Effect == shopEffectCrate {
+									action = "/open"
+								}
+
+								msg.Text += fmt.Sprintf("  %s%s [хэш: %s] (%d фишек) - %s %s\n",
+									item.PrizeName, countText, item.Hash, sellPrice, action, item.Hash)
 							}
 						}
 
-						if len(legendaryItems) > 0 {
-							msg.Text += "\n🔥 **ЛЕГЕНДАРНЫЕ:**\n"
-							for _, item := range legendaryItems {
-								countText := ""
-								if item.Count > 1 {
-									countText = fmt.Sprintf(" x%d", item.Count)
-								}
-								displayCost := item.Cost
-								if displayCost == 0 {
-									if correctCost, err := getPrizeCostByName(item.PrizeName); err == nil {
-										displayCost = correctCost
-									}
-								}
-								msg.Text += fmt.Sprintf("  %s%s [хэш: %s] (%d фишек) - /sell %s\n",
-									item.PrizeName, countText, item.Hash, displayCost, item.Hash)
+						for _, tier := range sortedRarityTiers() {
+							tierItems := itemsByRarity[tier.Name]
+							if len(tierItems) == 0 {
+								continue
 							}
-						}
 
-						if len(rareItems) > 0 {
-							msg.Text += "\n💎 **РЕДКИЕ:**\n"
-							for _, item := range rareItems {
+							msg.Text += fmt.Sprintf("\n%s **%s:**\n", tier.Emoji, tier.GroupLabel)
+							for _, item := range tierItems {
 								countText := ""
 								if item.Count > 1 {
 									countText = fmt.Sprintf(" x%d", item.Count)
@@ -3994,25 +9776,27 @@ func main() {
 									}
 								}
 								msg.Text += fmt.Sprintf("  %s%s [хэш: %s] (%d фишек) - /sell %s\n",
-									item.PrizeName, countText, item.Hash, displayCost, item.Hash)
+									formatItemName(item), countText, item.Hash, displayCost, item.Hash)
 							}
 						}
 
-						if len(commonItems) > 0 {
-							msg.Text += "\n⚪ **ОБЫЧНЫЕ:**\n"
-							for _, item := range commonItems {
+						// Плашки с редкостью, которой больше нет в конфиге, показываем отдельной группой
+						var unknownItems []InventoryItem
+						for rarity, items := range itemsByRarity {
+							if _, ok := getRarityTier(rarity); !ok {
+								unknownItems = append(unknownItems, items...)
+							}
+						}
+						if len(unknownItems) > 0 {
+							sort.Slice(unknownItems, func(i, j int) bool { return unknownItems[i].Hash < unknownItems[j].Hash })
+							msg.Text += "\n❔ **ПРОЧИЕ:**\n"
+							for _, item := range unknownItems {
 								countText := ""
 								if item.Count > 1 {
 									countText = fmt.Sprintf(" x%d", item.Count)
 								}
-								displayCost := item.Cost
-								if displayCost == 0 {
-									if correctCost, err := getPrizeCostByName(item.PrizeName); err == nil {
-										displayCost = correctCost
-									}
-								}
-								msg.Text += fmt.Sprintf("  %s%s [хэш: %s] (%d фишек) - /sell %s\n",
-									item.PrizeName, countText, item.Hash, displayCost, item.Hash)
+								msg.Text += fmt.Sprintf("  %s%s (редкость: %s) [хэш: %s] (%d фишек) - /sell %s\n",
+									formatItemName(item), countText, item.Rarity, item.Hash, item.Cost, item.Hash)
 							}
 						}
 
@@ -4031,21 +9815,8 @@ func main() {
 					args := update.Message.CommandArguments()
 
 					if args == "" {
-						// Показать доступные товары
-						msg.Text = "🛒 МАГАЗИН\n\n" +
-							"💰 Доступные товары:\n\n" +
-							"1️⃣ **Оборудование для грабежа** - 1,000 фишек\n" +
-							"   Специальное оборудование для проведения грабежей\n" +
-							"   📦 Хранится в инвентаре\n" +
-							"   🎯 Шанс успеха: 30% (украсть до 50% баланса)\n" +
-							"   💸 Штраф: 30% (потерять 10% баланса)\n" +
-							"   🏃‍♂️ Бегство: 40% (ничего не происходит)\n\n" +
-							"2️⃣ **Оборудование для разведки** - 100 фишек\n" +
-							"   Позволяет шпионить за балансами и инвентарем других игроков\n" +
-							"   📦 Хранится в инвентаре\n" +
-							"   👁️ Шанс успеха: 70%\n" +
-							"💡 Для покупки используйте:\n• /shop buy 1 [кол-во] (грабеж)\n• /shop buy 2 [кол-во] (разведка)\n\n" +
-							"⚠️ Оборудование можно использовать только один раз!"
+						// Показать доступные товары из каталога
+						msg.Text = formatShopMenu()
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
@@ -4058,7 +9829,12 @@ func main() {
 						break
 					}
 
-					itemID := parts[1]
+					shopItem, found := findShopItem(parts[1])
+					if !found {
+						msg.Text = "🚫 Неизвестный товар!\n\n💡 Доступные товары:\n" + formatShopItemList()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
 
 					// Парсим количество (по умолчанию 1)
 					quantity := 1
@@ -4071,44 +9847,18 @@ func main() {
 							break
 						}
 						// Проверяем лимит только для игроков без большого долга
-						if quantity > 10 {
+						if shopItem.MaxPerPurchase > 0 && quantity > shopItem.MaxPerPurchase {
 							hasLargeDebt, _ := checkLargeDebt(userName)
 							if !hasLargeDebt {
-								msg.Text = "🚫 Максимум можно купить 10 штук за раз!"
+								msg.Text = fmt.Sprintf("🚫 Максимум можно купить %d штук за раз!", shopItem.MaxPerPurchase)
 								msg.ReplyToMessageID = update.Message.MessageID
 								break
 							}
 						}
 					}
 
-					var itemName string
-					var itemCost int
-					var itemDescription string
-
-					switch itemID {
-					case "1", "robbery_gear":
-						itemName = "Оборудование для грабежа"
-						itemCost = 1000
-						itemDescription = "🔫 **Оборудование для грабежа**"
-					case "2", "scout_gear":
-						itemName = "Оборудование для разведки"
-						itemCost = 100
-						itemDescription = "🕵️ **Оборудование для разведки**"
-					default:
-						msg.Text = "🚫 Неизвестный товар!\n\n💡 Доступные товары:\n• 1 или robbery_gear - Оборудование для грабежа\n• 2 или scout_gear - Оборудование для разведки"
-						msg.ReplyToMessageID = update.Message.MessageID
-						break
-					}
-
-					// Проверяем, что товар был найден (itemName не пустой)
-					if itemName == "" {
-						msg.Text = "🚫 Неизвестный товар!\n\n💡 Доступные товары:\n• 1 или robbery_gear - Оборудование для грабежа\n• 2 или scout_gear - Оборудование для разведки"
-						msg.ReplyToMessageID = update.Message.MessageID
-						break
-					}
-
 					// Считаем общую стоимость
-					totalCost := itemCost * quantity
+					totalCost := shopItem.Price * quantity
 
 					// Проверяем баланс
 					userBalance, exists := playerBalances[userName]
@@ -4118,8 +9868,17 @@ func main() {
 						break
 					}
 
+					// Резервируем товар на складе (для товаров с ограниченным запасом)
+					if err := reserveShopStock(shopItem, quantity); err != nil {
+						log.Printf("Команда /shop: Товар %s не зарезервирован для %s: %v", shopItem.ID, userName, err)
+						msg.Text = fmt.Sprintf("🚫 %s закончился: %v", shopItem.Name, err)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Списываем деньги
 					if !changeBalance(userName, -totalCost) {
+						releaseShopStock(shopItem, quantity)
 						msg.Text = "🚫 Ошибка при списании средств!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
@@ -4128,7 +9887,7 @@ func main() {
 					// Добавляем предметы в инвентарь
 					var successCount int
 					for i := 0; i < quantity; i++ {
-						err := addItemToInventory(userName, itemName, itemCost)
+						err := addItemToInventory(userName, shopItem.Name, shopItem.Price)
 						if err != nil {
 							log.Printf("Ошибка добавления предмета %d в инвентарь: %v", i+1, err)
 							break
@@ -4137,21 +9896,114 @@ func main() {
 					}
 
 					if successCount < quantity {
-						// Возвращаем деньги за неудачные покупки
-						refund := (quantity - successCount) * itemCost
+						// Возвращаем деньги и товар за неудачные покупки
+						refund := (quantity - successCount) * shopItem.Price
 						changeBalance(userName, refund)
+						releaseShopStock(shopItem, quantity-successCount)
 						msg.Text = fmt.Sprintf("🚫 Добавлено только %d из %d товаров!\n💰 Возвращено: %d фишек\n\n📦 Проверьте инвентарь: /inv", successCount, quantity, refund)
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
 					msg.Text = fmt.Sprintf("✅ **ПОКУПКА УСПЕШНО ЗАВЕРШЕНА!**\n\n"+
-						"%s x%d добавлено в ваш инвентарь!\n\n"+
-						"💰 Списано: %d фишек\n", itemDescription, quantity, totalCost) +
+						"%s **%s** x%d добавлено в ваш инвентарь!\n\n"+
+						"💰 Списано: %d фишек\n", shopItem.Emoji, shopItem.Name, quantity, totalCost) +
 						"💵 Остаток: " + fmt.Sprintf("%d фишек", playerBalances[userName]) + "\n\n" +
-						"📦 Проверить инвентарь: /inv\n" +
-						"⚠️ Оборудование можно использовать только один раз!"
+						"📦 Проверить инвентарь: /inv\n"
+					if shopItem.Effect == shopEffectCrate {
+						msg.Text += "🎲 Открыть ящик: /open (хэш)"
+					} else {
+						msg.Text += "⚠️ Оборудование можно использовать только один раз!"
+					}
+
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "limits":
+					log.Printf("Команда /limits от %s", userName)
+					args := strings.Fields(update.Message.CommandArguments())
+
+					if len(args) == 0 {
+						msg.Text = formatGamblingLimits(userName)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					if len(args) != 2 {
+						msg.Text = "🚫 Неверный формат! Пример: /limits daily 5000 или /limits exclude 7d"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					setting := strings.ToLower(args[0])
+					value := strings.ToLower(args[1])
+					applyPendingLimits(userName)
+					limits := playerLimits[userName]
+
+					if setting == "exclude" {
+						duration, err := parseDurationWithDays(value)
+						if err != nil {
+							msg.Text = "🚫 Укажите срок самоисключения! Пример: /limits exclude 24h или /limits exclude 30d"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+
+						// Самоисключение можно только продлить, но не сократить
+						newUntil := time.Now().Add(duration)
+						if newUntil.After(limits.SelfExcludedUntil) {
+							limits.SelfExcludedUntil = newUntil
+						}
+						playerLimits[userName] = limits
+						saveLimitsToRedis(userName)
+
+						log.Printf("Команда /limits: %s исключил себя из игр до %s", userName, limits.SelfExcludedUntil.Format(time.RFC3339))
+						msg.Text = fmt.Sprintf("🧘 Самоисключение включено до %s.\n\n🚫 /bet, /coin и /rob недоступны до этого времени.\n⚠️ Досрочно снять самоисключение нельзя.",
+							limits.SelfExcludedUntil.Format("02.01.2006 15:04"))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					amount := 0
+					if value != "off" {
+						var err error
+						amount, err = strconv.Atoi(value)
+						if err != nil || amount <= 0 {
+							msg.Text = "🚫 Укажите положительное число или 'off'!"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+					}
+
+					field := limitField(&limits, setting)
+					if field == nil {
+						msg.Text = "🚫 Неизвестная настройка! Доступно: daily, weekly, stake, cooldown, exclude"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Новое значение заменяет ранее запрошенное ослабление этой настройки
+					delete(limits.PendingLimits, setting)
+					if isLimitLoosening(setting, *field, amount) {
+						// Повышение или снятие лимита - только после паузы, чтобы не отыгрываться сгоряча
+						if limits.PendingLimits == nil {
+							limits.PendingLimits = make(map[string]PendingLimit)
+						}
+						applyAt := time.Now().Add(limitCoolingOff)
+						limits.PendingLimits[setting] = PendingLimit{Value: amount, ApplyAt: applyAt}
+						playerLimits[userName] = limits
+						saveLimitsToRedis(userName)
+						log.Printf("Команда /limits: %s запросил ослабление %s = %d с %s", userName, setting, amount, applyAt.Format(time.RFC3339))
+
+						msg.Text = fmt.Sprintf("🕒 Ослабление лимита вступит в силу %s.\n\n", applyAt.Format("02.01.2006 15:04")) + formatGamblingLimits(userName)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
 
+					*field = amount
+					playerLimits[userName] = limits
+					saveLimitsToRedis(userName)
+					log.Printf("Команда /limits: %s установил %s = %d", userName, setting, amount)
+
+					msg.Text = "✅ Настройки обновлены!\n\n" + formatGamblingLimits(userName)
 					msg.ReplyToMessageID = update.Message.MessageID
 
 				case "payfine":
@@ -4165,45 +10017,53 @@ func main() {
 						break
 					}
 
+					// Частичная оплата: /payfine 500 (по умолчанию - весь долг)
+					payAmount := fineAmount
+					if args := strings.TrimSpace(update.Message.CommandArguments()); args != "" {
+						amount, err := strconv.Atoi(args)
+						if err != nil || amount <= 0 {
+							msg.Text = "🚫 Укажите корректную положительную сумму! Пример: /payfine 500"
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						if amount < payAmount {
+							payAmount = amount
+						}
+					}
+
 					// Проверяем баланс игрока
 					userBalance := playerBalances[userName]
-					if userBalance < fineAmount {
+					if userBalance < payAmount {
 						msg.Text = fmt.Sprintf("🚫 Недостаточно средств для оплаты штрафа!\n\n"+
-							"💸 Штраф: %d %s\n"+
+							"💸 К оплате: %d %s\n"+
 							"💰 Ваш баланс: %d %s\n"+
-							"💸 Не хватает: %d %s",
-							fineAmount, getChipsWord(fineAmount),
+							"💸 Не хватает: %d %s\n\n"+
+							"💡 Можно платить частями: /payfine сумма",
+							payAmount, getChipsWord(payAmount),
 							userBalance, getChipsWord(userBalance),
-							fineAmount-userBalance, getChipsWord(fineAmount-userBalance))
+							payAmount-userBalance, getChipsWord(payAmount-userBalance))
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
 					// Списываем штраф
-					if !changeBalance(userName, -fineAmount) {
+					if !changeBalance(userName, -payAmount) {
 						msg.Text = "🚫 Ошибка при оплате штрафа!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
+					reduceFine(userName, payAmount)
 
-					// Удаляем штраф из памяти
-					delete(playerFines, userName)
-					delete(playerFineDates, userName)
-
-					// Явно удаляем штраф из Redis
-					ctx := context.Background()
-					fineKey := fmt.Sprintf("fine:%s", userName)
-					err := redisClient.Del(ctx, fineKey).Err()
-					if err != nil {
-						log.Printf("Ошибка удаления штрафа из Redis для %s: %v", userName, err)
-					} else {
-						log.Printf("Штраф для %s успешно удален из Redis", userName)
-					}
-
-					// Сохраняем изменения в Redis для всех остальных штрафов
-					err = saveFinesToRedis()
-					if err != nil {
-						log.Printf("Ошибка сохранения штрафов после оплаты: %v", err)
+					if remaining := playerFines[userName]; remaining > 0 {
+						msg.Text = fmt.Sprintf("✅ **ЧАСТЬ ШТРАФА ОПЛАЧЕНА!**\n\n"+
+							"💸 Оплачено: %d %s\n"+
+							"⚠️ Осталось долга: %d %s\n"+
+							"💵 Остаток баланса: %d %s",
+							payAmount, getChipsWord(payAmount),
+							remaining, getChipsWord(remaining),
+							playerBalances[userName], getChipsWord(playerBalances[userName]))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
 					}
 
 					msg.Text = fmt.Sprintf("✅ **ШТРАФ ОПЛАЧЕН!**\n\n"+
@@ -4211,7 +10071,7 @@ func main() {
 						"💵 Остаток баланса: %d %s\n\n"+
 						"🎉 Теперь вы свободны от долгов!\n"+
 						"💡 Проверьте с помощью /shameboard - вас больше нет в списке!",
-						fineAmount, getChipsWord(fineAmount),
+						payAmount, getChipsWord(payAmount),
 						playerBalances[userName], getChipsWord(playerBalances[userName]))
 
 					msg.ReplyToMessageID = update.Message.MessageID
@@ -4225,11 +10085,22 @@ func main() {
 							"🎯 Шанс успеха: 30% (украсть до 50% баланса жертвы)\n" +
 							"💸 Штраф: 30% (10% от вашего баланса)\n" +
 							"🏃‍♂️ Бегство: 40% (ничего не происходит)\n" +
+							"🚨 Сигнализация жертвы снижает шанс успеха и увеличивает штраф\n" +
+							"💂 Охранник жертвы может отбить нападение и оштрафовать вас\n" +
+							"⏳ Пауза, дневной лимит и защита жертв: /robstatus\n" +
+							"⛓️ Пойманного грабителя могут посадить в тюрьму (выход под залог: /bail)\n" +
 							"⚠️ Требуется оборудование для грабежа (купить: /shop buy 1)"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
+					// Проверяем самоисключение
+					if isExcluded, until := checkSelfExclusion(userName); isExcluded {
+						msg.Text = fmt.Sprintf("🧘 Вы исключили себя из /bet, /coin и /rob до %s.\n\nДосрочно снять самоисключение нельзя.", until.Format("02.01.2006 15:04"))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Парсим цель
 					targetUsername := strings.TrimPrefix(strings.TrimSpace(args), "@")
 					if targetUsername == "" {
@@ -4260,19 +10131,72 @@ func main() {
 						break
 					}
 
+					// Проверяем паузу, дневной лимит и защиту жертвы
+					if err := checkRobAllowed(userName, targetUsername); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Бедных жертв грабить нельзя или шанс против них ниже
+					wealthPenalty, forbidden := getRobWealthPenalty(userName, targetUsername)
+					if forbidden {
+						msg.Text = fmt.Sprintf("🚫 У @%s меньше %d%% вашего баланса - грабить бедных нельзя!",
+							targetUsername, economyConfig.RobRules.ForbiddenRatio)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Проверяем наличие оборудования
-					err := useItemFromInventory(userName, "Оборудование для грабежа")
+					err := useItemFromInventory(userName, shopEffectRob)
 					if err != nil {
 						msg.Text = "🚫 У вас нет оборудования для грабежа!\n\n🛒 Купить: /shop buy robbery_gear"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
+					recordRobAttempt(userName)
+
+					// Охранник жертвы может отбить нападение (уходит после любого нападения)
+					if useItemFromInventory(targetUsername, shopEffectBodyguard) == nil {
+						if gamble.RollPercent() < economyConfig.Defense.BodyguardChance {
+							paid, debt := applyBodyguardFine(userName, targetUsername)
+							msg.Text = fmt.Sprintf("💂 **ОХРАННИК ОТБИЛ НАПАДЕНИЕ!**\n\n"+
+								"🔫 Вы попытались ограбить @%s, но вас скрутил охранник!\n"+
+								"💸 Штраф в пользу жертвы: %d %s\n",
+								targetUsername, paid+debt, getChipsWord(paid+debt))
+							if debt > 0 {
+								msg.Text += fmt.Sprintf("💸 Не хватило денег, в долг записано: %d %s\n", debt, getChipsWord(debt))
+							}
+							msg.Text += fmt.Sprintf("💵 Ваш баланс: %d %s", playerBalances[userName], getChipsWord(playerBalances[userName]))
+							notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+								fmt.Sprintf("@%s пытался вас ограбить, но охранник отбил нападение и взыскал %d %s в вашу пользу! Охранник ушел.",
+									userName, paid, getChipsWord(paid)))
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+							fmt.Sprintf("@%s напал на вас! Охранник не справился и ушел.", userName))
+					}
+
+					// Сигнализация жертвы снижает шанс успеха и увеличивает штраф (расходуется)
+					successChance := 30 - wealthPenalty
+					fineMultiplier := 1
+					alarmTriggered := useItemFromInventory(targetUsername, shopEffectAlarm) == nil
+					if alarmTriggered {
+						successChance -= economyConfig.Defense.AlarmSuccessPenalty
+						if successChance < 0 {
+							successChance = 0
+						}
+						fineMultiplier = economyConfig.Defense.AlarmFineMultiplier
+						notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+							fmt.Sprintf("@%s пытается вас ограбить - сработала сигнализация! Сигнализация израсходована.", userName))
+					}
 
-					// Генерируем результат ограбления (30% успех, 30% штраф, 40% бегство)
+					// Генерируем результат ограбления (30% успех, 30% штраф, 40% бегство; сигнализация переводит часть успеха в штраф)
 					r := crand.New(crand.NewSource(time.Now().UnixNano()))
 					result := r.Intn(100) // 0-99
 
-					if result < 30 { // 30% шанс успеха
+					if result < successChance { // 30% шанс успеха (меньше с сигнализацией)
 						// Успешное ограбление - крадем до 50% от баланса жертвы
 						maxSteal := targetBalance / 2
 						if maxSteal < 1 {
@@ -4287,7 +10211,8 @@ func main() {
 							break
 						}
 
-						changeBalance(userName, stolenAmount)
+						withheld, _ := creditPlayer(userName, stolenAmount)
+						shieldRobVictim(targetUsername)
 
 						// Базовое сообщение об успешном грабеже
 						msg.Text = fmt.Sprintf("✅ **УСПЕШНОЕ ОГРАБЛЕНИЕ!**\n\n"+
@@ -4297,6 +10222,8 @@ func main() {
 							"🏃‍♂️ Удачно смылись!",
 							targetUsername, stolenAmount, getChipsWord(stolenAmount),
 							playerBalances[userName], getChipsWord(playerBalances[userName]))
+						msg.Text += formatWithheld(userName, withheld)
+						msg.Text += payBounties(userName, targetUsername)
 
 						// Добавляем агрессивное сообщение для должников
 						if hasLargeDebt, debtAmount := checkLargeDebt(userName); hasLargeDebt {
@@ -4309,6 +10236,7 @@ func main() {
 						if penalty < 1000 {
 							penalty = 1000
 						}
+						penalty *= fineMultiplier
 
 						// Обновляем штрафы перед проверкой
 						updateFinesDaily()
@@ -4348,6 +10276,7 @@ func main() {
 								playerFines[userName], getChipsWord(playerFines[userName]),
 								playerBalances[userName], getChipsWord(playerBalances[userName]))
 						}
+						msg.Text += tryJailRobber(userName)
 					} else { // 40% шанс бегства (60-99)
 						// Ничего не происходит - просто бегство
 						msg.Text = fmt.Sprintf("😅 **НИХУЯ НЕ ВЫШЛО!**\n\n"+
@@ -4358,6 +10287,262 @@ func main() {
 							targetUsername, playerBalances[userName], getChipsWord(playerBalances[userName]))
 					}
 
+					if alarmTriggered {
+						msg.Text += "\n\n🚨 У жертвы сработала сигнализация!"
+					}
+					if wealthPenalty > 0 {
+						msg.Text += fmt.Sprintf("\n📉 Жертва намного беднее вас: шанс успеха был снижен на %d%%", wealthPenalty)
+					}
+
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "bail":
+					log.Printf("Команда /bail от %s", userName)
+					prisoner := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "@")
+					if prisoner == "" {
+						prisoner = userName
+					}
+					if _, exists := playerBalances[prisoner]; !exists {
+						msg.Text = fmt.Sprintf("🚫 Игрок @%s не найден!", prisoner)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					bail, err := payBail(userName, prisoner)
+					if err != nil {
+						if bail > 0 && playerBalances[userName] < bail {
+							msg.Text = fmt.Sprintf("🚫 Недостаточно средств для залога!\n\n💰 Залог: %d %s\n💵 Ваш баланс: %d %s",
+								bail, getChipsWord(bail), playerBalances[userName], getChipsWord(playerBalances[userName]))
+						} else {
+							msg.Text = fmt.Sprintf("🚫 Не удалось внести залог: %v", err)
+						}
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					if prisoner == userName {
+						msg.Text = fmt.Sprintf("🔓 Вы вышли из тюрьмы под залог!\n\n💸 Залог: %d %s\n💵 Ваш баланс: %d %s",
+							bail, getChipsWord(bail), playerBalances[userName], getChipsWord(playerBalances[userName]))
+					} else {
+						msg.Text = fmt.Sprintf("🔓 @%s вышел из тюрьмы - залог внес @%s!\n\n💸 Залог: %d %s\n💵 Ваш баланс: %d %s",
+							prisoner, userName, bail, getChipsWord(bail), playerBalances[userName], getChipsWord(playerBalances[userName]))
+					}
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "heist":
+					log.Printf("Команда /heist от %s", userName)
+					parts := strings.Fields(update.Message.CommandArguments())
+					heistConfig := economyConfig.Heist
+
+					if len(parts) == 0 {
+						msg.Text = fmt.Sprintf("🏦 СОВМЕСТНОЕ ОГРАБЛЕНИЕ\n\n"+
+							"📋 Команды:\n"+
+							"• /heist start @username - собрать банду против игрока\n"+
+							"• /heist join номер - вступить в банду\n\n"+
+							"⏳ Набор банды: %d мин., участников: %d-%d\n"+
+							"🎯 Шанс успеха: %d%% + %d%% за каждого участника (не больше %d%%)\n"+
+							"💰 Добыча: %d%% баланса и %d%% банка жертвы, делится поровну\n"+
+							"💸 При провале каждый участник платит штраф %d %s\n"+
+							"⚠️ Каждый участник тратит оборудование для грабежа (купить: /shop buy 1)",
+							heistConfig.LobbyMinutes, heistConfig.MinCrew, heistConfig.MaxCrew,
+							heistConfig.BaseChance, heistConfig.ChancePerMember, heistConfig.MaxChance,
+							heistConfig.BalancePercent, heistConfig.BankPercent, heistConfig.Fine, getChipsWord(heistConfig.Fine))
+
+						heists := getActiveHeists()
+						if len(heists) > 0 {
+							msg.Text += "\n\n🕵️ НАБОР ИДЕТ:"
+							for _, heist := range heists {
+								msg.Text += fmt.Sprintf("\n#%s: цель @%s, банда %d/%d, до %s",
+									heist.ID, heist.Target, len(heist.Crew), heistConfig.MaxCrew, heist.EndsAt.Format("15:04"))
+							}
+						}
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Проверяем самоисключение
+					if isExcluded, until := checkSelfExclusion(userName); isExcluded {
+						msg.Text = fmt.Sprintf("🧘 Вы исключили себя из /bet, /coin и /rob до %s.\n\nДосрочно снять самоисключение нельзя.", until.Format("02.01.2006 15:04"))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					switch strings.ToLower(parts[0]) {
+					case "start":
+						if len(parts) < 2 {
+							msg.Text = "🚫 Укажите цель! Пример: /heist start @username"
+							break
+						}
+						targetUsername := strings.TrimPrefix(parts[1], "@")
+						if targetUsername == userName {
+							msg.Text = "🚫 Нельзя грабить самого себя, идиот!"
+							break
+						}
+						if _, exists := playerBalances[targetUsername]; !exists {
+							msg.Text = fmt.Sprintf("🚫 Жертва @%s не найдена в списке участников!", targetUsername)
+							break
+						}
+						if playerBalances[targetUsername]+playerBanks[targetUsername] <= 0 {
+							msg.Text = fmt.Sprintf("🚫 У жертвы @%s нет денег для грабежа!", targetUsername)
+							break
+						}
+						if err := checkRobAllowed(userName, targetUsername); err != nil {
+							msg.Text = err.Error()
+							break
+						}
+
+						heist, err := startHeist(update.Message.Chat.ID, userName, targetUsername)
+						if err != nil {
+							msg.Text = fmt.Sprintf("🚫 Не удалось начать ограбление: %v", err)
+							break
+						}
+						if err := useItemFromInventory(userName, shopEffectRob); err != nil {
+							cancelHeist(heist.ID)
+							msg.Text = "🚫 У вас нет оборудования для грабежа!\n\n🛒 Купить: /shop buy robbery_gear"
+							break
+						}
+						recordRobAttempt(userName)
+						scheduleHeist(bot, heist)
+
+						msg.Text = fmt.Sprintf("🏦 **ОГРАБЛЕНИЕ #%s: НАБОР БАНДЫ!**\n\n"+
+							"😎 Главарь: @%s\n"+
+							"🎯 Цель: @%s\n"+
+							"⏳ Набор до %s\n"+
+							"🎲 Шанс сейчас: %d%%\n\n"+
+							"🤝 Вступить: /heist join %s",
+							heist.ID, userName, targetUsername, heist.EndsAt.Format("15:04"), heistChance(len(heist.Crew)), heist.ID)
+
+					case "join":
+						if len(parts) < 2 {
+							msg.Text = "🚫 Укажите номер ограбления! Пример: /heist join 1"
+							break
+						}
+						id := strings.TrimPrefix(parts[1], "#")
+						heist, err := getHeist(id)
+						if err != nil {
+							msg.Text = fmt.Sprintf("🚫 Ограбление #%s не найдено или уже завершено!", id)
+							break
+						}
+						if heist.Target == userName {
+							msg.Text = "🚫 Нельзя вступить в банду, которая грабит вас!"
+							break
+						}
+						if err := checkRobAllowed(userName, heist.Target); err != nil {
+							msg.Text = err.Error()
+							break
+						}
+
+						heist, err = joinHeist(id, userName)
+						if err != nil {
+							msg.Text = fmt.Sprintf("🚫 Не удалось вступить в банду: %v", err)
+							break
+						}
+						if err := useItemFromInventory(userName, shopEffectRob); err != nil {
+							leaveHeist(id, userName)
+							msg.Text = "🚫 У вас нет оборудования для грабежа!\n\n🛒 Купить: /shop buy robbery_gear"
+							break
+						}
+						recordRobAttempt(userName)
+
+						msg.Text = fmt.Sprintf("🤝 @%s вступил в банду ограбления #%s!\n\n"+
+							"🎯 Цель: @%s\n"+
+							"👥 Банда (%d/%d): %s\n"+
+							"🎲 Шанс сейчас: %d%%\n"+
+							"⏳ Набор до %s",
+							userName, heist.ID, heist.Target, len(heist.Crew), heistConfig.MaxCrew, formatHeistCrew(heist),
+							heistChance(len(heist.Crew)), heist.EndsAt.Format("15:04"))
+
+					default:
+						msg.Text = "🚫 Неизвестная команда! Используйте /heist start @username или /heist join номер"
+					}
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "bounty":
+					log.Printf("Команда /bounty от %s", userName)
+					parts := strings.Fields(update.Message.CommandArguments())
+					bountyConfig := economyConfig.Bounty
+					if len(parts) < 2 {
+						msg.Text = fmt.Sprintf("🎯 Назначьте награду за голову игрока! Пример: /bounty @username 1000\n\n"+
+							"💰 Фишки списываются сразу и ждут на кону (как перевод: с налогом и в счет суточного лимита)\n"+
+							"🔫 Награду забирает первый, кто успешно ограбит цель через /rob или /platerob\n"+
+							"➕ Награды за одну цель складываются\n"+
+							"⌛ Через %d дн. невостребованная награда возвращается\n"+
+							"💵 Минимум: %d %s\n\n"+
+							"📋 Все награды: /bounties",
+							bountyConfig.Days, bountyConfig.MinAmount, getChipsWord(bountyConfig.MinAmount))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					targetUsername := strings.TrimPrefix(parts[0], "@")
+					amount, err := strconv.Atoi(parts[1])
+					if err != nil || amount < bountyConfig.MinAmount {
+						msg.Text = fmt.Sprintf("🚫 Укажите сумму не меньше %d %s!", bountyConfig.MinAmount, getChipsWord(bountyConfig.MinAmount))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					if targetUsername == userName {
+						msg.Text = "🚫 Нельзя назначить награду за свою голову!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					if _, exists := playerBalances[targetUsername]; !exists {
+						msg.Text = fmt.Sprintf("🚫 Игрок @%s не найден!", targetUsername)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					// Награда - это перевод фишек: проверяем долг и суточный лимит переводов
+					if err := checkTransferAllowed(userName, amount); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					if tax := transferTax(amount); playerBalances[userName] < amount+tax {
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств! Нужно: %d %s (включая налог %d)\n💰 Ваш баланс: %d %s",
+							amount+tax, getChipsWord(amount+tax), tax, playerBalances[userName], getChipsWord(playerBalances[userName]))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					bounty, err := placeBounty(update.Message.Chat.ID, userName, targetUsername, amount)
+					if err != nil {
+						msg.Text = fmt.Sprintf("🚫 Не удалось назначить награду: %v", err)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					total := 0
+					for _, active := range getBounties(targetUsername) {
+						total += active.Amount
+					}
+					msg.Text = fmt.Sprintf("🎯 **НАГРАДА ЗА ГОЛОВУ @%s!**\n\n"+
+						"💰 @%s назначил %d %s\n"+
+						"💎 Всего за голову: %d %s\n"+
+						"⌛ Действует до %s\n\n"+
+						"🧾 Налог на перевод: %d %s\n"+
+						"💵 Ваш баланс: %d %s",
+						targetUsername, userName, amount, getChipsWord(amount), total, getChipsWord(total),
+						bounty.ExpiresAt.Format("02.01.2006 15:04"), bounty.Tax, getChipsWord(bounty.Tax), playerBalances[userName], getChipsWord(playerBalances[userName]))
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "bounties":
+					log.Printf("Команда /bounties от %s", userName)
+					msg.Text = formatBountyBoard()
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "robstatus":
+					log.Printf("Команда /robstatus от %s", userName)
+					targetUsername := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "@")
+					if targetUsername == "" {
+						targetUsername = userName
+					}
+					if _, exists := playerBalances[targetUsername]; !exists {
+						msg.Text = fmt.Sprintf("🚫 Игрок @%s не найден!", targetUsername)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					msg.Text = formatRobStatus(targetUsername)
 					msg.ReplyToMessageID = update.Message.MessageID
 
 				case "platerob":
@@ -4372,12 +10557,23 @@ func main() {
 							"💎 Редкая плашка: 25% успеха\n" +
 							"👑 Легендарная плашка: 10% успеха\n" +
 							"🎒 Если нет надетой плашки - крадет из инвентаря\n" +
+							"🔐 Надетую плашку в сейфе украсть нельзя\n" +
+							"💂 Охранник жертвы может отбить нападение и оштрафовать вас\n" +
+							"⏳ Пауза, дневной лимит и защита жертв: /robstatus\n" +
+							"⛓️ Пойманного грабителя могут посадить в тюрьму (выход под залог: /bail)\n" +
 							"💸 При провале: штраф 1000 фишек\n" +
 							"⚠️ Требуется оборудование для грабежа (купить: /shop buy robbery_gear)"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
+					// Проверяем самоисключение
+					if isExcluded, until := checkSelfExclusion(userName); isExcluded {
+						msg.Text = fmt.Sprintf("🧘 Вы исключили себя из /bet, /coin и /rob до %s.\n\nДосрочно снять самоисключение нельзя.", until.Format("02.01.2006 15:04"))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Парсим цель
 					targetUsername := strings.TrimPrefix(strings.TrimSpace(args), "@")
 					log.Printf("platerob: Парсинг цели - результат: '%s'", targetUsername)
@@ -4404,6 +10600,13 @@ func main() {
 						break
 					}
 
+					// Проверяем паузу, дневной лимит и защиту жертвы
+					if err := checkRobAllowed(userName, targetUsername); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Проверяем, что у цели есть надетая плашка или плашки в инвентаре
 					log.Printf("platerob: Проверка наличия плашек у цели %s", targetUsername)
 					targetWornData, targetWornErr := getWornItem(targetUsername)
@@ -4411,7 +10614,11 @@ func main() {
 					var targetItem InventoryItem
 					var stealingFromWorn bool = true
 
-					if targetWornErr != nil || targetWornData == nil {
+					// Сейф защищает надетую плашку - тогда крадем только из остального инвентаря
+					safeUntil, safeActive := getSafeUntil(targetUsername)
+					wornProtected := safeActive && targetWornErr == nil && targetWornData != nil
+
+					if targetWornErr != nil || targetWornData == nil || wornProtected {
 						// Нет надетой плашки, проверяем инвентарь на наличие плашек
 						targetInventory, invErr := getPlayerInventory(targetUsername)
 						if invErr != nil {
@@ -4424,6 +10631,9 @@ func main() {
 						// Ищем плашки в инвентаре (предметы с rarity common/rare/legendary, но не shop)
 						var availablePlates []InventoryItem
 						for _, item := range targetInventory {
+							if wornProtected && item.Hash == targetWornData["hash"] {
+								continue // Надетая плашка лежит в сейфе
+							}
 							if item.Rarity != "shop" && item.Count > 0 {
 								availablePlates = append(availablePlates, item)
 							}
@@ -4431,6 +10641,9 @@ func main() {
 
 						if len(availablePlates) == 0 {
 							msg.Text = fmt.Sprintf("🚫 У жертвы @%s нет плашек для кражи!", targetUsername)
+							if wornProtected {
+								msg.Text += fmt.Sprintf("\n🔐 Надетая плашка в сейфе до %s.", safeUntil.Format("02.01.2006 15:04"))
+							}
 							msg.ReplyToMessageID = update.Message.MessageID
 							break
 						}
@@ -4458,11 +10671,19 @@ func main() {
 							Cost:      prizeCost,
 							Count:     1, // всегда 1 для надетых
 						}
+						// Берем данные из инвентаря, чтобы не потерять номер экземпляра
+						if wornInvItem, invErr := getInventoryItem(targetUsername, targetWornData["hash"]); invErr == nil {
+							targetItem.Serial = wornInvItem.Serial
+							targetItem.MaxSupply = wornInvItem.MaxSupply
+							if wornInvItem.Cost > 0 {
+								targetItem.Cost = wornInvItem.Cost
+							}
+						}
 					}
 
 					// Проверяем наличие оборудования для грабежа
 					log.Printf("platerob: Проверка оборудования для грабежа у %s", userName)
-					err := useItemFromInventory(userName, "Оборудование для грабежа")
+					err := useItemFromInventory(userName, shopEffectRob)
 					if err != nil {
 						log.Printf("platerob: Ошибка - нет оборудования для грабежа: %v", err)
 						msg.Text = "🚫 У вас нет оборудования для грабежа!\n\n🛒 Купить: /shop buy robbery_gear"
@@ -4470,19 +10691,42 @@ func main() {
 						break
 					}
 					log.Printf("platerob: Оборудование для грабежа успешно использовано")
+					recordRobAttempt(userName)
+
+					if wornProtected {
+						notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+							fmt.Sprintf("@%s пытается украсть вашу надетую плашку, но она в сейфе до %s!", userName, safeUntil.Format("02.01.2006 15:04")))
+					}
+
+					// Охранник жертвы может отбить нападение (уходит после любого нападения)
+					if useItemFromInventory(targetUsername, shopEffectBodyguard) == nil {
+						if gamble.RollPercent() < economyConfig.Defense.BodyguardChance {
+							paid, debt := applyBodyguardFine(userName, targetUsername)
+							msg.Text = fmt.Sprintf("💂 **ОХРАННИК ОТБИЛ НАПАДЕНИЕ!**\n\n"+
+								"🔫 Вы попытались украсть плашку у @%s, но вас скрутил охранник!\n"+
+								"💸 Штраф в пользу жертвы: %d %s\n",
+								targetUsername, paid+debt, getChipsWord(paid+debt))
+							if debt > 0 {
+								msg.Text += fmt.Sprintf("💸 Не хватило денег, в долг записано: %d %s\n", debt, getChipsWord(debt))
+							}
+							msg.Text += fmt.Sprintf("💵 Ваш баланс: %d %s", playerBalances[userName], getChipsWord(playerBalances[userName]))
+							notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+								fmt.Sprintf("@%s пытался украсть вашу плашку, но охранник отбил нападение и взыскал %d %s в вашу пользу! Охранник ушел.",
+									userName, paid, getChipsWord(paid)))
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+						notifyRobVictim(bot, update.Message.Chat.ID, targetUsername,
+							fmt.Sprintf("@%s пытается украсть вашу плашку! Охранник не справился и ушел.", userName))
+					}
 
 					// Определяем шанс успеха в зависимости от редкости плашки
 					targetRarity := targetItem.Rarity
 					successChance := 0
 
-					switch targetRarity {
-					case "common":
-						successChance = 50
-					case "rare":
-						successChance = 25
-					case "legendary":
-						successChance = 10
-					default:
+					if tier, ok := getRarityTier(targetRarity); ok {
+						successChance = tier.PlaterobChance
+					} else {
 						successChance = 50 // fallback
 					}
 
@@ -4515,11 +10759,22 @@ func main() {
 								break
 							}
 
+							// Забираем плашку из инвентаря жертвы (у предмета может быть только один владелец)
+							removeErr := removeItemByHash(targetUsername, targetItem.Hash)
+							if removeErr != nil {
+								log.Printf("platerob: Ошибка удаления надетой плашки из инвентаря жертвы %s: %v", targetUsername, removeErr)
+							}
+
 							// Добавляем плашку в инвентарь грабителя
-							addErr := addStolenItemToInventory(userName, targetItem)
+							stolenHash, addErr := addStolenItemToInventory(userName, targetItem)
 							if addErr != nil {
 								log.Printf("platerob: Ошибка добавления плашки в инвентарь грабителя %s: %v", userName, addErr)
 								// Возвращаем плашку жертве
+								if removeErr == nil {
+									if _, restoreErr := addStolenItemToInventory(targetUsername, targetItem); restoreErr != nil {
+										log.Printf("platerob: Ошибка возврата плашки %s в инвентарь жертвы %s: %v", targetItem.Hash, targetUsername, restoreErr)
+									}
+								}
 								returnErr := wearItem(targetUsername, targetItem.Hash)
 								if returnErr != nil {
 									log.Printf("platerob: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть плашку %s жертве %s", targetItem.Hash, targetUsername)
@@ -4532,14 +10787,17 @@ func main() {
 							}
 
 							// Надеваем плашку на грабителя
-							wearErr := wearItem(userName, targetItem.Hash)
+							wearErr := wearItem(userName, stolenHash)
 							if wearErr != nil {
 								log.Printf("platerob: Ошибка надевания плашки на грабителя %s: %v", userName, wearErr)
 								// Удаляем плашку из инвентаря грабителя и возвращаем цели
-								removeErr := removeItemByHash(userName, targetItem.Hash)
+								removeErr := removeItemByHash(userName, stolenHash)
 								if removeErr != nil {
 									log.Printf("platerob: Ошибка удаления плашки из инвентаря грабителя %s: %v", userName, removeErr)
 								}
+								if _, restoreErr := addStolenItemToInventory(targetUsername, targetItem); restoreErr != nil {
+									log.Printf("platerob: Ошибка возврата плашки %s в инвентарь жертвы %s: %v", targetItem.Hash, targetUsername, restoreErr)
+								}
 								returnErr := wearItem(targetUsername, targetItem.Hash)
 								if returnErr != nil {
 									log.Printf("platerob: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть плашку %s жертве %s после ошибки надевания на грабителя %s", targetItem.Hash, targetUsername, userName)
@@ -4550,6 +10808,7 @@ func main() {
 								msg.ReplyToMessageID = update.Message.MessageID
 								break
 							}
+							appendItemHistory(stolenHash, ItemEvent{Type: "stolen", From: targetUsername, To: userName})
 						} else {
 							// Кража плашки из инвентаря
 							// Проверяем, что предмет все еще есть у цели
@@ -4589,11 +10848,11 @@ func main() {
 							}
 
 							// Добавляем предмет в инвентарь грабителя
-							addErr := addStolenItemToInventory(userName, targetItem)
+							stolenHash, addErr := addStolenItemToInventory(userName, targetItem)
 							if addErr != nil {
 								log.Printf("platerob: Ошибка добавления предмета в инвентарь грабителя %s: %v", userName, addErr)
 								// Пытаемся вернуть предмет цели
-								returnErr := addStolenItemToInventory(targetUsername, targetItem)
+								_, returnErr := addStolenItemToInventory(targetUsername, targetItem)
 								if returnErr != nil {
 									log.Printf("platerob: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть плашку %s цели %s после ошибки добавления грабителю %s", targetItem.PrizeName, targetUsername, userName)
 									msg.Text = fmt.Sprintf("🚫 КРИТИЧЕСКАЯ ОШИБКА! Не удалось добавить плашку в ваш инвентарь!\n\nПричина: %v\n\nПлашка потеряна - обратитесь к администратору!", addErr)
@@ -4603,8 +10862,11 @@ func main() {
 								msg.ReplyToMessageID = update.Message.MessageID
 								break
 							}
+							appendItemHistory(stolenHash, ItemEvent{Type: "stolen", From: targetUsername, To: userName})
 						}
 
+						shieldRobVictim(targetUsername)
+
 						sourceText := "с надетой плашки"
 						if !stealingFromWorn {
 							sourceText = "из инвентаря"
@@ -4616,7 +10878,8 @@ func main() {
 							"🏷️ Плашка: %s\n"+
 							"⭐ Редкость: %s\n\n"+
 							"🏃‍♂️ Удачно смылись!",
-							targetUsername, sourceText, targetItem.PrizeName, targetRarity)
+							targetUsername, sourceText, formatItemName(targetItem), rarityLabel(targetRarity))
+						msg.Text += payBounties(userName, targetUsername)
 
 						// Добавляем агрессивное сообщение для должников
 						if hasLargeDebt, debtAmount := checkLargeDebt(userName); hasLargeDebt {
@@ -4666,6 +10929,7 @@ func main() {
 								playerFines[userName], getChipsWord(playerFines[userName]),
 								playerBalances[userName], getChipsWord(playerBalances[userName]))
 						}
+						msg.Text += tryJailRobber(userName)
 					}
 
 					msg.ReplyToMessageID = update.Message.MessageID
@@ -4708,7 +10972,7 @@ func main() {
 					}
 
 					// Проверяем наличие оборудования
-					err := useItemFromInventory(userName, "Оборудование для разведки")
+					err := useItemFromInventory(userName, shopEffectScout)
 					if err != nil {
 						msg.Text = "🚫 У вас нет оборудования для разведки!\n\n🛒 Купить: /shop buy scout_gear"
 						msg.ReplyToMessageID = update.Message.MessageID
@@ -4734,14 +10998,23 @@ func main() {
 							inventoryInfo = fmt.Sprintf("📦 %d предметов в инвентаре", totalItems)
 						}
 
+						// Карточка надетой плашки цели
+						wornInfo := "👕 Плашка не надета"
+						if wornData, wornErr := getWornItem(targetUsername); wornErr == nil && wornData != nil {
+							if card, cardErr := buildItemPlateCard(wornData["hash"]); cardErr == nil {
+								wornInfo = "👕 Надетая плашка:\n" + formatPlateCard(card)
+							}
+						}
+
 						msg.Text = fmt.Sprintf("✅ **РАЗВЕДКА УСПЕШНА!**\n\n"+
 							"🕵️ Информация о цели @%s:\n\n"+
 							"💰 Баланс на руках: %d %s\n"+
 							"🏦 В банке: %d %s\n"+
 							"%s\n\n"+
+							"%s\n\n"+
 							"🔍 Разведка завершена!",
 							targetUsername, targetBalance, getChipsWord(targetBalance),
-							targetBank, getChipsWord(targetBank), inventoryInfo)
+							targetBank, getChipsWord(targetBank), inventoryInfo, wornInfo)
 					} else {
 						// Неудачная разведка
 						msg.Text = fmt.Sprintf("❌ **РАЗВЕДКА ПРОВАЛИЛАСЬ!**\n\n"+
@@ -4752,6 +11025,116 @@ func main() {
 
 					msg.ReplyToMessageID = update.Message.MessageID
 
+				case "plate":
+					log.Printf("Команда /plate от %s", userName)
+					query := strings.TrimSpace(update.Message.CommandArguments())
+					if query == "" {
+						msg.Text = "🚫 Укажите хэш предмета или название плашки! Пример: /plate 1a2b"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					card, err := findPlateCard(query)
+					if err != nil {
+						log.Printf("Команда /plate: %v", err)
+						msg.Text = "❌ Плашка не найдена ни по хэшу, ни по названию!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					msg.Text = formatPlateCard(card)
+					msg.ReplyToMessageID = update.Message.MessageID
+
+					// Отправляем карточку картинкой, при ошибке - обычным текстом
+					if cardImage, err := renderPlateCardImage(card); err != nil {
+						log.Printf("Команда /plate: Ошибка отрисовки карточки: %v", err)
+					} else if err := sendPhotoReply(bot, update.Message.Chat.ID, update.Message.MessageID, "plate.png", cardImage,
+						addDebtNotificationToMessage(userName, msg.Text)); err != nil {
+						log.Printf("Команда /plate: Ошибка отправки картинки: %v", err)
+					} else {
+						continue
+					}
+
+				case "profile":
+					log.Printf("Команда /profile от %s", userName)
+					targetUsername := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "@")
+					if targetUsername == "" {
+						targetUsername = userName
+					}
+
+					if _, exists := playerBalances[targetUsername]; !exists {
+						if balance, ok := loadBalanceFromRedis(targetUsername); ok {
+							playerBalances[targetUsername] = balance
+						} else {
+							msg.Text = fmt.Sprintf("🚫 Игрок @%s не найден!", targetUsername)
+							msg.ReplyToMessageID = update.Message.MessageID
+							break
+						}
+					}
+
+					profileText, profileCard := buildProfileCard(targetUsername)
+					msg.Text = profileText
+					msg.ReplyToMessageID = update.Message.MessageID
+
+					// Отправляем профиль картинкой, при ошибке - обычным текстом
+					if profileImage, err := render.RenderProfileCard(profileCard); err != nil {
+						log.Printf("Команда /profile: Ошибка отрисовки профиля: %v", err)
+					} else if err := sendPhotoReply(bot, update.Message.Chat.ID, update.Message.MessageID, "profile.png", profileImage,
+						addDebtNotificationToMessage(userName, msg.Text)); err != nil {
+						log.Printf("Команда /profile: Ошибка отправки картинки: %v", err)
+					} else {
+						continue
+					}
+
+				case "item":
+					log.Printf("Команда /item от %s", userName)
+					itemHash := strings.TrimSpace(update.Message.CommandArguments())
+					if itemHash == "" {
+						msg.Text = "🚫 Укажите хэш предмета! Пример: /item 1a2b"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					record, err := getItemRecord(itemHash)
+					if err != nil {
+						log.Printf("Команда /item: Предмет %s не найден: %v", itemHash, err)
+						msg.Text = "❌ Предмет с таким хэшем не найден!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					ownerText := "нет (предмет выбыл из игры)"
+					if record["owner"] != "" {
+						ownerText = "@" + record["owner"]
+					}
+
+					msg.Text = fmt.Sprintf("🏷️ Предмет %s\n\n"+
+						"📛 Название: %s\n"+
+						"⭐ Редкость: %s\n"+
+						"💰 Стоимость: %s фишек\n"+
+						"👤 Владелец: %s\n",
+						itemHash, record["prizeName"], record["rarity"], record["cost"], ownerText)
+					if record["serial"] != "" {
+						msg.Text += fmt.Sprintf("🔢 Экземпляр: #%s/%s\n", record["serial"], record["maxSupply"])
+					}
+					if createdAt, err := strconv.ParseInt(record["createdAt"], 10, 64); err == nil {
+						msg.Text += fmt.Sprintf("📅 Создан: %s\n", time.Unix(createdAt, 0).Format("02.01.2006 15:04"))
+					}
+
+					history, err := getItemHistory(itemHash)
+					if err != nil {
+						log.Printf("Команда /item: Ошибка получения истории %s: %v", itemHash, err)
+					}
+					if len(history) == 0 {
+						msg.Text += "\n📜 История не сохранилась (предмет получен до ее появления)"
+					} else {
+						msg.Text += "\n📜 История:\n"
+						for _, event := range history {
+							msg.Text += formatItemEvent(event) + "\n"
+						}
+					}
+					msg.ReplyToMessageID = update.Message.MessageID
+
 				case "sell":
 					log.Printf("Команда /sell от %s", userName)
 					args := update.Message.CommandArguments()
@@ -4765,25 +11148,13 @@ func main() {
 					log.Printf("Команда /sell: Попытка продажи предмета с хэшем %s пользователем %s", itemHash, userName)
 
 					// Ищем предмет в инвентаре пользователя
-					ctx := context.Background()
-					key := fmt.Sprintf("inventory:%s:%s", userName, itemHash)
-
-					val, err := redisClient.Get(ctx, key).Result()
+					item, err := getInventoryItem(userName, itemHash)
 					if err != nil {
-						log.Printf("Команда /sell: Предмет с хэшем %s не найден у пользователя %s", itemHash, userName)
+						log.Printf("Команда /sell: Предмет с хэшем %s не найден у пользователя %s: %v", itemHash, userName, err)
 						msg.Text = "❌ Предмет с таким хэшем не найден в вашем инвентаре!"
 						break
 					}
 
-					// Парсим предмет
-					var item InventoryItem
-					err = json.Unmarshal([]byte(val), &item)
-					if err != nil {
-						log.Printf("Команда /sell: Ошибка парсинга предмета %s: %v", itemHash, err)
-						msg.Text = "❌ Ошибка обработки предмета!"
-						break
-					}
-
 					// Проверяем, не надет ли этот предмет на игроке
 					wornData, wornErr := getWornItem(userName)
 					itemWasWorn := false
@@ -4799,41 +11170,17 @@ func main() {
 					}
 
 					// Уменьшаем счетчик предмета или удаляем если остался последний
-					item.Count--
-					if item.Count > 0 {
-						// Сохраняем обновленный предмет с уменьшенным счетчиком
-						data, err := json.Marshal(item)
-						if err != nil {
-							log.Printf("Команда /sell: Ошибка маршалинга обновленного предмета: %v", err)
-							msg.Text = "❌ Ошибка обновления предмета!"
-							break
-						}
-						err = redisClient.Set(ctx, key, data, 0).Err()
-						if err != nil {
-							log.Printf("Команда /sell: Ошибка сохранения обновленного предмета: %v", err)
-							msg.Text = "❌ Ошибка сохранения предмета!"
-							break
-						}
-					} else {
-						// Удаляем предмет если счетчик стал 0
-						err = redisClient.Del(ctx, key).Err()
-						if err != nil {
-							log.Printf("Команда /sell: Ошибка удаления предмета %s: %v", itemHash, err)
-							msg.Text = "❌ Ошибка удаления предмета!"
-							break
-						}
+					if err := removeItemByHash(userName, itemHash); err != nil {
+						log.Printf("Команда /sell: Ошибка удаления предмета %s: %v", itemHash, err)
+						msg.Text = "❌ Ошибка удаления предмета!"
+						break
 					}
 
+					appendItemHistory(itemHash, ItemEvent{Type: "sold", From: userName})
+
 					// Начисляем деньги игроку (специальная цена для магазинных предметов)
-					sellPrice := item.Cost
-					if item.Rarity == "shop" {
-						if item.PrizeName == "Оборудование для разведки" {
-							sellPrice = 50 // Оборудование для разведки продается за 50
-						} else {
-							sellPrice = 500 // Оборудование для грабежа продается за 500
-						}
-					}
-					changeBalance(userName, sellPrice)
+					sellPrice := itemSellPrice(item)
+					withheld, _ := creditPlayer(userName, sellPrice)
 
 					log.Printf("Команда /sell: Предмет %s продан за %d фишек пользователем %s", item.PrizeName, sellPrice, userName)
 
@@ -4842,11 +11189,147 @@ func main() {
 					if itemWasWorn {
 						msg.Text += "\n👕 Плашка автоматически снята с вашего имени!"
 					}
+					msg.Text += formatWithheld(userName, withheld)
 					msg.Text += fmt.Sprintf("\n💰 Ваш баланс: %d фишек", playerBalances[userName])
 
 					// Отвечаем на сообщение пользователя
 					msg.ReplyToMessageID = update.Message.MessageID
 
+				case "use":
+					log.Printf("Команда /use от %s", userName)
+					itemHash := strings.TrimSpace(update.Message.CommandArguments())
+					if itemHash == "" {
+						msg.Text = "🚫 Укажите хэш предмета! Пример: /use 1a2b\n\n🔐 Через /use включается сейф (купить: /shop buy safe)"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					item, err := getInventoryItem(userName, itemHash)
+					if err != nil {
+						msg.Text = "❌ Предмет с таким хэшем не найден в вашем инвентаре!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					shopItem, isShopItem := findShopItemByName(item.PrizeName)
+					if item.Rarity != "shop" || !isShopItem {
+						msg.Text = fmt.Sprintf("🚫 %s нельзя использовать! Плашки надеваются через /wear %s", formatItemName(item), itemHash)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					switch shopItem.Effect {
+					case shopEffectSafe:
+						if err := removeItemByHash(userName, itemHash); err != nil {
+							log.Printf("Команда /use: Ошибка списания сейфа %s у %s: %v", itemHash, userName, err)
+							msg.Text = "❌ Ошибка списания предмета!"
+							break
+						}
+
+						until, err := activateSafe(userName)
+						if err != nil {
+							log.Printf("Команда /use: Ошибка включения сейфа у %s: %v", userName, err)
+							if restoreErr := saveInventoryItem(userName, item); restoreErr != nil {
+								log.Printf("Команда /use: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть сейф %s игроку %s: %v", itemHash, userName, restoreErr)
+							}
+							msg.Text = "❌ Не удалось включить сейф, предмет возвращен в инвентарь!"
+							break
+						}
+						appendItemHistory(itemHash, ItemEvent{Type: "used", From: userName})
+
+						msg.Text = fmt.Sprintf("🔐 Сейф включен!\n\n👕 Надетая плашка защищена от /platerob до %s", until.Format("02.01.2006 15:04"))
+					case shopEffectCrate:
+						msg.Text = fmt.Sprintf("📦 Ящики открываются командой /open %s", itemHash)
+					default:
+						msg.Text = fmt.Sprintf("ℹ️ %s %s срабатывает автоматически, /use не нужен.", shopItem.Emoji, shopItem.Name)
+					}
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "open":
+					log.Printf("Команда /open от %s", userName)
+					itemHash := strings.TrimSpace(update.Message.CommandArguments())
+					if itemHash == "" {
+						msg.Text = "🚫 Укажите хэш ящика! Пример: /open 1a2b\n\n📦 Ящики продаются в /shop"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					crateItem, item, err := openCrate(userName, itemHash)
+					if err != nil {
+						log.Printf("Команда /open: Ящик %s у %s не открыт: %v", itemHash, userName, err)
+						msg.Text = "❌ " + err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					emoji := "🏷️"
+					if tier, ok := getRarityTier(item.Rarity); ok {
+						emoji = tier.Emoji
+					}
+					sellPrice := itemSellPrice(item)
+					msg.Text = fmt.Sprintf("📦 %s ОТКРЫТ!\n\n"+
+						"%s Выпала %s плашка: %s\n"+
+						"💰 Стоимость: %d %s\n"+
+						"💱 Выкуп: %d %s\n"+
+						"🔑 Хэш: %s\n\n"+
+						"👕 Надеть: /wear %s",
+						strings.ToUpper(crateItem.Name), emoji, rarityLabel(item.Rarity), formatItemName(item),
+						item.Cost, getChipsWord(item.Cost), sellPrice, getChipsWord(sellPrice), item.Hash, item.Hash)
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "craft":
+					log.Printf("Команда /craft от %s", userName)
+					hashes := strings.Fields(update.Message.CommandArguments())
+					if len(hashes) != economyConfig.Craft.Inputs {
+						fee := economyConfig.Craft.Fee
+						msg.Text = fmt.Sprintf("⚒️ КРАФТ ПЛАШЕК\n\n"+
+							"Переплавьте %d плашки одной редкости в случайную плашку следующей редкости!\n"+
+							"Пример: /craft abc1 abc2 abc3\n\n"+
+							"💰 Плата: %d %s\n"+
+							"💥 Шанс неудачи: %d%% (плашки и плата сгорают)",
+							economyConfig.Craft.Inputs, fee, getChipsWord(fee), economyConfig.Craft.FailChance)
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					result, err := craftPlates(userName, hashes)
+					if err != nil {
+						log.Printf("Команда /craft: Крафт для %s отклонен: %v", userName, err)
+						msg.Text = "❌ " + err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					consumedByHash := make(map[string]InventoryItem)
+					for _, item := range result.Consumed {
+						consumedByHash[item.Hash] = item
+					}
+					var consumedNames []string
+					for _, itemHash := range hashes {
+						consumedNames = append(consumedNames, formatItemName(consumedByHash[itemHash]))
+					}
+
+					fee := economyConfig.Craft.Fee
+					if result.Failed {
+						msg.Text = fmt.Sprintf("💥 КРАФТ НЕ УДАЛСЯ!\n\n"+
+							"🔥 Сгорели: %s\n"+
+							"💸 Плата: %d %s",
+							strings.Join(consumedNames, ", "), fee, getChipsWord(fee))
+					} else {
+						msg.Text = fmt.Sprintf("⚒️ КРАФТ УДАЛСЯ!\n\n"+
+							"🔥 Переплавлены: %s\n"+
+							"✨ Получена %s плашка: %s\n"+
+							"🔑 Хэш: %s\n"+
+							"💸 Плата: %d %s",
+							strings.Join(consumedNames, ", "), rarityLabel(result.Item.Rarity), formatItemName(result.Item),
+							result.Item.Hash, fee, getChipsWord(fee))
+					}
+					if result.WasWorn {
+						msg.Text += "\n👕 Надетая плашка автоматически снята!"
+					}
+					msg.Text += fmt.Sprintf("\n💰 Ваш баланс: %d %s", playerBalances[userName], getChipsWord(playerBalances[userName]))
+					msg.ReplyToMessageID = update.Message.MessageID
+
 				case "giveplate":
 					log.Printf("Команда /giveplate от %s", userName)
 					args := update.Message.CommandArguments()
@@ -4898,27 +11381,14 @@ func main() {
 					}
 
 					// Проверяем, что у отправителя есть такая плашка
-					ctx := context.Background()
-					senderKey := fmt.Sprintf("inventory:%s:%s", userName, plateHash)
-
-					val, err := redisClient.Get(ctx, senderKey).Result()
+					plate, err := getInventoryItem(userName, plateHash)
 					if err != nil {
-						log.Printf("Команда /giveplate: Плашка с хэшем %s не найдена у пользователя %s", plateHash, userName)
+						log.Printf("Команда /giveplate: Плашка с хэшем %s не найдена у пользователя %s: %v", plateHash, userName, err)
 						msg.Text = "❌ Такая плашка не найдена в вашем инвентаре!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
-					// Парсим плашку
-					var plate InventoryItem
-					err = json.Unmarshal([]byte(val), &plate)
-					if err != nil {
-						log.Printf("Команда /giveplate: Ошибка парсинга плашки %s: %v", plateHash, err)
-						msg.Text = "❌ Ошибка обработки плашки!"
-						msg.ReplyToMessageID = update.Message.MessageID
-						break
-					}
-
 					// Проверяем, что это плашка (не магазинный предмет)
 					if plate.Rarity == "shop" {
 						msg.Text = "🚫 Можно передавать только плашки, а не магазинные предметы!"
@@ -4933,6 +11403,21 @@ func main() {
 						break
 					}
 
+					// Проверяем долг, суточный лимит и налог (считаются по цене выкупа)
+					transferValue := itemSellPrice(plate) * quantity
+					if err := checkTransferAllowed(userName, transferValue); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					// Налог списывается только после того, как все плашки сняты с отправителя
+					tax := transferTax(transferValue)
+					if tax > 0 && playerBalances[userName] < tax {
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств для налога на перевод: %d %s", tax, getChipsWord(tax))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
 					// Проверяем, не надета ли эта плашка на отправителе (если передаем хотя бы одну)
 					wornData, wornErr := getWornItem(userName)
 					if quantity > 0 && wornErr == nil && wornData != nil && wornData["hash"] == plateHash {
@@ -4952,31 +11437,57 @@ func main() {
 					plateToTransfer.Count = quantity
 
 					// Уменьшаем количество плашек у отправителя
-					for i := 0; i < quantity; i++ {
-						removeErr := removeItemByHash(userName, plateHash)
-						if removeErr != nil {
-							log.Printf("Команда /giveplate: Ошибка удаления плашки %d у отправителя %s: %v", i+1, userName, removeErr)
-							msg.Text = "❌ Ошибка передачи плашек!"
-							msg.ReplyToMessageID = update.Message.MessageID
+					removed := 0
+					var removeErr error
+					for removed < quantity {
+						if removeErr = removeItemByHash(userName, plateHash); removeErr != nil {
 							break
 						}
+						removed++
+					}
+					if removeErr != nil {
+						log.Printf("Команда /giveplate: Ошибка удаления плашки %d у отправителя %s: %v", removed+1, userName, removeErr)
+						// Возвращаем уже снятые плашки, получатель ничего не получает
+						if removed > 0 {
+							returned := plate
+							returned.Count = removed
+							if _, returnErr := addStolenItemToInventory(userName, returned); returnErr != nil {
+								log.Printf("Команда /giveplate: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d плашек %s отправителю %s: %v", removed, plate.PrizeName, userName, returnErr)
+							}
+						}
+						msg.Text = "❌ Ошибка передачи плашек!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Все плашки сняты, теперь списываем налог
+					if tax > 0 && !changeBalance(userName, -tax) {
+						if _, returnErr := addStolenItemToInventory(userName, plateToTransfer); returnErr != nil {
+							log.Printf("Команда /giveplate: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d плашек %s отправителю %s: %v", quantity, plate.PrizeName, userName, returnErr)
+						}
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств для налога на перевод: %d %s", tax, getChipsWord(tax))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
 					}
 
 					// Добавляем плашки получателю
-					addErr := addStolenItemToInventory(targetUsername, plateToTransfer)
+					receivedHash, addErr := addStolenItemToInventory(targetUsername, plateToTransfer)
 					if addErr != nil {
 						log.Printf("Команда /giveplate: Ошибка добавления плашек получателю %s: %v", targetUsername, addErr)
 						// Пытаемся вернуть плашки отправителю
-						returnErr := addStolenItemToInventory(userName, plateToTransfer)
+						_, returnErr := addStolenItemToInventory(userName, plateToTransfer)
 						if returnErr != nil {
 							log.Printf("Команда /giveplate: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d плашек %s отправителю %s", quantity, plate.PrizeName, userName)
 							msg.Text = fmt.Sprintf("🚫 КРИТИЧЕСКАЯ ОШИБКА! %d плашек %s потеряны!", quantity, plate.PrizeName)
 						} else {
+							changeBalance(userName, tax)
 							msg.Text = fmt.Sprintf("❌ Ошибка передачи плашек! Плашки возвращены вам.")
 						}
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
+					appendItemHistory(receivedHash, ItemEvent{Type: "gifted", From: userName, To: targetUsername})
+					recordTransfer(bot, userName, targetUsername, transferValue)
 
 					// Успешная передача
 					senderName := getParticipantNameByUsername(userName)
@@ -4987,6 +11498,13 @@ func main() {
 						quantityText = fmt.Sprintf(" (x%d)", quantity)
 					}
 
+					taxText := ""
+					if tax > 0 {
+						taxText = fmt.Sprintf("🧾 Налог на перевод: %d %s\n", tax, getChipsWord(tax))
+						appendJournal(userName, JournalEntry{Type: "transfer_out", Amount: -tax,
+							Note: fmt.Sprintf("налог за передачу @%s", targetUsername)})
+					}
+
 					randomQuote := getRandomGiveplateQuote()
 
 					msg.Text = fmt.Sprintf("✅ **ПЛАШКА ПЕРЕДАНА!**\n\n"+
@@ -4994,8 +11512,8 @@ func main() {
 						"👤 Кому: %s\n"+
 						"🏷️ Плашка: %s%s\n"+
 						"⭐ Редкость: %s\n\n"+
-						"%s",
-						senderName, receiverName, plate.PrizeName, quantityText, plate.Rarity, randomQuote)
+						"%s%s",
+						senderName, receiverName, plate.PrizeName, quantityText, plate.Rarity, taxText, randomQuote)
 
 					log.Printf("Команда /giveplate: Успешная передача %d плашки(ек) %s от %s к %s", quantity, plate.PrizeName, userName, targetUsername)
 					msg.ReplyToMessageID = update.Message.MessageID
@@ -5051,30 +11569,32 @@ func main() {
 					}
 
 					// Проверяем, что у отправителя есть такой предмет
-					ctx := context.Background()
-					senderKey := fmt.Sprintf("inventory:%s:%s", userName, itemHash)
-
-					val, err := redisClient.Get(ctx, senderKey).Result()
+					item, err := getInventoryItem(userName, itemHash)
 					if err != nil {
-						log.Printf("Команда /give: Предмет с хэшем %s не найден у пользователя %s", itemHash, userName)
+						log.Printf("Команда /give: Предмет с хэшем %s не найден у пользователя %s: %v", itemHash, userName, err)
 						msg.Text = "❌ Такой предмет не найден в вашем инвентаре!"
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
-					// Парсим предмет
-					var item InventoryItem
-					err = json.Unmarshal([]byte(val), &item)
-					if err != nil {
-						log.Printf("Команда /give: Ошибка парсинга предмета %s: %v", itemHash, err)
-						msg.Text = "❌ Ошибка обработки предмета!"
+					// Проверяем, что у отправителя есть достаточное количество предметов
+					if item.Count < quantity {
+						msg.Text = fmt.Sprintf("🚫 У вас недостаточно предметов! Доступно: %d, запрошено: %d", item.Count, quantity)
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
 
-					// Проверяем, что у отправителя есть достаточное количество предметов
-					if item.Count < quantity {
-						msg.Text = fmt.Sprintf("🚫 У вас недостаточно предметов! Доступно: %d, запрошено: %d", item.Count, quantity)
+					// Проверяем долг, суточный лимит и налог (считаются по цене выкупа)
+					transferValue := itemSellPrice(item) * quantity
+					if err := checkTransferAllowed(userName, transferValue); err != nil {
+						msg.Text = err.Error()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+					// Налог списывается только после того, как все предметы сняты с отправителя
+					tax := transferTax(transferValue)
+					if tax > 0 && playerBalances[userName] < tax {
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств для налога на перевод: %d %s", tax, getChipsWord(tax))
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
@@ -5098,31 +11618,57 @@ func main() {
 					itemToTransfer.Count = quantity
 
 					// Уменьшаем количество предметов у отправителя
-					for i := 0; i < quantity; i++ {
-						removeErr := removeItemByHash(userName, itemHash)
-						if removeErr != nil {
-							log.Printf("Команда /give: Ошибка удаления предмета %d у отправителя %s: %v", i+1, userName, removeErr)
-							msg.Text = "❌ Ошибка передачи предмета!"
-							msg.ReplyToMessageID = update.Message.MessageID
+					removed := 0
+					var removeErr error
+					for removed < quantity {
+						if removeErr = removeItemByHash(userName, itemHash); removeErr != nil {
 							break
 						}
+						removed++
+					}
+					if removeErr != nil {
+						log.Printf("Команда /give: Ошибка удаления предмета %d у отправителя %s: %v", removed+1, userName, removeErr)
+						// Возвращаем уже снятые предметы, получатель ничего не получает
+						if removed > 0 {
+							returned := item
+							returned.Count = removed
+							if _, returnErr := addStolenItemToInventory(userName, returned); returnErr != nil {
+								log.Printf("Команда /give: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d предметов %s отправителю %s: %v", removed, item.PrizeName, userName, returnErr)
+							}
+						}
+						msg.Text = "❌ Ошибка передачи предмета!"
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					// Все предметы сняты, теперь списываем налог
+					if tax > 0 && !changeBalance(userName, -tax) {
+						if _, returnErr := addStolenItemToInventory(userName, itemToTransfer); returnErr != nil {
+							log.Printf("Команда /give: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d предметов %s отправителю %s: %v", quantity, item.PrizeName, userName, returnErr)
+						}
+						msg.Text = fmt.Sprintf("🚫 Недостаточно средств для налога на перевод: %d %s", tax, getChipsWord(tax))
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
 					}
 
 					// Добавляем предметы получателю
-					addErr := addStolenItemToInventory(targetUsername, itemToTransfer)
+					receivedHash, addErr := addStolenItemToInventory(targetUsername, itemToTransfer)
 					if addErr != nil {
 						log.Printf("Команда /give: Ошибка добавления предметов получателю %s: %v", targetUsername, addErr)
 						// Пытаемся вернуть предметы отправителю
-						returnErr := addStolenItemToInventory(userName, itemToTransfer)
+						_, returnErr := addStolenItemToInventory(userName, itemToTransfer)
 						if returnErr != nil {
 							log.Printf("Команда /give: КРИТИЧЕСКАЯ ОШИБКА: Не удалось вернуть %d предметов %s отправителю %s", quantity, item.PrizeName, userName)
 							msg.Text = fmt.Sprintf("🚫 КРИТИЧЕСКАЯ ОШИБКА! %d предметов %s потеряны!", quantity, item.PrizeName)
 						} else {
+							changeBalance(userName, tax)
 							msg.Text = fmt.Sprintf("❌ Ошибка передачи предметов! Предметы возвращены вам.")
 						}
 						msg.ReplyToMessageID = update.Message.MessageID
 						break
 					}
+					appendItemHistory(receivedHash, ItemEvent{Type: "gifted", From: userName, To: targetUsername})
+					recordTransfer(bot, userName, targetUsername, transferValue)
 
 					// Успешная передача
 					senderName := getParticipantNameByUsername(userName)
@@ -5133,6 +11679,13 @@ func main() {
 						quantityText = fmt.Sprintf(" (x%d)", quantity)
 					}
 
+					taxText := ""
+					if tax > 0 {
+						taxText = fmt.Sprintf("🧾 Налог на перевод: %d %s\n", tax, getChipsWord(tax))
+						appendJournal(userName, JournalEntry{Type: "transfer_out", Amount: -tax,
+							Note: fmt.Sprintf("налог за передачу @%s", targetUsername)})
+					}
+
 					randomQuote := getRandomGiveplateQuote()
 
 					msg.Text = fmt.Sprintf("✅ **ПРЕДМЕТ ПЕРЕДАН!**\n\n"+
@@ -5140,8 +11693,8 @@ func main() {
 						"👤 Кому: %s\n"+
 						"🏷️ Предмет: %s%s\n"+
 						"📦 Тип: %s\n\n"+
-						"%s",
-						senderName, receiverName, item.PrizeName, quantityText, item.Rarity, randomQuote)
+						"%s%s",
+						senderName, receiverName, item.PrizeName, quantityText, item.Rarity, taxText, randomQuote)
 
 					log.Printf("Команда /give: Успешная передача %d предмета(ов) %s от %s к %s", quantity, item.PrizeName, userName, targetUsername)
 					msg.ReplyToMessageID = update.Message.MessageID
@@ -5199,6 +11752,68 @@ func main() {
 					// Отвечаем на сообщение пользователя
 					msg.ReplyToMessageID = update.Message.MessageID
 
+				case "supply":
+					log.Printf("Команда /supply: Вызвана пользователем %s", userName)
+
+					// Команда для просмотра тиражей призов (только для администраторов)
+					if userName != "hunnidstooblue" && userName != "iamnothiding" {
+						msg.Text = "🚫 Только администраторы могут использовать эту команду!"
+						break
+					}
+
+					allPrizes, err := loadAllPrizesFromRedis()
+					if err != nil {
+						log.Printf("Команда /supply: Ошибка загрузки призов: %v", err)
+						msg.Text = "❌ Ошибка загрузки призов!"
+						break
+					}
+
+					minted, err := getPrizeMintedCounts()
+					if err != nil {
+						log.Printf("Команда /supply: Ошибка загрузки тиражей: %v", err)
+						minted = map[string]int{}
+					}
+
+					circulation, err := getPrizeCirculation()
+					if err != nil {
+						log.Printf("Команда /supply: Ошибка подсчета предметов в обороте: %v", err)
+						circulation = map[string]int{}
+					}
+
+					sort.Slice(allPrizes, func(i, j int) bool {
+						if allPrizes[i].Rarity != allPrizes[j].Rarity {
+							return rarityOrder(allPrizes[i].Rarity) > rarityOrder(allPrizes[j].Rarity)
+						}
+						return allPrizes[i].Name < allPrizes[j].Name
+					})
+
+					msg.Text = "📦 Тиражи плашек (в обороте / выпущено / тираж):\n\n"
+					for _, prize := range allPrizes {
+						supplyText := "∞"
+						if prize.MaxSupply > 0 {
+							supplyText = strconv.Itoa(prize.MaxSupply)
+						}
+						line := fmt.Sprintf("%s [%s]: %d / %d / %s", prize.Name, prize.Rarity,
+							circulation[prize.Name], minted[prizeKey(prize)], supplyText)
+						if isPrizeExhausted(prize, minted) {
+							line += " ⛔ распродан"
+						}
+						msg.Text += line + "\n"
+					}
+					msg.ReplyToMessageID = update.Message.MessageID
+
+				case "prizeadmin":
+					log.Printf("Команда /prizeadmin: Вызвана пользователем %s", userName)
+
+					// Команда для управления каталогом плашек (только для администраторов)
+					if userName != "hunnidstooblue" && userName != "iamnothiding" {
+						msg.Text = "🚫 Только администраторы могут изменять каталог плашек!"
+						break
+					}
+
+					msg.Text = handlePrizeAdminCommand(strings.TrimSpace(update.Message.CommandArguments()))
+					msg.ReplyToMessageID = update.Message.MessageID
+
 				case "loadfromfile":
 					// Проверяем, является ли пользователь администратором
 					if userName != "hunnidstooblue" && userName != "iamnothiding" {
@@ -5206,10 +11821,17 @@ func main() {
 						break
 					}
 
-					if err := loadPrizesFromFileToRedis(); err != nil {
+					// Сначала показываем различия, применяем только после подтверждения
+					if strings.TrimSpace(update.Message.CommandArguments()) != "confirm" {
+						msg.Text, _ = preparePrizeReload()
+						msg.ReplyToMessageID = update.Message.MessageID
+						break
+					}
+
+					if diff, err := confirmPrizeReload(); err != nil {
 						msg.Text = fmt.Sprintf("❌ Ошибка загрузки призов: %v", err)
 					} else {
-						msg.Text = "✅ Призы успешно загружены из prizes.json в Redis!"
+						msg.Text = "✅ Призы успешно загружены из prizes.json в Redis!\n\n" + diff
 					}
 
 				case "removefromredis":
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	benchUsers        = 22
+	benchItemsPerUser = 1000
+)
+
+// Подключаемся к отдельной базе Redis (DB 15) и очищаем её. База стирается целиком,
+// поэтому без явного разрешения RANDOMIZER_TEST_REDIS=1 тесты и бенчмарки с Redis пропускаются
+func setupTestRedis(tb testing.TB) *redis.Client {
+	tb.Helper()
+
+	if os.Getenv("RANDOMIZER_TEST_REDIS") != "1" {
+		tb.Skip("тесты с Redis очищают DB 15, для запуска задайте RANDOMIZER_TEST_REDIS=1")
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		tb.Skipf("Redis недоступен (%s): %v", addr, err)
+	}
+
+	log.SetOutput(io.Discard)
+	savedClient := redisClient
+	redisClient = client
+	client.FlushDB(ctx)
+
+	tb.Cleanup(func() {
+		client.FlushDB(ctx)
+		client.Close()
+		redisClient = savedClient
+		log.SetOutput(os.Stderr)
+	})
+
+	return client
+}
+
+// Заполняем тестовую базу Redis инвентарями (всего benchUsers*benchItemsPerUser предметов)
+func setupInventoryBenchmark(b *testing.B) []string {
+	b.Helper()
+
+	client := setupTestRedis(b)
+	ctx := context.Background()
+
+	usernames := make([]string, 0, benchUsers)
+	pipe := client.Pipeline()
+	for u := 0; u < benchUsers; u++ {
+		username := fmt.Sprintf("bench_user_%d", u)
+		usernames = append(usernames, username)
+		for i := 0; i < benchItemsPerUser; i++ {
+			item := InventoryItem{
+				PrizeName: fmt.Sprintf("Плашка %d", i%50),
+				Rarity:    "common",
+				Cost:      100,
+				Count:     1,
+				Hash:      fmt.Sprintf("%s-%d", username, i),
+			}
+			data, _ := json.Marshal(item)
+			pipe.HSet(ctx, inventoryKey(username), item.Hash, data)
+			pipe.HSet(ctx, itemOwnersKey, item.Hash, username)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		b.Fatalf("не удалось заполнить Redis: %v", err)
+	}
+
+	return usernames
+}
+
+// Инвентарь одного игрока (/inv)
+func BenchmarkGetPlayerInventory(b *testing.B) {
+	usernames := setupInventoryBenchmark(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getPlayerInventory(usernames[i%len(usernames)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Инвентари всех участников (/leaderboard)
+func BenchmarkGetInventoriesForUsers(b *testing.B) {
+	usernames := setupInventoryBenchmark(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getInventoriesForUsers(usernames); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Сбрасываем настройки экономики и балансы в памяти (тесты ниже работают без Redis)
+func setupEconomyTest(t *testing.T) {
+	t.Helper()
+
+	savedConfig, savedClient := economyConfig, redisClient
+	savedBalances, savedBanks, savedFines := playerBalances, playerBanks, playerFines
+	economyConfig = defaultEconomyConfig
+	redisClient = nil
+	playerBalances = make(map[string]int)
+	playerBanks = make(map[string]int)
+	playerFines = make(map[string]int)
+	log.SetOutput(io.Discard)
+
+	t.Cleanup(func() {
+		economyConfig, redisClient = savedConfig, savedClient
+		playerBalances, playerBanks, playerFines = savedBalances, savedBanks, savedFines
+		log.SetOutput(os.Stderr)
+	})
+}
+
+func TestGetBailAmount(t *testing.T) {
+	tests := []struct {
+		name string
+		left time.Duration
+		want int
+	}{
+		{"срок истек", -time.Minute, 50},
+		{"меньше минуты", 10 * time.Second, 50},
+		{"неполная минута округляется вверх", 90 * time.Second, 100},
+		{"час", time.Hour, 3000},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		if got := getBailAmount(time.Now().Add(tt.left)); got != tt.want {
+			t.Errorf("%s: getBailAmount() = %d, ожидалось %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHeistChance(t *testing.T) {
+	tests := []struct {
+		crew int
+		want int
+	}{
+		{1, 15},
+		{2, 25},
+		{5, 55},
+		{6, 60},
+		{10, 60},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		if got := heistChance(tt.crew); got != tt.want {
+			t.Errorf("heistChance(%d) = %d, ожидалось %d", tt.crew, got, tt.want)
+		}
+	}
+}
+
+func TestGarnishAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		fine   int
+		amount int
+		want   int
+	}{
+		{"без штрафа", 0, 1000, 0},
+		{"половина зачисления", 5000, 1000, 500},
+		{"не больше штрафа", 300, 1000, 300},
+		{"пустое зачисление", 5000, 0, 0},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		playerFines["player"] = tt.fine
+		if got := garnishAmount("player", tt.amount); got != tt.want {
+			t.Errorf("%s: garnishAmount() = %d, ожидалось %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Игра резервирует номер, затем выпускается следующий, затем игра возвращает свой номер:
+// возвращенный номер выдается повторно, а тираж не превышается
+func TestReleasedPrizeSerialIsReused(t *testing.T) {
+	setupTestRedis(t)
+	prize := Prize{ID: "limited", Name: "Лимитка", Rarity: "rare", MaxSupply: 4}
+
+	reserve := func() int {
+		t.Helper()
+		serial, err := reservePrizeSerial(prize)
+		if err != nil {
+			t.Fatalf("reservePrizeSerial: %v", err)
+		}
+		return serial
+	}
+
+	reserve()
+	reserve()
+	gameSerial := reserve()
+	craftSerial := reserve()
+	if gameSerial != 3 || craftSerial != 4 {
+		t.Fatalf("выданы номера #%d и #%d, ожидались #3 и #4", gameSerial, craftSerial)
+	}
+
+	releasePrizeSerial(prize, gameSerial)
+	if minted, _ := getPrizeMintedCounts(); minted[prizeKey(prize)] != 3 {
+		t.Errorf("после возврата выпущено %d, ожидалось 3", minted[prizeKey(prize)])
+	}
+
+	if serial := reserve(); serial != gameSerial {
+		t.Errorf("после возврата выдан #%d, ожидался возвращенный #%d", serial, gameSerial)
+	}
+	if _, err := reservePrizeSerial(prize); err == nil {
+		t.Error("выдан номер сверх тиража")
+	}
+	if minted, _ := getPrizeMintedCounts(); minted[prizeKey(prize)] != 4 {
+		t.Errorf("выпущено %d, ожидалось 4", minted[prizeKey(prize)])
+	}
+}
+
+// Подтверждение перезагрузки отклоняется, если каталог изменился после показа различий
+func TestConfirmPrizeReloadRejectsStaleVersion(t *testing.T) {
+	client := setupTestRedis(t)
+	ctx := context.Background()
+	client.Set(ctx, prizesVersionKey, 5, 0)
+
+	t.Cleanup(func() { pendingPrizeReload = nil })
+	pendingPrizeReload = &PrizeReload{Diff: "+ Новый приз", Version: 5}
+	client.Incr(ctx, prizesVersionKey)
+
+	if _, err := confirmPrizeReload(); err == nil {
+		t.Fatal("перезагрузка применена поверх изменившегося каталога")
+	}
+	if pendingPrizeReload != nil {
+		t.Error("устаревшая перезагрузка осталась ожидающей подтверждения")
+	}
+}
+
+func TestGetCreditScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int
+		bank    int
+		fine    int
+		want    int
+	}{
+		{"новый игрок", 0, 0, 0, 300},
+		{"капитал", 40000, 10000, 0, 350},
+		{"капитал ограничен 150", 500000, 500000, 0, 450},
+		{"штраф", 0, 0, 5000, 250},
+		{"штраф ограничен 200", 0, 0, 100000, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupEconomyTest(t)
+			playerBalances["player"] = tt.balance
+			playerBanks["player"] = tt.bank
+			playerFines["player"] = tt.fine
+
+			score, details := getCreditScore("player")
+			if score != tt.want {
+				t.Errorf("getCreditScore() = %d, ожидалось %d", score, tt.want)
+			}
+			if len(details) != 5 {
+				t.Errorf("getCreditScore() вернул %d составляющих, ожидалось 5", len(details))
+			}
+		})
+	}
+}
+
+func TestCalcCreditScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats map[string]int
+		want  int
+	}{
+		{"1000 ставок по 1 фишке", map[string]int{"wagered": 1000}, 302},
+		{"ставки на 50000", map[string]int{"wagered": 50000}, 400},
+		{"ставки ограничены 200", map[string]int{"wagered": 10000000}, 500},
+		{"погашенные штрафы и кредиты", map[string]int{"fines_cleared": 2, "loans_repaid": 1}, 400},
+		{"просроченный кредит", map[string]int{"loans_defaulted": 1}, 150},
+	}
+
+	for _, tt := range tests {
+		if got, _ := calcCreditScore(tt.stats, 0, 0); got != tt.want {
+			t.Errorf("%s: calcCreditScore() = %d, ожидалось %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetLoanLimit(t *testing.T) {
+	tests := []struct {
+		score int
+		want  int
+	}{
+		{0, 0},
+		{299, 0},
+		{300, 3000},
+		{750, 7500},
+		{1000, 10000},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		if got := getLoanLimit("player", tt.score); got != tt.want {
+			t.Errorf("getLoanLimit(%d) = %d, ожидалось %d", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestTakeLoanRefusedWithFine(t *testing.T) {
+	setupEconomyTest(t)
+	playerFines["player"] = 500
+
+	_, err := takeLoan("player", 1000)
+	if err == nil || !strings.Contains(err.Error(), "штраф") {
+		t.Errorf("takeLoan() со штрафом = %v, ожидался отказ из-за штрафа", err)
+	}
+	if playerBalances["player"] != 0 {
+		t.Errorf("баланс после отказа = %d, ожидалось 0", playerBalances["player"])
+	}
+}
+
+func TestSettleLoanPayment(t *testing.T) {
+	due := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	loan := Loan{Principal: 1000, Total: 1150, Installment: 230, NextDue: due}
+
+	tests := []struct {
+		name          string
+		paid          int
+		amount        int
+		want          LoanPayment
+		wantNextDue   time.Time
+		wantRemaining int
+	}{
+		{"первый платеж", 0, 230, LoanPayment{Applied: 230, Principal: 200, Interest: 30}, due.AddDate(0, 0, 1), 920},
+		{"неровный платеж", 100, 333, LoanPayment{Applied: 333, Principal: 290, Interest: 43}, due.AddDate(0, 0, 1), 717},
+		{"последний платеж", 920, 230, LoanPayment{Applied: 230, Principal: 200, Interest: 30, Repaid: true}, due, 0},
+		{"переплата", 920, 500, LoanPayment{Applied: 230, Principal: 200, Interest: 30, Overpaid: 270, Repaid: true}, due, 0},
+		{"досрочное погашение", 0, 1150, LoanPayment{Applied: 1150, Principal: 1000, Interest: 150, Repaid: true}, due, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupEconomyTest(t)
+			current := loan
+			current.Paid = tt.paid
+			current.Missed = 1
+
+			next, payment := settleLoanPayment(current, tt.amount)
+			if payment != tt.want {
+				t.Errorf("платеж = %+v, ожидалось %+v", payment, tt.want)
+			}
+			if remaining := next.Total - next.Paid; remaining != tt.wantRemaining {
+				t.Errorf("остаток = %d, ожидалось %d", remaining, tt.wantRemaining)
+			}
+			if next.Missed != 0 {
+				t.Errorf("Missed = %d, ожидалось 0", next.Missed)
+			}
+			if !next.NextDue.Equal(tt.wantNextDue) {
+				t.Errorf("NextDue = %s, ожидалось %s", next.NextDue, tt.wantNextDue)
+			}
+		})
+	}
+
+	// По графику платежей выплачиваются ровно основной долг и все проценты
+	setupEconomyTest(t)
+	current := loan
+	principal, interest := 0, 0
+	for i := 0; i < 5; i++ {
+		var payment LoanPayment
+		current, payment = settleLoanPayment(current, current.Installment)
+		principal += payment.Principal
+		interest += payment.Interest
+	}
+	if principal != 1000 || interest != 150 || current.Paid != current.Total {
+		t.Errorf("по графику выплачено: основной долг %d, проценты %d, всего %d из %d", principal, interest, current.Paid, current.Total)
+	}
+}
+
+func TestDepositPayout(t *testing.T) {
+	tests := []struct {
+		deposit Deposit
+		want    int
+	}{
+		{Deposit{Amount: 10000, Days: 3, Rate: 0.12}, 10036},
+		{Deposit{Amount: 10000, Days: 7, Rate: 0.15}, 10105},
+		{Deposit{Amount: 10000, Days: 30, Rate: 0.2}, 10600},
+		{Deposit{Amount: 1000, Days: 3, Rate: 0.12}, 1003},
+		{Deposit{Amount: 0, Days: 30, Rate: 0.2}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.deposit.Payout(); got != tt.want {
+			t.Errorf("Payout(%d на %d дн. под %.2f%%) = %d, ожидалось %d",
+				tt.deposit.Amount, tt.deposit.Days, tt.deposit.Rate, got, tt.want)
+		}
+	}
+}
+
+func TestBankInterest(t *testing.T) {
+	tests := []struct {
+		balance int
+		want    int
+	}{
+		{0, 0},
+		{1000, 0},
+		{9999, 4},
+		{10000, 8},
+		{99999, 79},
+		{100000, 100},
+		{1000000, 1000},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		if got := bankInterest(tt.balance); got != tt.want {
+			t.Errorf("bankInterest(%d) = %d, ожидалось %d", tt.balance, got, tt.want)
+		}
+	}
+}
+
+func TestTransferTax(t *testing.T) {
+	tests := []struct {
+		value int
+		want  int
+	}{
+		{0, 0},
+		{19, 0},
+		{20, 1},
+		{1000, 50},
+		{12345, 617},
+	}
+
+	for _, tt := range tests {
+		setupEconomyTest(t)
+		if got := transferTax(tt.value); got != tt.want {
+			t.Errorf("transferTax(%d) = %d, ожидалось %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTransferAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		fine    int
+		value   int
+		wantErr string
+	}{
+		{"в пределах лимита", 0, 1000, ""},
+		{"ровно лимит нового аккаунта", 0, 5000, ""},
+		{"выше лимита", 0, 5001, "суточный лимит"},
+		{"долг по штрафу", 100, 10, "долг"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupEconomyTest(t)
+			playerFines["player"] = tt.fine
+
+			err := checkTransferAllowed("player", tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkTransferAllowed() = %v, ожидалось без ошибки", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkTransferAllowed() = %v, ожидалась ошибка с %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+module tg-random-bot/render
+
+go 1.24.5
+
+require golang.org/x/image v0.30.0
+
+require golang.org/x/text v0.28.0 // indirect
@@ -0,0 +1,311 @@
+// Package render рисует карточки плашек и профилей игроков в PNG (чистый Go, встроенные шрифты Go)
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// PlateCard описывает карточку плашки
+type PlateCard struct {
+	Title       string   // Подпись редкости ("ЛЕГЕНДАРНАЯ ПЛАШКА")
+	Name        string   // Название плашки
+	Serial      string   // Номер экземпляра ("#3/10"), может быть пустым
+	Description string   // Описание плашки
+	Details     []string // Строки внизу карточки (стоимость, владелец, дата)
+	Color       string   // Цвет редкости в формате #RRGGBB
+}
+
+// ProfileCard описывает карточку профиля игрока
+type ProfileCard struct {
+	Name       string   // Имя участника
+	Username   string   // username без @
+	PlateName  string   // Надетая плашка (пусто - не надета)
+	PlateColor string   // Цвет редкости надетой плашки в формате #RRGGBB
+	Rank       string   // Место в рейтинге ("#2 из 15")
+	Stats      []string // Строки со статистикой (баланс, банк)
+}
+
+const (
+	plateWidth    = 800
+	plateHeight   = 420
+	profileWidth  = 800
+	profileHeight = 360
+	padding       = 40
+)
+
+var (
+	background = color.RGBA{0x1e, 0x1e, 0x24, 0xff}
+	textColor  = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	mutedColor = color.RGBA{0xa0, 0xa0, 0xaa, 0xff}
+	fallback   = color.RGBA{0x9e, 0x9e, 0x9e, 0xff}
+)
+
+// ParseHexColor разбирает цвет вида #RRGGBB (при ошибке возвращает серый)
+func ParseHexColor(s string) color.RGBA {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return fallback
+	}
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return fallback
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 0xff}
+}
+
+// RenderPlateCard рисует карточку плашки (результат кэшируется по хэшу содержимого)
+func RenderPlateCard(card PlateCard) ([]byte, error) {
+	return cached("plate", card, func() ([]byte, error) {
+		accent := ParseHexColor(card.Color)
+
+		title := card.Name
+		if card.Serial != "" {
+			title += " " + card.Serial
+		}
+		titleLines := wrapText(face(true, 42), title, plateWidth-2*padding)
+		descriptionLines := wrapText(face(false, 24), card.Description, plateWidth-2*padding)
+
+		// Высота карточки растет вместе с длинным описанием
+		height := 150 + 52*len(titleLines) + 32*len(descriptionLines) + 34*len(card.Details) + padding
+		if height < plateHeight {
+			height = plateHeight
+		}
+		img := newCanvas(plateWidth, height, accent)
+
+		// Полоса редкости сверху
+		fill(img, image.Rect(8, 8, plateWidth-8, 80), accent)
+		drawText(img, face(true, 30), padding, 56, card.Title, background)
+
+		y := 150
+		for _, line := range titleLines {
+			drawText(img, face(true, 42), padding, y, line, textColor)
+			y += 52
+		}
+		for _, line := range descriptionLines {
+			drawText(img, face(false, 24), padding, y, line, mutedColor)
+			y += 32
+		}
+
+		y = height - padding - 34*(len(card.Details)-1)
+		for _, line := range card.Details {
+			drawText(img, face(false, 24), padding, y, line, textColor)
+			y += 34
+		}
+
+		return encode(img)
+	})
+}
+
+// RenderProfileCard рисует карточку профиля игрока (результат кэшируется по хэшу содержимого)
+func RenderProfileCard(card ProfileCard) ([]byte, error) {
+	return cached("profile", card, func() ([]byte, error) {
+		accent := ParseHexColor(card.PlateColor)
+		if card.PlateName == "" {
+			accent = fallback
+		}
+		img := newCanvas(profileWidth, profileHeight, accent)
+
+		drawText(img, face(true, 40), padding, 80, card.Name, textColor)
+		drawText(img, face(false, 24), padding, 116, "@"+card.Username, mutedColor)
+		if card.Rank != "" {
+			rankFace := face(true, 32)
+			width := font.MeasureString(rankFace, sanitize(rankFace, card.Rank)).Ceil()
+			drawText(img, rankFace, profileWidth-padding-width, 80, card.Rank, accent)
+		}
+
+		// Плашка - цветной бейдж под именем
+		plate := card.PlateName
+		if plate == "" {
+			plate = "без плашки"
+		}
+		plateFace := face(true, 26)
+		plate = sanitize(plateFace, plate)
+		badgeWidth := font.MeasureString(plateFace, plate).Ceil() + 32
+		if badgeWidth > profileWidth-2*padding {
+			badgeWidth = profileWidth - 2*padding
+		}
+		fill(img, image.Rect(padding, 140, padding+badgeWidth, 190), accent)
+		drawText(img, plateFace, padding+16, 175, plate, background)
+
+		y := 240
+		for _, line := range card.Stats {
+			drawText(img, face(false, 26), padding, y, line, textColor)
+			y += 38
+		}
+
+		return encode(img)
+	})
+}
+
+// Кэш отрисованных карточек по хэшу содержимого
+type renderCache struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	order []string
+	max   int
+}
+
+var cache = &renderCache{items: make(map[string][]byte), max: 256}
+
+// Функция для получения карточки из кэша или ее отрисовки
+func cached(kind string, card interface{}, draw func() ([]byte, error)) ([]byte, error) {
+	data, err := json.Marshal(card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash card: %v", err)
+	}
+	sum := sha256.Sum256(append([]byte(kind+":"), data...))
+	key := hex.EncodeToString(sum[:])
+
+	cache.mu.Lock()
+	if png, ok := cache.items[key]; ok {
+		cache.mu.Unlock()
+		return png, nil
+	}
+	cache.mu.Unlock()
+
+	png, err := draw()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, ok := cache.items[key]; !ok {
+		if len(cache.order) >= cache.max {
+			delete(cache.items, cache.order[0])
+			cache.order = cache.order[1:]
+		}
+		cache.items[key] = png
+		cache.order = append(cache.order, key)
+	}
+	return png, nil
+}
+
+// Шрифты загружаются один раз, начертания кэшируются по размеру
+var (
+	fontsOnce   sync.Once
+	regularFont *opentype.Font
+	boldFont    *opentype.Font
+	facesMu     sync.Mutex
+	faces       = make(map[string]font.Face)
+)
+
+// Функция для получения начертания шрифта нужного размера
+func face(bold bool, size float64) font.Face {
+	fontsOnce.Do(func() {
+		regularFont, _ = opentype.Parse(goregular.TTF)
+		boldFont, _ = opentype.Parse(gobold.TTF)
+	})
+
+	key := fmt.Sprintf("%t:%.0f", bold, size)
+	facesMu.Lock()
+	defer facesMu.Unlock()
+	if f, ok := faces[key]; ok {
+		return f
+	}
+
+	src := regularFont
+	if bold {
+		src = boldFont
+	}
+	f, err := opentype.NewFace(src, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil
+	}
+	faces[key] = f
+	return f
+}
+
+// Функция для создания холста с фоном и рамкой цвета редкости
+func newCanvas(width, height int, accent color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, img.Bounds(), accent)
+	fill(img, image.Rect(8, 8, width-8, height-8), background)
+	return img
+}
+
+// Функция для заливки прямоугольника цветом
+func fill(img *image.RGBA, rect image.Rectangle, c color.Color) {
+	draw.Draw(img, rect, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+// Функция для удаления символов, которых нет в шрифте (эмодзи и т.п.)
+func sanitize(f font.Face, text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r == ' ' {
+			b.WriteRune(r)
+			continue
+		}
+		if _, ok := f.GlyphAdvance(r); ok {
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Функция для вывода строки текста (y - базовая линия)
+func drawText(img *image.RGBA, f font.Face, x, y int, text string, c color.Color) {
+	if f == nil {
+		return
+	}
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: f,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(sanitize(f, text))
+}
+
+// Функция для переноса текста по словам в пределах заданной ширины
+func wrapText(f font.Face, text string, maxWidth int) []string {
+	if f == nil {
+		return nil
+	}
+	words := strings.Fields(sanitize(f, text))
+	var lines []string
+	current := ""
+	for _, word := range words {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current != "" && font.MeasureString(f, candidate).Ceil() > maxWidth {
+			lines = append(lines, current)
+			current = word
+		} else {
+			current = candidate
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// Функция для кодирования изображения в PNG
+func encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %v", err)
+	}
+	return buf.Bytes(), nil
+}
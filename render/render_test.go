@@ -0,0 +1,64 @@
+package render
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestRenderPlateCard(t *testing.T) {
+	card := PlateCard{
+		Title:       "ЛЕГЕНДАРНАЯ ПЛАШКА",
+		Name:        "🔥МАМА В БУДКЕ🔥",
+		Serial:      "#3/10",
+		Description: "Очень длинное описание плашки, которое должно переноситься на несколько строк внутри карточки",
+		Details:     []string{"Стоимость: 100000 фишек", "Владелец: @player"},
+		Color:       "#FF9800",
+	}
+
+	data, err := RenderPlateCard(card)
+	if err != nil {
+		t.Fatalf("RenderPlateCard вернул ошибку: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Результат не является PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != plateWidth || b.Dy() < plateHeight {
+		t.Errorf("Размер карточки %dx%d, ожидалось не меньше %dx%d", b.Dx(), b.Dy(), plateWidth, plateHeight)
+	}
+
+	// Повторная отрисовка того же содержимого берется из кэша
+	before := len(cache.items)
+	again, err := RenderPlateCard(card)
+	if err != nil || !bytes.Equal(data, again) || len(cache.items) != before {
+		t.Errorf("Повторная отрисовка не взята из кэша")
+	}
+}
+
+func TestRenderProfileCard(t *testing.T) {
+	data, err := RenderProfileCard(ProfileCard{
+		Name:       "Иван Иванов",
+		Username:   "ivan",
+		PlateName:  "ЧМО",
+		PlateColor: "#9E9E9E",
+		Rank:       "#1 из 5",
+		Stats:      []string{"Баланс: 1000", "Банк: 500"},
+	})
+	if err != nil {
+		t.Fatalf("RenderProfileCard вернул ошибку: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Результат не является PNG: %v", err)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	if c := ParseHexColor("#2196F3"); c.R != 0x21 || c.G != 0x96 || c.B != 0xf3 {
+		t.Errorf("ParseHexColor(#2196F3) = %v", c)
+	}
+	if c := ParseHexColor("bad"); c != fallback {
+		t.Errorf("Некорректный цвет должен давать серый, получено %v", c)
+	}
+}
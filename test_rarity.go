@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -71,23 +73,17 @@ func loadAllPrizesFromRedis() ([]Prize, error) {
 	}
 
 	ctx := context.Background()
-	keys, err := redisClient.Keys(ctx, "prize:*").Result()
+	values, err := redisClient.HGetAll(ctx, "prizes").Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get prize keys: %v", err)
+		return nil, fmt.Errorf("failed to get prizes: %v", err)
 	}
 
 	var prizes []Prize
-	for _, key := range keys {
-		val, err := redisClient.Get(ctx, key).Result()
-		if err != nil {
-			log.Printf("Warning: failed to get prize %s: %v", key, err)
-			continue
-		}
-
+	for name, val := range values {
 		var prize Prize
 		err = json.Unmarshal([]byte(val), &prize)
 		if err != nil {
-			log.Printf("Warning: failed to unmarshal prize %s: %v", key, err)
+			log.Printf("Warning: failed to unmarshal prize %s: %v", name, err)
 			continue
 		}
 